@@ -0,0 +1,332 @@
+// Package api defines the JSON invoice schema shared by the web server and
+// the command-line tool, and its mapping onto facturx.InvoiceRequest.
+//
+// Example document:
+//
+//	{
+//	  "number": "FA-2024-001",
+//	  "date": "2024-01-15",
+//	  "seller": {"name": "ACME Corp", "siret": "52825000400033", "vatNumber": "FR12345678901",
+//	             "street": "123 Rue de Paris", "postalCode": "75001", "city": "Paris"},
+//	  "buyer": {"name": "Client SA", "street": "456 Avenue des Champs", "postalCode": "69001", "city": "Lyon"},
+//	  "lines": [{"description": "Prestation de conseil", "quantity": 10, "unitPrice": 100, "vatRegime": 0}],
+//	  "paymentTerms": {"iban": "FR76 1234 5678 9012", "note": "Paiement à 30 jours"},
+//	  "note": "Merci de votre confiance"
+//	}
+//
+// VAT regime codes: 0 standard 20%, 1 reduced 10%, 2 super-reduced 5.5%,
+// 3 minimal 2.1%, 4 franchise en base (art. 293 B), 5 health exemption.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// GenerateRequest is the JSON representation of an invoice.
+type GenerateRequest struct {
+	Number       string                `json:"number"`
+	Date         string                `json:"date"`
+	DeliveryDate string                `json:"deliveryDate,omitempty"` // YYYY-MM-DD
+	Seller       ContactJSON           `json:"seller"`
+	Buyer        ContactJSON           `json:"buyer"`
+	Lines        []LineJSON            `json:"lines"`
+	PaymentTerms PaymentJSON           `json:"paymentTerms"`
+	Shipping     float64               `json:"shipping,omitempty"` // excluding tax, at the invoice VAT rate
+	Note         string                `json:"note"`
+	Template     string                `json:"template,omitempty"`    // resolved by the web server
+	Locale       string                `json:"locale,omitempty"`      // PDF number format, "fr" or "en"
+	XMLFormat    string                `json:"xmlFormat,omitempty"`   // embedded XML layout, "pretty" or "compact"
+	Metadata     *facturx.Metadata     `json:"metadata,omitempty"`    // PDF title, author, subject and producer
+	Header       *facturx.Header       `json:"header,omitempty"`      // tagline and contact line of the PDF
+	Footer       *facturx.Footer       `json:"footer,omitempty"`      // replaces the default PDF footer
+	Layout       *facturx.LayoutConfig `json:"layout,omitempty"`      // margins and line table columns
+	Supplements  []facturx.Supplement  `json:"supplements,omitempty"` // PDF documents embedded with the invoice
+}
+
+// ContactJSON is the JSON representation of a seller or buyer: the
+// canonical facturx.Contact encoding plus an email address.
+type ContactJSON struct {
+	facturx.Contact
+	Email string `json:"email,omitempty"`
+}
+
+// LineJSON is the JSON representation of an invoice line: the canonical
+// facturx.InvoiceLine encoding plus a VAT regime code. A nil VATRegime
+// means the regime was omitted (standard 20% unless a template sets one).
+type LineJSON struct {
+	facturx.InvoiceLine
+	VATRegime *int `json:"vatRegime,omitempty"`
+}
+
+// MarshalJSON adds the vatRegime field to the encoded invoice line.
+func (l LineJSON) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(l.InvoiceLine)
+	if err != nil || l.VATRegime == nil {
+		return data, err
+	}
+	return fmt.Appendf(data[:len(data)-1], `,"vatRegime":%d}`, *l.VATRegime), nil
+}
+
+// UnmarshalJSON splits the vatRegime field from the invoice line, which
+// facturx.InvoiceLine would otherwise reject as unknown.
+func (l *LineJSON) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if raw, ok := fields["vatRegime"]; ok {
+		if err := json.Unmarshal(raw, &l.VATRegime); err != nil {
+			return fmt.Errorf("vatRegime: %w", err)
+		}
+		delete(fields, "vatRegime")
+		data, _ = json.Marshal(fields)
+	}
+	return json.Unmarshal(data, &l.InvoiceLine)
+}
+
+// Regime returns the line's VAT regime code, 0 when omitted.
+func (l LineJSON) Regime() int {
+	if l.VATRegime == nil {
+		return 0
+	}
+	return *l.VATRegime
+}
+
+// PaymentJSON is the JSON representation of the payment terms.
+type PaymentJSON struct {
+	DueDate      string                    `json:"dueDate"`
+	IBAN         string                    `json:"iban"`
+	BIC          string                    `json:"bic"`
+	Note         string                    `json:"note"`
+	MeansCode    facturx.PaymentMeansCode  `json:"meansCode,omitempty"`
+	LatePayment  *facturx.LatePaymentTerms `json:"latePayment,omitempty"`
+	CashDiscount *facturx.CashDiscount     `json:"cashDiscount,omitempty"`
+	Installments []facturx.Installment     `json:"installments,omitempty"`
+	DirectDebit  *facturx.DirectDebit      `json:"directDebit,omitempty"`
+}
+
+// ToInvoiceRequest converts the JSON representation to the library format.
+func (req GenerateRequest) ToInvoiceRequest() (facturx.InvoiceRequest, error) {
+	// Convert date from YYYY-MM-DD to YYYYMMDD
+	date := strings.ReplaceAll(req.Date, "-", "")
+	if len(date) != 8 {
+		return facturx.InvoiceRequest{}, fmt.Errorf("format de date invalide")
+	}
+
+	// Determine VAT regime from lines
+	var regime facturx.VatRegime
+	if len(req.Lines) > 0 {
+		firstRegime := req.Lines[0].Regime()
+		switch firstRegime {
+		case 4: // franchise_auto
+			regime = facturx.VatFranchiseAuto()
+		case 5: // exempt_health
+			regime = facturx.VatExemptHealth()
+		default:
+			// Standard VAT - get rate from regime code
+			rate := vatRate(firstRegime)
+			regime = facturx.VatStandard(rate)
+		}
+	} else {
+		regime = facturx.VatStandard(20.0)
+	}
+
+	// Build custom mentions from payment info
+	var mentions []string
+	if req.PaymentTerms.Note != "" {
+		mentions = append(mentions, req.PaymentTerms.Note)
+	}
+	if req.PaymentTerms.IBAN != "" {
+		mentions = append(mentions, fmt.Sprintf("IBAN: %s", req.PaymentTerms.IBAN))
+	}
+	if req.Note != "" {
+		mentions = append(mentions, req.Note)
+	}
+
+	invoiceReq := facturx.InvoiceRequest{
+		Number:         req.Number,
+		Date:           date,
+		Seller:         contact(req.Seller),
+		Buyer:          contact(req.Buyer),
+		Regime:         regime,
+		AddEISuffix:    false,
+		CustomMentions: strings.Join(mentions, "\n"),
+		LatePayment:    req.PaymentTerms.LatePayment,
+		CashDiscount:   req.PaymentTerms.CashDiscount,
+		Installments:   req.PaymentTerms.Installments,
+		PaymentMeans:   req.PaymentTerms.MeansCode,
+		DirectDebit:    req.PaymentTerms.DirectDebit,
+		Locale:         facturx.Locale(req.Locale),
+		XMLFormat:      facturx.XMLFormat(req.XMLFormat),
+		Metadata:       req.Metadata,
+		Header:         req.Header,
+		Footer:         req.Footer,
+		Layout:         req.Layout,
+		Supplements:    req.Supplements,
+	}
+
+	if req.DeliveryDate != "" {
+		delivery, err := time.Parse("2006-01-02", req.DeliveryDate)
+		if err != nil {
+			return facturx.InvoiceRequest{}, fmt.Errorf("format de date invalide")
+		}
+		invoiceReq.DeliveryDate = delivery
+	}
+
+	// Convert lines
+	for _, line := range req.Lines {
+		invoiceReq.Lines = append(invoiceReq.Lines, line.InvoiceLine)
+	}
+	if req.Shipping != 0 {
+		invoiceReq.AddShipping(req.Shipping, regime.Rate())
+	}
+
+	return invoiceReq, nil
+}
+
+// contact converts a JSON contact, defaulting to a French address.
+func contact(c ContactJSON) facturx.Contact {
+	out := c.Contact
+	if out.CountryCode == "" {
+		out.CountryCode = "FR"
+	}
+	out.Siret = strings.ReplaceAll(out.Siret, " ", "")
+	out.Siren = strings.ReplaceAll(out.Siren, " ", "")
+	return out
+}
+
+// FromInvoiceRequest converts a library invoice to its JSON representation,
+// e.g. one read back with facturx.ParseXML. Regimes without a code (such
+// as reverse charge) are reported with vatRegime -1.
+func FromInvoiceRequest(req facturx.InvoiceRequest) GenerateRequest {
+	out := GenerateRequest{
+		Number: req.Number,
+		Date:   isoDate(req.Date),
+		Seller: ContactJSON{Contact: req.Seller},
+		Buyer:  ContactJSON{Contact: req.Buyer},
+		Note:   req.CustomMentions,
+	}
+	if !req.DueDate.IsZero() {
+		out.PaymentTerms.DueDate = req.DueDate.Format("2006-01-02")
+	}
+	out.PaymentTerms.Installments = req.Installments
+	out.PaymentTerms.MeansCode = req.PaymentMeans
+	out.PaymentTerms.DirectDebit = req.DirectDebit
+	if !req.DeliveryDate.IsZero() {
+		out.DeliveryDate = req.DeliveryDate.Format("2006-01-02")
+	}
+
+	regime := -1
+	if vat := facturx.ComputeTotals(&req).VAT; len(vat) > 0 {
+		regime = regimeCode(vat[0])
+	}
+	for _, line := range req.Lines {
+		out.Lines = append(out.Lines, LineJSON{InvoiceLine: line, VATRegime: &regime})
+	}
+	return out
+}
+
+// isoDate converts a YYYYMMDD date to YYYY-MM-DD.
+func isoDate(date string) string {
+	if len(date) != 8 {
+		return date
+	}
+	return date[0:4] + "-" + date[4:6] + "-" + date[6:8]
+}
+
+// regimeCode returns the regime code matching a VAT breakdown, or -1.
+func regimeCode(vat facturx.VatBreakdown) int {
+	switch {
+	case vat.CategoryCode == "E" && vat.ExemptionCode == "VATEX-FR-FRANCHISE":
+		return 4
+	case vat.CategoryCode == "E" && vat.ExemptionCode == "VATEX-EU-O":
+		return 5
+	case vat.CategoryCode == "S":
+		for code := 0; code <= 3; code++ {
+			if vatRate(code) == vat.Rate {
+				return code
+			}
+		}
+	}
+	return -1
+}
+
+// vatRate returns the VAT rate for a regime code.
+func vatRate(regime int) float64 {
+	switch regime {
+	case 0: // standard
+		return 20.0
+	case 1: // reduced
+		return 10.0
+	case 2: // super_reduced
+		return 5.5
+	case 3: // minimal
+		return 2.1
+	case 4, 5, 6, 7: // exempt
+		return 0.0
+	default:
+		return 20.0
+	}
+}
+
+// ValidationReport is the JSON representation of a validation result.
+type ValidationReport struct {
+	Valid    bool        `json:"valid"`
+	Profile  string      `json:"profile,omitempty"` // declared by a validated XML or PDF
+	Errors   []IssueJSON `json:"errors"`
+	Warnings []IssueJSON `json:"warnings"`
+}
+
+// IssueJSON is a validation error or warning on a field.
+type IssueJSON struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Rule is the EN 16931 business rule an error breaks, if known.
+	Rule string `json:"rule,omitempty"`
+}
+
+// NewValidationReport converts a validation result to its JSON representation.
+func NewValidationReport(result facturx.ValidationResult) ValidationReport {
+	report := ValidationReport{
+		Valid:    result.Valid(),
+		Profile:  string(result.Profile),
+		Errors:   []IssueJSON{},
+		Warnings: []IssueJSON{},
+	}
+	for _, e := range result.Errors {
+		report.Errors = append(report.Errors, IssueJSON{Field: e.Field, Message: e.Message, Rule: e.Rule})
+	}
+	for _, w := range result.Warnings {
+		report.Warnings = append(report.Warnings, IssueJSON{Field: w.Field, Message: w.Message})
+	}
+	return report
+}
+
+// TotalsJSON is the JSON representation of the invoice totals.
+type TotalsJSON struct {
+	LineTotal  float64 `json:"lineTotal"`
+	Charges    float64 `json:"charges"`
+	TaxBasis   float64 `json:"taxBasis"`
+	TaxTotal   float64 `json:"taxTotal"`
+	GrandTotal float64 `json:"grandTotal"`
+	Prepaid    float64 `json:"prepaid"`
+	DuePayable float64 `json:"duePayable"`
+}
+
+// NewTotalsJSON converts computed totals to their JSON representation.
+func NewTotalsJSON(t facturx.Totals) TotalsJSON {
+	return TotalsJSON{
+		LineTotal:  t.LineTotal,
+		Charges:    t.Charges,
+		TaxBasis:   t.TaxBasis,
+		TaxTotal:   t.TaxTotal,
+		GrandTotal: t.GrandTotal,
+		Prepaid:    t.Prepaid,
+		DuePayable: t.DuePayable,
+	}
+}
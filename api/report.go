@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+)
+
+// WriteJSON writes the report as indented JSON, for scripts and CI
+// pipelines.
+func (r ValidationReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteHTML writes the report as a standalone HTML page listing each
+// error and warning with its severity, rule, field and message, after the
+// declared profile if known. Headings are in
+// French, or in English if lang is "en".
+func (r ValidationReport) WriteHTML(w io.Writer, lang string) error {
+	labels := reportLabels["fr"]
+	if lang == "en" {
+		labels = reportLabels["en"]
+	}
+	type issue struct {
+		IssueJSON
+		Severity string
+		Class    string
+	}
+	var issues []issue
+	for _, e := range r.Errors {
+		issues = append(issues, issue{e, labels["error"], "error"})
+	}
+	for _, warning := range r.Warnings {
+		issues = append(issues, issue{warning, labels["warning"], "warning"})
+	}
+	status := labels["invalid"]
+	if r.Valid {
+		status = labels["valid"]
+	}
+	return reportTemplate.Execute(w, map[string]any{
+		"Lang":    lang,
+		"Labels":  labels,
+		"Valid":   r.Valid,
+		"Status":  status,
+		"Profile": r.Profile,
+		"Issues":  issues,
+	})
+}
+
+// reportLabels holds the headings of the HTML report by language.
+var reportLabels = map[string]map[string]string{
+	"fr": {
+		"title": "Rapport de validation", "valid": "Facture valide", "invalid": "Facture invalide",
+		"severity": "Gravité", "rule": "Règle", "field": "Champ", "message": "Message",
+		"error": "Erreur", "warning": "Avertissement", "none": "Aucune anomalie.", "profile": "Profil",
+	},
+	"en": {
+		"title": "Validation report", "valid": "Valid invoice", "invalid": "Invalid invoice",
+		"severity": "Severity", "rule": "Rule", "field": "Field", "message": "Message",
+		"error": "Error", "warning": "Warning", "none": "No issues.", "profile": "Profile",
+	},
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="{{if eq .Lang "en"}}en{{else}}fr{{end}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Labels.title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+.status { display: inline-block; padding: .3em .8em; border-radius: 4px; color: #fff; }
+.status.valid { background: #2e7d32; }
+.status.invalid { background: #c62828; }
+table { border-collapse: collapse; margin-top: 1em; width: 100%; }
+th, td { border: 1px solid #ddd; padding: .4em .6em; text-align: left; vertical-align: top; }
+th { background: #f5f5f5; }
+td.error { color: #c62828; font-weight: bold; }
+td.warning { color: #ef6c00; font-weight: bold; }
+code { font-size: .95em; }
+</style>
+</head>
+<body>
+<h1>{{.Labels.title}}</h1>
+<p class="status {{if .Valid}}valid{{else}}invalid{{end}}">{{.Status}}</p>
+{{- if .Profile}}
+<p>{{.Labels.profile}} : {{.Profile}}</p>
+{{- end}}
+{{- if .Issues}}
+<table>
+<tr><th>{{.Labels.severity}}</th><th>{{.Labels.rule}}</th><th>{{.Labels.field}}</th><th>{{.Labels.message}}</th></tr>
+{{- range .Issues}}
+<tr><td class="{{.Class}}">{{.Severity}}</td><td>{{.Rule}}</td><td><code>{{.Field}}</code></td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>{{.Labels.none}}</p>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// invoiceXML returns the CII XML of a valid invoice of 1200.00 EUR, due
+// before its issue date.
+func invoiceXML(t *testing.T) string {
+	t.Helper()
+	res, err := facturx.GenerateResult(facturx.InvoiceRequest{
+		Number:  "FA-2024-001",
+		Date:    "20240115",
+		DueDate: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC),
+		Seller:  facturx.Contact{Name: "ACME Corp", Address: "123 Rue de Paris", ZipCode: "75001", City: "Paris", CountryCode: "FR", Siret: "52825000400033"},
+		Buyer:   facturx.Contact{Name: "Client SA", Address: "456 Avenue des Champs", ZipCode: "69001", City: "Lyon", CountryCode: "FR"},
+		Lines:   []facturx.InvoiceLine{{Description: "Conseil", Quantity: 2, UnitPrice: 500}},
+		Regime:  facturx.VatStandard(20),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.XML
+}
+
+func TestValidationReport(t *testing.T) {
+	valid := invoiceXML(t)
+	invalid := strings.Replace(valid, "<ram:GrandTotalAmount>1200.00<", "<ram:GrandTotalAmount>1300.00<", 1)
+	if invalid == valid {
+		t.Fatal("GrandTotalAmount not found in the XML")
+	}
+	dueWarning := IssueJSON{Field: "DueDate", Message: "due date is before the issue date"}
+
+	tests := []struct {
+		name string
+		xml  string
+		want ValidationReport
+	}{
+		{"valid", valid, ValidationReport{
+			Valid:    true,
+			Profile:  string(facturx.ProfileBasic),
+			Errors:   []IssueJSON{},
+			Warnings: []IssueJSON{dueWarning},
+		}},
+		{"wrong grand total", invalid, ValidationReport{
+			Valid:   false,
+			Profile: string(facturx.ProfileBasic),
+			Errors: []IssueJSON{
+				{Field: "GrandTotalAmount", Message: "declared 1300.00, computed 1200.00", Rule: "BR-CO-15"},
+			},
+			Warnings: []IssueJSON{dueWarning},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := facturx.ValidateXML([]byte(tt.xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			report := NewValidationReport(result)
+			if !reflect.DeepEqual(report, tt.want) {
+				t.Fatalf("report = %+v, want %+v", report, tt.want)
+			}
+
+			var buf bytes.Buffer
+			if err := report.WriteJSON(&buf); err != nil {
+				t.Fatal(err)
+			}
+			var decoded ValidationReport
+			if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+				t.Fatalf("invalid JSON report: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.want) {
+				t.Errorf("JSON report = %+v, want %+v", decoded, tt.want)
+			}
+
+			buf.Reset()
+			if err := report.WriteHTML(&buf, "en"); err != nil {
+				t.Fatal(err)
+			}
+			html := buf.String()
+			for _, e := range tt.want.Errors {
+				row := `<tr><td class="error">Error</td><td>` + e.Rule + `</td><td><code>` + e.Field + `</code></td>`
+				if !strings.Contains(html, row) {
+					t.Errorf("HTML report lacks %s", row)
+				}
+			}
+			if row := `<tr><td class="warning">Warning</td><td></td><td><code>DueDate</code></td>`; !strings.Contains(html, row) {
+				t.Errorf("HTML report lacks %s", row)
+			}
+			status := "Invalid invoice"
+			if tt.want.Valid {
+				status = "Valid invoice"
+			}
+			if !strings.Contains(html, status) {
+				t.Errorf("HTML report lacks %q", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// Package archive stores generated invoices, so that every PDF and its
+// Factur-X XML can be kept for the legal retention period (ten years for
+// accounting documents in France).
+//
+// Invoices are filed by period (the month of the invoice date) and number.
+// Stores never overwrite an archived invoice: Put returns ErrExists.
+//
+// Two implementations are provided, a directory tree (Dir) and an
+// S3-compatible bucket (S3). Open selects one from a location string:
+//
+//	store, err := archive.Open("/var/lib/facturx")     // or "s3://bucket/prefix"
+//	inv, err := archive.NewInvoice(req, pdf)
+//	err = store.Put(ctx, inv)
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+var (
+	// ErrNotFound is returned by Get for an invoice that is not archived.
+	ErrNotFound = errors.New("archive: invoice not found")
+	// ErrExists is returned by Put for an invoice already archived.
+	ErrExists = errors.New("archive: invoice already archived")
+)
+
+// Invoice is an archived invoice.
+type Invoice struct {
+	Number string
+	// Date is the invoice date; only its month is used to file the invoice.
+	Date time.Time
+	PDF  []byte
+	XML  []byte
+}
+
+// Info describes an archived invoice returned by List.
+type Info struct {
+	Number string
+	// Period is the first day of the invoice month, in UTC.
+	Period time.Time
+}
+
+// Store archives invoices.
+type Store interface {
+	// Put archives an invoice, failing with ErrExists if its number is
+	// already archived for the period. The archived invoice is kept as is:
+	// invoices of different issuers numbered alike collide, so a store
+	// shared by several issuers must give each its own Sub store.
+	Put(ctx context.Context, inv Invoice) error
+	// Get returns the invoice with the given number filed in the month of
+	// period, or ErrNotFound.
+	Get(ctx context.Context, number string, period time.Time) (Invoice, error)
+	// List returns the invoices filed in the months from..to inclusive,
+	// sorted by period then number.
+	List(ctx context.Context, from, to time.Time) ([]Info, error)
+}
+
+// NewInvoice prepares a generated PDF for archiving, with the XML embedded
+// in it and the date of req.
+func NewInvoice(req facturx.InvoiceRequest, pdf []byte) (Invoice, error) {
+	date := req.IssueDate
+	if date.IsZero() {
+		var err error
+		if date, err = time.Parse("20060102", req.Date); err != nil {
+			return Invoice{}, fmt.Errorf("archive: invalid invoice date %q", req.Date)
+		}
+	}
+	xml, err := facturx.ExtractXML(pdf)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("archive: %w", err)
+	}
+	return Invoice{Number: req.Number, Date: date, PDF: pdf, XML: xml}, nil
+}
+
+// Open returns the store for a location: "s3://bucket[/prefix]" for an
+// S3-compatible bucket configured from the environment (see NewS3FromEnv),
+// or a directory path, created if needed.
+func Open(location string) (Store, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("archive: invalid location %q", location)
+		}
+		return NewS3FromEnv(bucket, prefix)
+	}
+	if strings.Contains(location, "://") {
+		return nil, fmt.Errorf("archive: unsupported location %q", location)
+	}
+	if err := os.MkdirAll(location, 0o755); err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	return Dir(location), nil
+}
+
+// Sub returns the store filing invoices under name in s: a subdirectory
+// of a Dir, or an object prefix of an S3 store. It keeps apart the
+// invoices of several issuers sharing a store, whose numbers may collide.
+// Other stores are returned unchanged.
+func Sub(s Store, name string) Store {
+	switch s := s.(type) {
+	case Dir:
+		return Dir(filepath.Join(string(s), escapeName(name)))
+	case *S3:
+		sub := *s
+		if sub.Prefix != "" && !strings.HasSuffix(sub.Prefix, "/") {
+			sub.Prefix += "/"
+		}
+		sub.Prefix += escapeName(name) + "/"
+		return &sub
+	}
+	return s
+}
+
+// Objects are named <YYYY>/<MM>/<number>.pdf and .xml, the number being
+// path-escaped so that it never contains a path separator (slash or, on
+// Windows, backslash) nor starts with a dot.
+
+func periodPrefix(t time.Time) string {
+	return t.Format("2006/01") + "/"
+}
+
+func objectName(number string, period time.Time, ext string) string {
+	return periodPrefix(period) + escapeName(number) + ext
+}
+
+// escapeName path-escapes a number or Sub name into a single path element.
+func escapeName(name string) string {
+	escaped := strings.ReplaceAll(url.PathEscape(name), `\`, "%5C")
+	if rest, ok := strings.CutPrefix(escaped, "."); ok {
+		escaped = "%2E" + rest
+	}
+	return escaped
+}
+
+// parseObjectName returns the invoice of a PDF object name, relative to
+// the store root.
+func parseObjectName(name string) (Info, bool) {
+	dir, file, ok := strings.Cut(name, "/")
+	if !ok {
+		return Info{}, false
+	}
+	month, file, ok := strings.Cut(file, "/")
+	if !ok {
+		return Info{}, false
+	}
+	period, err := time.Parse("2006/01", dir+"/"+month)
+	if err != nil {
+		return Info{}, false
+	}
+	escaped, ok := strings.CutSuffix(file, ".pdf")
+	if !ok {
+		return Info{}, false
+	}
+	number, err := url.PathUnescape(escaped)
+	if err != nil {
+		return Info{}, false
+	}
+	return Info{Number: number, Period: period}, true
+}
+
+// months returns the first day of each month from..to inclusive.
+func months(from, to time.Time) []time.Time {
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var list []time.Time
+	for m := start; !m.After(end); m = m.AddDate(0, 1, 0) {
+		list = append(list, m)
+	}
+	return list
+}
@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Dir is a Store keeping invoices in a directory tree:
+// <dir>/<YYYY>/<MM>/<number>.pdf and <number>.xml. Archived files are
+// written read-only.
+type Dir string
+
+func (d Dir) Put(ctx context.Context, inv Invoice) error {
+	pdfPath := filepath.Join(string(d), filepath.FromSlash(objectName(inv.Number, inv.Date, ".pdf")))
+	xmlPath := filepath.Join(string(d), filepath.FromSlash(objectName(inv.Number, inv.Date, ".xml")))
+	if err := os.MkdirAll(filepath.Dir(pdfPath), 0o755); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+
+	// The XML is written first: the PDF marks the invoice as archived
+	if err := writeNew(xmlPath, inv.XML); err != nil {
+		return err
+	}
+	if err := writeNew(pdfPath, inv.PDF); err != nil {
+		if !errors.Is(err, ErrExists) {
+			os.Remove(xmlPath)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeNew creates a read-only file, failing with ErrExists if it exists.
+func writeNew(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o444)
+	if errors.Is(err, os.ErrExist) {
+		return ErrExists
+	}
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("archive: %w", err)
+	}
+	return nil
+}
+
+func (d Dir) Get(ctx context.Context, number string, period time.Time) (Invoice, error) {
+	pdf, err := os.ReadFile(filepath.Join(string(d), filepath.FromSlash(objectName(number, period, ".pdf"))))
+	if errors.Is(err, os.ErrNotExist) {
+		return Invoice{}, ErrNotFound
+	}
+	if err != nil {
+		return Invoice{}, fmt.Errorf("archive: %w", err)
+	}
+	xml, err := os.ReadFile(filepath.Join(string(d), filepath.FromSlash(objectName(number, period, ".xml"))))
+	if err != nil {
+		return Invoice{}, fmt.Errorf("archive: %w", err)
+	}
+	return Invoice{Number: number, Date: period, PDF: pdf, XML: xml}, nil
+}
+
+func (d Dir) List(ctx context.Context, from, to time.Time) ([]Info, error) {
+	var list []Info
+	for _, month := range months(from, to) {
+		prefix := periodPrefix(month)
+		entries, err := os.ReadDir(filepath.Join(string(d), filepath.FromSlash(prefix)))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive: %w", err)
+		}
+		var infos []Info
+		for _, e := range entries {
+			if info, ok := parseObjectName(prefix + e.Name()); ok && !e.IsDir() {
+				infos = append(infos, info)
+			}
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Number < infos[j].Number })
+		list = append(list, infos...)
+	}
+	return list, nil
+}
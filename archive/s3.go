@@ -0,0 +1,308 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 is a Store keeping invoices in a bucket of an S3-compatible object
+// storage (AWS S3, MinIO, Scaleway, OVHcloud...), with the same layout as
+// Dir under Prefix. Requests are signed with AWS Signature Version 4 and
+// use path-style URLs.
+//
+// Put relies on conditional writes (If-None-Match: *) to never overwrite
+// an archived invoice; combine it with object lock on the bucket to enforce
+// retention.
+type S3 struct {
+	// Endpoint is the service URL, e.g. "https://s3.eu-west-3.amazonaws.com".
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix, if set, is prepended to object names.
+	Prefix string
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// Client is the HTTP client; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// NewS3FromEnv returns an S3 store configured with the variables used by
+// the AWS tools: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN,
+// AWS_REGION (default us-east-1) and AWS_ENDPOINT_URL (default: AWS S3 in
+// the region).
+func NewS3FromEnv(bucket, prefix string) (*S3, error) {
+	s := &S3{
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+		Region:       os.Getenv("AWS_REGION"),
+		Bucket:       bucket,
+		Prefix:       prefix,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("archive: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for S3")
+	}
+	return s, nil
+}
+
+func (s *S3) Put(ctx context.Context, inv Invoice) error {
+	// The XML is written first: the PDF marks the invoice as archived
+	xmlName := objectName(inv.Number, inv.Date, ".xml")
+	if err := s.putObject(ctx, xmlName, "application/xml", inv.XML); err != nil {
+		return err
+	}
+	err := s.putObject(ctx, objectName(inv.Number, inv.Date, ".pdf"), "application/pdf", inv.PDF)
+	if err != nil && !errors.Is(err, ErrExists) {
+		if resp, derr := s.do(ctx, "DELETE", s.Prefix+xmlName, nil, nil, nil); derr == nil {
+			resp.Body.Close()
+		}
+	}
+	return err
+}
+
+func (s *S3) putObject(ctx context.Context, name, contentType string, data []byte) error {
+	resp, err := s.do(ctx, "PUT", s.Prefix+name, nil, data, map[string]string{
+		"Content-Type":  contentType,
+		"If-None-Match": "*",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return ErrExists
+	case resp.StatusCode >= 300:
+		return s.responseError(resp)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, number string, period time.Time) (Invoice, error) {
+	pdf, err := s.getObject(ctx, objectName(number, period, ".pdf"))
+	if err != nil {
+		return Invoice{}, err
+	}
+	xml, err := s.getObject(ctx, objectName(number, period, ".xml"))
+	if err != nil {
+		return Invoice{}, err
+	}
+	return Invoice{Number: number, Date: period, PDF: pdf, XML: xml}, nil
+}
+
+func (s *S3) getObject(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.do(ctx, "GET", s.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode >= 300:
+		return nil, s.responseError(resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	return data, nil
+}
+
+func (s *S3) List(ctx context.Context, from, to time.Time) ([]Info, error) {
+	var list []Info
+	for _, month := range months(from, to) {
+		var infos []Info
+		query := map[string]string{"list-type": "2", "prefix": s.Prefix + periodPrefix(month)}
+		for {
+			var result struct {
+				Contents []struct {
+					Key string
+				}
+				IsTruncated           bool
+				NextContinuationToken string
+			}
+			if err := s.list(ctx, query, &result); err != nil {
+				return nil, err
+			}
+			for _, c := range result.Contents {
+				if info, ok := parseObjectName(strings.TrimPrefix(c.Key, s.Prefix)); ok {
+					infos = append(infos, info)
+				}
+			}
+			if !result.IsTruncated {
+				break
+			}
+			query["continuation-token"] = result.NextContinuationToken
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Number < infos[j].Number })
+		list = append(list, infos...)
+	}
+	return list, nil
+}
+
+func (s *S3) list(ctx context.Context, query map[string]string, v any) error {
+	resp, err := s.do(ctx, "GET", "", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return s.responseError(resp)
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("archive: invalid S3 response: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("archive: S3 %s: %s: %s", resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("archive: S3 %s", resp.Status)
+}
+
+// do sends a signed request for an object of the bucket (the bucket itself
+// when key is empty).
+func (s *S3) do(ctx context.Context, method, key string, query map[string]string, body []byte, headers map[string]string) (*http.Response, error) {
+	path := "/" + uriEncode(s.Bucket, false)
+	if key != "" {
+		path += "/" + uriEncode(key, false)
+	}
+	var keys []string
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		params = append(params, uriEncode(k, true)+"="+uriEncode(query[k], true))
+	}
+	rawQuery := strings.Join(params, "&")
+
+	target := strings.TrimSuffix(s.Endpoint, "/") + path
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	s.sign(req, path, rawQuery, body, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, whose
+// canonical path and query are given already encoded.
+func (s *S3) sign(req *http.Request, path, rawQuery string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	signed := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			signed[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	var names []string
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, rawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// uriEncode percent-encodes s as required by Signature Version 4: every
+// byte but unreserved characters, and slashes unless encodeSlash is false.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,111 @@
+package facturx
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchResult is the outcome of generating one invoice of a batch.
+type BatchResult struct {
+	// Index is the position of the request in the batch.
+	Index int
+	// Number is the invoice number of the request.
+	Number string
+	// PDF holds the generated file, or nil on failure.
+	PDF []byte
+	// Err is the generation error, or nil on success.
+	Err error
+}
+
+// GenerateBatch generates one PDF per request.
+//
+// Font and ICC resources are prepared once and shared by every invoice. A
+// failing invoice does not abort the batch: its error is reported in the
+// corresponding result, which is returned in request order.
+func GenerateBatch(reqs []InvoiceRequest) []BatchResult {
+	// A loading error is reported by every Generate call
+	_ = loadStaticResources()
+
+	results := make([]BatchResult, len(reqs))
+	for i, req := range reqs {
+		pdf, err := Generate(req)
+		results[i] = BatchResult{Index: i, Number: req.Number, PDF: pdf, Err: err}
+	}
+	return results
+}
+
+// GenerateConcurrent generates invoices across a pool of workers and hands
+// each result to handle as soon as it is ready.
+//
+// Memory stays bounded: results are not accumulated, at most workers PDFs are
+// in flight at once, and handle is always called from the calling goroutine
+// (so it needs no locking), in completion order rather than request order.
+// A workers value below 1 means one worker.
+//
+// Generation stops early when ctx is cancelled or handle returns an error;
+// that error is returned. Invoice-level failures are reported through
+// BatchResult.Err and do not stop the batch; an unusable embedded font
+// (see WarmUp) fails it before any invoice is generated.
+func GenerateConcurrent(ctx context.Context, reqs []InvoiceRequest, workers int, handle func(BatchResult) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if err := loadStaticResources(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make(chan BatchResult, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				pdf, err := Generate(reqs[i])
+				select {
+				case results <- BatchResult{Index: i, Number: reqs[i].Number, PDF: pdf, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Feed jobs until done or cancelled
+	go func() {
+		defer close(jobs)
+		for i := range reqs {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var handleErr error
+	for result := range results {
+		if handleErr != nil {
+			continue // drain so workers can exit
+		}
+		if err := handle(result); err != nil {
+			handleErr = err
+			cancel()
+		}
+	}
+
+	if handleErr != nil {
+		return handleErr
+	}
+	return ctx.Err()
+}
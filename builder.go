@@ -0,0 +1,141 @@
+package facturx
+
+import "time"
+
+// InvoiceBuilder builds an InvoiceRequest step by step, so optional groups
+// (payment, references, delivery...) can be added without a large struct literal.
+//
+// Example:
+//
+//	pdf, err := facturx.NewInvoice("FA-2024-001").
+//	    IssuedOn(time.Now()).
+//	    Seller(seller).
+//	    Buyer(buyer).
+//	    AddLine("Prestation de conseil", 10, 100).
+//	    Regime(facturx.VatStandard(20.0)).
+//	    Generate()
+type InvoiceBuilder struct {
+	req InvoiceRequest
+}
+
+// NewInvoice starts a new invoice with the given number.
+// The VAT regime defaults to VatStandard(20.0).
+func NewInvoice(number string) *InvoiceBuilder {
+	return &InvoiceBuilder{
+		req: InvoiceRequest{
+			Number: number,
+			Regime: VatStandard(20.0),
+		},
+	}
+}
+
+// IssuedOn sets the invoice date.
+func (b *InvoiceBuilder) IssuedOn(date time.Time) *InvoiceBuilder {
+	b.req.IssueDate = date
+	return b
+}
+
+// DueOn sets the payment due date.
+func (b *InvoiceBuilder) DueOn(date time.Time) *InvoiceBuilder {
+	b.req.DueDate = date
+	return b
+}
+
+// Seller sets the seller.
+func (b *InvoiceBuilder) Seller(seller Contact) *InvoiceBuilder {
+	b.req.Seller = seller
+	return b
+}
+
+// Buyer sets the buyer.
+func (b *InvoiceBuilder) Buyer(buyer Contact) *InvoiceBuilder {
+	b.req.Buyer = buyer
+	return b
+}
+
+// AddLine appends a line with the given description, quantity and unit price.
+func (b *InvoiceBuilder) AddLine(description string, quantity, unitPrice float64) *InvoiceBuilder {
+	b.req.Lines = append(b.req.Lines, InvoiceLine{
+		Description: description,
+		Quantity:    quantity,
+		UnitPrice:   unitPrice,
+	})
+	return b
+}
+
+// AddLines appends fully specified lines.
+func (b *InvoiceBuilder) AddLines(lines ...InvoiceLine) *InvoiceBuilder {
+	b.req.Lines = append(b.req.Lines, lines...)
+	return b
+}
+
+// AddShipping adds delivery costs excluding tax, charged at the given VAT
+// rate, as a "Frais de port" document-level charge.
+func (b *InvoiceBuilder) AddShipping(amount, vatRate float64) *InvoiceBuilder {
+	b.req.AddShipping(amount, vatRate)
+	return b
+}
+
+// Regime sets the VAT regime.
+func (b *InvoiceBuilder) Regime(regime VatRegime) *InvoiceBuilder {
+	b.req.Regime = regime
+	return b
+}
+
+// EISuffix adds the "Entrepreneur Individuel" suffix to the seller name.
+func (b *InvoiceBuilder) EISuffix() *InvoiceBuilder {
+	b.req.AddEISuffix = true
+	return b
+}
+
+// Mentions sets the custom legal mentions (can contain newlines).
+func (b *InvoiceBuilder) Mentions(text string) *InvoiceBuilder {
+	b.req.CustomMentions = text
+	return b
+}
+
+// PaidOn marks the invoice as paid on the given date with the given method.
+func (b *InvoiceBuilder) PaidOn(date time.Time, method PaymentMethod) *InvoiceBuilder {
+	b.req.Payment = &Payment{PaidOn: date, Method: method}
+	return b
+}
+
+// Corrects turns the invoice into a corrective invoice (384) of the given
+// invoice, with an optional reason.
+func (b *InvoiceBuilder) Corrects(ref InvoiceReference, reason string) *InvoiceBuilder {
+	b.req.Type = TypeCorrective
+	b.req.PrecedingInvoice = &ref
+	b.req.CorrectionReason = reason
+	return b
+}
+
+// DespatchAdvice sets the despatch advice (bon de livraison) reference.
+func (b *InvoiceBuilder) DespatchAdvice(ref string) *InvoiceBuilder {
+	b.req.DespatchAdviceRef = ref
+	return b
+}
+
+// Limits sets sanity thresholds on amounts and quantities.
+func (b *InvoiceBuilder) Limits(limits Limits) *InvoiceBuilder {
+	b.req.Limits = &limits
+	return b
+}
+
+// Build validates and returns the invoice request.
+func (b *InvoiceBuilder) Build() (InvoiceRequest, error) {
+	req := b.req
+	req.Lines = append([]InvoiceLine(nil), b.req.Lines...)
+	if err := Validate(&req).Err(); err != nil {
+		return InvoiceRequest{}, err
+	}
+	return req, nil
+}
+
+// Generate builds the invoice and generates the Factur-X PDF.
+func (b *InvoiceBuilder) Generate() ([]byte, error) {
+	req, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return Generate(req)
+}
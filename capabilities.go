@@ -0,0 +1,52 @@
+package facturx
+
+import (
+	"sort"
+	"sync"
+)
+
+// CapabilitySet describes what the compiled library supports.
+type CapabilitySet struct {
+	// Profiles lists the Factur-X profiles that can be generated.
+	Profiles []string `json:"profiles"`
+	// Versions lists the Factur-X specification versions that can be
+	// generated.
+	Versions []Version `json:"versions"`
+	// Syntaxes lists the supported invoice syntaxes.
+	Syntaxes []string `json:"syntaxes"`
+	// Fonts lists the embedded fonts.
+	Fonts []string `json:"fonts"`
+	// Subsystems lists the optional subsystems compiled into the binary.
+	Subsystems []string `json:"subsystems"`
+}
+
+var (
+	subsystemsMu sync.Mutex
+	subsystems   []string
+)
+
+// registerSubsystem records an optional subsystem as available. It is meant
+// to be called from init functions, so files gated behind build tags only
+// advertise themselves when compiled in.
+func registerSubsystem(name string) {
+	subsystemsMu.Lock()
+	defer subsystemsMu.Unlock()
+	subsystems = append(subsystems, name)
+}
+
+// Capabilities returns the profiles, syntaxes, fonts and optional subsystems
+// compiled into the library, so servers can advertise them and clients adapt.
+func Capabilities() CapabilitySet {
+	subsystemsMu.Lock()
+	enabled := append([]string(nil), subsystems...)
+	subsystemsMu.Unlock()
+	sort.Strings(enabled)
+
+	return CapabilitySet{
+		Profiles:   []string{"BASIC"},
+		Versions:   Versions(),
+		Syntaxes:   []string{"CII D16B"},
+		Fonts:      []string{"LiberationSans"},
+		Subsystems: enabled,
+	}
+}
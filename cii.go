@@ -0,0 +1,414 @@
+package facturx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CrossIndustryInvoice is the document model of a CII invoice, the XML
+// embedded in Factur-X PDFs. Its types mirror the CII structure, limited to
+// the elements of the profiles this package writes. Values are kept as
+// written in the XML: amounts and quantities are decimal strings and dates
+// are Date values. Optional elements are omitted when
+// their value is empty or nil.
+//
+// BuildCII returns the model of an invoice request and ParseCII reads it
+// from XML. InvoiceRequest.CustomizeCII edits it before it is embedded.
+type CrossIndustryInvoice struct {
+	XMLName     xml.Name                 `xml:"CrossIndustryInvoice"`
+	Context     ExchangedDocumentContext `xml:"ExchangedDocumentContext"`
+	Document    ExchangedDocument        `xml:"ExchangedDocument"`
+	Transaction TradeTransaction         `xml:"SupplyChainTradeTransaction"`
+}
+
+// ExchangedDocumentContext identifies the business process and the
+// profile (BT-23, BT-24).
+type ExchangedDocumentContext struct {
+	BusinessProcess *DocumentContextParameter `xml:"BusinessProcessSpecifiedDocumentContextParameter"`
+	Guideline       DocumentContextParameter  `xml:"GuidelineSpecifiedDocumentContextParameter"`
+}
+
+// DocumentContextParameter is the identifier of a business process or
+// specification.
+type DocumentContextParameter struct {
+	ID string `xml:"ID"`
+}
+
+// ExchangedDocument is the invoice header: number (BT-1), type code
+// (BT-3), issue date (BT-2) and notes (BG-1).
+type ExchangedDocument struct {
+	ID        string         `xml:"ID"`
+	TypeCode  string         `xml:"TypeCode"`
+	IssueDate Date           `xml:"IssueDateTime,omitempty"`
+	Notes     []IncludedNote `xml:"IncludedNote"`
+}
+
+// IncludedNote is an invoice note (BT-22) with its subject code (BT-21).
+type IncludedNote struct {
+	Content     string `xml:"Content"`
+	SubjectCode string `xml:"SubjectCode,omitempty"`
+}
+
+// TradeTransaction holds the lines and the header of the invoice.
+type TradeTransaction struct {
+	Lines      []LineItem            `xml:"IncludedSupplyChainTradeLineItem"`
+	Agreement  HeaderTradeAgreement  `xml:"ApplicableHeaderTradeAgreement"`
+	Delivery   HeaderTradeDelivery   `xml:"ApplicableHeaderTradeDelivery"`
+	Settlement HeaderTradeSettlement `xml:"ApplicableHeaderTradeSettlement"`
+}
+
+// LineItem is an invoice line (BG-25).
+type LineItem struct {
+	LineID         string      `xml:"AssociatedDocumentLineDocument>LineID"`
+	Name           string      `xml:"SpecifiedTradeProduct>Name"`
+	GrossPrice     *TradePrice `xml:"SpecifiedLineTradeAgreement>GrossPriceProductTradePrice"`
+	NetPrice       TradePrice  `xml:"SpecifiedLineTradeAgreement>NetPriceProductTradePrice"`
+	BilledQuantity Quantity    `xml:"SpecifiedLineTradeDelivery>BilledQuantity"`
+	Tax            TradeTax    `xml:"SpecifiedLineTradeSettlement>ApplicableTradeTax"`
+	BillingPeriod  *Period     `xml:"SpecifiedLineTradeSettlement>BillingSpecifiedPeriod"`
+	// AllowanceCharges are the line discounts (BG-27) and charges (BG-28).
+	AllowanceCharges []TradeAllowanceCharge `xml:"SpecifiedLineTradeSettlement>SpecifiedTradeAllowanceCharge"`
+	LineTotal        string                 `xml:"SpecifiedLineTradeSettlement>SpecifiedTradeSettlementLineMonetarySummation>LineTotalAmount"`
+}
+
+// TradePrice is an item price: the net price (BT-146), or the gross price
+// (BT-148) with its discount (BT-147).
+type TradePrice struct {
+	ChargeAmount string                `xml:"ChargeAmount"`
+	Allowance    *TradeAllowanceCharge `xml:"AppliedTradeAllowanceCharge"`
+}
+
+// Quantity is the invoiced quantity (BT-129) and its unit (BT-130).
+type Quantity struct {
+	Value    string `xml:",chardata"`
+	UnitCode string `xml:"unitCode,attr,omitempty"`
+}
+
+// Period is a billing period; either date may be empty.
+type Period struct {
+	Start Date `xml:"StartDateTime,omitempty"`
+	End   Date `xml:"EndDateTime,omitempty"`
+}
+
+// TradeAllowanceCharge is an allowance, or a charge if ChargeIndicator is
+// set, on a line, a price or the document.
+type TradeAllowanceCharge struct {
+	ChargeIndicator    bool   `xml:"ChargeIndicator>Indicator"`
+	CalculationPercent string `xml:"CalculationPercent,omitempty"`
+	BasisAmount        string `xml:"BasisAmount,omitempty"`
+	ActualAmount       string `xml:"ActualAmount"`
+	ReasonCode         string `xml:"ReasonCode,omitempty"`
+	Reason             string `xml:"Reason,omitempty"`
+	// CategoryTax is the VAT of document-level allowances and charges.
+	CategoryTax *TradeTax `xml:"CategoryTradeTax"`
+}
+
+// TradeTax is a VAT breakdown (BG-23), or the VAT category of a line or a
+// document-level allowance or charge.
+type TradeTax struct {
+	CalculatedAmount      string `xml:"CalculatedAmount,omitempty"`
+	TypeCode              string `xml:"TypeCode"`
+	ExemptionReason       string `xml:"ExemptionReason,omitempty"`
+	BasisAmount           string `xml:"BasisAmount,omitempty"`
+	CategoryCode          string `xml:"CategoryCode"`
+	ExemptionReasonCode   string `xml:"ExemptionReasonCode,omitempty"`
+	TaxPointDate          Date   `xml:"TaxPointDate,omitempty"`
+	DueDateTypeCode       string `xml:"DueDateTypeCode,omitempty"`
+	RateApplicablePercent string `xml:"RateApplicablePercent,omitempty"`
+}
+
+// HeaderTradeAgreement holds the parties and the referenced documents.
+type HeaderTradeAgreement struct {
+	Seller     TradeParty          `xml:"SellerTradeParty"`
+	Buyer      TradeParty          `xml:"BuyerTradeParty"`
+	BuyerOrder *ReferencedDocument `xml:"BuyerOrderReferencedDocument"`
+	// Additional are the supporting documents (BG-24).
+	Additional []ReferencedDocument `xml:"AdditionalReferencedDocument"`
+}
+
+// TradeParty is the seller (BG-4) or the buyer (BG-7). TradingName is a
+// pointer: encoding/xml would write an empty SpecifiedLegalOrganization for
+// an empty string.
+type TradeParty struct {
+	IDs               []Identifier      `xml:"ID"`
+	GlobalIDs         []Identifier      `xml:"GlobalID"`
+	Name              string            `xml:"Name"`
+	LegalOrganization *Identifier       `xml:"SpecifiedLegalOrganization>ID"`
+	TradingName       *string           `xml:"SpecifiedLegalOrganization>TradingBusinessName"`
+	Address           TradeAddress      `xml:"PostalTradeAddress"`
+	TaxRegistrations  []TaxRegistration `xml:"SpecifiedTaxRegistration"`
+}
+
+// TaxRegistration is a tax registration, such as the VAT number (scheme
+// VA).
+type TaxRegistration struct {
+	ID Identifier `xml:"ID"`
+}
+
+// Identifier is an identifier with its optional scheme.
+type Identifier struct {
+	Value    string `xml:",chardata"`
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+}
+
+// TradeAddress is a postal address.
+type TradeAddress struct {
+	Postcode  string `xml:"PostcodeCode"`
+	LineOne   string `xml:"LineOne"`
+	City      string `xml:"CityName"`
+	CountryID string `xml:"CountryID"`
+}
+
+// ReferencedDocument is a document referenced by the invoice: purchase
+// order, despatch advice, supporting document or preceding invoice.
+type ReferencedDocument struct {
+	IssuerAssignedID string `xml:"IssuerAssignedID"`
+	TypeCode         string `xml:"TypeCode,omitempty"`
+	Name             string `xml:"Name,omitempty"`
+	IssueDate        Date   `xml:"FormattedIssueDateTime,omitempty"`
+}
+
+// HeaderTradeDelivery holds the delivery (BT-72) and the despatch advice
+// (BT-16).
+type HeaderTradeDelivery struct {
+	ActualDelivery *SupplyChainEvent   `xml:"ActualDeliverySupplyChainEvent"`
+	DespatchAdvice *ReferencedDocument `xml:"DespatchAdviceReferencedDocument"`
+}
+
+// SupplyChainEvent is a delivery event and its date.
+type SupplyChainEvent struct {
+	Date Date `xml:"OccurrenceDateTime"`
+}
+
+// HeaderTradeSettlement holds the SEPA creditor identifier (BT-90),
+// currency, payment means, VAT, charges, payment terms and totals.
+type HeaderTradeSettlement struct {
+	CreditorReferenceID string                 `xml:"CreditorReferenceID,omitempty"`
+	Currency            string                 `xml:"InvoiceCurrencyCode"`
+	PaymentMeans        []PaymentMeans         `xml:"SpecifiedTradeSettlementPaymentMeans"`
+	Taxes               []TradeTax             `xml:"ApplicableTradeTax"`
+	AllowanceCharges    []TradeAllowanceCharge `xml:"SpecifiedTradeAllowanceCharge"`
+	PaymentTerms        []PaymentTerms         `xml:"SpecifiedTradePaymentTerms"`
+	Summation           MonetarySummation      `xml:"SpecifiedTradeSettlementHeaderMonetarySummation"`
+	// InvoiceReference is the preceding invoice (BG-3).
+	InvoiceReference *ReferencedDocument `xml:"InvoiceReferencedDocument"`
+}
+
+// PaymentMeans is a payment means (BG-16): its type code (BT-81), such as
+// 59 for SEPA direct debit, and the debited account (BT-91).
+type PaymentMeans struct {
+	TypeCode      string            `xml:"TypeCode"`
+	DebtorAccount *FinancialAccount `xml:"PayerPartyDebtorFinancialAccount"`
+}
+
+// FinancialAccount is a bank account identified by its IBAN.
+type FinancialAccount struct {
+	IBAN string `xml:"IBANID"`
+}
+
+// PaymentTerms are the payment terms (BT-20), due date (BT-9) and direct
+// debit mandate reference (BT-89). In the EXTENDED profile, each
+// installment has its own terms with the partial amount due.
+type PaymentTerms struct {
+	Description          string `xml:"Description,omitempty"`
+	DueDate              Date   `xml:"DueDateDateTime,omitempty"`
+	DirectDebitMandateID string `xml:"DirectDebitMandateID,omitempty"`
+	PartialPaymentAmount string `xml:"PartialPaymentAmount,omitempty"`
+}
+
+// MonetarySummation holds the document totals (BG-22).
+type MonetarySummation struct {
+	LineTotal      string         `xml:"LineTotalAmount"`
+	ChargeTotal    string         `xml:"ChargeTotalAmount,omitempty"`
+	AllowanceTotal string         `xml:"AllowanceTotalAmount,omitempty"`
+	TaxBasisTotal  string         `xml:"TaxBasisTotalAmount"`
+	TaxTotal       CurrencyAmount `xml:"TaxTotalAmount"`
+	GrandTotal     string         `xml:"GrandTotalAmount"`
+	TotalPrepaid   string         `xml:"TotalPrepaidAmount,omitempty"`
+	DuePayable     string         `xml:"DuePayableAmount"`
+}
+
+// CurrencyAmount is an amount with its currency.
+type CurrencyAmount struct {
+	Value      string `xml:",chardata"`
+	CurrencyID string `xml:"currencyID,attr,omitempty"`
+}
+
+// ParseCII decodes a CII document into its model. Elements are matched by
+// local name, so namespace prefixes don't matter, and elements outside the
+// model are ignored. It returns an error wrapping ErrXML if the document
+// is not well-formed.
+//
+// ZUGFeRD 1.0 documents (a CrossIndustryDocument root) are read too, and
+// mapped onto the same model.
+func ParseCII(data []byte) (*CrossIndustryInvoice, error) {
+	if xmlRoot(data) == "CrossIndustryDocument" {
+		var legacy zugferd1Document
+		if err := xml.Unmarshal(data, &legacy); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrXML, err)
+		}
+		return legacy.cii(), nil
+	}
+
+	var doc CrossIndustryInvoice
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrXML, err)
+	}
+	return &doc, nil
+}
+
+// xmlRoot returns the local name of the root element of an XML document,
+// or "" if it cannot be read.
+func xmlRoot(data []byte) string {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// XMLFormat selects the layout of the serialized CII XML; the zero value
+// is XMLPretty.
+type XMLFormat string
+
+const (
+	// XMLPretty writes one element per line, indented by two spaces.
+	XMLPretty XMLFormat = "pretty"
+	// XMLCompact writes no indentation or line breaks between elements,
+	// for smaller files.
+	XMLCompact XMLFormat = "compact"
+)
+
+// XML serializes the document in the XMLPretty format.
+func (d *CrossIndustryInvoice) XML() (string, error) {
+	return d.Marshal(XMLPretty)
+}
+
+// Marshal serializes the document in the given format, with the rsm, ram,
+// udt and qdt namespace prefixes the Factur-X specification uses. Elements
+// are written in the order of the model fields, which follows the CII
+// schema.
+func (d *CrossIndustryInvoice) Marshal(format XMLFormat) (string, error) {
+	newline, indent := "\n", "  "
+	if format == XMLCompact {
+		newline, indent = "", ""
+	}
+
+	// Marshal with local names, then add the prefixes and indentation
+	plain, err := xml.Marshal(d)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrXML, err)
+	}
+
+	var b strings.Builder
+	b.Grow(2 * len(plain))
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + newline)
+	dec := xml.NewDecoder(bytes.NewReader(plain))
+	var parents []string
+	afterStart := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrXML, err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if afterStart {
+				b.WriteString(newline)
+			}
+			parent := ""
+			if len(parents) > 0 {
+				parent = parents[len(parents)-1]
+			}
+			name := ciiPrefix(tok.Name.Local, parent, len(parents)) + ":" + tok.Name.Local
+			b.WriteString(strings.Repeat(indent, len(parents)))
+			b.WriteString("<" + name)
+			if len(parents) == 0 {
+				fmt.Fprintf(&b, ` xmlns:rsm="%s" xmlns:ram="%s" xmlns:udt="%s" xmlns:qdt="%s"`, nsRSM, nsRAM, nsUDT, nsQDT)
+			}
+			for _, a := range tok.Attr {
+				if a.Name.Space == "" && a.Name.Local != "xmlns" {
+					fmt.Fprintf(&b, ` %s="%s"`, a.Name.Local, escapeXML(a.Value))
+				}
+			}
+			b.WriteByte('>')
+			parents = append(parents, tok.Name.Local)
+			afterStart = true
+		case xml.EndElement:
+			local := parents[len(parents)-1]
+			parents = parents[:len(parents)-1]
+			if !afterStart {
+				b.WriteString(strings.Repeat(indent, len(parents)))
+			}
+			parent := ""
+			if len(parents) > 0 {
+				parent = parents[len(parents)-1]
+			}
+			b.WriteString("</" + ciiPrefix(local, parent, len(parents)) + ":" + local + ">" + newline)
+			afterStart = false
+		case xml.CharData:
+			b.WriteString(escapeXML(string(tok)))
+		}
+	}
+	return b.String(), nil
+}
+
+// ciiPrefix returns the namespace prefix of a CII element from its name,
+// its parent's and its depth: the root and its children belong to rsm,
+// data type content to udt (qdt for formatted dates) and aggregates to ram.
+func ciiPrefix(local, parent string, depth int) string {
+	switch {
+	case depth <= 1:
+		return "rsm"
+	case parent == "FormattedIssueDateTime":
+		return "qdt"
+	case local == "DateTimeString" || local == "DateString" || local == "Indicator":
+		return "udt"
+	}
+	return "ram"
+}
+
+// Date is a CII date in format 102 (YYYYMMDD). It is written in a
+// DateTimeString element, or DateString for the tax point date.
+type Date string
+
+// MarshalXML writes the date element and its format.
+func (d Date) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	inner := xml.StartElement{
+		Name: xml.Name{Local: "DateTimeString"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "format"}, Value: "102"}},
+	}
+	if start.Name.Local == "TaxPointDate" {
+		inner.Name.Local = "DateString"
+	}
+	for _, tok := range []xml.Token{start, inner, xml.CharData(d), inner.End(), start.End()} {
+		if err := e.EncodeToken(tok); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalXML reads the date from the element it contains.
+func (d *Date) UnmarshalXML(dec *xml.Decoder, start xml.StartElement) error {
+	var v struct {
+		Value string `xml:",any"`
+	}
+	if err := dec.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	*d = Date(v.Value)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/archive"
+	"github.com/audrenbdb/facturx/csvimport"
+)
+
+// runBatch implements "facturx batch". The CSV layout is documented in
+// package csvimport.
+func runBatch(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	outDir := fs.String("out", ".", "output directory for the generated PDFs")
+	sep := fs.String("sep", "", "field separator (default: detected from the header, ',' or ';')")
+	archiveTo := fs.String("archive", "", "also archive each PDF and XML to a directory or s3://bucket/prefix")
+	version := fs.String("facturx-version", string(facturx.Version1p0), "Factur-X version: 1.0 or 1.0.07")
+	objectStreams := fs.Bool("object-streams", false, "write compressed object and cross-reference streams (PDF 1.5) for smaller files")
+	compactXML := fs.Bool("compact-xml", false, "write the embedded XML without indentation, for smaller files")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: facturx batch <lines.csv|-> [-out dir] [-sep ;] [-archive location]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(reorderArgs(fs, args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one CSV file")
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if len([]rune(*sep)) > 1 {
+		return fmt.Errorf("invalid separator %q", *sep)
+	}
+	var comma rune
+	if *sep != "" {
+		comma = []rune(*sep)[0]
+	}
+	invoices, err := csvimport.Read(r, comma)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+	var store archive.Store
+	if *archiveTo != "" {
+		if store, err = archive.Open(*archiveTo); err != nil {
+			return err
+		}
+	}
+
+	// Row errors are reported per invoice, like generation errors
+	reqs := make([]facturx.InvoiceRequest, len(invoices))
+	for i, inv := range invoices {
+		reqs[i] = inv.Request
+		reqs[i].FacturXVersion = facturx.Version(*version)
+		reqs[i].ObjectStreams = *objectStreams
+		if *compactXML {
+			reqs[i].XMLFormat = facturx.XMLCompact
+		}
+	}
+
+	report := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(report, "NUMBER\tSTATUS\tDETAIL")
+	failed := 0
+	for i, res := range facturx.GenerateBatch(reqs) {
+		number := invoices[i].Number
+		if number == "" {
+			number = fmt.Sprintf("(line %d)", invoices[i].Line)
+		}
+		err := invoices[i].Err()
+		if err == nil {
+			err = res.Err
+		}
+		if err == nil {
+			path := filepath.Join(*outDir, safeFileName(number)+".pdf")
+			err = os.WriteFile(path, res.PDF, 0o644)
+			if err == nil && store != nil {
+				err = archivePDF(store, reqs[i], res.PDF)
+			}
+			if err == nil {
+				fmt.Fprintf(report, "%s\tok\t%s\n", number, path)
+				continue
+			}
+		}
+		failed++
+		fmt.Fprintf(report, "%s\terror\t%s\n", number, strings.ReplaceAll(err.Error(), "\n", "; "))
+	}
+	report.Flush()
+	fmt.Printf("\n%d invoice(s) generated, %d failed\n", len(invoices)-failed, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d invoice(s) failed", failed)
+	}
+	return nil
+}
+
+// safeFileName makes an invoice number usable as a file name.
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '-'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// runEmbed implements "facturx embed".
+func runEmbed(args []string) error {
+	fs := flag.NewFlagSet("embed", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (default: <visual>-facturx.pdf)")
+	version := fs.String("facturx-version", string(facturx.Version1p0), "Factur-X version: 1.0 or 1.0.07")
+	objectStreams := fs.Bool("object-streams", false, "write compressed object and cross-reference streams (PDF 1.5) for smaller files")
+	compactXML := fs.Bool("compact-xml", false, "write the embedded XML without indentation, for smaller files")
+	incremental := fs.Bool("incremental", false, "append to the visual PDF as an incremental update, keeping its digital signatures valid")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: facturx embed <visual.pdf> <invoice.json|invoice-ubl.xml|-> [-o file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(reorderArgs(fs, args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected a PDF and a JSON invoice")
+	}
+
+	visual, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	req, err := readInvoice(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	req.FacturXVersion = facturx.Version(*version)
+	req.ObjectStreams = *objectStreams
+	if *compactXML {
+		req.XMLFormat = facturx.XMLCompact
+	}
+
+	embed := facturx.Embed
+	if *incremental {
+		embed = facturx.EmbedIncremental
+	}
+	data, err := embed(visual, req)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = strings.TrimSuffix(fs.Arg(0), ".pdf") + "-facturx.pdf"
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s written (%d bytes)\n", path, len(data))
+	return nil
+}
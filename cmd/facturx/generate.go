@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+	"github.com/audrenbdb/facturx/archive"
+	"github.com/audrenbdb/facturx/mail"
+)
+
+// runGenerate implements "facturx generate".
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (default: facture-<number>.pdf, or .xml with -xml)")
+	xmlOnly := fs.Bool("xml", false, "write only the CII XML instead of the PDF")
+	email := fs.String("email", "", "also send the PDF to these comma-separated addresses (SMTP settings from FACTURX_SMTP_*)")
+	emailLang := fs.String("email-lang", "fr", "language of the email: fr or en")
+	archiveTo := fs.String("archive", "", "also archive the PDF and XML to a directory or s3://bucket/prefix")
+	version := fs.String("facturx-version", string(facturx.Version1p0), "Factur-X version: 1.0 or 1.0.07")
+	objectStreams := fs.Bool("object-streams", false, "write compressed object and cross-reference streams (PDF 1.5) for smaller files")
+	compactXML := fs.Bool("compact-xml", false, "write the embedded XML without indentation, for smaller files")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: facturx generate <invoice.json|invoice-ubl.xml|-> [-o file] [-xml] [-email addresses] [-archive location]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(reorderArgs(fs, args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one input file")
+	}
+	if (*email != "" || *archiveTo != "") && *xmlOnly {
+		return errors.New("-email and -archive cannot be combined with -xml")
+	}
+
+	req, err := readInvoice(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	req.FacturXVersion = facturx.Version(*version)
+	req.ObjectStreams = *objectStreams
+	if *compactXML {
+		req.XMLFormat = facturx.XMLCompact
+	}
+	var store archive.Store
+	if *archiveTo != "" {
+		if store, err = archive.Open(*archiveTo); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	ext := ".pdf"
+	if *xmlOnly {
+		xml, err := facturx.GenerateXMLOnly(&req)
+		if err != nil {
+			return err
+		}
+		data, ext = []byte(xml), ".xml"
+	} else {
+		res, err := facturx.GenerateResult(req)
+		if err != nil {
+			return err
+		}
+		data = res.PDF
+		for _, lw := range res.LayoutWarnings {
+			fmt.Fprintf(os.Stderr, "warning: %s truncated to fit the page\n", lw.Field)
+		}
+	}
+
+	path := *output
+	if path == "" {
+		path = "facture-" + req.Number + ext
+	}
+	if path == "-" {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+	} else {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s written (%d bytes)\n", path, len(data))
+	}
+
+	if store != nil {
+		if err := archivePDF(store, req, data); err != nil {
+			return err
+		}
+	}
+	if *email != "" {
+		return sendEmail(strings.Split(*email, ","), *emailLang, req, data)
+	}
+	return nil
+}
+
+// archivePDF stores a generated PDF and its XML.
+func archivePDF(store archive.Store, req facturx.InvoiceRequest, pdf []byte) error {
+	inv, err := archive.NewInvoice(req, pdf)
+	if err != nil {
+		return err
+	}
+	return store.Put(context.Background(), inv)
+}
+
+// sendEmail mails the invoice PDF using the FACTURX_SMTP_HOST, _PORT, _USER,
+// _PASSWORD and _FROM environment variables.
+func sendEmail(to []string, lang string, req facturx.InvoiceRequest, pdf []byte) error {
+	s := &mail.Sender{
+		SMTP: mail.SMTPConfig{
+			Host:     os.Getenv("FACTURX_SMTP_HOST"),
+			Username: os.Getenv("FACTURX_SMTP_USER"),
+			Password: os.Getenv("FACTURX_SMTP_PASSWORD"),
+		},
+		From: os.Getenv("FACTURX_SMTP_FROM"),
+		Lang: lang,
+	}
+	if s.SMTP.Host == "" || s.From == "" {
+		return errors.New("-email requires FACTURX_SMTP_HOST and FACTURX_SMTP_FROM")
+	}
+	if port := os.Getenv("FACTURX_SMTP_PORT"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("invalid FACTURX_SMTP_PORT %q", port)
+		}
+		s.SMTP.Port = n
+	}
+	for i := range to {
+		to[i] = strings.TrimSpace(to[i])
+	}
+	if err := s.SendInvoice(to, req, pdf); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "sent to %s\n", strings.Join(to, ", "))
+	return nil
+}
+
+// readInvoice reads a JSON invoice, or an EN 16931 UBL invoice to make
+// hybrid, from a file, or stdin for "-".
+func readInvoice(path string) (facturx.InvoiceRequest, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return facturx.InvoiceRequest{}, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		req, err := facturx.ParseUBL(data)
+		if err != nil {
+			return facturx.InvoiceRequest{}, fmt.Errorf("%s: %w", path, err)
+		}
+		return *req, nil
+	}
+	return decodeInvoiceJSON(bytes.NewReader(data), path)
+}
+
+// decodeInvoiceJSON decodes a JSON invoice read from the named file.
+func decodeInvoiceJSON(r io.Reader, path string) (facturx.InvoiceRequest, error) {
+	var req api.GenerateRequest
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return facturx.InvoiceRequest{}, fmt.Errorf("%s: invalid JSON: %w", path, err)
+	}
+	return req.ToInvoiceRequest()
+}
+
+// reorderArgs moves flags before positional arguments, so that
+// "generate invoice.json -o out.pdf" works with the flag package.
+func reorderArgs(fs *flag.FlagSet, args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-" || !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		if strings.Contains(arg, "=") || i+1 == len(args) {
+			continue
+		}
+		// Non-boolean flags take their value from the next argument
+		f := fs.Lookup(strings.TrimLeft(arg, "-"))
+		if f == nil {
+			continue
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			flags = append(flags, args[i+1])
+			i++
+		}
+	}
+	return append(flags, positional...)
+}
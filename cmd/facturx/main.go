@@ -0,0 +1,64 @@
+// Command facturx generates Factur-X invoices from the command line.
+//
+// Usage:
+//
+//	facturx generate invoice.json [-o invoice.pdf] [-xml] [-email client@example.com]
+//	facturx generate invoice-ubl.xml [-o invoice.pdf]
+//	facturx embed visual.pdf invoice.json [-o facturx.pdf]
+//	facturx batch lines.csv [-out ./invoices/]
+//	facturx validate invoice.pdf [-format text|json|html] [-o report.html]
+//	facturx ubl invoice.pdf [-o invoice-ubl.xml]
+//
+// The input file uses the same JSON schema as the web API (see package
+// github.com/audrenbdb/facturx/api), or an EN 16931 UBL invoice to turn
+// into a Factur-X PDF. Use "-" to read it from stdin.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: facturx <command> [arguments]
+
+Commands:
+  generate   Generate a Factur-X PDF from a JSON or UBL invoice
+  embed      Attach the Factur-X XML of a JSON invoice to an existing PDF
+  batch      Generate one PDF per invoice from a CSV file
+  validate   Check a JSON invoice, a CII XML or a Factur-X PDF and write a report
+  ubl        Convert a Factur-X PDF or CII XML to an EN 16931 UBL invoice
+
+Run "facturx <command> -h" for command help.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = runGenerate(os.Args[2:])
+	case "embed":
+		err = runEmbed(os.Args[2:])
+	case "batch":
+		err = runBatch(os.Args[2:])
+	case "validate":
+		err = runValidate(os.Args[2:])
+	case "ubl":
+		err = runUBL(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "facturx: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "facturx: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// runUBL implements "facturx ubl".
+func runUBL(args []string) error {
+	fs := flag.NewFlagSet("ubl", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (default: <input>-ubl.xml)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: facturx ubl <invoice.pdf|invoice.xml|-> [-o file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(reorderArgs(fs, args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one input file")
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		if data, err = facturx.ExtractXML(data); err != nil {
+			return err
+		}
+	}
+	ubl, err := facturx.ConvertToUBL(data)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = "-"
+		if fs.Arg(0) != "-" {
+			path = strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + "-ubl.xml"
+		}
+	}
+	if path == "-" {
+		_, err = io.WriteString(os.Stdout, ubl)
+		return err
+	}
+	if err := os.WriteFile(path, []byte(ubl), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s written (%d bytes)\n", path, len(ubl))
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+)
+
+// runValidate implements "facturx validate".
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	output := fs.String("o", "-", "report file (default: stdout)")
+	format := fs.String("format", "text", "report format: text, json or html")
+	lang := fs.String("lang", "fr", "language of the HTML report headings: fr or en")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: facturx validate <invoice.json|invoice.xml|invoice.pdf|-> [-format text|json|html] [-o file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(reorderArgs(fs, args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one input file")
+	}
+	if *format != "text" && *format != "json" && *format != "html" {
+		return fmt.Errorf("unknown report format %q", *format)
+	}
+
+	result, err := validateFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	report := api.NewValidationReport(result)
+
+	var out bytes.Buffer
+	switch *format {
+	case "json":
+		err = report.WriteJSON(&out)
+	case "html":
+		err = report.WriteHTML(&out, *lang)
+	default:
+		writeTextReport(&out, report)
+	}
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		_, err = os.Stdout.Write(out.Bytes())
+	} else {
+		err = os.WriteFile(*output, out.Bytes(), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A non-zero exit status lets CI pipelines fail on invalid invoices
+	if !report.Valid {
+		return fmt.Errorf("%s: invalid invoice (%d error(s))", fs.Arg(0), len(report.Errors))
+	}
+	return nil
+}
+
+// validateFile validates a JSON invoice, a CII XML or a Factur-X PDF, told
+// apart by their content.
+func validateFile(path string) (facturx.ValidationResult, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return facturx.ValidationResult{}, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		req, err := decodeInvoiceJSON(bytes.NewReader(data), path)
+		if err != nil {
+			return facturx.ValidationResult{}, err
+		}
+		return facturx.Validate(&req), nil
+	}
+
+	var result facturx.ValidationResult
+
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		result, err = facturx.ValidatePDF(data)
+	} else {
+		result, err = facturx.ValidateXML(data)
+	}
+	if err != nil {
+		return facturx.ValidationResult{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return result, nil
+}
+
+// writeTextReport writes one line per finding, as "severity: field:
+// message", followed by the broken rule in brackets if known.
+func writeTextReport(w io.Writer, report api.ValidationReport) {
+	if report.Profile != "" {
+		fmt.Fprintf(w, "profile: %s\n", report.Profile)
+	}
+	for _, e := range report.Errors {
+		if e.Rule != "" {
+			fmt.Fprintf(w, "error: %s: %s [%s]\n", e.Field, e.Message, e.Rule)
+			continue
+		}
+		fmt.Fprintf(w, "error: %s: %s\n", e.Field, e.Message)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(w, "warning: %s: %s\n", warning.Field, warning.Message)
+	}
+	if report.Valid {
+		fmt.Fprintln(w, "valid")
+	}
+}
@@ -0,0 +1,222 @@
+// Package corpus generates a corpus of edge-case invoices: every VAT
+// regime, accented and XML-special text, very long descriptions, 1 to 500
+// lines and extreme amounts. It feeds tests, benchmarks and demos with
+// invoices that are valid yet exercise the limits of the library:
+//
+//	for _, c := range corpus.All() {
+//		if _, err := facturx.Generate(c.Request); err != nil {
+//			t.Errorf("%s: %v", c.Name, err)
+//		}
+//	}
+//
+// The corpus is deterministic: the same invoices are generated on every
+// call, with fixed dates, so they can be pinned in golden files.
+package corpus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// Case is an invoice of the corpus.
+type Case struct {
+	// Name identifies the case, e.g. "lines-500".
+	Name string `json:"name"`
+	// Description tells which edge case the invoice covers.
+	Description string `json:"description"`
+	// Request is the invoice.
+	Request facturx.InvoiceRequest `json:"-"`
+}
+
+// IssueDate is the issue date of every invoice of the corpus; they are due
+// 30 days later.
+var IssueDate = time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+// LineCounts are the line counts of the "lines-N" cases.
+var LineCounts = []int{1, 10, 50, 100, 500}
+
+// All returns the whole corpus, in a stable order.
+func All() []Case {
+	cases := []Case{
+		{"vat-standard", "Taux normal de 20 %", invoice("vat-standard", facturx.VatStandard(20), Lines(3))},
+		{"vat-intermediate", "Taux intermédiaire de 10 %", invoice("vat-intermediate", facturx.VatStandard(10), Lines(3))},
+		{"vat-reduced", "Taux réduit de 5,5 %", invoice("vat-reduced", facturx.VatStandard(5.5), Lines(3))},
+		{"vat-super-reduced", "Taux particulier de 2,1 %", invoice("vat-super-reduced", facturx.VatStandard(2.1), Lines(3))},
+		{"vat-franchise", "Franchise en base d'un entrepreneur individuel", franchise()},
+		{"vat-exempt-health", "Exonération des professions de santé", health()},
+		{"vat-reverse-charge", "Autoliquidation pour un client allemand", reverseCharge()},
+		{"vat-margin", "Régime de la marge d'un marchand de biens d'occasion", invoice("vat-margin", facturx.VatMarginScheme(), Lines(3))},
+		{"accents", "Accents, ligatures, guillemets et caractères spéciaux XML", accents()},
+		{"long-description", "Désignations et raisons sociales très longues", longDescription()},
+		{"amounts-large", "Montants proches du milliard d'euros", largeAmounts()},
+		{"amounts-small", "Centimes, quantités fractionnaires et arrondis", smallAmounts()},
+		{"amounts-negative", "Lignes d'avoir déduites d'une facture", negativeAmounts()},
+	}
+	for _, n := range LineCounts {
+		name := fmt.Sprintf("lines-%d", n)
+		cases = append(cases, Case{name, fmt.Sprintf("Facture de %d ligne(s)", n), invoice(name, facturx.VatStandard(20), Lines(n))})
+	}
+	return cases
+}
+
+// Get returns the case with the given name.
+func Get(name string) (Case, bool) {
+	for _, c := range All() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Case{}, false
+}
+
+// products are the designations, unit prices and quantities Lines cycles
+// through.
+var products = []struct {
+	description string
+	unitPrice   float64
+	quantity    float64
+}{
+	{"Prestation de conseil", 650, 2},
+	{"Développement logiciel (jour-homme)", 540, 5},
+	{"Licence annuelle", 1200, 1},
+	{"Câble réseau Cat. 6 – 3 m", 7.9, 25},
+	{"Hébergement mensuel", 49.99, 12},
+	{"Déplacement (forfait kilométrique)", 0.636, 180},
+	{"Formation « Factur-X en pratique »", 1450, 1},
+	{"Maintenance corrective", 95, 3.5},
+}
+
+// Lines returns n invoice lines, cycling through a catalogue of products
+// with varying quantities and prices. Descriptions are numbered so that
+// every line is distinct.
+func Lines(n int) []facturx.InvoiceLine {
+	lines := make([]facturx.InvoiceLine, n)
+	for i := range lines {
+		p := products[i%len(products)]
+		lines[i] = facturx.InvoiceLine{
+			Description: fmt.Sprintf("%s n° %d", p.description, i+1),
+			Quantity:    p.quantity + float64(i/len(products)),
+			UnitPrice:   p.unitPrice,
+		}
+	}
+	return lines
+}
+
+// invoice returns an invoice between two French companies.
+func invoice(name string, regime facturx.VatRegime, lines []facturx.InvoiceLine) facturx.InvoiceRequest {
+	return facturx.InvoiceRequest{
+		Number:    "CORPUS-" + strings.ToUpper(name),
+		IssueDate: IssueDate,
+		DueDate:   IssueDate.AddDate(0, 0, 30),
+		Seller: facturx.Contact{
+			Name:        "ACME Corp",
+			Address:     "123 Rue de Paris",
+			ZipCode:     "75001",
+			City:        "Paris",
+			CountryCode: "FR",
+			Siret:       "52825000400033",
+			VatNumber:   "FR12345678901",
+		},
+		Buyer: facturx.Contact{
+			Name:        "Client SA",
+			Address:     "456 Avenue des Champs",
+			ZipCode:     "69001",
+			City:        "Lyon",
+			CountryCode: "FR",
+			Siret:       "35600000000048",
+			VatNumber:   "FR98765432109",
+		},
+		Lines:  lines,
+		Regime: regime,
+	}
+}
+
+func franchise() facturx.InvoiceRequest {
+	req := invoice("vat-franchise", facturx.VatFranchiseAuto(), Lines(2))
+	req.Seller.Name = "Jeanne Martin"
+	req.Seller.VatNumber = ""
+	req.AddEISuffix = true
+	return req
+}
+
+func health() facturx.InvoiceRequest {
+	req := invoice("vat-exempt-health", facturx.VatExemptHealth(), []facturx.InvoiceLine{
+		{Description: "Séance de kinésithérapie", Quantity: 10, UnitPrice: 16.13},
+		{Description: "Bilan-diagnostic kinésithérapique", Quantity: 1, UnitPrice: 48.3},
+	})
+	req.Seller.Name = "Cabinet de kinésithérapie Dupré"
+	req.Seller.VatNumber = ""
+	req.Seller.ProfessionalIds = []facturx.ProfessionalId{{Type: "RPPS", Value: "10101234567"}}
+	req.Buyer = facturx.Contact{Name: "Éloïse Lefèvre", Address: "8 rue des Lilas", ZipCode: "33000", City: "Bordeaux", CountryCode: "FR"}
+	return req
+}
+
+func reverseCharge() facturx.InvoiceRequest {
+	req := invoice("vat-reverse-charge", facturx.VatReverseCharge(), Lines(3))
+	req.Buyer = facturx.Contact{
+		Name:        "Müller & Söhne GmbH",
+		Address:     "Königstraße 12",
+		ZipCode:     "70173",
+		City:        "Stuttgart",
+		CountryCode: "DE",
+		VatNumber:   "DE123456789",
+	}
+	return req
+}
+
+func accents() facturx.InvoiceRequest {
+	req := invoice("accents", facturx.VatStandard(20), []facturx.InvoiceLine{
+		{Description: "Œuvre d'art « L'été à Noël » – édition n°1", Quantity: 1, UnitPrice: 850},
+		{Description: "Crème brûlée & pâtisseries <assortiment> pour 12 personnes", Quantity: 2, UnitPrice: 42.5},
+		{Description: "Cœur de bœuf, maïs, ÇA VA ? Ÿ, Æ, ß, €, ‰, “guillemets”", Quantity: 3, UnitPrice: 9.99},
+		{Description: `Apostrophes ' ’ et "doubles" ; chevrons < > ; esperluette &amp;`, Quantity: 1, UnitPrice: 1},
+	})
+	req.Seller.Name = "Société Française d'Édition & Cie"
+	req.Seller.Address = "12 bis, allée des Châtaigniers"
+	req.Buyer.Name = "L'Œil de Bœuf – Café-Théâtre"
+	req.Buyer.City = "Saint-Étienne"
+	req.Buyer.ZipCode = "42000"
+	req.CustomMentions = "Pénalités de retard : trois fois le taux d'intérêt légal.\nIndemnité forfaitaire pour frais de recouvrement : 40 €."
+	return req
+}
+
+func longDescription() facturx.InvoiceRequest {
+	long := strings.Repeat("Intégration, paramétrage et recette de la chaîne de facturation électronique conforme Factur-X, ", 10)
+	req := invoice("long-description", facturx.VatStandard(20), []facturx.InvoiceLine{
+		{Description: strings.TrimSpace(long), Quantity: 1, UnitPrice: 12500},
+		{Description: strings.Repeat("Désignationsansespacesuffisammentlonguepourdépasserlacolonne", 3), Quantity: 2, UnitPrice: 75},
+		{Description: "Ligne courte", Quantity: 1, UnitPrice: 10},
+	})
+	req.Seller.Name = "Compagnie Générale des Établissements de Conseil en Systèmes d'Information et en Transformation Numérique"
+	req.Buyer.Name = "Association Départementale pour la Promotion des Activités Culturelles, Sportives et de Loisirs des Jeunes"
+	req.OrderRef = strings.Repeat("BC-2024-", 5) + "0001"
+	return req
+}
+
+func largeAmounts() facturx.InvoiceRequest {
+	return invoice("amounts-large", facturx.VatStandard(20), []facturx.InvoiceLine{
+		{Description: "Construction d'un ensemble immobilier", Quantity: 1, UnitPrice: 987654321.98},
+		{Description: "Fourniture en gros volume", Quantity: 1000000, UnitPrice: 12.34},
+		{Description: "Article à très grande quantité", Quantity: 99999999, UnitPrice: 0.01},
+	})
+}
+
+func smallAmounts() facturx.InvoiceRequest {
+	return invoice("amounts-small", facturx.VatStandard(20), []facturx.InvoiceLine{
+		{Description: "Article à un centime", Quantity: 1, UnitPrice: 0.01},
+		{Description: "Tiers d'unité (arrondi)", Quantity: 3, UnitPrice: 0.333},
+		{Description: "Quantité fractionnaire", Quantity: 0.125, UnitPrice: 7.77},
+		{Description: "Prix unitaire à quatre décimales", Quantity: 7, UnitPrice: 0.0125},
+	})
+}
+
+func negativeAmounts() facturx.InvoiceRequest {
+	return invoice("amounts-negative", facturx.VatStandard(20), []facturx.InvoiceLine{
+		{Description: "Prestation de conseil", Quantity: 10, UnitPrice: 650},
+		{Description: "Avoir sur la facture FA-2023-118", Quantity: -1, UnitPrice: 1300},
+		{Description: "Retour de marchandise", Quantity: -2.5, UnitPrice: 19.9},
+	})
+}
@@ -0,0 +1,47 @@
+package corpus
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/audrenbdb/facturx"
+)
+
+func TestGenerateVerified(t *testing.T) {
+	for _, c := range All() {
+		t.Run(c.Name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := facturx.GenerateVerified(c.Request); err != nil {
+				t.Errorf("GenerateVerified: %v", err)
+			}
+		})
+	}
+}
+
+func TestCases(t *testing.T) {
+	seen := map[string]bool{}
+	for _, c := range All() {
+		if seen[c.Name] {
+			t.Errorf("duplicate case %s", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Description == "" {
+			t.Errorf("%s: no description", c.Name)
+		}
+		if got, ok := Get(c.Name); !ok || got.Request.Number != c.Request.Number {
+			t.Errorf("Get(%s) = %v, %v", c.Name, got.Name, ok)
+		}
+		if !c.Request.IssueDate.Equal(IssueDate) {
+			t.Errorf("%s: issued on %v", c.Name, c.Request.IssueDate)
+		}
+	}
+	for _, n := range LineCounts {
+		c, ok := Get(fmt.Sprintf("lines-%d", n))
+		if !ok || len(c.Request.Lines) != n {
+			t.Errorf("lines-%d: %d lines", n, len(c.Request.Lines))
+		}
+	}
+	if _, ok := Get("missing"); ok {
+		t.Error("Get(missing) found a case")
+	}
+}
@@ -0,0 +1,234 @@
+// Package csvimport reads invoices from CSV files, as used by "facturx
+// batch" and the web server's CSV upload.
+//
+// The first row names the columns (any order, case-insensitive, unknown
+// columns ignored); each following row is one invoice line. Rows sharing
+// the same number form one invoice, whose invoice-level columns are read
+// from its first row:
+//
+//	number, date (YYYY-MM-DD), due_date, note, iban,
+//	seller_name, seller_siret, seller_siren, seller_rcs, seller_vat,
+//	seller_street, seller_postal_code, seller_city,
+//	buyer_name, buyer_siret, buyer_siren, buyer_rcs, buyer_vat,
+//	buyer_street, buyer_postal_code, buyer_city,
+//	description, quantity, unit_price, vat_regime
+//
+// number, date, description, quantity and unit_price are required. The
+// separator is ',' or ';', detected from the header by default. Decimal
+// commas are accepted ("12,50"). vat_regime uses the codes of package api
+// (0 = 20%, 4 = franchise en base, ...).
+package csvimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+)
+
+// RequiredColumns are the columns every CSV file must have.
+var RequiredColumns = []string{"number", "date", "description", "quantity", "unit_price"}
+
+// Invoice is an invoice assembled from CSV rows.
+type Invoice struct {
+	Number string
+	// Line is the CSV line of the invoice's first row.
+	Line int
+	// Request is the invoice, valid only when Errors is empty.
+	Request facturx.InvoiceRequest
+	// Errors lists the invalid rows of the invoice (as *RowError), or the
+	// error converting it to a request.
+	Errors []error
+}
+
+// Err returns the invoice errors joined, or nil.
+func (inv Invoice) Err() error {
+	return errors.Join(inv.Errors...)
+}
+
+// RowError is an invalid value in a CSV row.
+type RowError struct {
+	Line   int
+	Column string
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: invalid %s: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Read parses a CSV file into invoices, in order of first appearance.
+// sep is the field separator, 0 to detect it. Invalid rows are reported in
+// the invoice they belong to, and malformed CSV records as an invoice of
+// their own without number; an error is returned only for an unreadable
+// file or header.
+func Read(r io.Reader, sep rune) ([]Invoice, error) {
+	br := bufio.NewReader(r)
+	if sep == 0 {
+		header, _ := br.Peek(4096)
+		if line, _, _ := bytes.Cut(header, []byte("\n")); bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+			sep = ';'
+		} else {
+			sep = ','
+		}
+	}
+
+	cr := csv.NewReader(br)
+	cr.Comma = sep
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csvimport: reading header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range RequiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csvimport: missing required column %q", name)
+		}
+	}
+
+	var invoices []Invoice
+	var reqs []api.GenerateRequest
+	index := make(map[string]int)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// A malformed record cannot be attributed to an invoice:
+			// report it on its own and read on
+			invoices = append(invoices, Invoice{Line: parseErr.Line, Errors: []error{
+				&RowError{Line: parseErr.Line, Column: "CSV record", Err: parseErr.Err},
+			}})
+			reqs = append(reqs, api.GenerateRequest{})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csvimport: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		number := get("number")
+		if number == "" {
+			invoices = append(invoices, Invoice{Line: line, Errors: []error{
+				&RowError{Line: line, Column: "number", Err: errors.New("empty value")},
+			}})
+			reqs = append(reqs, api.GenerateRequest{})
+			continue
+		}
+		i, ok := index[number]
+		if !ok {
+			i = len(invoices)
+			index[number] = i
+			invoices = append(invoices, Invoice{Number: number, Line: line})
+			reqs = append(reqs, invoiceRequest(get))
+		}
+
+		lineJSON, err := parseLine(line, get)
+		if err != nil {
+			invoices[i].Errors = append(invoices[i].Errors, err)
+			continue
+		}
+		reqs[i].Lines = append(reqs[i].Lines, lineJSON)
+	}
+
+	for i := range invoices {
+		if len(invoices[i].Errors) > 0 {
+			continue
+		}
+		req, err := reqs[i].ToInvoiceRequest()
+		if err != nil {
+			invoices[i].Errors = []error{err}
+			continue
+		}
+		invoices[i].Request = req
+	}
+	return invoices, nil
+}
+
+// invoiceRequest reads the invoice-level columns of a CSV row.
+func invoiceRequest(get func(string) string) api.GenerateRequest {
+	contact := func(prefix string) api.ContactJSON {
+		return api.ContactJSON{Contact: facturx.Contact{
+			Name:      get(prefix + "_name"),
+			Siret:     get(prefix + "_siret"),
+			Siren:     get(prefix + "_siren"),
+			RCS:       get(prefix + "_rcs"),
+			VatNumber: get(prefix + "_vat"),
+			Address:   get(prefix + "_street"),
+			ZipCode:   get(prefix + "_postal_code"),
+			City:      get(prefix + "_city"),
+		}}
+	}
+	return api.GenerateRequest{
+		Number: get("number"),
+		Date:   get("date"),
+		Note:   get("note"),
+		Seller: contact("seller"),
+		Buyer:  contact("buyer"),
+		PaymentTerms: api.PaymentJSON{
+			DueDate: get("due_date"),
+			IBAN:    get("iban"),
+		},
+	}
+}
+
+// parseLine reads the invoice line columns of a CSV row.
+func parseLine(line int, get func(string) string) (api.LineJSON, error) {
+	quantity, err := parseDecimal(get("quantity"))
+	if err != nil {
+		return api.LineJSON{}, &RowError{Line: line, Column: "quantity", Err: err}
+	}
+	price, err := parseDecimal(get("unit_price"))
+	if err != nil {
+		return api.LineJSON{}, &RowError{Line: line, Column: "unit_price", Err: err}
+	}
+	l := api.LineJSON{InvoiceLine: facturx.InvoiceLine{
+		Description: get("description"),
+		Quantity:    quantity,
+		UnitPrice:   price,
+	}}
+	if s := get("vat_regime"); s != "" {
+		regime, err := strconv.Atoi(s)
+		if err != nil {
+			return api.LineJSON{}, &RowError{Line: line, Column: "vat_regime", Err: fmt.Errorf("%q is not a regime code", s)}
+		}
+		l.VATRegime = &regime
+	}
+	return l, nil
+}
+
+// parseDecimal parses a number written with a decimal point or comma.
+// NaN, infinities and out of range values are rejected.
+func parseDecimal(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.Replace(strings.ReplaceAll(s, " ", ""), ",", ".", 1), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return f, nil
+}
@@ -0,0 +1,134 @@
+package csvimport
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const header = "number,date,seller_name,seller_siret,buyer_name,description,quantity,unit_price\n"
+
+// row returns a CSV row of a valid invoice line.
+func row(number, date, quantity string) string {
+	return number + "," + date + ",ACME Corp,52825000400033,Client SA,Conseil," + quantity + ",100\n"
+}
+
+func TestReadSeparator(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		sep  rune
+	}{
+		{"comma", header + row("F-1", "2024-01-15", "2"), 0},
+		{"semicolon", strings.ReplaceAll(header+row("F-1", "2024-01-15", "2"), ",", ";"), 0},
+		{"decimal comma", strings.ReplaceAll(header, ",", ";") + "F-1;2024-01-15;ACME Corp;52825000400033;Client SA;Conseil;2,5;100\n", 0},
+		{"explicit", strings.ReplaceAll(header+row("F-1", "2024-01-15", "2"), ",", "\t"), '\t'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoices, err := Read(strings.NewReader(tt.csv), tt.sep)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if len(invoices) != 1 || invoices[0].Err() != nil {
+				t.Fatalf("Expected one valid invoice, got %+v", invoices)
+			}
+			if lines := invoices[0].Request.Lines; len(lines) != 1 || lines[0].Description != "Conseil" || lines[0].UnitPrice != 100 {
+				t.Errorf("Unexpected lines %+v", lines)
+			}
+		})
+	}
+}
+
+func TestReadGroupsLines(t *testing.T) {
+	csv := header + row("F-1", "2024-01-15", "1") + row("F-2", "2024-01-16", "2") + row("F-1", "2024-01-15", "3")
+	invoices, err := Read(strings.NewReader(csv), 0)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(invoices) != 2 {
+		t.Fatalf("Expected 2 invoices, got %d", len(invoices))
+	}
+	tests := []struct {
+		number     string
+		line       int
+		quantities []float64
+	}{
+		{"F-1", 2, []float64{1, 3}},
+		{"F-2", 3, []float64{2}},
+	}
+	for i, tt := range tests {
+		inv := invoices[i]
+		if inv.Number != tt.number || inv.Line != tt.line || inv.Err() != nil {
+			t.Errorf("Invoice %d = %s line %d (%v), want %s line %d", i, inv.Number, inv.Line, inv.Err(), tt.number, tt.line)
+			continue
+		}
+		var got []float64
+		for _, l := range inv.Request.Lines {
+			got = append(got, l.Quantity)
+		}
+		if !slices.Equal(got, tt.quantities) {
+			t.Errorf("%s quantities = %v, want %v", tt.number, got, tt.quantities)
+		}
+	}
+}
+
+func TestReadMissingColumn(t *testing.T) {
+	for _, column := range RequiredColumns {
+		t.Run(column, func(t *testing.T) {
+			fields := strings.Split(strings.TrimSpace(header), ",")
+			var kept []string
+			for _, f := range fields {
+				if f != column {
+					kept = append(kept, f)
+				}
+			}
+			_, err := Read(strings.NewReader(strings.Join(kept, ",")+"\n"), 0)
+			if err == nil || !strings.Contains(err.Error(), `"`+column+`"`) {
+				t.Errorf("Expected a missing column error for %s, got %v", column, err)
+			}
+		})
+	}
+}
+
+func TestReadRowErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		bad    string
+		line   int
+		column string
+	}{
+		{"bad number", row("F-1", "2024-01-15", "deux"), 2, "quantity"},
+		{"NaN quantity", row("F-1", "2024-01-15", "NaN"), 2, "quantity"},
+		{"infinite unit price", "F-1,2024-01-15,ACME Corp,52825000400033,Client SA,Conseil,2,Inf\n", 2, "unit_price"},
+		{"out of range number", row("F-1", "2024-01-15", "1e400"), 2, "quantity"},
+		{"bad date", row("F-1", "15/01/2024", "2"), 0, ""},
+		{"empty number", row("", "2024-01-15", "2"), 2, "number"},
+		{"CSV syntax", `F-1,2024-01-15,ACME "Corp",52825000400033,Client SA,Conseil,2,100` + "\n", 2, "CSV record"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csv := header + tt.bad + row("F-2", "2024-01-16", "1") + row("F-3", "2024-01-17", "1")
+			invoices, err := Read(strings.NewReader(csv), 0)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if len(invoices) != 3 {
+				t.Fatalf("Expected 3 invoices, got %d", len(invoices))
+			}
+			if invoices[0].Err() == nil {
+				t.Fatal("Expected an error on the first invoice")
+			}
+			var rowErr *RowError
+			if tt.column != "" && (!errors.As(invoices[0].Err(), &rowErr) || rowErr.Line != tt.line || rowErr.Column != tt.column) {
+				t.Errorf("Expected a row error on line %d column %s, got %v", tt.line, tt.column, invoices[0].Err())
+			}
+			for _, inv := range invoices[1:] {
+				if inv.Err() != nil || len(inv.Request.Lines) != 1 {
+					t.Errorf("Invoice %s should import despite the bad row: %v", inv.Number, inv.Err())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package facturx
+
+import "time"
+
+// Date layouts used by the library. Every date string is parsed and formatted
+// through the helpers below so that the XML (CII format code 102) and the PDF
+// (French DD/MM/YYYY) always agree.
+const (
+	ciiDateLayout     = "20060102"
+	displayDateLayout = "02/01/2006"
+)
+
+// parseCIIDate parses a YYYYMMDD date (CII format code 102).
+func parseCIIDate(s string) (time.Time, error) {
+	return time.Parse(ciiDateLayout, s)
+}
+
+// formatCIIDate formats a date as YYYYMMDD (CII format code 102).
+func formatCIIDate(t time.Time) string {
+	return t.Format(ciiDateLayout)
+}
+
+// parseDisplayDate parses a DD/MM/YYYY date as shown on the PDF.
+func parseDisplayDate(s string) (time.Time, error) {
+	return time.Parse(displayDateLayout, s)
+}
+
+// formatDisplayDate formats a date as DD/MM/YYYY for the PDF.
+func formatDisplayDate(t time.Time) string {
+	return t.Format(displayDateLayout)
+}
+
+// ciiToDisplayDate converts a YYYYMMDD date to DD/MM/YYYY.
+// The input is returned unchanged if it cannot be parsed.
+func ciiToDisplayDate(s string) string {
+	t, err := parseCIIDate(s)
+	if err != nil {
+		return s
+	}
+	return formatDisplayDate(t)
+}
+
+// normalizeDates returns a copy of req where the time.Time fields are
+// reflected into their legacy string counterparts. When both are set, the
+// time.Time value wins. The caller's Payment and Lines are never modified.
+func normalizeDates(req InvoiceRequest) InvoiceRequest {
+	if !req.IssueDate.IsZero() {
+		req.Date = formatCIIDate(req.IssueDate)
+	}
+
+	if req.Payment != nil && !req.Payment.PaidOn.IsZero() {
+		payment := *req.Payment
+		payment.Date = formatDisplayDate(payment.PaidOn)
+		req.Payment = &payment
+	}
+
+	if hasServiceDates(req.Lines) {
+		lines := make([]InvoiceLine, len(req.Lines))
+		copy(lines, req.Lines)
+		for i := range lines {
+			if !lines[i].ServiceDate.IsZero() {
+				lines[i].Date = formatDisplayDate(lines[i].ServiceDate)
+			}
+		}
+		req.Lines = lines
+	}
+
+	return req
+}
+
+// hasServiceDates reports whether any line carries a time.Time service date.
+func hasServiceDates(lines []InvoiceLine) bool {
+	for _, line := range lines {
+		if !line.ServiceDate.IsZero() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package facturx
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// amount is a monetary value stored as an integer number of cents.
+//
+// All invoice totals are computed with amounts so that the values written to
+// the XML follow the EN 16931 BR-CO rules exactly: the sum of the rounded line
+// amounts is the line total, and no float64 drift (e.g. 3 × 0.1) can creep in.
+type amount int64
+
+// String formats the amount with 2 decimal places (e.g. "-12.05").
+func (a amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	cents := v % 100
+	s := sign + strconv.FormatInt(v/100, 10) + "."
+	if cents < 10 {
+		s += "0"
+	}
+	return s + strconv.FormatInt(cents, 10)
+}
+
+// Float returns the amount in EUR as a float64 (for display only).
+func (a amount) Float() float64 {
+	return float64(a) / 100
+}
+
+// toAmount rounds a float64 EUR value to the nearest cent.
+func toAmount(v float64) amount {
+	return amount(roundRat(mulPow10(exactDecimal(v), 2)).Int64())
+}
+
+// lineNetAmount computes quantity × unit price rounded to the cent.
+// Quantity and price are first rounded to the 4 decimals written in the XML,
+// so the line amount can be recomputed from the document itself.
+func lineNetAmount(quantity, unitPrice float64) amount {
+	q := roundedDecimal(quantity, 4)
+	p := roundedDecimal(unitPrice, 4)
+	product := new(big.Rat).Mul(q, p)
+	return amount(roundRat(mulPow10(product, 2)).Int64())
+}
+
+// percentOf computes base × rate / 100 rounded to the cent.
+func percentOf(base amount, rate float64) amount {
+	r := new(big.Rat).Mul(big.NewRat(int64(base), 100), exactDecimal(rate))
+	r.Quo(r, big.NewRat(100, 1))
+	return amount(roundRat(mulPow10(r, 2)).Int64())
+}
+
+// exactDecimal returns the shortest decimal representation of v as a rational,
+// so that 0.1 is exactly 1/10 rather than its binary approximation.
+func exactDecimal(v float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(v, 'f', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// roundedDecimal returns v rounded to the given number of decimal places.
+func roundedDecimal(v float64, digits int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n := roundRat(mulPow10(exactDecimal(v), digits))
+	return new(big.Rat).SetFrac(n, scale)
+}
+
+// mulPow10 returns r × 10^digits.
+func mulPow10(r *big.Rat, digits int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	return new(big.Rat).Mul(r, new(big.Rat).SetInt(scale))
+}
+
+// roundRat rounds r to the nearest integer, halves away from zero.
+func roundRat(r *big.Rat) *big.Int {
+	num, den := r.Num(), r.Denom()
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	m.Abs(m).Lsh(m, 1)
+	if m.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
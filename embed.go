@@ -0,0 +1,470 @@
+package facturx
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Embed attaches the Factur-X XML generated from req to an existing PDF,
+// typically an invoice laid out with another tool. The document is
+// rewritten with the factur-x.xml attachment, /AF entry, Factur-X XMP
+// metadata and an sRGB output intent (when it has none).
+//
+// Embed does not make the visual PDF PDF/A-3 compliant by itself: fonts
+// must already be embedded and forbidden features (transparency groups,
+// JavaScript, ...) absent. Existing attachments are replaced by
+// factur-x.xml and the supplements of req, and any
+// digital signature is invalidated by the rewrite; use EmbedIncremental
+// for signed documents. Encrypted PDFs are rejected with ErrPDF.
+func Embed(pdf []byte, req InvoiceRequest) ([]byte, error) {
+	return embed(pdf, req, false)
+}
+
+// EmbedIncremental is like Embed, but appends the attachment, metadata and
+// updated catalog to the unchanged original bytes as an incremental
+// update, so that digital signatures applied to the visual PDF remain
+// valid. The update uses a cross-reference stream when the document does;
+// req.ObjectStreams is ignored.
+//
+// The signed bytes are left untouched, but readers may still flag a
+// certification signature (DocMDP) whose permissions exclude adding
+// attachments.
+func EmbedIncremental(pdf []byte, req InvoiceRequest) ([]byte, error) {
+	return embed(pdf, req, true)
+}
+
+func embed(pdf []byte, req InvoiceRequest, incremental bool) ([]byte, error) {
+	req = normalizeDates(req)
+	if err := Validate(&req).Err(); err != nil {
+		return nil, err
+	}
+
+	doc, err := readPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	xmlContent, err := generateCIIXML(&req)
+	if err != nil {
+		return nil, err
+	}
+	return embedXML(doc, &req, xmlContent, incremental)
+}
+
+// embedXML rewrites doc with the Factur-X attachment and metadata, or
+// appends them to it when incremental.
+func embedXML(doc *pdfDocument, req *InvoiceRequest, xmlContent string, incremental bool) ([]byte, error) {
+	catalog, rootNum, err := doc.catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the existing objects, dropping the cross-reference and object
+	// streams: their content is rewritten as plain objects. An incremental
+	// update only holds the new and changed objects.
+	var objects []pdfObject
+	nextNum := 1
+	for _, num := range doc.objectNumbers() {
+		if num >= nextNum {
+			nextNum = num + 1
+		}
+		if num == rootNum || incremental {
+			continue
+		}
+		v, err := doc.object(num)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := v.(*pdfStream); ok {
+			if t := s.dict["Type"]; t == pdfName("XRef") || t == pdfName("ObjStm") {
+				continue
+			}
+		}
+		objects = append(objects, rawObject(num, doc.xref[num].gen, v))
+	}
+	if size, ok := doc.trailer["Size"].(int); ok && size > nextNum {
+		nextNum = size
+	}
+	alloc := func() int {
+		nextNum++
+		return nextNum - 1
+	}
+
+	// New objects: info, XMP metadata, attachment and output intent
+	infoNum := alloc()
+	created := creationTime(req)
+	objects = append(objects, pdfObject{num: infoNum, content: []byte(infoDict(req, created))})
+
+	xmp := generateXMPMetadata(req, created)
+	metadataNum := alloc()
+	objects = append(objects, pdfObject{
+		num:     metadataNum,
+		content: []byte(fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>", len(xmp))),
+		stream:  []byte(xmp),
+	})
+
+	xmlBytes := []byte(xmlContent)
+	fileNum, filespecNum := alloc(), alloc()
+	objects = append(objects,
+		pdfObject{num: fileNum, content: []byte(embeddedFileDict(req, xmlBytes)), stream: xmlBytes},
+		pdfObject{num: filespecNum, content: []byte(filespecDict(req, fileNum))},
+	)
+
+	af := pdfArray{pdfRef{num: filespecNum}}
+	files := []attachment{{name: specOf(req).fileName, filespecNum: filespecNum}}
+	for _, s := range req.Supplements {
+		fileNum, specNum := alloc(), alloc()
+		objects = append(objects,
+			pdfObject{num: fileNum, content: []byte(s.fileDict(req.Date)), stream: s.Data},
+			pdfObject{num: specNum, content: []byte(s.filespecDict(fileNum))},
+		)
+		af = append(af, pdfRef{num: specNum})
+		files = append(files, attachment{name: s.FileName, filespecNum: specNum})
+	}
+	sortAttachments(files)
+	var nameTree pdfArray
+	for _, f := range files {
+		nameTree = append(nameTree, pdfString(f.name), pdfRef{num: f.filespecNum})
+	}
+
+	if _, ok := catalog["OutputIntents"]; !ok {
+		if err := loadStaticResources(); err != nil {
+			return nil, err
+		}
+		iccNum, intentNum := alloc(), alloc()
+		objects = append(objects,
+			pdfObject{num: iccNum, content: staticICC.content, stream: staticICC.stream},
+			pdfObject{num: intentNum, content: []byte(fmt.Sprintf(outputIntentFormat, iccNum))},
+		)
+		catalog["OutputIntents"] = pdfArray{pdfRef{num: intentNum}}
+	}
+
+	// Updated catalog, keeping other name trees (destinations, ...)
+	names := make(pdfDict)
+	if existing, err := doc.resolve(catalog["Names"]); err == nil {
+		if d, ok := existing.(pdfDict); ok {
+			for k, v := range d {
+				names[k] = v
+			}
+		}
+	}
+	names["EmbeddedFiles"] = pdfDict{"Names": nameTree}
+	catalog["Names"] = names
+	catalog["AF"] = af
+	catalog["Metadata"] = pdfRef{num: metadataNum}
+	objects = append(objects, rawObject(rootNum, doc.xref[rootNum].gen, catalog))
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].num < objects[j].num })
+
+	id := generateFileID(fmt.Sprintf("%s_%s", req.Number, req.Date))
+	if ids, ok := doc.trailer["ID"].(pdfArray); ok && len(ids) == 2 {
+		if first, ok := ids[0].(pdfString); ok {
+			id = fmt.Sprintf("%X", []byte(first))
+		}
+	}
+	trailer := fmt.Sprintf("/Root %d %d R /Info %d 0 R /ID [<%s> <%s>]",
+		rootNum, doc.xref[rootNum].gen, infoNum, id, generateFileID(id+req.Number))
+	if incremental {
+		return appendUpdate(doc, objects, nextNum, trailer), nil
+	}
+	if req.ObjectStreams {
+		return writeObjectStreamPDF(objects, trailer), nil
+	}
+	return writePDF(objects, fmt.Sprintf("<< /Size %d %s >>", nextNum, trailer)), nil
+}
+
+// appendUpdate appends objects, sorted by number, to the original file of
+// doc as an incremental update (ISO 32000-1, 7.5.6). Its cross-reference
+// section is of the same kind as the last one of doc and points back to
+// it; nextNum is the first unused object number.
+func appendUpdate(doc *pdfDocument, objects []pdfObject, nextNum int, trailer string) []byte {
+	var buf bytes.Buffer
+	buf.Write(doc.data)
+	if !bytes.HasSuffix(doc.data, []byte("\n")) && !bytes.HasSuffix(doc.data, []byte("\r")) {
+		buf.WriteByte('\n')
+	}
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		writeIndirect(&buf, obj)
+	}
+
+	trailer = fmt.Sprintf("%s /Prev %d", trailer, doc.startxref)
+	var xrefOffset int
+	if doc.trailer["Type"] == pdfName("XRef") {
+		rows := make(map[int]xrefRow, len(objects))
+		for i, obj := range objects {
+			rows[obj.num] = xrefRow{1, offsets[i], obj.gen}
+		}
+		xrefOffset = writeXRefStream(&buf, nextNum, rows, trailer)
+	} else {
+		xrefOffset = buf.Len()
+		buf.WriteString("xref\n")
+		writeXRefTable(&buf, objects, offsets)
+		fmt.Fprintf(&buf, "trailer\n<< /Size %d %s >>\n", nextNum, trailer)
+	}
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+// rawObject serializes a parsed object for rewriting. Stream lengths are
+// made direct, as the original /Length may reference another object.
+func rawObject(num, gen int, v pdfValue) pdfObject {
+	var buf bytes.Buffer
+	if s, ok := v.(*pdfStream); ok {
+		dict := make(pdfDict, len(s.dict))
+		for k, val := range s.dict {
+			dict[k] = val
+		}
+		dict["Length"] = len(s.data)
+		writePDFValue(&buf, dict)
+		return pdfObject{num: num, gen: gen, content: buf.Bytes(), stream: s.data}
+	}
+	writePDFValue(&buf, v)
+	return pdfObject{num: num, gen: gen, content: buf.Bytes()}
+}
+
+// writePDF writes a complete PDF file from objects sorted by number, which
+// need not be contiguous.
+func writePDF(objects []pdfObject, trailer string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	buf.Write([]byte("%\xE2\xE3\xCF\xD3\n"))
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		writeIndirect(&buf, obj)
+	}
+
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	writeXRefTable(&buf, objects, offsets)
+	fmt.Fprintf(&buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, xrefOffset)
+	return buf.Bytes()
+}
+
+// writeIndirect writes an indirect object.
+func writeIndirect(buf *bytes.Buffer, obj pdfObject) {
+	fmt.Fprintf(buf, "%d %d obj\n", obj.num, obj.gen)
+	buf.Write(obj.content)
+	if obj.stream != nil {
+		buf.WriteString("\nstream\n")
+		buf.Write(obj.stream)
+		buf.WriteString("\nendstream")
+	}
+	buf.WriteString("\nendobj\n")
+}
+
+// writeXRefTable writes the cross-reference entries of objects, sorted by
+// number and written at offsets, one subsection per run of consecutive
+// numbers.
+func writeXRefTable(buf *bytes.Buffer, objects []pdfObject, offsets []int) {
+	for start := 0; start < len(objects); {
+		end := start + 1
+		for end < len(objects) && objects[end].num == objects[end-1].num+1 {
+			end++
+		}
+		fmt.Fprintf(buf, "%d %d\n", objects[start].num, end-start)
+		for i := start; i < end; i++ {
+			fmt.Fprintf(buf, "%010d %05d n \n", offsets[i], objects[i].gen)
+		}
+		start = end
+	}
+}
+
+// objectsPerStream is the number of objects packed in each object stream.
+const objectsPerStream = 100
+
+// writeObjectStreamPDF is like writePDF, but packs the objects that are
+// not streams into compressed object streams, indexed by a cross-reference
+// stream (PDF 1.5). trailer holds the trailer entries other than /Size,
+// e.g. "/Root 1 0 R /ID [<...> <...>]".
+func writeObjectStreamPDF(objects []pdfObject, trailer string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	buf.Write([]byte("%\xE2\xE3\xCF\xD3\n"))
+
+	// Streams, and objects of another generation, stay direct
+	nextNum := 1
+	var packed []pdfObject
+	rows := make(map[int]xrefRow)
+	writeObject := func(obj pdfObject) {
+		rows[obj.num] = xrefRow{1, buf.Len(), obj.gen}
+		writeIndirect(&buf, obj)
+	}
+	for _, obj := range objects {
+		if obj.num >= nextNum {
+			nextNum = obj.num + 1
+		}
+		if obj.stream != nil || obj.gen != 0 {
+			writeObject(obj)
+			continue
+		}
+		packed = append(packed, obj)
+	}
+
+	for start := 0; start < len(packed); start += objectsPerStream {
+		chunk := packed[start:min(start+objectsPerStream, len(packed))]
+		stmNum := nextNum
+		nextNum++
+		var header, body bytes.Buffer
+		for i, obj := range chunk {
+			rows[obj.num] = xrefRow{2, stmNum, i}
+			fmt.Fprintf(&header, "%d %d ", obj.num, body.Len())
+			body.Write(obj.content)
+			body.WriteByte('\n')
+		}
+		data := flate(append(header.Bytes(), body.Bytes()...))
+		writeObject(pdfObject{
+			num:     stmNum,
+			content: []byte(fmt.Sprintf("<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>", len(chunk), header.Len(), len(data))),
+			stream:  data,
+		})
+	}
+
+	// Every number up to the cross-reference stream is listed, unused
+	// ones as free
+	xrefNum := nextNum
+	for num := 0; num < xrefNum; num++ {
+		if _, ok := rows[num]; !ok {
+			rows[num] = xrefRow{0, 0, 0}
+		}
+	}
+	rows[0] = xrefRow{0, 0, 65535}
+	xrefOffset := writeXRefStream(&buf, xrefNum, rows, trailer)
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+// xrefRow is a cross-reference stream entry: its type (0 free, 1 at an
+// offset, 2 in an object stream) and two fields, with W [1 4 2].
+type xrefRow struct{ kind, field2, field3 int }
+
+// writeXRefStream writes cross-reference stream object num, which lists
+// itself along with rows, and returns its offset. The stream has one
+// /Index subsection per run of consecutive numbers and its /Size is num+1.
+// trailer holds the trailer entries other than /Size.
+func writeXRefStream(buf *bytes.Buffer, num int, rows map[int]xrefRow, trailer string) int {
+	offset := buf.Len()
+	rows[num] = xrefRow{1, offset, 0}
+	nums := make([]int, 0, len(rows))
+	for n := range rows {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	var index []int
+	var data bytes.Buffer
+	for i, n := range nums {
+		if i == 0 || n != nums[i-1]+1 {
+			index = append(index, n, 0)
+		}
+		index[len(index)-1]++
+		r := rows[n]
+		data.Write([]byte{byte(r.kind),
+			byte(r.field2 >> 24), byte(r.field2 >> 16), byte(r.field2 >> 8), byte(r.field2),
+			byte(r.field3 >> 8), byte(r.field3)})
+	}
+	// The default /Index is [0 Size]
+	indexEntry := ""
+	if len(index) != 2 || index[0] != 0 {
+		indexEntry = strings.Trim(fmt.Sprint(index), "[]")
+		indexEntry = " /Index [" + indexEntry + "]"
+	}
+
+	compressed := flate(data.Bytes())
+	fmt.Fprintf(buf, "%d 0 obj\n<< /Type /XRef /Size %d%s /W [1 4 2] %s /Filter /FlateDecode /Length %d >>\nstream\n",
+		num, num+1, indexEntry, trailer, len(compressed))
+	buf.Write(compressed)
+	buf.WriteString("\nendstream\nendobj\n")
+	return offset
+}
+
+// flate compresses data with zlib, for /FlateDecode streams.
+func flate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// ExtractXML returns the Factur-X XML attached to a PDF: the file named
+// factur-x.xml (or zugferd-invoice.xml / xrechnung.xml for ZUGFeRD 2
+// documents, ZUGFeRD-invoice.xml for ZUGFeRD 1.0) in the embedded files
+// name tree. It returns an error wrapping
+// ErrPDF if the document has no such attachment.
+func ExtractXML(pdf []byte) ([]byte, error) {
+	doc, err := readPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	catalog, _, err := doc.catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	names, _ := doc.resolve(catalog["Names"])
+	namesDict, _ := names.(pdfDict)
+	tree, _ := doc.resolve(namesDict["EmbeddedFiles"])
+	treeDict, _ := tree.(pdfDict)
+
+	files := make(map[string]pdfValue)
+	if err := doc.collectNameTree(treeDict, files, 0); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"factur-x.xml", "zugferd-invoice.xml", "xrechnung.xml", "ZUGFeRD-invoice.xml"} {
+		spec, ok := files[name]
+		if !ok {
+			continue
+		}
+		specV, err := doc.resolve(spec)
+		if err != nil {
+			return nil, err
+		}
+		specDict, _ := specV.(pdfDict)
+		ef, _ := doc.resolve(specDict["EF"])
+		efDict, _ := ef.(pdfDict)
+		file, err := doc.resolve(efDict["F"])
+		if err != nil {
+			return nil, err
+		}
+		stream, ok := file.(*pdfStream)
+		if !ok {
+			return nil, pdfErrorf("attachment %s has no file stream", name)
+		}
+		return decodeStream(stream)
+	}
+	return nil, pdfErrorf("no Factur-X XML attachment found")
+}
+
+// collectNameTree gathers the leaves of a name tree into files.
+func (doc *pdfDocument) collectNameTree(node pdfDict, files map[string]pdfValue, depth int) error {
+	if node == nil || depth > 32 {
+		return nil
+	}
+	if names, ok := node["Names"].(pdfArray); ok {
+		for i := 0; i+1 < len(names); i += 2 {
+			if key, ok := names[i].(pdfString); ok {
+				files[string(key)] = names[i+1]
+			}
+		}
+	}
+	kids, _ := doc.resolve(node["Kids"])
+	kidsArr, _ := kids.(pdfArray)
+	for _, kid := range kidsArr {
+		v, err := doc.resolve(kid)
+		if err != nil {
+			return err
+		}
+		child, _ := v.(pdfDict)
+		if err := doc.collectNameTree(child, files, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package facturx
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+func init() {
+	registerSubsystem("export")
+}
+
+// AuditReport is the validation report of an invoice written by Export.
+type AuditReport struct {
+	// Number is the invoice number (BT-1).
+	Number string `json:"number"`
+	// Fingerprint is the digest of the invoice data (see Fingerprint).
+	Fingerprint string `json:"fingerprint"`
+	// SHA256 is the SHA-256 digest of the PDF, in hexadecimal.
+	SHA256 string `json:"sha256"`
+	// FileID is the PDF file identifier (trailer /ID), in hexadecimal.
+	FileID string `json:"fileId"`
+	// Totals are the amounts printed on the invoice and written in the XML.
+	Totals Totals `json:"totals"`
+	// Request is the validation of the request, with its warnings.
+	Request ValidationResult `json:"request"`
+	// XML is the validation of the XML read back from the PDF.
+	XML ValidationResult `json:"xml"`
+	// PDFA lists the PDF/A-3 requirements the PDF fails.
+	PDFA []PDFAIssue `json:"pdfa"`
+	// LayoutWarnings lists the texts truncated on the PDF.
+	LayoutWarnings []LayoutWarning `json:"layoutWarnings"`
+	// Verified tells whether the checks of GenerateVerified passed.
+	Verified bool `json:"verified"`
+	// VerificationError is the reason the checks failed, if they did.
+	VerificationError string `json:"verificationError,omitempty"`
+}
+
+// Export generates an invoice and writes a ZIP archive holding everything
+// needed to keep a reliable audit trail ("piste d'audit fiable") of it: the
+// Factur-X PDF, the standalone CII XML, the request as JSON and the
+// validation report (AuditReport) as JSON. The files are named after the
+// invoice number: "F-2024-001.pdf", "F-2024-001.xml", "F-2024-001.json" and
+// "F-2024-001.report.json".
+//
+// Invalid requests are rejected as by Generate. A failed verification does
+// not stop the export: it is recorded in the report.
+func Export(w io.Writer, req InvoiceRequest) error {
+	req = normalizeDates(req)
+	res, err := GenerateResult(req)
+	if err != nil {
+		return err
+	}
+
+	report := AuditReport{
+		Number:         req.Number,
+		Fingerprint:    res.Fingerprint,
+		SHA256:         res.SHA256,
+		FileID:         res.FileID,
+		Totals:         res.Totals,
+		Request:        Validate(&req),
+		PDFA:           []PDFAIssue{},
+		LayoutWarnings: res.LayoutWarnings,
+		Verified:       true,
+	}
+	if report.XML, err = ValidateXML([]byte(res.XML)); err != nil {
+		return err
+	}
+	if issues, err := CheckPDFA(res.PDF); err == nil && issues != nil {
+		report.PDFA = issues
+	}
+	if report.LayoutWarnings == nil {
+		report.LayoutWarnings = []LayoutWarning{}
+	}
+	if err := verifyResult(res); err != nil {
+		report.Verified = false
+		report.VerificationError = err.Error()
+	}
+
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+	reportData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := exportFileName(req.Number)
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{name + ".pdf", res.PDF},
+		{name + ".xml", []byte(res.XML)},
+		{name + ".json", data},
+		{name + ".report.json", reportData},
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// exportFileName makes an invoice number usable as a file name.
+func exportFileName(number string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '-'
+		}
+		return r
+	}, number)
+}
@@ -30,19 +30,23 @@
 package facturx
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 	"unicode"
 )
 
 // VatRegime represents the VAT regime for the invoice.
 type VatRegime struct {
-	kind           vatKind
-	rate           float64
-	categoryCode   string
-	exemptionCode  string
-	exemptionText  string
+	kind          vatKind
+	rate          float64
+	categoryCode  string
+	exemptionCode string
+	exemptionText string
 }
 
 type vatKind int
@@ -51,6 +55,8 @@ const (
 	vatStandard vatKind = iota
 	vatFranchiseAuto
 	vatExemptHealth
+	vatReverseCharge
+	vatMargin
 )
 
 // VatStandard creates a standard VAT regime with the given rate (e.g., 20.0 for 20%).
@@ -86,32 +92,127 @@ func VatExemptHealth() VatRegime {
 	}
 }
 
+// VatReverseCharge creates a VAT regime for cross-border B2B services where the
+// VAT is due by the buyer (autoliquidation, art. 283-2 du CGI / art. 196 of
+// Directive 2006/112/EC). The mandatory mention is generated in French and in
+// the buyer's language. Both seller and buyer VAT numbers are required.
+// Code: VATEX-EU-AE
+func VatReverseCharge() VatRegime {
+	return VatRegime{
+		kind:          vatReverseCharge,
+		rate:          0,
+		categoryCode:  "AE",
+		exemptionCode: "VATEX-EU-AE",
+		exemptionText: "Autoliquidation",
+	}
+}
+
+// VatMarginScheme creates a VAT regime for the margin scheme (régime de la
+// marge) of second-hand goods dealers and travel agencies, where VAT is due
+// on the margin only and must not appear on the invoice (art. 297 A and
+// 297 E du CGI). Invoices show no VAT breakdown amounts.
+// Code: VATEX-EU-F
+func VatMarginScheme() VatRegime {
+	return VatRegime{
+		kind:          vatMargin,
+		rate:          0,
+		categoryCode:  "E",
+		exemptionCode: "VATEX-EU-F",
+		exemptionText: "TVA sur la marge, art. 297 A du CGI",
+	}
+}
+
+// Rate returns the VAT rate in percent, 0 for exempt and reverse charge regimes.
+func (v VatRegime) Rate() float64 {
+	return v.rate
+}
+
+// VatDueDateType describes the event on which VAT becomes due (BT-8, UNTDID 2005).
+type VatDueDateType string
+
+const (
+	// VatDueOnInvoice: VAT is due on the invoice date ("TVA sur les débits").
+	VatDueOnInvoice VatDueDateType = "5"
+	// VatDueOnDelivery: VAT is due on the delivery date.
+	VatDueOnDelivery VatDueDateType = "29"
+	// VatDueOnPayment: VAT is due on payment ("TVA sur les encaissements").
+	VatDueOnPayment VatDueDateType = "72"
+)
+
 // ProfessionalId represents a professional identifier (ADELI, RPPS, etc.).
+// It is printed as "N° ADELI: 123456789" under the seller and written in
+// the XML as a party identifier (BT-29, BT-46) without scheme: EN 16931
+// only accepts ISO 6523 ICD codes as schemes, so the type stays on the PDF.
 type ProfessionalId struct {
-	// Type of identifier (e.g., "ADELI", "RPPS").
-	Type string
+	// Type of identifier (e.g., "ADELI", "RPPS"), printed as its label.
+	// Optional; empty for identifiers read from an XML invoice.
+	Type string `json:"type,omitempty"`
+	// Value is the identifier value.
+	Value string `json:"value"`
+}
+
+// GlobalId is a party identifier with its ISO 6523 ICD scheme (BT-29/BT-46).
+type GlobalId struct {
+	// Scheme is the 4-digit ISO 6523 scheme code (e.g. SchemeGLN).
+	Scheme string `json:"scheme"`
 	// Value is the identifier value.
-	Value string
+	Value string `json:"value"`
 }
 
+// Common ISO 6523 ICD scheme codes for GlobalId.
+const (
+	SchemeSIREN  = "0002" // SIRENE (French company register)
+	SchemeSIRET  = "0009" // SIRET (French establishment)
+	SchemeDUNS   = "0060" // Dun & Bradstreet DUNS
+	SchemeGLN    = "0088" // GS1 Global Location Number
+	SchemeODETTE = "0177" // Odette International
+)
+
 // Contact represents contact information for seller or buyer.
 type Contact struct {
 	// Name is the full name (company or individual).
-	Name string
+	Name string `json:"name"`
 	// Address is the street address.
-	Address string
+	Address string `json:"street,omitempty"`
 	// ZipCode is the postal code.
-	ZipCode string
+	ZipCode string `json:"postalCode,omitempty"`
 	// City is the city name.
-	City string
+	City string `json:"city,omitempty"`
 	// CountryCode is the ISO 3166-1 alpha-2 country code (e.g., "FR").
-	CountryCode string
+	CountryCode string `json:"countryCode,omitempty"`
 	// Siret is the SIRET number (14 digits for French companies).
-	Siret string
+	Siret string `json:"siret,omitempty"`
+	// Siren is the SIREN number (9 digits), for parties without a SIRET.
+	// Ignored when Siret is set.
+	Siren string `json:"siren,omitempty"`
+	// RCS is the trade register registration (e.g. "RCS Paris 123 456 789"),
+	// for parties identified by neither SIRET nor SIREN.
+	RCS string `json:"rcs,omitempty"`
 	// VatNumber is the VAT number (e.g., "FR12345678901"). Optional for exempt regimes.
-	VatNumber string
+	VatNumber string `json:"vatNumber,omitempty"`
 	// ProfessionalIds contains professional identifiers (ADELI, RPPS, etc.).
-	ProfessionalIds []ProfessionalId
+	ProfessionalIds []ProfessionalId `json:"professionalIds,omitempty"`
+	// GlobalIds contains additional identifiers with their scheme (GLN, DUNS...),
+	// used to route invoices in EDI networks.
+	GlobalIds []GlobalId `json:"globalIds,omitempty"`
+	// TradingName is the name the party trades under (BT-28, BT-45), when
+	// it differs from Name. Optional.
+	TradingName string `json:"tradingName,omitempty"`
+
+	// The company mentions below (art. R123-237 du Code de commerce) are
+	// printed on the first footer line of the PDF for the seller, e.g.
+	// "SARL au capital de 10 000,00 € - RCS Paris 123 456 789 - NAF 6201Z",
+	// and emitted as a legal information note. Optional.
+
+	// LegalForm is the legal form (forme juridique), e.g. "SARL" or "SAS".
+	LegalForm string `json:"legalForm,omitempty"`
+	// ShareCapital is the share capital (capital social) in euros.
+	ShareCapital float64 `json:"shareCapital,omitempty"`
+	// RCSCity is the city of the trade register the party is registered
+	// with; the RCS number is the SIREN. Requires Siret or Siren.
+	RCSCity string `json:"rcsCity,omitempty"`
+	// NAF is the activity code (code NAF or APE), e.g. "6201Z".
+	NAF string `json:"naf,omitempty"`
 }
 
 // PaymentMethod represents the payment method for a paid invoice.
@@ -140,58 +241,387 @@ func (m PaymentMethod) Label() string {
 	}
 }
 
+// MeansCode returns the payment means code (BT-81) of the method, or "" if
+// the method is unknown. Transfers are generic credit transfers (30).
+func (m PaymentMethod) MeansCode() PaymentMeansCode {
+	switch m {
+	case PaymentCash:
+		return PaymentMeansCash
+	case PaymentCheck:
+		return PaymentMeansCheque
+	case PaymentCard:
+		return PaymentMeansCard
+	case PaymentTransfer:
+		return PaymentMeansCreditTransfer
+	default:
+		return ""
+	}
+}
+
+// PaymentMeansCode is the payment means type code (BT-81, UNTDID 4461)
+// written in the XML.
+type PaymentMeansCode string
+
+const (
+	PaymentMeansCash               PaymentMeansCode = "10"
+	PaymentMeansCheque             PaymentMeansCode = "20"
+	PaymentMeansCreditTransfer     PaymentMeansCode = "30"
+	PaymentMeansCard               PaymentMeansCode = "48"
+	PaymentMeansSEPACreditTransfer PaymentMeansCode = "58"
+	PaymentMeansSEPADirectDebit    PaymentMeansCode = "59"
+)
+
+// Label returns the French label of the payment means, or "" for codes
+// without one.
+func (c PaymentMeansCode) Label() string {
+	switch c {
+	case PaymentMeansCash:
+		return "espèces"
+	case PaymentMeansCheque:
+		return "chèque"
+	case PaymentMeansCreditTransfer:
+		return "virement"
+	case PaymentMeansCard:
+		return "carte bancaire"
+	case PaymentMeansSEPACreditTransfer:
+		return "virement SEPA"
+	case PaymentMeansSEPADirectDebit:
+		return "prélèvement SEPA"
+	default:
+		return ""
+	}
+}
+
 // Payment contains payment information for paid invoices.
 type Payment struct {
 	// Date is the payment date in DD/MM/YYYY format.
-	Date string
+	Date string `json:"-"`
+	// PaidOn is the payment date. If set, it takes precedence over Date.
+	PaidOn time.Time `json:"-"`
 	// Method is the payment method.
-	Method PaymentMethod
+	Method PaymentMethod `json:"method"`
+}
+
+// InvoiceType is the invoice type code (BT-3, UNTDID 1001).
+type InvoiceType string
+
+const (
+	// TypeCommercial is a commercial invoice (380). This is the default.
+	TypeCommercial InvoiceType = "380"
+	// TypeDownPayment is a down payment invoice, "facture d'acompte" (386).
+	TypeDownPayment InvoiceType = "386"
+	// TypeCorrective is a corrective invoice, "facture rectificative" (384).
+	// It requires PrecedingInvoice to reference the corrected invoice.
+	TypeCorrective InvoiceType = "384"
+	// TypeSelfBilled is a self-billed invoice, "autofacturation" (389).
+	// The buyer issues the invoice on behalf of the supplier: Seller still
+	// describes the supplier and Buyer the customer issuing the document.
+	TypeSelfBilled InvoiceType = "389"
+)
+
+// code returns the UNTDID 1001 code, defaulting to a commercial invoice.
+func (t InvoiceType) code() string {
+	if t == "" {
+		return string(TypeCommercial)
+	}
+	return string(t)
+}
+
+// Title returns the French document title printed on the PDF.
+func (t InvoiceType) Title() string {
+	switch t {
+	case TypeDownPayment:
+		return "FACTURE D'ACOMPTE"
+	case TypeCorrective:
+		return "FACTURE RECTIFICATIVE"
+	case TypeSelfBilled:
+		return "AUTOFACTURATION"
+	default:
+		return "FACTURE"
+	}
+}
+
+// InvoiceReference references a previous invoice (BG-3).
+type InvoiceReference struct {
+	// Number is the preceding invoice number (BT-25).
+	Number string `json:"number"`
+	// Date is the preceding invoice issue date (BT-26). Optional.
+	Date time.Time `json:"-"`
 }
 
 // InvoiceLine represents a single invoice line item.
 type InvoiceLine struct {
 	// Description of the product or service.
-	Description string
-	// Quantity (number of units).
-	Quantity float64
-	// UnitPrice in EUR (excluding tax).
-	UnitPrice float64
+	Description string `json:"description"`
+	// Quantity (number of units). Negative for refund or correction lines,
+	// making the line amount negative.
+	Quantity float64 `json:"quantity"`
+	// UnitPrice in EUR (excluding tax). This is the net price (BT-146).
+	UnitPrice float64 `json:"unitPrice"`
+	// GrossPrice is the catalogue unit price before discount (BT-148). Optional.
+	// When set, the difference with UnitPrice is emitted as the item price
+	// discount (BT-147).
+	GrossPrice float64 `json:"grossPrice,omitempty"`
+	// DiscountPercent is a discount in percent deducted from the line
+	// amount (quantity × UnitPrice). Optional. It is emitted as a line
+	// allowance (BG-27) and printed in a "Remise" column.
+	DiscountPercent float64 `json:"discountPercent,omitempty"`
+	// EcoContribution is the eco-participation of the line (DEEE), in EUR
+	// excluding tax. Optional. It is added to the line amount as a line
+	// charge (BG-28), bears the line VAT, and is printed under the line.
+	EcoContribution float64 `json:"ecoContribution,omitempty"`
 	// Date is the service/delivery date in DD/MM/YYYY format (optional).
-	Date string
+	Date string `json:"-"`
+	// ServiceDate is the service/delivery date. If set, it takes precedence over Date.
+	ServiceDate time.Time `json:"-"`
+	// PeriodStart is the start of the line billing period (BT-134). Optional.
+	PeriodStart time.Time `json:"-"`
+	// PeriodEnd is the end of the line billing period (BT-135). Optional.
+	PeriodEnd time.Time `json:"-"`
+}
+
+// Charge is a document-level charge (BG-21), such as shipping costs, added
+// to the invoice total without being an invoice line.
+type Charge struct {
+	// Amount excluding tax (BT-99).
+	Amount float64 `json:"amount"`
+	// VatRate is the VAT rate of the charge in percent (BT-103). Invoices
+	// have a single VAT breakdown, so it must be the rate of the regime.
+	VatRate float64 `json:"vatRate"`
+	// Reason is printed in the totals area (BT-104).
+	Reason string `json:"reason"`
+	// ReasonCode is the UNTDID 7161 charge reason code (BT-105). Optional.
+	ReasonCode string `json:"reasonCode,omitempty"`
+}
+
+// Metadata overrides the document information of the PDF, written both
+// to the Info dictionary and to the XMP metadata as PDF/A requires. Empty
+// fields keep their defaults.
+type Metadata struct {
+	// Title defaults to "Facture <number>".
+	Title string `json:"title,omitempty"`
+	// Author defaults to the seller name.
+	Author string `json:"author,omitempty"`
+	// Subject is omitted by default.
+	Subject string `json:"subject,omitempty"`
+	// Producer defaults to "facturx-go".
+	Producer string `json:"producer,omitempty"`
+	// CreationDate is the creation date of the PDF, the generation time by
+	// default. A fixed date makes the output reproducible.
+	CreationDate time.Time `json:"-"`
+}
+
+// Header adds letterhead text to the header band of the PDF, between the
+// document title and the date.
+type Header struct {
+	// Tagline is the seller's baseline, e.g. "Conseil en stratégie
+	// numérique".
+	Tagline string `json:"tagline,omitempty"`
+	// Phone, Email and Website form the contact line under the tagline.
+	Phone   string `json:"phone,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Website string `json:"website,omitempty"`
+}
+
+// contactLine joins the non-empty contact details.
+func (h *Header) contactLine() string {
+	var parts []string
+	for _, s := range []string{h.Phone, h.Email, h.Website} {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// maxFooterLines is the number of footer lines that fit under the legal
+// mentions.
+const maxFooterLines = 4
+
+// Footer replaces the default "Document généré conformément à la norme
+// Factur-X" line at the bottom of the PDF. The company mentions of the
+// seller (see Contact.LegalForm) stay on the first line.
+type Footer struct {
+	// Lines are printed in order, e.g. the website or a slogan. A footer
+	// without lines suppresses the footer band, unless the seller has
+	// company mentions.
+	Lines []string `json:"lines,omitempty"`
+}
+
+// AddShipping adds delivery costs excluding tax as a "Frais de port" charge.
+func (r *InvoiceRequest) AddShipping(amount, vatRate float64) {
+	r.Charges = append(r.Charges, Charge{Amount: amount, VatRate: vatRate, Reason: "Frais de port", ReasonCode: "FC"})
+}
+
+// LatePaymentTerms generates the late payment mentions required on French
+// B2B invoices (art. L441-10 du Code de commerce): penalty rate and the 40 €
+// recovery indemnity.
+type LatePaymentTerms struct {
+	// PenaltyRate is the annual late payment penalty rate in percent. Zero
+	// prints the legal minimum, three times the legal interest rate.
+	PenaltyRate float64 `json:"penaltyRate,omitempty"`
+}
+
+// CashDiscount is a discount granted for early payment (escompte).
+type CashDiscount struct {
+	// Percent is the discount in percent.
+	Percent float64 `json:"percent"`
+	// Days is the payment delay in days qualifying for the discount.
+	// Optional.
+	Days int `json:"days,omitempty"`
+}
+
+// Installment is a part of the amount due, payable on its own date.
+type Installment struct {
+	// DueDate is the date the installment is due.
+	DueDate time.Time `json:"-"`
+	// Amount is the amount due on that date.
+	Amount float64 `json:"amount"`
+}
+
+// DirectDebit is the SEPA direct debit mandate the buyer signed, for
+// sellers collecting by direct debit (payment means 59).
+type DirectDebit struct {
+	// MandateID is the unique mandate reference (RUM, BT-89).
+	MandateID string `json:"mandateId"`
+	// CreditorID is the seller's SEPA creditor identifier (ICS, BT-90).
+	CreditorID string `json:"creditorId"`
+	// DebtorIBAN is the IBAN of the debited account (BT-91).
+	DebtorIBAN string `json:"debtorIban"`
 }
 
 // InvoiceRequest contains all data needed to generate an invoice.
 type InvoiceRequest struct {
 	// Number is the unique invoice identifier.
-	Number string
+	Number string `json:"number"`
+	// Type is the invoice type code (BT-3). Defaults to TypeCommercial.
+	Type InvoiceType `json:"type,omitempty"`
 	// Date in YYYYMMDD format (CII format code 102).
-	Date string
+	Date string `json:"-"`
+	// IssueDate is the invoice date. If set, it takes precedence over Date.
+	IssueDate time.Time `json:"-"`
+	// DueDate is the payment due date (BT-9). Optional.
+	DueDate time.Time `json:"-"`
+	// DeliveryDate is the actual delivery date of the goods or services
+	// (BT-72), printed on the PDF. Optional.
+	DeliveryDate time.Time `json:"-"`
 	// Seller information.
-	Seller Contact
+	Seller Contact `json:"seller"`
 	// Buyer information.
-	Buyer Contact
+	Buyer Contact `json:"buyer"`
 	// Lines contains the invoice line items.
-	Lines []InvoiceLine
+	Lines []InvoiceLine `json:"lines"`
+	// Charges are document-level charges such as shipping (BG-21). Optional.
+	Charges []Charge `json:"charges,omitempty"`
 	// Regime is the VAT regime.
-	Regime VatRegime
+	Regime VatRegime `json:"regime,omitzero"`
+	// TaxPointDate is the date when VAT becomes due (BT-7). Optional,
+	// mutually exclusive with VatDueDateType.
+	TaxPointDate time.Time `json:"-"`
+	// VatDueDateType is the event on which VAT becomes due (BT-8). Optional,
+	// mutually exclusive with TaxPointDate.
+	VatDueDateType VatDueDateType `json:"vatDueDateType,omitempty"`
 	// AddEISuffix adds "Entrepreneur Individuel" suffix to seller name.
-	AddEISuffix bool
+	AddEISuffix bool `json:"addEISuffix,omitempty"`
 	// CustomMentions is free text for legal mentions (can contain newlines).
-	CustomMentions string
+	CustomMentions string `json:"customMentions,omitempty"`
+	// LatePayment generates the late payment mentions as coded notes
+	// instead of pasting them into CustomMentions. Optional.
+	LatePayment *LatePaymentTerms `json:"latePayment,omitempty"`
+	// CashDiscount is the early payment discount, printed and emitted in the
+	// payment terms. Without it, B2B invoices state "Escompte : néant".
+	CashDiscount *CashDiscount `json:"cashDiscount,omitempty"`
+	// Installments split the amount due into payments with their own due
+	// dates, for invoices payable in 3x or milestone billing; they must
+	// add up to the amount due. Only the EXTENDED profile repeats payment
+	// terms, so the document then declares it. Mutually exclusive with
+	// DueDate. Optional.
+	Installments []Installment `json:"installments,omitempty"`
+	// PaymentMeans is the payment means code (BT-81) written in the XML
+	// and, for unpaid invoices, printed on the PDF. Defaults to 59 with
+	// DirectDebit, else to the code of Payment.Method. Optional.
+	PaymentMeans PaymentMeansCode `json:"paymentMeans,omitempty"`
+	// DirectDebit collects the amount due by SEPA direct debit: the
+	// mandate, creditor identifier and debited account are written in
+	// the XML and the PDF states the debit. Optional.
+	DirectDebit *DirectDebit `json:"directDebit,omitempty"`
 	// Payment contains payment info. If set, displays "Payée le [date] par [method]".
-	Payment *Payment
+	Payment *Payment `json:"payment,omitempty"`
+	// OrderRef is the buyer's purchase order reference (BT-13). Optional.
+	OrderRef string `json:"orderRef,omitempty"`
+	// PrecedingInvoice references a previous invoice (BG-3), e.g. the down
+	// payment invoices deducted from a final invoice. Optional.
+	PrecedingInvoice *InvoiceReference `json:"precedingInvoice,omitempty"`
+	// CorrectionReason explains why a corrective invoice is issued. Optional.
+	CorrectionReason string `json:"correctionReason,omitempty"`
+	// PrepaidAmount is the amount already paid, e.g. down payments (BT-113).
+	// It is deducted from the amount due.
+	PrepaidAmount float64 `json:"prepaidAmount,omitempty"`
+	// DespatchAdviceRef is the despatch advice (bon de livraison) number (BT-16). Optional.
+	DespatchAdviceRef string `json:"despatchAdviceRef,omitempty"`
+	// Limits holds optional sanity thresholds on amounts and quantities.
+	// If nil, no limit checks are performed.
+	Limits *Limits `json:"limits,omitempty"`
+	// AttachmentDescription is the description of the embedded factur-x.xml
+	// shown by PDF readers. Defaults to "Factur-X XML invoice <number>".
+	AttachmentDescription string `json:"attachmentDescription,omitempty"`
+	// AttachmentAnnotation adds a paperclip icon to the top right corner of
+	// the page, opening factur-x.xml in viewers that do not list document
+	// attachments. Ignored by Embed, which leaves the pages untouched.
+	AttachmentAnnotation bool `json:"attachmentAnnotation,omitempty"`
+	// ObjectStreams writes the PDF with compressed object streams and a
+	// cross-reference stream (PDF 1.5), for smaller files. The default
+	// classic cross-reference table suits older tools.
+	ObjectStreams bool `json:"objectStreams,omitempty"`
+	// XMLFormat selects the layout of the embedded XML: XMLPretty
+	// (default) for reading and debugging, XMLCompact for smaller files.
+	XMLFormat XMLFormat `json:"xmlFormat,omitempty"`
+	// FacturXVersion is the Factur-X specification version the document
+	// declares. Defaults to Version1p0.
+	FacturXVersion Version `json:"facturxVersion,omitempty"`
+	// Locale selects the number format of the PDF. Defaults to LocaleFrench.
+	Locale Locale `json:"locale,omitempty"`
+	// Metadata overrides the PDF title, author, subject and producer.
+	// Optional.
+	Metadata *Metadata `json:"metadata,omitempty"`
+	// Header adds a tagline and contact line to the PDF header. Optional.
+	Header *Header `json:"header,omitempty"`
+	// Footer customizes the footer of the PDF. Optional.
+	Footer *Footer `json:"footer,omitempty"`
+	// Layout adjusts the margins and line table geometry of the PDF.
+	// Optional.
+	Layout *LayoutConfig `json:"layout,omitempty"`
+	// Font draws the PDF text instead of DefaultFont, e.g. a font from
+	// NewTrueTypeFont. Optional; not available in JSON.
+	Font FontProvider `json:"-"`
+	// Supplements are PDF documents (signed quote, contract...) embedded
+	// next to factur-x.xml. Optional.
+	Supplements []Supplement `json:"supplements,omitempty"`
+	// CustomizeCII edits the CII document model before it is serialized
+	// and embedded, e.g. to add an element the request cannot express. The
+	// PDF is drawn from the request and does not reflect the changes.
+	// Optional; not available in JSON.
+	CustomizeCII func(doc *CrossIndustryInvoice) `json:"-"`
 }
 
 // ValidationError represents a validation error.
 type ValidationError struct {
-	Field   string
-	Message string
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Rule is the EN 16931 business rule the error breaks, e.g.
+	// "BR-CO-15", when the check maps onto one.
+	Rule string `json:"rule,omitempty"`
 }
 
 func (e ValidationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Field, e.Message)
 }
 
+// Unwrap makes every ValidationError match ErrValidation with errors.Is.
+func (e ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
 // validate checks the invoice request for errors.
 func validate(req *InvoiceRequest) error {
 	// Invoice number
@@ -210,32 +640,82 @@ func validate(req *InvoiceRequest) error {
 	}
 
 	// Validate date values
-	year := parseInt(req.Date[0:4])
-	month := parseInt(req.Date[4:6])
-	day := parseInt(req.Date[6:8])
-	if year < 2000 || year > 2100 || month < 1 || month > 12 || day < 1 || day > 31 {
+	date, err := parseCIIDate(req.Date)
+	if err != nil || date.Year() < 2000 || date.Year() > 2100 {
 		return ValidationError{Field: "Date", Message: "invalid date values"}
 	}
 
+	// Invoice type
+	switch req.Type {
+	case "", TypeCommercial, TypeDownPayment, TypeCorrective, TypeSelfBilled:
+	default:
+		return ValidationError{Field: "Type", Message: "unsupported invoice type code"}
+	}
+	if req.Type == TypeCorrective && req.PrecedingInvoice == nil {
+		return ValidationError{Field: "PrecedingInvoice", Message: "corrective invoice must reference the corrected invoice"}
+	}
+
+	// NaN and infinities pass every comparison below
+	if field := nonFiniteField(req); field != "" {
+		return ValidationError{Field: field, Message: "value must be a finite number"}
+	}
+
+	// Preceding invoice and prepaid amount
+	if req.PrecedingInvoice != nil && strings.TrimSpace(req.PrecedingInvoice.Number) == "" {
+		return ValidationError{Field: "PrecedingInvoice.Number", Message: "preceding invoice number cannot be empty"}
+	}
+	if req.PrepaidAmount < 0 {
+		return ValidationError{Field: "PrepaidAmount", Message: "prepaid amount cannot be negative"}
+	}
+
 	// Lines
 	if len(req.Lines) == 0 {
 		return ValidationError{Field: "Lines", Message: "invoice must have at least one line"}
 	}
 
 	for i, line := range req.Lines {
-		if line.Quantity <= 0 {
-			return ValidationError{Field: fmt.Sprintf("Lines[%d].Quantity", i), Message: "quantity must be positive"}
+		// Refund lines have a negative quantity; the net price itself
+		// cannot be negative (BR-27)
+		if line.Quantity == 0 {
+			return ValidationError{Field: fmt.Sprintf("Lines[%d].Quantity", i), Message: "quantity cannot be zero"}
 		}
 		if line.UnitPrice < 0 {
 			return ValidationError{Field: fmt.Sprintf("Lines[%d].UnitPrice", i), Message: "unit price cannot be negative"}
 		}
+		if line.GrossPrice != 0 && line.GrossPrice < line.UnitPrice {
+			return ValidationError{Field: fmt.Sprintf("Lines[%d].GrossPrice", i), Message: "gross price cannot be lower than unit price"}
+		}
+		if line.DiscountPercent < 0 || line.DiscountPercent > 100 {
+			return ValidationError{Field: fmt.Sprintf("Lines[%d].DiscountPercent", i), Message: "discount must be between 0 and 100 percent"}
+		}
+		if line.EcoContribution*line.Quantity < 0 {
+			return ValidationError{Field: fmt.Sprintf("Lines[%d].EcoContribution", i), Message: "eco-contribution must have the sign of the quantity"}
+		}
+		if !line.PeriodStart.IsZero() && !line.PeriodEnd.IsZero() && line.PeriodEnd.Before(line.PeriodStart) {
+			return ValidationError{Field: fmt.Sprintf("Lines[%d].PeriodEnd", i), Message: "billing period end cannot be before start"}
+		}
+		if line.Date != "" {
+			if _, err := parseDisplayDate(line.Date); err != nil {
+				return ValidationError{Field: fmt.Sprintf("Lines[%d].Date", i), Message: "date must be in DD/MM/YYYY format"}
+			}
+		}
+	}
+
+	// Payment date
+	if req.Payment != nil && req.Payment.Date != "" {
+		if _, err := parseDisplayDate(req.Payment.Date); err != nil {
+			return ValidationError{Field: "Payment.Date", Message: "date must be in DD/MM/YYYY format"}
+		}
 	}
 
 	// Seller
 	if strings.TrimSpace(req.Seller.Name) == "" {
 		return ValidationError{Field: "Seller.Name", Message: "seller name cannot be empty"}
 	}
-	if err := validateContact(&req.Seller, "Seller", true); err != nil {
+	if err := validateContact(&req.Seller, "Seller", req.Seller.isFrench()); err != nil {
+		return err
+	}
+	if err := validateForeignSeller(req); err != nil {
 		return err
 	}
 
@@ -252,12 +732,138 @@ func validate(req *InvoiceRequest) error {
 		return ValidationError{Field: "Regime", Message: "VAT rate cannot be negative"}
 	}
 
+	// Late payment and cash discount terms
+	if lp := req.LatePayment; lp != nil {
+		if lp.PenaltyRate < 0 {
+			return ValidationError{Field: "LatePayment.PenaltyRate", Message: "penalty rate cannot be negative"}
+		}
+	}
+	if d := req.CashDiscount; d != nil {
+		if d.Percent <= 0 || d.Percent >= 100 {
+			return ValidationError{Field: "CashDiscount.Percent", Message: "cash discount must be between 0 and 100 percent"}
+		}
+		if d.Days < 0 {
+			return ValidationError{Field: "CashDiscount.Days", Message: "cash discount days cannot be negative"}
+		}
+	}
+
+	// Document-level charges (BR-38, BR-39)
+	for i, c := range req.Charges {
+		if c.Amount <= 0 {
+			return ValidationError{Field: fmt.Sprintf("Charges[%d].Amount", i), Message: "charge amount must be positive"}
+		}
+		if strings.TrimSpace(c.Reason) == "" && c.ReasonCode == "" {
+			return ValidationError{Field: fmt.Sprintf("Charges[%d].Reason", i), Message: "charge reason cannot be empty"}
+		}
+		if c.VatRate != req.Regime.rate {
+			return ValidationError{Field: fmt.Sprintf("Charges[%d].VatRate", i), Message: "charge VAT rate must match the invoice VAT rate"}
+		}
+	}
+
+	// Installments
+	if len(req.Installments) > 0 && !req.DueDate.IsZero() {
+		return ValidationError{Field: "DueDate", Message: "due date and installments are mutually exclusive"}
+	}
+	var installments amount
+	for i, inst := range req.Installments {
+		if inst.DueDate.IsZero() {
+			return ValidationError{Field: fmt.Sprintf("Installments[%d].DueDate", i), Message: "installment due date is required"}
+		}
+		if i > 0 && inst.DueDate.Before(req.Installments[i-1].DueDate) {
+			return ValidationError{Field: fmt.Sprintf("Installments[%d].DueDate", i), Message: "installments must be in due date order"}
+		}
+		if inst.Amount <= 0 {
+			return ValidationError{Field: fmt.Sprintf("Installments[%d].Amount", i), Message: "installment amount must be positive"}
+		}
+		installments += toAmount(inst.Amount)
+	}
+	if due := calculateInvoice(req).dueAmount; len(req.Installments) > 0 && installments != due {
+		return ValidationError{Field: "Installments", Message: fmt.Sprintf("installments add up to %s, the amount due is %s", installments, due)}
+	}
+
+	// Payment means (BT-81): a UNTDID 4461 code, 59 for direct debits
+	if c := req.PaymentMeans; c != "" && (len(c) > 3 || !isDigits(string(c))) {
+		return ValidationError{Field: "PaymentMeans", Message: "payment means must be a UNTDID 4461 code"}
+	}
+	if req.DirectDebit != nil && req.PaymentMeans != "" && req.PaymentMeans != PaymentMeansSEPADirectDebit {
+		return ValidationError{Field: "PaymentMeans", Message: "direct debit requires payment means 59"}
+	}
+
+	// SEPA direct debit (BG-19)
+	if dd := req.DirectDebit; dd != nil {
+		if strings.TrimSpace(dd.MandateID) == "" {
+			return ValidationError{Field: "DirectDebit.MandateID", Message: "direct debit mandate reference is required"}
+		}
+		if strings.TrimSpace(dd.CreditorID) == "" {
+			return ValidationError{Field: "DirectDebit.CreditorID", Message: "SEPA creditor identifier is required"}
+		}
+		if !validIBAN(dd.DebtorIBAN) {
+			return ValidationError{Field: "DirectDebit.DebtorIBAN", Message: "invalid IBAN"}
+		}
+	}
+
+	if _, ok := versionSpecs[req.FacturXVersion]; req.FacturXVersion != "" && !ok {
+		return ValidationError{Field: "FacturXVersion", Message: "unknown Factur-X version"}
+	}
+	switch req.Locale {
+	case "", LocaleFrench, LocaleEnglish:
+	default:
+		return ValidationError{Field: "Locale", Message: "unknown locale"}
+	}
+	switch req.XMLFormat {
+	case "", XMLPretty, XMLCompact:
+	default:
+		return ValidationError{Field: "XMLFormat", Message: "unknown XML format"}
+	}
+	// The seller company mentions take the first footer line
+	maxLines := maxFooterLines
+	if req.Seller.legalMention() != "" {
+		maxLines--
+	}
+	if req.Footer != nil && len(req.Footer.Lines) > maxLines {
+		return ValidationError{Field: "Footer.Lines", Message: fmt.Sprintf("footer cannot exceed %d lines", maxLines)}
+	}
+	if err := validateLayout(req); err != nil {
+		return err
+	}
+	if err := validateSupplements(req); err != nil {
+		return err
+	}
+	if req.Font != nil && !isPDFName(req.Font.Name()) {
+		return ValidationError{Field: "Font", Message: "font name must be printable ASCII without spaces or delimiters"}
+	}
+
+	// BR-CO-3: tax point date and VAT due date type are mutually exclusive
+	if !req.TaxPointDate.IsZero() && req.VatDueDateType != "" {
+		return ValidationError{Field: "TaxPointDate", Message: "tax point date and VAT due date type are mutually exclusive"}
+	}
+	switch req.VatDueDateType {
+	case "", VatDueOnInvoice, VatDueOnDelivery, VatDueOnPayment:
+	default:
+		return ValidationError{Field: "VatDueDateType", Message: "unknown VAT due date type code"}
+	}
+
+	// Reverse charge (BR-AE-02): both VAT numbers are required
+	if req.Regime.kind == vatReverseCharge {
+		if strings.TrimSpace(req.Seller.VatNumber) == "" {
+			return ValidationError{Field: "Seller.VatNumber", Message: "seller VAT number is required for reverse charge"}
+		}
+		if strings.TrimSpace(req.Buyer.VatNumber) == "" {
+			return ValidationError{Field: "Buyer.VatNumber", Message: "buyer VAT number is required for reverse charge"}
+		}
+	}
+
 	return nil
 }
 
-func validateContact(c *Contact, prefix string, requireSiret bool) error {
-	// SIRET: 14 digits (optional for buyer in B2C)
-	if c.Siret != "" || requireSiret {
+func validateContact(c *Contact, prefix string, requireLegalID bool) error {
+	// Legal identifier: SIRET, else SIREN or RCS (optional for buyer in B2C)
+	if requireLegalID && c.Siret == "" && c.Siren == "" && strings.TrimSpace(c.RCS) == "" {
+		return ValidationError{Field: prefix + ".Siret", Message: "SIRET, SIREN or RCS number is required"}
+	}
+
+	// SIRET: 14 digits
+	if c.Siret != "" {
 		if len(c.Siret) != 14 {
 			return ValidationError{Field: prefix + ".Siret", Message: "SIRET must be 14 digits"}
 		}
@@ -271,6 +877,38 @@ func validateContact(c *Contact, prefix string, requireSiret bool) error {
 		}
 	}
 
+	// SIREN: 9 digits, the first 9 digits of the SIRET when both are set
+	if c.Siren != "" {
+		if len(c.Siren) != 9 || strings.IndexFunc(c.Siren, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+			return ValidationError{Field: prefix + ".Siren", Message: "SIREN must be 9 digits"}
+		}
+		if !validateSirenLuhn(c.Siren) {
+			return ValidationError{Field: prefix + ".Siren", Message: "SIREN checksum invalid (Luhn)"}
+		}
+		if c.Siret != "" && !strings.HasPrefix(c.Siret, c.Siren) {
+			return ValidationError{Field: prefix + ".Siren", Message: "SIRET must start with the SIREN"}
+		}
+	}
+
+	// Professional identifiers
+	for i, id := range c.ProfessionalIds {
+		field := fmt.Sprintf("%s.ProfessionalIds[%d]", prefix, i)
+		if strings.TrimSpace(id.Value) == "" {
+			return ValidationError{Field: field + ".Value", Message: "identifier value cannot be empty"}
+		}
+	}
+
+	// Global identifiers
+	for i, id := range c.GlobalIds {
+		field := fmt.Sprintf("%s.GlobalIds[%d]", prefix, i)
+		if len(id.Scheme) != 4 || strings.IndexFunc(id.Scheme, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+			return ValidationError{Field: field + ".Scheme", Message: "scheme must be a 4-digit ISO 6523 code"}
+		}
+		if strings.TrimSpace(id.Value) == "" {
+			return ValidationError{Field: field + ".Value", Message: "identifier value cannot be empty"}
+		}
+	}
+
 	// Country code: 2 letters
 	if len(c.CountryCode) != 2 {
 		return ValidationError{Field: prefix + ".CountryCode", Message: "country code must be 2 letters"}
@@ -281,9 +919,98 @@ func validateContact(c *Contact, prefix string, requireSiret bool) error {
 		}
 	}
 
+	// Company mentions
+	if c.ShareCapital < 0 {
+		return ValidationError{Field: prefix + ".ShareCapital", Message: "share capital cannot be negative"}
+	}
+	if strings.TrimSpace(c.RCSCity) != "" && c.Siret == "" && c.Siren == "" {
+		return ValidationError{Field: prefix + ".RCSCity", Message: "RCS city requires a SIRET or SIREN"}
+	}
+	if naf := strings.TrimSpace(c.NAF); naf != "" && !validNAF(naf) {
+		return ValidationError{Field: prefix + ".NAF", Message: "NAF code must be 4 digits and a letter"}
+	}
+
 	return nil
 }
 
+// validNAF reports whether code is a NAF code such as "6201Z" or "62.01Z".
+func validNAF(code string) bool {
+	if len(code) == 6 && code[2] == '.' {
+		code = code[:2] + code[3:]
+	}
+	return len(code) == 5 && isDigits(code[:4]) && code[4] >= 'A' && code[4] <= 'Z'
+}
+
+// validateForeignSeller checks the identification of a seller established
+// outside France: a VAT number from its country instead of a SIRET, SIREN
+// or RCS number (BR-CO-26), and no French-only VAT regime.
+func validateForeignSeller(req *InvoiceRequest) error {
+	s := &req.Seller
+	if s.isFrench() {
+		return nil
+	}
+	if s.Siret != "" || s.Siren != "" {
+		return ValidationError{Field: "Seller.Siret", Message: "SIRET and SIREN only apply to French sellers"}
+	}
+	vat := strings.ToUpper(strings.TrimSpace(s.VatNumber))
+	if vat == "" {
+		return ValidationError{Field: "Seller.VatNumber", Message: "seller VAT number is required outside France"}
+	}
+	if !strings.HasPrefix(vat, vatPrefix(s.CountryCode)) {
+		return ValidationError{Field: "Seller.VatNumber", Message: "seller VAT number must start with its country prefix"}
+	}
+	if req.Regime.kind == vatFranchiseAuto {
+		return ValidationError{Field: "Regime", Message: "franchise en base only applies to French sellers"}
+	}
+	return nil
+}
+
+// nonFiniteField returns the first numeric field of req that is NaN or
+// infinite, or "" if there is none.
+func nonFiniteField(req *InvoiceRequest) string {
+	type field struct {
+		name  string
+		value float64
+	}
+	fields := []field{
+		{"Regime", req.Regime.rate},
+		{"PrepaidAmount", req.PrepaidAmount},
+		{"Seller.ShareCapital", req.Seller.ShareCapital},
+		{"Buyer.ShareCapital", req.Buyer.ShareCapital},
+	}
+	for i, l := range req.Lines {
+		prefix := fmt.Sprintf("Lines[%d].", i)
+		fields = append(fields,
+			field{prefix + "Quantity", l.Quantity},
+			field{prefix + "UnitPrice", l.UnitPrice},
+			field{prefix + "GrossPrice", l.GrossPrice},
+			field{prefix + "DiscountPercent", l.DiscountPercent},
+			field{prefix + "EcoContribution", l.EcoContribution},
+		)
+	}
+	for i, c := range req.Charges {
+		fields = append(fields,
+			field{fmt.Sprintf("Charges[%d].Amount", i), c.Amount},
+			field{fmt.Sprintf("Charges[%d].VatRate", i), c.VatRate},
+		)
+	}
+	for i, inst := range req.Installments {
+		fields = append(fields, field{fmt.Sprintf("Installments[%d].Amount", i), inst.Amount})
+	}
+	if req.LatePayment != nil {
+		fields = append(fields, field{"LatePayment.PenaltyRate", req.LatePayment.PenaltyRate})
+	}
+	if req.CashDiscount != nil {
+		fields = append(fields, field{"CashDiscount.Percent", req.CashDiscount.Percent})
+	}
+	for _, f := range fields {
+		if math.IsNaN(f.value) || math.IsInf(f.value, 0) {
+			return f.name
+		}
+	}
+	return ""
+}
+
 // validateSiretLuhn validates a 14-digit SIRET using the Luhn algorithm.
 // Handles the La Poste exception (SIREN 356000000) which uses a simple sum % 5 rule.
 // Assumes the input has already been validated as 14 numeric digits.
@@ -319,39 +1046,209 @@ func validateSiretLuhn(siret string) bool {
 	return false
 }
 
-func parseInt(s string) int {
-	n := 0
-	for _, c := range s {
-		n = n*10 + int(c-'0')
+// validateSirenLuhn validates a 9-digit SIREN using the Luhn algorithm.
+// Assumes the input has already been validated as 9 numeric digits.
+func validateSirenLuhn(siren string) bool {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		digit := int(siren[i] - '0')
+		// Double every second digit from the right: odd positions from the left
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks the format and the ISO 7064 mod 97-10 check digits of an
+// IBAN, ignoring spaces.
+func validIBAN(iban string) bool {
+	iban = compactIBAN(iban)
+	if len(iban) < 15 || len(iban) > 34 || !isUpperLetters(iban[:2]) || !isDigits(iban[2:4]) {
+		return false
+	}
+	// The country code and check digits move to the end, letters count
+	// as 10 to 35
+	remainder := 0
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// compactIBAN removes the spaces of an IBAN and upper-cases it.
+func compactIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+}
+
+// isUpperLetters reports whether s contains only ASCII capital letters.
+func isUpperLetters(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < 'A' || r > 'Z' }) < 0
+}
+
+// isFrench reports whether the party is established in France, where
+// SIRET/SIREN identification and the CGI exemption mentions apply.
+func (c *Contact) isFrench() bool {
+	return strings.EqualFold(c.CountryCode, "FR")
+}
+
+// vatPrefix returns the prefix of VAT numbers issued in a country: its
+// ISO 3166-1 code, except for Greece which uses "EL".
+func vatPrefix(countryCode string) string {
+	if code := strings.ToUpper(countryCode); code != "GR" {
+		return code
+	}
+	return "EL"
+}
+
+// legalMention returns the company mentions of the party, such as "SARL
+// au capital de 10 000,00 € - RCS Paris 123 456 789 - NAF 6201Z", or "" if
+// none is set.
+func (c *Contact) legalMention() string {
+	var parts []string
+	form := strings.TrimSpace(c.LegalForm)
+	switch {
+	case c.ShareCapital > 0 && form != "":
+		parts = append(parts, form+" au capital de "+LocaleFrench.money(toAmount(c.ShareCapital)))
+	case c.ShareCapital > 0:
+		parts = append(parts, "Capital social : "+LocaleFrench.money(toAmount(c.ShareCapital)))
+	case form != "":
+		parts = append(parts, form)
+	}
+	if city := strings.TrimSpace(c.RCSCity); city != "" {
+		siren := c.Siren
+		if siren == "" && len(c.Siret) == 14 {
+			siren = c.Siret[:9]
+		}
+		if len(siren) == 9 {
+			parts = append(parts, fmt.Sprintf("RCS %s %s %s %s", city, siren[:3], siren[3:6], siren[6:]))
+		}
+	}
+	if naf := strings.TrimSpace(c.NAF); naf != "" {
+		parts = append(parts, "NAF "+naf)
+	}
+	return strings.Join(parts, " - ")
+}
+
+// legalID returns the legal registration identifier of a party (BT-30,
+// BT-47) and its ISO 6523 scheme, empty if it has none: 0009 for a SIRET,
+// 0002 for a SIREN, none for an RCS number.
+func (c *Contact) legalID() (id, scheme string) {
+	switch {
+	case c.Siret != "":
+		return c.Siret, SchemeSIRET
+	case c.Siren != "":
+		return c.Siren, SchemeSIREN
+	default:
+		return strings.TrimSpace(c.RCS), ""
 	}
-	return n
 }
 
 // Generate creates a Factur-X PDF/A-3 invoice.
 //
 // Returns the PDF file bytes on success, or an error on failure.
 func Generate(req InvoiceRequest) ([]byte, error) {
+	res, err := GenerateResult(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.PDF, nil
+}
+
+// Result describes a generated invoice, so that callers can log or audit
+// exactly what was produced without parsing the PDF back.
+type Result struct {
+	PDF []byte
+	// XML is the CII XML embedded in the PDF.
+	XML string
+	// Totals are the amounts printed on the invoice and written in the XML.
+	Totals Totals
+	// FileID is the PDF file identifier (trailer /ID), in hexadecimal.
+	FileID string
+	// SHA256 is the SHA-256 digest of PDF, in hexadecimal.
+	SHA256 string
+	// Fingerprint is the digest of the invoice data (see Fingerprint),
+	// unchanged by presentation options.
+	Fingerprint string
+	// LayoutWarnings lists the texts truncated because they did not fit
+	// their area on the PDF, even with a smaller font.
+	LayoutWarnings []LayoutWarning
+}
+
+// GenerateResult is like Generate, but also returns the embedded XML, the
+// totals, the file ID, the digest of the PDF and the invoice fingerprint.
+func GenerateResult(req InvoiceRequest) (*Result, error) {
+	req = normalizeDates(req)
+
 	// Validate input
-	if err := validate(&req); err != nil {
+	if err := Validate(&req).Err(); err != nil {
 		return nil, err
 	}
 
 	// Generate CII XML
-	xml := generateCIIXML(&req)
+	xml, err := generateCIIXML(&req)
+	if err != nil {
+		return nil, err
+	}
 
 	// Generate PDF/A-3 with embedded XML
-	pdf := generatePDF(&req, xml)
+	pdf, warnings, err := generatePDF(&req, xml)
+	if err != nil {
+		return nil, err
+	}
 
-	return pdf, nil
+	fingerprint, err := FingerprintXML([]byte(xml))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(pdf)
+	return &Result{
+		PDF:            pdf,
+		XML:            xml,
+		Totals:         ComputeTotals(&req),
+		FileID:         pdfFileID(&req),
+		SHA256:         hex.EncodeToString(sum[:]),
+		Fingerprint:    fingerprint,
+		LayoutWarnings: warnings,
+	}, nil
 }
 
 // GenerateXMLOnly generates only the CII XML for an invoice (useful for debugging).
 func GenerateXMLOnly(req *InvoiceRequest) (string, error) {
-	if err := validate(req); err != nil {
+	r := normalizeDates(*req)
+	if err := Validate(&r).Err(); err != nil {
 		return "", err
 	}
-	return generateCIIXML(req), nil
+	return generateCIIXML(&r)
 }
 
-// ErrValidation is returned when the invoice request fails validation.
-var ErrValidation = errors.New("validation error")
+// Sentinel errors, testable with errors.Is.
+var (
+	// ErrValidation is returned when the invoice request fails validation.
+	// The concrete error is a ValidationError (use errors.As to inspect it).
+	ErrValidation = errors.New("validation error")
+	// ErrFont is returned when a font cannot be parsed or embedded.
+	ErrFont = errors.New("font error")
+	// ErrPDF is returned when a PDF cannot be built or read.
+	ErrPDF = errors.New("pdf error")
+	// ErrXML is returned when an invoice XML cannot be built or read.
+	ErrXML = errors.New("xml error")
+	// ErrTransmission is returned when a Transmitter fails to send an invoice.
+	ErrTransmission = errors.New("transmission error")
+	// ErrVerification is returned when a generated XML breaks the EN 16931
+	// BR-CO arithmetic rules, and by GenerateVerified when a generated
+	// invoice is inconsistent with its own XML.
+	ErrVerification = errors.New("verification error")
+)
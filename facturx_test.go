@@ -1,9 +1,28 @@
 package facturx
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func sampleRequest() InvoiceRequest {
@@ -92,6 +111,28 @@ func TestValidationInvalidSiret(t *testing.T) {
 	}
 }
 
+func TestValidationNonFinite(t *testing.T) {
+	tests := []struct {
+		field  string
+		modify func(*InvoiceRequest)
+	}{
+		{"Lines[0].Quantity", func(r *InvoiceRequest) { r.Lines[0].Quantity = math.NaN() }},
+		{"Lines[0].UnitPrice", func(r *InvoiceRequest) { r.Lines[0].UnitPrice = math.Inf(1) }},
+		{"Lines[0].EcoContribution", func(r *InvoiceRequest) { r.Lines[0].EcoContribution = math.Inf(-1) }},
+		{"PrepaidAmount", func(r *InvoiceRequest) { r.PrepaidAmount = math.NaN() }},
+		{"Regime", func(r *InvoiceRequest) { r.Regime = VatStandard(math.Inf(1)) }},
+	}
+	for _, tt := range tests {
+		req := sampleRequest()
+		tt.modify(&req)
+		_, err := Generate(req)
+		var verr ValidationError
+		if !errors.As(err, &verr) || verr.Field != tt.field {
+			t.Errorf("%s: expected a validation error, got %v", tt.field, err)
+		}
+	}
+}
+
 func TestValidationInvalidSiretLuhn(t *testing.T) {
 	req := sampleRequest()
 	req.Seller.Siret = "12345678901234" // 14 digits but invalid Luhn checksum
@@ -164,7 +205,7 @@ func TestXMLGeneration(t *testing.T) {
 	// Check required elements
 	checks := []string{
 		"CrossIndustryInvoice",
-		profileURN,
+		versionSpecs[Version1p0].guideline,
 		"<ram:ID>FA-2024-001</ram:ID>",
 		"<ram:TypeCode>380</ram:TypeCode>",
 		"<ram:InvoiceCurrencyCode>EUR</ram:InvoiceCurrencyCode>",
@@ -234,16 +275,127 @@ func TestPDFGeneration(t *testing.T) {
 
 	// Check for required elements
 	pdfStr := string(pdf)
+	xmlContent, _ := GenerateXMLOnly(&req)
 	checks := []string{
 		"/Type /Catalog",
 		"factur-x.xml",
 		"/AFRelationship /Data",
+		"/Subtype /application#2Fxml",
+		"/ModDate (D:" + req.Date + ")",
+		fmt.Sprintf("/CheckSum <%X>", md5.Sum([]byte(xmlContent))),
+		"/Desc (Factur-X XML invoice " + req.Number + ")",
 	}
 	for _, check := range checks {
 		if !strings.Contains(pdfStr, check) {
 			t.Errorf("PDF missing: %s", check)
 		}
 	}
+
+	req.AttachmentDescription = "Facture électronique"
+	pdf, err = Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pdf, []byte("/Desc <FEFF0046006100630074007500720065002000E9")) {
+		t.Error("Custom description not written as a UTF-16 text string")
+	}
+}
+
+func TestXMPMetadata(t *testing.T) {
+	defer func(saved func() time.Time) { now = saved }(now)
+	now = func() time.Time { return time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC) }
+
+	req := sampleRequest()
+	first, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []string{
+		"/CreationDate (D:20240115103000+00'00')",
+		"/Creator (facturx-go) /Producer (facturx-go)",
+		"/Author (" + req.Seller.Name + ")",
+		"<xmp:CreateDate>2024-01-15T10:30:00+00:00</xmp:CreateDate>",
+		"<xmp:CreatorTool>facturx-go</xmp:CreatorTool>",
+		"<pdf:Producer>facturx-go</pdf:Producer>",
+		"<xmpMM:DocumentID>uuid:",
+	}
+	for _, check := range checks {
+		if !bytes.Contains(first, []byte(check)) {
+			t.Errorf("PDF missing: %s", check)
+		}
+	}
+
+	// Same document, new instance
+	now = func() time.Time { return time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC) }
+	second, _ := Generate(req)
+	xmpID := func(pdf []byte, tag string) string {
+		_, after, _ := bytes.Cut(pdf, []byte("<xmpMM:"+tag+">"))
+		id, _, _ := bytes.Cut(after, []byte("<"))
+		return string(id)
+	}
+	if xmpID(first, "DocumentID") != xmpID(second, "DocumentID") {
+		t.Error("DocumentID changed between renditions")
+	}
+	if xmpID(first, "InstanceID") == xmpID(second, "InstanceID") {
+		t.Error("InstanceID did not change between renditions")
+	}
+
+	// A fixed creation date makes the output reproducible
+	req.Metadata = &Metadata{CreationDate: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)}
+	if third, _ := Generate(req); !bytes.Equal(first, third) {
+		t.Error("PDF with the creation date of the first rendition differs from it")
+	}
+}
+
+func TestFacturXVersion(t *testing.T) {
+	req := sampleRequest()
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pdf, []byte("/AFRelationship /Data")) || !bytes.Contains(pdf, []byte("<fx:Version>1.0</fx:Version>")) {
+		t.Error("Default version should be Factur-X 1.0")
+	}
+
+	req.FacturXVersion = Version1p07
+	pdf, err = Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pdf, []byte("/AFRelationship /Alternative")) {
+		t.Error("Factur-X 1.0.07 attachment should be an alternative representation")
+	}
+	if _, err := ExtractXML(pdf); err != nil {
+		t.Errorf("ExtractXML failed: %v", err)
+	}
+
+	req.FacturXVersion = "2.0"
+	var verr ValidationError
+	if _, err := Generate(req); !errors.As(err, &verr) || verr.Field != "FacturXVersion" {
+		t.Errorf("Expected a FacturXVersion validation error, got %v", err)
+	}
+}
+
+func TestAttachmentAnnotation(t *testing.T) {
+	req := sampleRequest()
+	pdf, _ := Generate(req)
+	if bytes.Contains(pdf, []byte("/FileAttachment")) {
+		t.Error("Annotation added without AttachmentAnnotation")
+	}
+
+	req.AttachmentAnnotation = true
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []string{"/Annots [16 0 R]", "/Subtype /FileAttachment", "/FS 7 0 R", "/F 4 /AP << /N 17 0 R >>"} {
+		if !bytes.Contains(pdf, []byte(check)) {
+			t.Errorf("PDF missing: %s", check)
+		}
+	}
+	if _, err := ExtractXML(pdf); err != nil {
+		t.Errorf("ExtractXML failed: %v", err)
+	}
 }
 
 func TestWinAnsiEncoding(t *testing.T) {
@@ -258,15 +410,18 @@ func TestWinAnsiEncoding(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		result := encodeWinAnsi(tt.input)
+		result := escapeWinAnsi(DefaultFont.Encode(tt.input))
 		if result != tt.expected {
-			t.Errorf("encodeWinAnsi(%q) = %q, want %q", tt.input, result, tt.expected)
+			t.Errorf("Encode(%q) = %q, want %q", tt.input, result, tt.expected)
 		}
 	}
 }
 
 func TestFontMetrics(t *testing.T) {
-	metrics := getFontMetrics()
+	metrics, err := loadFontMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Liberation Sans should have 2048 units per em
 	if metrics.unitsPerEM != 2048 {
@@ -290,12 +445,43 @@ func TestProfessionalIds(t *testing.T) {
 		{Type: "ADELI", Value: "123456789"},
 		{Type: "RPPS", Value: "12345678901"},
 	}
-	pdf, err := Generate(req)
+	res, err := GenerateResult(req)
 	if err != nil {
 		t.Fatalf("Generation failed: %v", err)
 	}
-	if len(pdf) < 1000 {
-		t.Error("PDF too small")
+	// Without scheme: ADELI and RPPS are not ISO 6523 ICD codes
+	if !strings.Contains(res.XML, `<ram:ID>123456789</ram:ID>`) || !strings.Contains(res.XML, `<ram:ID>12345678901</ram:ID>`) || strings.Contains(res.XML, `schemeID="ADELI"`) {
+		t.Errorf("Expected the professional identifiers in XML:\n%s", res.XML)
+	}
+	if !bytes.Contains(res.PDF, []byte("ADELI: 123456789")) {
+		t.Error("Expected the ADELI number on the PDF")
+	}
+
+	// The type is only printed, so it is not read back
+	want := []ProfessionalId{{Value: "123456789"}, {Value: "12345678901"}}
+	parsed, err := ParseXML([]byte(res.XML))
+	if err != nil || !reflect.DeepEqual(parsed.Seller.ProfessionalIds, want) {
+		t.Errorf("ParseXML ProfessionalIds = %v (%v)", parsed.Seller.ProfessionalIds, err)
+	}
+	ubl, err := ConvertToUBL([]byte(res.XML))
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if parsed, err := ParseUBL([]byte(ubl)); err != nil || !reflect.DeepEqual(parsed.Seller.ProfessionalIds, want) || len(parsed.Seller.GlobalIds) != 0 {
+		t.Errorf("ParseUBL ProfessionalIds = %v, GlobalIds %v (%v)", parsed.Seller.ProfessionalIds, parsed.Seller.GlobalIds, err)
+	}
+
+	// Parsed identifiers have no type and can be generated again
+	req.Seller.ProfessionalIds = parsed.Seller.ProfessionalIds
+	if res, err = GenerateResult(req); err != nil {
+		t.Fatalf("Generation without type failed: %v", err)
+	}
+	if !bytes.Contains(res.PDF, []byte(`(N\260 123456789)`)) {
+		t.Error("Expected the untyped identifier on the PDF")
+	}
+	req.Seller.ProfessionalIds = []ProfessionalId{{Type: "ADELI"}}
+	if errs := Validate(&req).Errors; len(errs) == 0 || errs[0].Field != "Seller.ProfessionalIds[0].Value" {
+		t.Errorf("Expected an error on the identifier value, got %v", errs)
 	}
 }
 
@@ -341,8 +527,26 @@ func TestLineDates(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Generation failed: %v", err)
 	}
-	if len(pdf) < 1000 {
-		t.Error("PDF too small")
+	if !bytes.Contains(pdf, []byte("(10/01/2024)")) {
+		t.Error("PDF should show the service date column")
+	}
+
+	// Service dates are written as one-day billing periods
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	want := "<ram:StartDateTime>\n            <udt:DateTimeString format=\"102\">20240110</udt:DateTimeString>\n          </ram:StartDateTime>\n" +
+		"          <ram:EndDateTime>\n            <udt:DateTimeString format=\"102\">20240110</udt:DateTimeString>"
+	if !strings.Contains(xml, want) {
+		t.Error("XML should carry the service date as the line billing period")
+	}
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if got := parsed.Lines[1].ServiceDate; !got.Equal(time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)) || !parsed.Lines[1].PeriodStart.IsZero() {
+		t.Errorf("Parsed line = %+v, want service date 11/01/2024", parsed.Lines[1])
 	}
 }
 
@@ -370,6 +574,44 @@ func TestHealthExemptionVat(t *testing.T) {
 	}
 }
 
+func TestMarginSchemeVat(t *testing.T) {
+	req := sampleRequest()
+	req.Regime = VatMarginScheme()
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:ExemptionReason>TVA sur la marge, art. 297 A du CGI</ram:ExemptionReason>",
+		"<ram:CategoryCode>E</ram:CategoryCode>",
+		"<ram:ExemptionReasonCode>VATEX-EU-F</ram:ExemptionReasonCode>",
+		`<ram:TaxTotalAmount currencyID="EUR">0.00</ram:TaxTotalAmount>`,
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if parsed.Regime != req.Regime {
+		t.Errorf("Parsed regime = %+v, want the margin scheme", parsed.Regime)
+	}
+
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("TVA sur la marge, art. 297 A du CGI")) {
+		t.Error("PDF should carry the margin scheme mention")
+	}
+	if bytes.Contains(pdf, []byte("(TVA (")) || bytes.Contains(pdf, []byte("Total HT")) {
+		t.Error("PDF should not show VAT under the margin scheme")
+	}
+}
+
 func BenchmarkGenerate(b *testing.B) {
 	req := sampleRequest()
 	for i := 0; i < b.N; i++ {
@@ -389,3 +631,2877 @@ func BenchmarkGenerateXML(b *testing.B) {
 		}
 	}
 }
+
+// The fuzz targets below feed untrusted input to the parsers: custom
+// fonts, received PDFs and received XML invoices. They must fail with an
+// error, never panic. Run one with e.g. go test -fuzz FuzzTrueTypeFont.
+
+func FuzzTrueTypeFont(f *testing.F) {
+	f.Add(fontData)
+	f.Add(fontData[:len(fontData)/2])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		font, err := NewTrueTypeFont("Fuzz", data)
+		if err != nil {
+			if !errors.Is(err, ErrFont) {
+				t.Errorf("Expected ErrFont, got %v", err)
+			}
+			return
+		}
+		metrics, _ := font.Metrics()
+		metrics.stringWidth("Facture N° 1 : 1 234,56 €", 10)
+		font.Encode("Facture N° 1 : 1 234,56 €")
+		subsetFont(data, contentGlyphs([]byte("(Facture) Tj"), metrics))
+	})
+}
+
+func FuzzExtractXML(f *testing.F) {
+	req := sampleRequest()
+	pdf, err := Generate(req)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(pdf)
+	req.ObjectStreams = true
+	if pdf, err = Generate(req); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(pdf)
+	f.Add([]byte("%PDF-1.7\nxref\n0 1\n0000000000 65535 f \ntrailer\n<< /Size 1 >>\nstartxref\n9\n%%EOF\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ExtractXML(data)
+		CheckPDFA(data)
+	})
+}
+
+func FuzzParseXML(f *testing.F) {
+	req := sampleRequest()
+	req.AddShipping(15, 20)
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add([]byte(xml))
+	ubl, err := ConvertToUBL([]byte(xml))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add([]byte(ubl))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ParseXML(data)
+		ValidateXML(data)
+		ParseUBL(data)
+	})
+}
+
+func TestLimitsWarnings(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].UnitPrice = 100000 // 10 x 100 000 = 1 000 000
+	limits := DefaultLimits()
+	req.Limits = &limits
+
+	result := Validate(&req)
+	if !result.Valid() {
+		t.Fatalf("Expected valid request, got %v", result.Err())
+	}
+	if len(result.Warnings) != 2 {
+		t.Errorf("Expected 2 warnings (line amount, grand total), got %d: %v", len(result.Warnings), result.Warnings)
+	}
+
+	if _, err := Generate(req); err != nil {
+		t.Errorf("Warnings should not block generation: %v", err)
+	}
+}
+
+func TestPlausibilityWarnings(t *testing.T) {
+	defer func(saved func() time.Time) { now = saved }(now)
+	now = func() time.Time { return time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC) }
+
+	req := sampleRequest() // issued 2024-01-15
+	req.DueDate = time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	for i := range req.Lines {
+		req.Lines[i].UnitPrice = 0
+	}
+	result := Validate(&req)
+	if !result.Valid() {
+		t.Fatalf("Expected valid request, got %v", result.Err())
+	}
+	var fields []string
+	for _, w := range result.Warnings {
+		fields = append(fields, w.Field+": "+w.Message)
+	}
+	want := []string{"Date: issue date is in the future", "DueDate: due date is before the issue date", "Lines: invoice total is zero"}
+	if !slices.Equal(fields, want) {
+		t.Errorf("Warnings = %v, want %v", fields, want)
+	}
+
+	// Thresholds only apply with limits
+	now = func() time.Time { return time.Date(2027, 6, 1, 9, 0, 0, 0, time.UTC) }
+	req = sampleRequest()
+	if result := Validate(&req); len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings without limits, got %v", result.Warnings)
+	}
+	req.Limits = &Limits{MaxUnitPrice: 50, MaxAgeYears: 3}
+	fields = nil
+	for _, w := range Validate(&req).Warnings {
+		fields = append(fields, w.Field+": "+w.Message)
+	}
+	want = []string{"Lines[0].UnitPrice: unit price 100.00 exceeds limit 50.00", "Date: issue date is more than 3 years old"}
+	if !slices.Equal(fields, want) {
+		t.Errorf("Warnings = %v, want %v", fields, want)
+	}
+}
+
+func TestLimitsStrict(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].Quantity = 50000
+	req.Limits = &Limits{MaxQuantity: 1000, Strict: true}
+
+	_, err := Generate(req)
+	ve, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("Expected ValidationError, got %T (%v)", err, err)
+	}
+	if ve.Field != "Lines[0].Quantity" {
+		t.Errorf("Expected field Lines[0].Quantity, got %s", ve.Field)
+	}
+}
+
+func TestDecimalAmounts(t *testing.T) {
+	tests := []struct {
+		quantity, price float64
+		expected        string
+	}{
+		{3, 0.1, "0.30"},
+		{1, 1.005, "1.01"},
+		{0.333, 3, "1.00"},
+		{2.5, 19.99, "49.98"},
+		{1, 0, "0.00"},
+	}
+	for _, tt := range tests {
+		if got := lineNetAmount(tt.quantity, tt.price).String(); got != tt.expected {
+			t.Errorf("lineNetAmount(%v, %v) = %s, want %s", tt.quantity, tt.price, got, tt.expected)
+		}
+	}
+
+	if got := amount(-1205).String(); got != "-12.05" {
+		t.Errorf("amount(-1205).String() = %s, want -12.05", got)
+	}
+	if got := percentOf(toAmount(0.3), 5.5).String(); got != "0.02" {
+		t.Errorf("percentOf(0.30, 5.5) = %s, want 0.02", got)
+	}
+}
+
+func TestXMLCalculationsExact(t *testing.T) {
+	req := sampleRequest()
+	req.Lines = []InvoiceLine{
+		{Description: "A", Quantity: 1, UnitPrice: 0.1},
+		{Description: "B", Quantity: 1, UnitPrice: 0.1},
+		{Description: "C", Quantity: 1, UnitPrice: 0.1},
+	}
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	// 0.1 + 0.1 + 0.1 must be exactly 0.30, VAT 0.06, total 0.36
+	for _, check := range []string{
+		"<ram:LineTotalAmount>0.30</ram:LineTotalAmount>",
+		`<ram:TaxTotalAmount currencyID="EUR">0.06</ram:TaxTotalAmount>`,
+		"<ram:GrandTotalAmount>0.36</ram:GrandTotalAmount>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+}
+
+func TestTimeDates(t *testing.T) {
+	req := sampleRequest()
+	req.Date = ""
+	req.IssueDate = time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	req.DueDate = time.Date(2024, 4, 4, 0, 0, 0, 0, time.UTC)
+	req.Lines[0].ServiceDate = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	req.Payment = &Payment{PaidOn: time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC), Method: PaymentTransfer}
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, `<udt:DateTimeString format="102">20240305</udt:DateTimeString>`) {
+		t.Error("Issue date not formatted from IssueDate")
+	}
+	if !strings.Contains(xml, "<ram:DueDateDateTime>") || !strings.Contains(xml, ">20240404<") {
+		t.Error("Due date missing")
+	}
+	if req.Date != "" || req.Payment.Date != "" || req.Lines[0].Date != "" {
+		t.Error("Caller's request must not be modified")
+	}
+
+	if _, err := Generate(req); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+}
+
+func TestValidationImpossibleDate(t *testing.T) {
+	req := sampleRequest()
+	req.Date = "20240231"
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for 31 February")
+	}
+
+	req = sampleRequest()
+	req.Payment = &Payment{Date: "2024-01-15", Method: PaymentCash}
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for payment date format")
+	}
+}
+
+func TestInvoiceBuilder(t *testing.T) {
+	sample := sampleRequest()
+	req, err := NewInvoice("FA-2024-002").
+		IssuedOn(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)).
+		Seller(sample.Seller).
+		Buyer(sample.Buyer).
+		AddLine("Service 1", 2, 50).
+		AddLine("Service 2", 1, 100).
+		Regime(VatFranchiseAuto()).
+		PaidOn(time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC), PaymentCheck).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if req.Number != "FA-2024-002" || len(req.Lines) != 2 || req.Payment == nil {
+		t.Errorf("Unexpected request: %+v", req)
+	}
+
+	if _, err := NewInvoice("FA-2024-003").Seller(sample.Seller).Buyer(sample.Buyer).Build(); err == nil {
+		t.Error("Expected validation error for missing date and lines")
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	req := sampleRequest()
+	var buf bytes.Buffer
+	if err := ExportXLSX(&buf, []InvoiceRequest{req, req}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Invalid ZIP: %v", err)
+	}
+	names := map[string]*zip.File{}
+	for _, f := range zr.File {
+		names[f.Name] = f
+	}
+	for _, name := range []string{"[Content_Types].xml", "xl/workbook.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if names[name] == nil {
+			t.Errorf("Workbook missing %s", name)
+		}
+	}
+
+	rc, _ := names["xl/worksheets/sheet1.xml"].Open()
+	sheet, _ := io.ReadAll(rc)
+	rc.Close()
+	if !strings.Contains(string(sheet), `<c r="I2" s="2"><v>1200</v></c>`) {
+		t.Errorf("Grand total cell not found in sheet: %s", sheet)
+	}
+	if !strings.Contains(string(sheet), `<c r="B2" s="3"><v>45306</v></c>`) {
+		t.Error("Date cell should be an Excel serial date")
+	}
+}
+
+func TestExport(t *testing.T) {
+	req := sampleRequest()
+	req.Number = "F/2024/001"
+	var buf bytes.Buffer
+	if err := Export(&buf, req); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Invalid ZIP: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	for _, name := range []string{"F-2024-001.pdf", "F-2024-001.xml", "F-2024-001.json", "F-2024-001.report.json"} {
+		if files[name] == nil {
+			t.Fatalf("Bundle missing %s: %v", name, slices.Collect(maps.Keys(files)))
+		}
+	}
+
+	embedded, err := ExtractXML(files["F-2024-001.pdf"])
+	if err != nil || !bytes.Equal(embedded, files["F-2024-001.xml"]) {
+		t.Errorf("Standalone XML should be the embedded one (%v)", err)
+	}
+	var back InvoiceRequest
+	if err := json.Unmarshal(files["F-2024-001.json"], &back); err != nil || back.Number != req.Number {
+		t.Errorf("Unexpected JSON rendition (%v): %s", err, files["F-2024-001.json"])
+	}
+
+	var report AuditReport
+	if err := json.Unmarshal(files["F-2024-001.report.json"], &report); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	fingerprint, _ := Fingerprint(req)
+	if !report.Verified || report.Number != req.Number || report.Fingerprint != fingerprint || report.Totals.GrandTotal != 1200 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if len(report.XML.Errors) != 0 || len(report.PDFA) != 0 {
+		t.Errorf("Report should be clean: %+v", report)
+	}
+	sum := sha256.Sum256(files["F-2024-001.pdf"])
+	if report.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Error("Report digest should be the PDF one")
+	}
+
+	req.Number = ""
+	if err := Export(io.Discard, req); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
+
+func TestComputeTotals(t *testing.T) {
+	req := sampleRequest()
+	req.Lines = []InvoiceLine{
+		{Description: "Service 1", Quantity: 3, UnitPrice: 0.1},
+		{Description: "Service 2", Quantity: 2, UnitPrice: 500},
+	}
+	totals := ComputeTotals(&req)
+
+	if totals.LineTotal != 1000.30 || totals.TaxTotal != 200.06 || totals.GrandTotal != 1200.36 || totals.DuePayable != 1200.36 {
+		t.Errorf("Unexpected totals: %+v", totals)
+	}
+	if len(totals.Lines) != 2 || totals.Lines[0] != 0.30 {
+		t.Errorf("Unexpected line amounts: %v", totals.Lines)
+	}
+	if len(totals.VAT) != 1 || totals.VAT[0].CategoryCode != "S" || totals.VAT[0].Rate != 20 {
+		t.Errorf("Unexpected VAT breakdown: %+v", totals.VAT)
+	}
+}
+
+func TestReverseCharge(t *testing.T) {
+	req := sampleRequest()
+	req.Regime = VatReverseCharge()
+	req.Buyer.CountryCode = "DE"
+	req.Buyer.Siret = ""
+	req.Buyer.VatNumber = "DE123456789"
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	checks := []string{
+		"<ram:CategoryCode>AE</ram:CategoryCode>",
+		"<ram:ExemptionReasonCode>VATEX-EU-AE</ram:ExemptionReasonCode>",
+		"<ram:SubjectCode>TXD</ram:SubjectCode>",
+		"art. 283-2 du CGI",
+		"Steuerschuldnerschaft des Leistungsempfängers",
+		`<ram:TaxTotalAmount currencyID="EUR">0.00</ram:TaxTotalAmount>`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	// Country codes are matched case-insensitively
+	req.Buyer.CountryCode = "de"
+	if xml, err = GenerateXMLOnly(&req); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, "Steuerschuldnerschaft des Leistungsempfängers") {
+		t.Error("Lowercase country code: German mention missing")
+	}
+
+	req.Buyer.VatNumber = ""
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for missing buyer VAT number")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities()
+	if len(caps.Profiles) == 0 || caps.Profiles[0] != "BASIC" {
+		t.Errorf("Unexpected profiles: %v", caps.Profiles)
+	}
+	found := false
+	for _, s := range caps.Subsystems {
+		if s == "xlsx" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("xlsx subsystem not advertised: %v", caps.Subsystems)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	req := sampleRequest()
+	req.Number = ""
+	_, err := Generate(req)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected errors.Is(err, ErrValidation), got %v", err)
+	}
+	var ve ValidationError
+	if !errors.As(err, &ve) || ve.Field != "Number" {
+		t.Errorf("Expected ValidationError on Number, got %v", err)
+	}
+
+	if _, err := parseTTF([]byte("not a font")); !errors.Is(err, ErrFont) {
+		t.Errorf("Expected errors.Is(err, ErrFont), got %v", err)
+	}
+}
+
+func TestBrokenFont(t *testing.T) {
+	reset := func() {
+		metricsOnce, staticOnce = sync.Once{}, sync.Once{}
+		cachedMetrics, metricsErr, staticErr = nil, nil, nil
+	}
+	original := fontData
+	fontData = []byte("not a font")
+	reset()
+	defer func() {
+		fontData = original
+		reset()
+	}()
+
+	if err := WarmUp(); !errors.Is(err, ErrFont) {
+		t.Errorf("WarmUp should report the broken font, got %v", err)
+	}
+	if _, err := Generate(sampleRequest()); !errors.Is(err, ErrFont) {
+		t.Errorf("Generate should return ErrFont instead of panicking, got %v", err)
+	}
+	if _, err := PreviewSVG(sampleRequest()); !errors.Is(err, ErrFont) {
+		t.Errorf("PreviewSVG should return ErrFont, got %v", err)
+	}
+}
+
+func TestVatDueDate(t *testing.T) {
+	req := sampleRequest()
+	req.VatDueDateType = VatDueOnInvoice
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, "<ram:DueDateTypeCode>5</ram:DueDateTypeCode>") {
+		t.Error("DueDateTypeCode missing")
+	}
+	if !strings.Contains(xml, "d&apos;après les débits") {
+		t.Error("Débits mention missing")
+	}
+
+	req.VatDueDateType = ""
+	req.TaxPointDate = time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)
+	xml, err = GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, `<udt:DateString format="102">20240120</udt:DateString>`) {
+		t.Error("TaxPointDate missing")
+	}
+
+	req.VatDueDateType = VatDueOnPayment
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error when both BT-7 and BT-8 are set")
+	}
+}
+
+func TestGrossPriceDiscount(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].GrossPrice = 120
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:GrossPriceProductTradePrice>\n          <ram:ChargeAmount>120.0000</ram:ChargeAmount>",
+		"<ram:ActualAmount>20.0000</ram:ActualAmount>",
+		"<ram:LineTotalAmount>1000.00</ram:LineTotalAmount>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	if _, err := Generate(req); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+
+	req.Lines[0].GrossPrice = 50
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for gross price below unit price")
+	}
+}
+
+func TestLineDiscountPercent(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].DiscountPercent = 12.5
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:CalculationPercent>12.50</ram:CalculationPercent>",
+		"<ram:BasisAmount>1000.00</ram:BasisAmount>\n          <ram:ActualAmount>125.00</ram:ActualAmount>",
+		"<ram:ReasonCode>95</ram:ReasonCode>",
+		"<ram:LineTotalAmount>875.00</ram:LineTotalAmount>",
+		"<ram:GrandTotalAmount>1050.00</ram:GrandTotalAmount>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if parsed.Lines[0].DiscountPercent != 12.5 {
+		t.Errorf("Parsed discount = %v, want 12.5", parsed.Lines[0].DiscountPercent)
+	}
+	if result, _ := ValidateXML([]byte(xml)); !result.Valid() {
+		t.Errorf("Discounted XML should be valid: %+v", result.Errors)
+	}
+
+	res, err := GenerateVerified(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(res.PDF, []byte("(Remise)")) {
+		t.Error("PDF should have a Remise column")
+	}
+
+	req.Lines[0].DiscountPercent = 120
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for a discount above 100%")
+	}
+}
+
+func TestRefundLines(t *testing.T) {
+	req := sampleRequest()
+	req.Lines = append(req.Lines, InvoiceLine{Description: "Avoir sur prestation", Quantity: -2.5, UnitPrice: 100})
+	req.Limits = &Limits{MaxQuantity: 2, Strict: true}
+
+	result := Validate(&req)
+	if result.Valid() || result.Errors[0].Field != "Lines[0].Quantity" || len(result.Errors) != 2 {
+		t.Errorf("Expected both lines over the quantity limit, got %+v", result.Errors)
+	}
+	req.Limits = nil
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:BilledQuantity unitCode=\"C62\">-2.5000</ram:BilledQuantity>",
+		"<ram:LineTotalAmount>-250.00</ram:LineTotalAmount>",
+		"<ram:LineTotalAmount>750.00</ram:LineTotalAmount>",
+		"<ram:GrandTotalAmount>900.00</ram:GrandTotalAmount>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	// A credit exceeding the invoice makes every total negative
+	req.Lines[1].Quantity = -15
+	res, err := GenerateVerified(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if res.Totals.GrandTotal != -600 {
+		t.Errorf("GrandTotal = %v, want -600", res.Totals.GrandTotal)
+	}
+	for _, check := range []string{"(-15,00)", `(-1\240500,00\240\200)`, `(-600,00\240\200)`} {
+		if !bytes.Contains(res.PDF, []byte(check)) {
+			t.Errorf("PDF missing %s", check)
+		}
+	}
+
+	req.Lines[1].Quantity = 0
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for a zero quantity")
+	}
+	req.Lines[1].Quantity, req.Lines[1].UnitPrice = 1, -100
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for a negative unit price")
+	}
+}
+
+func TestShippingCharge(t *testing.T) {
+	req := sampleRequest()
+	req.AddShipping(15, 20)
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<udt:Indicator>true</udt:Indicator>\n        </ram:ChargeIndicator>\n        <ram:ActualAmount>15.00</ram:ActualAmount>",
+		"<ram:ReasonCode>FC</ram:ReasonCode>\n        <ram:Reason>Frais de port</ram:Reason>",
+		"<ram:LineTotalAmount>1000.00</ram:LineTotalAmount>\n        <ram:ChargeTotalAmount>15.00</ram:ChargeTotalAmount>",
+		"<ram:TaxBasisTotalAmount>1015.00</ram:TaxBasisTotalAmount>",
+		"<ram:GrandTotalAmount>1218.00</ram:GrandTotalAmount>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if len(parsed.Charges) != 1 || parsed.Charges[0] != req.Charges[0] {
+		t.Errorf("Parsed charges = %+v, want %+v", parsed.Charges, req.Charges)
+	}
+	if result, _ := ValidateXML([]byte(xml)); !result.Valid() {
+		t.Errorf("XML with charges should be valid: %+v", result.Errors)
+	}
+
+	res, err := GenerateVerified(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if res.Totals.Charges != 15 || res.Totals.TaxBasis != 1015 {
+		t.Errorf("Totals = %+v", res.Totals)
+	}
+	if !bytes.Contains(res.PDF, []byte("(Frais de port:)")) {
+		t.Error("PDF totals should show the shipping costs")
+	}
+
+	req.Charges[0].VatRate = 5.5
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for a charge at another VAT rate")
+	}
+}
+
+func TestEcoContribution(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].DiscountPercent = 10
+	req.Lines[0].EcoContribution = 12.5
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:BasisAmount>1000.00</ram:BasisAmount>\n          <ram:ActualAmount>100.00</ram:ActualAmount>",
+		"<ram:ActualAmount>12.50</ram:ActualAmount>\n          <ram:Reason>Éco-participation DEEE</ram:Reason>",
+		"<ram:LineTotalAmount>912.50</ram:LineTotalAmount>",
+		"<ram:TaxTotalAmount currencyID=\"EUR\">182.50</ram:TaxTotalAmount>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if line := parsed.Lines[0]; line.EcoContribution != 12.5 || line.DiscountPercent != 10 {
+		t.Errorf("Parsed line = %+v", line)
+	}
+	if result, _ := ValidateXML([]byte(xml)); !result.Valid() {
+		t.Errorf("XML with eco-contribution should be valid: %+v", result.Errors)
+	}
+
+	res, err := GenerateVerified(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(res.PDF, []byte(`co-participation DEEE : 12,50\240\200 HT)`)) {
+		t.Error("PDF should print the eco-participation under the line")
+	}
+
+	req.Lines[0].EcoContribution = -1
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for a negative eco-contribution")
+	}
+}
+
+func TestLatePaymentMentions(t *testing.T) {
+	req := sampleRequest()
+	req.LatePayment = &LatePaymentTerms{PenaltyRate: 10.5}
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:Content>Pénalités de retard : 10,5 % par an</ram:Content>\n      <ram:SubjectCode>PMD</ram:SubjectCode>",
+		"<ram:Content>Indemnité forfaitaire pour frais de recouvrement en cas de retard de paiement : 40 €</ram:Content>\n      <ram:SubjectCode>PMT</ram:SubjectCode>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if parsed.LatePayment == nil || *parsed.LatePayment != *req.LatePayment || parsed.CustomMentions != "" {
+		t.Errorf("Parsed late payment = %+v, mentions %q", parsed.LatePayment, parsed.CustomMentions)
+	}
+
+	// Default: legal penalty rate
+	req.LatePayment = &LatePaymentTerms{}
+	xml, _ = GenerateXMLOnly(&req)
+	if !strings.Contains(xml, "trois fois le taux d&apos;intérêt légal") {
+		t.Error("XML missing the legal penalty rate")
+	}
+	if parsed, _ := ParseXML([]byte(xml)); parsed.LatePayment == nil || *parsed.LatePayment != (LatePaymentTerms{}) {
+		t.Errorf("Parsed default late payment = %+v", parsed.LatePayment)
+	}
+
+	req.LatePayment.PenaltyRate = -1
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for a negative penalty rate")
+	}
+}
+
+func TestCashDiscount(t *testing.T) {
+	req := sampleRequest()
+	xml, _ := GenerateXMLOnly(&req)
+	if !strings.Contains(xml, "<ram:Content>Escompte : néant</ram:Content>\n      <ram:SubjectCode>AAB</ram:SubjectCode>") {
+		t.Error("B2B invoice without discount should state \"Escompte : néant\"")
+	}
+
+	req.CashDiscount = &CashDiscount{Percent: 1.5, Days: 8}
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:Description>Paiement à réception de facture. Escompte de 1,5 % pour paiement sous 8 jours</ram:Description>",
+		"<ram:Content>Escompte de 1,5 % pour paiement sous 8 jours</ram:Content>\n      <ram:SubjectCode>AAB</ram:SubjectCode>",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+	if strings.Contains(xml, "néant") {
+		t.Error("XML should not state \"Escompte : néant\" with a discount")
+	}
+
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if parsed.CashDiscount == nil || *parsed.CashDiscount != *req.CashDiscount || parsed.CustomMentions != "" {
+		t.Errorf("Parsed cash discount = %+v, mentions %q", parsed.CashDiscount, parsed.CustomMentions)
+	}
+
+	// B2C invoices need no discount mention
+	req.CashDiscount = nil
+	req.Buyer.Siret, req.Buyer.VatNumber = "", ""
+	if xml, _ := GenerateXMLOnly(&req); strings.Contains(xml, "Escompte") {
+		t.Error("B2C invoice should have no discount mention")
+	}
+
+	req.CashDiscount = &CashDiscount{Percent: 0}
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for a zero discount")
+	}
+}
+
+func TestSirenAndRCS(t *testing.T) {
+	req := sampleRequest()
+	req.Seller.Siret = ""
+	req.Seller.Siren = "528250004"
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, `<ram:ID schemeID="0002">528250004</ram:ID>`) {
+		t.Error("XML should carry the SIREN with scheme 0002")
+	}
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if parsed.Seller.Siren != "528250004" || parsed.Seller.Siret != "" {
+		t.Errorf("Parsed seller = %+v", parsed.Seller)
+	}
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("SIREN: 528250004")) {
+		t.Error("PDF should show the SIREN")
+	}
+
+	req.Seller.Siren = ""
+	req.Seller.RCS = "RCS Paris 528 250 004"
+	xml, err = GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, "<ram:ID>RCS Paris 528 250 004</ram:ID>") {
+		t.Error("XML should carry the RCS number without a scheme")
+	}
+	if parsed, err = ParseXML([]byte(xml)); err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if parsed.Seller.RCS != req.Seller.RCS {
+		t.Errorf("Parsed RCS = %q, want %q", parsed.Seller.RCS, req.Seller.RCS)
+	}
+
+	for name, seller := range map[string]Contact{
+		"bad SIREN checksum": {Siren: "528250005"},
+		"SIRET/SIREN clash":  {Siret: "52825000400033", Siren: "356000000"},
+		"no identifier":      {},
+	} {
+		req := sampleRequest()
+		seller.Name, seller.Address, seller.ZipCode, seller.City, seller.CountryCode =
+			req.Seller.Name, req.Seller.Address, req.Seller.ZipCode, req.Seller.City, req.Seller.CountryCode
+		req.Seller = seller
+		if _, err := Generate(req); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestForeignSeller(t *testing.T) {
+	req := sampleRequest()
+	req.Seller.CountryCode = "DE"
+	req.Seller.Siret = ""
+	req.Seller.VatNumber = "DE123456789"
+
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if strings.Count(xml, "<ram:SpecifiedLegalOrganization>") != 1 {
+		t.Error("only the buyer should carry a SIRENE identifier")
+	}
+	if !strings.Contains(xml, `<ram:ID schemeID="VA">DE123456789</ram:ID>`) {
+		t.Error("XML should carry the seller VAT number")
+	}
+	if strings.Contains(xml, noDiscountText) {
+		t.Error("foreign seller should not get the French cash discount mention")
+	}
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("TVA: DE123456789")) {
+		t.Error("PDF should identify the foreign seller by its VAT number")
+	}
+
+	req.Seller.CountryCode, req.Seller.VatNumber = "GR", "EL123456789"
+	if _, err := Generate(req); err != nil {
+		t.Errorf("Greek VAT prefix should be accepted: %v", err)
+	}
+
+	for name, mutate := range map[string]func(*InvoiceRequest){
+		"no VAT number":    func(r *InvoiceRequest) { r.Seller.VatNumber = "" },
+		"wrong VAT prefix": func(r *InvoiceRequest) { r.Seller.VatNumber = "FR12345678901" },
+		"SIRET":            func(r *InvoiceRequest) { r.Seller.Siret = "52825000400033" },
+		"franchise":        func(r *InvoiceRequest) { r.Regime = VatFranchiseAuto() },
+	} {
+		r := req
+		mutate(&r)
+		if _, err := Generate(r); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestLocaleFormatting(t *testing.T) {
+	req := sampleRequest()
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(pdf, []byte(`(1\240200,00\240\200)`)) {
+		t.Error("PDF should print French amounts by default")
+	}
+
+	req.Locale = LocaleEnglish
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(res.PDF, []byte(`(\2001,200.00)`)) {
+		t.Error("PDF should print English amounts")
+	}
+	if !strings.Contains(res.XML, "<ram:GrandTotalAmount>1200.00</ram:GrandTotalAmount>") {
+		t.Error("XML amounts should not depend on the locale")
+	}
+
+	for a, want := range map[amount]string{0: "0,00", -5: "-0,05", 123456789: "1\u202F234\u202F567,89"} {
+		if got := LocaleFrench.decimal(a); got != want {
+			t.Errorf("decimal(%d) = %q, want %q", a, got, want)
+		}
+	}
+
+	req.Locale = "de"
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for an unknown locale")
+	}
+}
+
+func TestDeliveryDate(t *testing.T) {
+	req := sampleRequest()
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if strings.Contains(xml, "ActualDeliverySupplyChainEvent") {
+		t.Error("XML should not invent a delivery date")
+	}
+
+	req.DeliveryDate = time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	xml, err = GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, "<ram:OccurrenceDateTime>\n          <udt:DateTimeString format=\"102\">20240105</udt:DateTimeString>") {
+		t.Error("XML should carry the delivery date")
+	}
+	parsed, err := ParseXML([]byte(xml))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if !parsed.DeliveryDate.Equal(req.DeliveryDate) {
+		t.Errorf("Parsed delivery date = %v, want %v", parsed.DeliveryDate, req.DeliveryDate)
+	}
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("(Date de livraison : 05/01/2024)")) {
+		t.Error("PDF should print the delivery date")
+	}
+}
+
+func TestDocumentMetadata(t *testing.T) {
+	req := sampleRequest()
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{"/Title (Facture FA-2024-001)", "/Producer (facturx-go)", "<pdf:Producer>facturx-go</pdf:Producer>"} {
+		if !bytes.Contains(pdf, []byte(check)) {
+			t.Errorf("PDF missing %s", check)
+		}
+	}
+	if bytes.Contains(pdf, []byte("/Subject")) {
+		t.Error("PDF should have no subject by default")
+	}
+
+	req.Metadata = &Metadata{Title: "Archive 2024", Subject: "Factures clients", Producer: "ACME ERP"}
+	pdf, err = Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"/Title (Archive 2024) /Author (ACME Corp) /Subject (Factures clients)",
+		"/Producer (ACME ERP)",
+		`<rdf:li xml:lang="x-default">Archive 2024</rdf:li>`,
+		`<rdf:li xml:lang="x-default">Factures clients</rdf:li>`,
+		"<pdf:Producer>ACME ERP</pdf:Producer>",
+	} {
+		if !bytes.Contains(pdf, []byte(check)) {
+			t.Errorf("PDF missing %s", check)
+		}
+	}
+}
+
+func TestHeaderLetterhead(t *testing.T) {
+	req := sampleRequest()
+	req.Header = &Header{Tagline: "Conseil en stratégie", Phone: "01 23 45 67 89", Website: "www.acme.fr"}
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{`(Conseil en strat\351gie)`, `(01 23 45 67 89 | www.acme.fr)`} {
+		if !bytes.Contains(pdf, []byte(check)) {
+			t.Errorf("PDF missing %s", check)
+		}
+	}
+
+	// No room next to a long title: the letterhead is dropped, not squashed
+	req.Type = TypeDownPayment
+	if _, err := Generate(req); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+}
+
+func TestFooter(t *testing.T) {
+	req := sampleRequest()
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("norme Factur-X")) {
+		t.Error("PDF should keep the default footer")
+	}
+
+	req.Footer = &Footer{Lines: []string{"www.acme.fr", "SAS au capital de 10 000 EUR - NAF 6201Z"}}
+	pdf, err = Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if bytes.Contains(pdf, []byte("norme Factur-X")) || !bytes.Contains(pdf, []byte("(www.acme.fr)")) || !bytes.Contains(pdf, []byte("NAF 6201Z)")) {
+		t.Error("PDF should print the custom footer lines instead of the default one")
+	}
+
+	req.Footer = &Footer{}
+	pdf, err = Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if bytes.Contains(pdf, []byte("norme Factur-X")) {
+		t.Error("An empty footer should suppress the default line")
+	}
+
+	req.Footer = &Footer{Lines: []string{"1", "2", "3", "4", "5"}}
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for too many footer lines")
+	}
+}
+
+func TestLayoutOverflow(t *testing.T) {
+	req := sampleRequest()
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if len(res.LayoutWarnings) != 0 {
+		t.Errorf("Expected no layout warnings, got %v", res.LayoutWarnings)
+	}
+
+	// Slightly too long: shrunk, printed in full
+	req.Seller.Name = "Société Générale des Travaux Publics du Grand Ouest"
+	res, err = GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if len(res.LayoutWarnings) != 0 || !bytes.Contains(res.PDF, []byte("du Grand Ouest)")) {
+		t.Errorf("A slightly long seller name should shrink, got warnings %v", res.LayoutWarnings)
+	}
+
+	// Far too long: truncated and reported
+	req.Lines[0].Description = strings.Repeat("Développement spécifique ", 6)
+	res, err = GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if len(res.LayoutWarnings) != 1 || res.LayoutWarnings[0].Field != "Lines[0].Description" {
+		t.Fatalf("Expected a warning for the description, got %v", res.LayoutWarnings)
+	}
+	if !bytes.Contains(res.PDF, []byte("...)")) {
+		t.Error("The description should be truncated with an ellipsis")
+	}
+
+	// Mentions wrap, and what reaches the footer is reported
+	req = sampleRequest()
+	req.CustomMentions = strings.Repeat("Clause de réserve de propriété applicable. ", 40)
+	res, err = GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if len(res.LayoutWarnings) == 0 || res.LayoutWarnings[0].Field != "CustomMentions" {
+		t.Errorf("Expected a warning for the overflowing mentions, got %v", res.LayoutWarnings)
+	}
+}
+
+func TestLayoutConfig(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].Description = "Développement d'une application de gestion des stocks et de la facturation du siège de Rennes et Nantes"
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if len(res.LayoutWarnings) != 1 {
+		t.Fatalf("Expected the description to overflow the default column, got %v", res.LayoutWarnings)
+	}
+
+	// A wider description column fits it
+	req.Layout = &LayoutConfig{Margin: 30, Quantity: 370, UnitPrice: 400, Total: 445}
+	res, err = GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if len(res.LayoutWarnings) != 0 {
+		t.Errorf("Expected no layout warnings with a wider column, got %v", res.LayoutWarnings)
+	}
+	if !bytes.Contains(res.PDF, []byte("400.00 ")) {
+		t.Error("The quantity column should start at margin + 370")
+	}
+
+	for _, layout := range []LayoutConfig{
+		{Margin: 5},
+		{RowHeight: 100},
+		{Quantity: 380},
+		{Total: 480},
+		{DateWidth: -1},
+	} {
+		req.Layout = &layout
+		if _, err := Generate(req); err == nil {
+			t.Errorf("Expected validation error for layout %+v", layout)
+		}
+	}
+}
+
+func TestCompressedResources(t *testing.T) {
+	pdf, err := Generate(sampleRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readPDF(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := doc.object(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, ok := v.(*pdfStream)
+	if !ok || stream.dict["Filter"] != pdfName("FlateDecode") {
+		t.Fatal("ICC profile should be a compressed stream")
+	}
+	if got, err := decodeStream(stream); err != nil || !bytes.Equal(got, srgbICCProfile) {
+		t.Errorf("ICC profile should decode to the original profile (%v)", err)
+	}
+}
+
+func TestFontSubset(t *testing.T) {
+	req := sampleRequest()
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readPDF(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := doc.object(15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, _ := v.(*pdfStream)
+	font, err := decodeStream(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(font) >= len(fontData) {
+		t.Errorf("Font subset should be smaller than the full font: %d >= %d bytes", len(font), len(fontData))
+	}
+	if _, err := parseTTF(font); err != nil {
+		t.Fatalf("Font subset should stay a valid TrueType font: %v", err)
+	}
+	if !bytes.Contains(pdf, []byte("+LiberationSans /FirstChar")) {
+		t.Error("Font subset name should have a subset tag")
+	}
+
+	glyphs, err := readGlyphTable(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := loadFontMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r, used := range map[rune]bool{'F': true, '€': true, 'Ÿ': false, '§': false} {
+		g, err := glyphs.glyph(int(metrics.glyphIDs[uint32(r)]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(g) > 0) != used {
+			t.Errorf("Glyph %q kept = %v, want %v", r, len(g) > 0, used)
+		}
+	}
+}
+
+// upperFont is a FontProvider drawing text in capitals.
+type upperFont struct{ FontProvider }
+
+func (f upperFont) Name() string { return "UpperSans" }
+
+func (f upperFont) Encode(text string) []byte {
+	return f.FontProvider.Encode(strings.ToUpper(text))
+}
+
+func TestFontProvider(t *testing.T) {
+	if _, err := NewTrueTypeFont("Corporate Sans", fontData); !errors.Is(err, ErrFont) {
+		t.Errorf("Expected ErrFont for a name with a space, got %v", err)
+	}
+	if _, err := NewTrueTypeFont("Corporate", []byte("not a font")); !errors.Is(err, ErrFont) {
+		t.Errorf("Expected ErrFont for invalid data, got %v", err)
+	}
+
+	custom, err := NewTrueTypeFont("Corporate-Regular", fontData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := sampleRequest()
+	req.Font = custom
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pdf, []byte("+Corporate-Regular /Flags 32 /FontBBox [-544 -303 1302 980]")) {
+		t.Error("PDF should embed the custom font with scaled metrics")
+	}
+	issues, err := CheckPDFA(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		t.Error(issue)
+	}
+
+	req.Font = upperFont{DefaultFont}
+	pdf, err = Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pdf, []byte("(ACME CORP) Tj")) || !bytes.Contains(pdf, []byte("+UpperSans")) {
+		t.Error("PDF text should use the encoder of the font provider")
+	}
+	if _, err := PreviewSVG(req); err != nil {
+		t.Errorf("PreviewSVG failed with a font provider: %v", err)
+	}
+}
+
+func TestTextMeasurer(t *testing.T) {
+	m, err := NewTextMeasurer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := m.Width("ACME", 10); w <= 0 || m.Width("ACME ACME", 10) <= 2*w {
+		t.Errorf("Unexpected widths: %v", w)
+	}
+
+	// Mentions wrap exactly as the measurer predicts
+	req := sampleRequest()
+	req.CustomMentions = strings.Repeat("Paiement par virement sous trente jours, sans escompte. ", 5)
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := m.Wrap(req.CustomMentions, a4Width-2*req.Layout.margin(), 8)
+	if len(lines) < 2 {
+		t.Fatalf("Mention should wrap, got %q", lines)
+	}
+	for _, line := range lines {
+		if !bytes.Contains(pdf, []byte("("+line+") Tj")) {
+			t.Errorf("PDF missing wrapped line %q", line)
+		}
+	}
+
+	text, size := m.Fit(req.CustomMentions, 200, 10)
+	if !strings.HasSuffix(text, "...") || size != 7.5 || m.Width(text, size) > 200 {
+		t.Errorf("Fit = %q at %v", text, size)
+	}
+	if text, size := m.Fit("ACME", 200, 10); text != "ACME" || size != 10 {
+		t.Errorf("Short text should fit unchanged, got %q at %v", text, size)
+	}
+}
+
+func TestLineBillingPeriod(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].PeriodStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	req.Lines[0].PeriodEnd = time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, "<ram:BillingSpecifiedPeriod>") ||
+		!strings.Contains(xml, ">20240101<") || !strings.Contains(xml, ">20240131<") {
+		t.Error("Billing period missing")
+	}
+
+	req.Lines[0].PeriodEnd = time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for period end before start")
+	}
+}
+
+func TestDespatchAdviceReference(t *testing.T) {
+	req := sampleRequest()
+	req.DespatchAdviceRef = "BL-2024-042"
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, "<ram:DespatchAdviceReferencedDocument>\n        <ram:IssuerAssignedID>BL-2024-042</ram:IssuerAssignedID>") {
+		t.Error("Despatch advice reference missing")
+	}
+}
+
+func TestGlobalIds(t *testing.T) {
+	req := sampleRequest()
+	req.Seller.GlobalIds = []GlobalId{{Scheme: SchemeGLN, Value: "3012345678901"}}
+	req.Buyer.GlobalIds = []GlobalId{{Scheme: SchemeDUNS, Value: "123456789"}}
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, `<ram:GlobalID schemeID="0088">3012345678901</ram:GlobalID>`) {
+		t.Error("Seller GLN missing")
+	}
+	if !strings.Contains(xml, `<ram:GlobalID schemeID="0060">123456789</ram:GlobalID>`) {
+		t.Error("Buyer DUNS missing")
+	}
+
+	req.Buyer.GlobalIds = []GlobalId{{Scheme: "GLN", Value: "3012345678901"}}
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for invalid scheme")
+	}
+}
+
+func TestB2CBuyerWithoutLegalOrganization(t *testing.T) {
+	req := sampleRequest()
+	req.Buyer.Siret = ""
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if strings.Count(xml, "<ram:SpecifiedLegalOrganization>") != 1 {
+		t.Error("Buyer without SIRET must not have an empty legal organization")
+	}
+}
+
+func TestDownPaymentInvoice(t *testing.T) {
+	req := sampleRequest()
+	req.Type = TypeDownPayment
+	req.OrderRef = "CMD-2024-007"
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:TypeCode>386</ram:TypeCode>",
+		"<ram:BuyerOrderReferencedDocument>\n        <ram:IssuerAssignedID>CMD-2024-007</ram:IssuerAssignedID>",
+		"commande N° CMD-2024-007",
+		`<ram:TaxTotalAmount currencyID="EUR">200.00</ram:TaxTotalAmount>`,
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+	if _, err := Generate(req); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+}
+
+func TestFinalInvoiceWithPrepaidAmount(t *testing.T) {
+	req := sampleRequest()
+	req.PrecedingInvoice = &InvoiceReference{Number: "FA-2024-000", Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}
+	req.PrepaidAmount = 360
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:TotalPrepaidAmount>360.00</ram:TotalPrepaidAmount>",
+		"<ram:DuePayableAmount>840.00</ram:DuePayableAmount>",
+		"<ram:IssuerAssignedID>FA-2024-000</ram:IssuerAssignedID>",
+		`<qdt:DateTimeString format="102">20240102</qdt:DateTimeString>`,
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+	if totals := ComputeTotals(&req); totals.DuePayable != 840 {
+		t.Errorf("DuePayable = %v, want 840", totals.DuePayable)
+	}
+	if _, err := Generate(req); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+}
+
+func TestCorrectiveInvoice(t *testing.T) {
+	sample := sampleRequest()
+	req, err := NewInvoice("FA-2024-010").
+		IssuedOn(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)).
+		Seller(sample.Seller).
+		Buyer(sample.Buyer).
+		AddLine("Prestation de conseil", 8, 100).
+		Corrects(InvoiceReference{Number: "FA-2024-001", Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}, "erreur de quantité").
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, check := range []string{
+		"<ram:TypeCode>384</ram:TypeCode>",
+		"<ram:InvoiceReferencedDocument>",
+		"Facture rectificative de la facture N° FA-2024-001 du 15/01/2024. Motif : erreur de quantité",
+	} {
+		if !strings.Contains(xml, check) {
+			t.Errorf("XML missing: %s", check)
+		}
+	}
+
+	req.PrecedingInvoice = nil
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for corrective invoice without reference")
+	}
+}
+
+func TestSelfBilledInvoice(t *testing.T) {
+	req := sampleRequest()
+	req.Type = TypeSelfBilled
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xml, "<ram:TypeCode>389</ram:TypeCode>") {
+		t.Error("Self-billed type code missing")
+	}
+	if !strings.Contains(xml, "<ram:Content>Autofacturation</ram:Content>") {
+		t.Error("Autofacturation mention missing")
+	}
+	if _, err := Generate(req); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+}
+
+func TestGenerateBatch(t *testing.T) {
+	valid := sampleRequest()
+	invalid := sampleRequest()
+	invalid.Number = "FA-2024-BAD"
+	invalid.Lines = nil
+
+	results := GenerateBatch([]InvoiceRequest{valid, invalid, valid})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Err != nil || len(results[0].PDF) == 0 || results[2].Err != nil {
+		t.Error("Valid invoices should be generated")
+	}
+	if results[1].Err == nil || results[1].PDF != nil || results[1].Number != "FA-2024-BAD" || results[1].Index != 1 {
+		t.Errorf("Invalid invoice should report its error: %+v", results[1])
+	}
+}
+
+func TestGenerateConcurrent(t *testing.T) {
+	reqs := make([]InvoiceRequest, 50)
+	for i := range reqs {
+		reqs[i] = sampleRequest()
+		reqs[i].Number = fmt.Sprintf("FA-2024-%03d", i)
+	}
+	reqs[7].Lines = nil // invalid
+
+	seen := make(map[int]bool)
+	failures := 0
+	err := GenerateConcurrent(context.Background(), reqs, 4, func(r BatchResult) error {
+		seen[r.Index] = true
+		if r.Err != nil {
+			failures++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateConcurrent failed: %v", err)
+	}
+	if len(seen) != len(reqs) || failures != 1 {
+		t.Errorf("Expected %d results with 1 failure, got %d results with %d failures", len(reqs), len(seen), failures)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = GenerateConcurrent(context.Background(), reqs, 4, func(r BatchResult) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected handler error after 1 call, got %v after %d calls", err, calls)
+	}
+}
+
+// compressedVisualPDF builds a one-page PDF using an object stream and a
+// Flate-compressed cross-reference stream with a PNG predictor.
+func compressedVisualPDF(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+	offsets := map[int]int{}
+
+	offsets[1] = buf.Len()
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	objStm := "2 0 3 45 << /Type /Pages /Kids [3 0 R] /Count 1 >> << /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>"
+	offsets[4] = buf.Len()
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Type /ObjStm /N 2 /First 9 /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(objStm), objStm)
+
+	// Rows: type (1 byte), field 2 (2 bytes), field 3 (1 byte)
+	rows := [][4]byte{
+		{0, 0, 0, 255},
+		{1, byte(offsets[1] >> 8), byte(offsets[1]), 0},
+		{2, 0, 4, 0},
+		{2, 0, 4, 1},
+		{1, byte(offsets[4] >> 8), byte(offsets[4]), 0},
+		{1, 0, 0, 0}, // patched below with the xref stream offset
+	}
+	xrefOffset := buf.Len()
+	rows[5][1], rows[5][2] = byte(xrefOffset>>8), byte(xrefOffset)
+	var raw []byte
+	var prev [4]byte
+	for _, row := range rows {
+		raw = append(raw, 2) // PNG Up
+		for i := range row {
+			raw = append(raw, row[i]-prev[i])
+		}
+		prev = row
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(raw)
+	zw.Close()
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /XRef /Size 6 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Columns 4 /Predictor 12 >> /Length %d >>\nstream\n", z.Len())
+	buf.Write(z.Bytes())
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+func TestEmbed(t *testing.T) {
+	req := sampleRequest()
+	xmlContent, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	visual, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string][]byte{"xref table": visual, "xref stream": compressedVisualPDF(t)} {
+		out, err := Embed(input, req)
+		if err != nil {
+			t.Fatalf("%s: Embed failed: %v", name, err)
+		}
+
+		doc, err := readPDF(out)
+		if err != nil {
+			t.Fatalf("%s: output is not readable: %v", name, err)
+		}
+		catalog, _, err := doc.catalog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"AF", "Metadata", "OutputIntents", "Pages"} {
+			if _, ok := catalog[key]; !ok {
+				t.Errorf("%s: catalog missing /%s", name, key)
+			}
+		}
+
+		af := catalog["AF"].(pdfArray)
+		spec, _ := doc.resolve(af[0])
+		ef, _ := doc.resolve(spec.(pdfDict)["EF"].(pdfDict)["F"])
+		if got := string(ef.(*pdfStream).data); got != xmlContent {
+			t.Errorf("%s: embedded XML differs from GenerateXMLOnly output", name)
+		}
+
+		pages, _ := doc.resolve(catalog["Pages"])
+		if count := pages.(pdfDict)["Count"]; count != 1 {
+			t.Errorf("%s: expected 1 page, got %v", name, count)
+		}
+	}
+
+	if _, err := Embed([]byte("not a pdf"), req); !errors.Is(err, ErrPDF) {
+		t.Errorf("Expected ErrPDF for invalid input, got %v", err)
+	}
+}
+
+func TestSupplements(t *testing.T) {
+	quote, err := Generate(sampleRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := sampleRequest()
+	req.AddSupplement("D2026-014", "devis-D2026-014.pdf", quote)
+	req.Supplements[0].Description = "Devis signé"
+
+	xmlContent, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xmlContent, "<ram:IssuerAssignedID>D2026-014</ram:IssuerAssignedID>") ||
+		!strings.Contains(xmlContent, "<ram:TypeCode>916</ram:TypeCode>") ||
+		!strings.Contains(xmlContent, "<ram:Name>Devis signé</ram:Name>") {
+		t.Error("XML should reference the supporting document")
+	}
+
+	visual, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	embedded, err := Embed(visual, req)
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	for name, pdf := range map[string][]byte{"Generate": visual, "Embed": embedded} {
+		doc, err := readPDF(pdf)
+		if err != nil {
+			t.Fatalf("%s: output is not readable: %v", name, err)
+		}
+		catalog, _, _ := doc.catalog()
+		if af := catalog["AF"].(pdfArray); len(af) != 2 {
+			t.Fatalf("%s: expected 2 associated files, got %d", name, len(af))
+		}
+		names, _ := doc.resolve(catalog["Names"])
+		tree, _ := doc.resolve(names.(pdfDict)["EmbeddedFiles"])
+		files := make(map[string]pdfValue)
+		doc.collectNameTree(tree.(pdfDict), files, 0)
+		spec, _ := doc.resolve(files["devis-D2026-014.pdf"])
+		if spec == nil || spec.(pdfDict)["AFRelationship"] != pdfName("Supplement") {
+			t.Fatalf("%s: supplement should be attached with /AFRelationship /Supplement", name)
+		}
+		ef, _ := doc.resolve(spec.(pdfDict)["EF"].(pdfDict)["F"])
+		if !bytes.Equal(ef.(*pdfStream).data, quote) {
+			t.Errorf("%s: embedded supplement differs from the input", name)
+		}
+		if got, err := ExtractXML(pdf); err != nil || string(got) != xmlContent {
+			t.Errorf("%s: ExtractXML should still return the invoice XML (%v)", name, err)
+		}
+	}
+
+	for _, s := range []Supplement{
+		{FileName: "devis.pdf", Data: quote},
+		{ID: "D1", FileName: "devis.docx", Data: quote},
+		{ID: "D1", FileName: "factur-x.pdf", Data: []byte("PK")},
+		{ID: "D1", FileName: "devis-signé.pdf", Data: quote},
+	} {
+		req.Supplements = []Supplement{s}
+		if _, err := Generate(req); err == nil {
+			t.Errorf("Expected validation error for supplement %q", s.FileName)
+		}
+	}
+	req.Supplements = []Supplement{{ID: "D1", FileName: "a.pdf", Data: quote}, {ID: "D2", FileName: "A.pdf", Data: quote}}
+	if _, err := Generate(req); err == nil {
+		t.Error("Expected validation error for duplicate file names")
+	}
+}
+
+func TestCheckPDFA(t *testing.T) {
+	req := sampleRequest()
+	req.AttachmentAnnotation = true
+	visual, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddSupplement("D2026-014", "devis.pdf", visual)
+	withSupplement, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := Embed(compressedVisualPDF(t), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, pdf := range map[string][]byte{"Generate": visual, "supplement": withSupplement, "Embed": embedded} {
+		issues, err := CheckPDFA(pdf)
+		if err != nil {
+			t.Fatalf("%s: CheckPDFA failed: %v", name, err)
+		}
+		for _, issue := range issues {
+			t.Errorf("%s: %s", name, issue)
+		}
+	}
+
+	// Forbidden features
+	xmp := []byte(`<x:xmpmeta><pdfaid:part>1</pdfaid:part><pdfaid:conformance>B</pdfaid:conformance></x:xmpmeta>`)
+	bad := writePDF([]pdfObject{
+		{num: 1, content: []byte("<< /Type /Catalog /Pages 2 0 R /Metadata 5 0 R /OpenAction << /S /JavaScript /JS (app.alert(1)) >> >>")},
+		{num: 2, content: []byte("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")},
+		{num: 3, content: []byte("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> >>")},
+		{num: 4, content: []byte("<< /Type /Font /Subtype /TrueType /BaseFont /Arial >>")},
+		{num: 5, content: []byte(fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>", len(xmp))), stream: xmp},
+	}, "<< /Size 6 /Root 1 0 R >>")
+	issues, err := CheckPDFA(bad)
+	if err != nil {
+		t.Fatalf("CheckPDFA failed: %v", err)
+	}
+	rules := make(map[string]bool)
+	for _, issue := range issues {
+		rules[issue.Rule] = true
+	}
+	for _, rule := range []string{"trailer", "metadata", "output intent", "actions", "fonts"} {
+		if !rules[rule] {
+			t.Errorf("Expected a %q issue, got %v", rule, issues)
+		}
+	}
+
+	if _, err := CheckPDFA([]byte("not a pdf")); !errors.Is(err, ErrPDF) {
+		t.Errorf("Expected ErrPDF for invalid input, got %v", err)
+	}
+}
+
+func TestObjectStreams(t *testing.T) {
+	req := sampleRequest()
+	classic, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ObjectStreams = true
+	compact, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := Embed(classic, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(compact, []byte("\nxref\n")) || !bytes.Contains(compact, []byte("/Type /XRef")) {
+		t.Error("PDF should use a cross-reference stream")
+	}
+	if len(compact) >= len(classic) {
+		t.Errorf("Object streams should shrink the PDF: %d >= %d bytes", len(compact), len(classic))
+	}
+
+	xmlContent, _ := GenerateXMLOnly(&req)
+	for name, pdf := range map[string][]byte{"Generate": compact, "Embed": embedded} {
+		doc, err := readPDF(pdf)
+		if err != nil {
+			t.Fatalf("%s: output is not readable: %v", name, err)
+		}
+		if entry := doc.xref[1]; !entry.compressed {
+			t.Errorf("%s: the catalog should be in an object stream", name)
+		}
+		if got, err := ExtractXML(pdf); err != nil || string(got) != xmlContent {
+			t.Errorf("%s: ExtractXML should return the invoice XML (%v)", name, err)
+		}
+		issues, err := CheckPDFA(pdf)
+		if err != nil {
+			t.Fatalf("%s: CheckPDFA failed: %v", name, err)
+		}
+		for _, issue := range issues {
+			t.Errorf("%s: %s", name, issue)
+		}
+	}
+}
+
+func TestEmbedIncremental(t *testing.T) {
+	req := sampleRequest()
+	xmlContent, _ := GenerateXMLOnly(&req)
+	visual, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string][]byte{"xref table": visual, "xref stream": compressedVisualPDF(t)} {
+		out, err := EmbedIncremental(input, req)
+		if err != nil {
+			t.Fatalf("%s: EmbedIncremental failed: %v", name, err)
+		}
+		if !bytes.HasPrefix(out, input) {
+			t.Fatalf("%s: the original bytes should be kept", name)
+		}
+		update := out[len(input):]
+		if !bytes.Contains(update, []byte("/Prev ")) {
+			t.Errorf("%s: the update should point to the previous cross-reference section", name)
+		}
+		if isStream := name == "xref stream"; bytes.Contains(update, []byte("/Type /XRef")) != isStream {
+			t.Errorf("%s: the update should keep the cross-reference format", name)
+		}
+		if got, err := ExtractXML(out); err != nil || string(got) != xmlContent {
+			t.Errorf("%s: ExtractXML should return the invoice XML (%v)", name, err)
+		}
+		doc, err := readPDF(out)
+		if err != nil {
+			t.Fatalf("%s: output is not readable: %v", name, err)
+		}
+		if _, err := doc.object(3); err != nil {
+			t.Errorf("%s: original objects should stay reachable: %v", name, err)
+		}
+	}
+
+	out, _ := EmbedIncremental(visual, req)
+	issues, err := CheckPDFA(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		t.Error(issue)
+	}
+}
+
+func TestParseXMLRoundTrip(t *testing.T) {
+	req := sampleRequest()
+	req.Type = TypeCorrective
+	req.PrecedingInvoice = &InvoiceReference{Number: "FA-2023-099", Date: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)}
+	req.CorrectionReason = "erreur de quantité"
+	req.AddEISuffix = true
+	req.VatDueDateType = VatDueOnPayment
+	req.Lines[0].GrossPrice = 120
+	req.Lines[0].PeriodStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	req.Lines[0].PeriodEnd = time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	xmlContent, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseXML([]byte(xmlContent))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+
+	if parsed.Number != req.Number || parsed.Date != req.Date || parsed.Type != TypeCorrective {
+		t.Errorf("Header mismatch: %q %q %q", parsed.Number, parsed.Date, parsed.Type)
+	}
+	if parsed.Seller.Name != "ACME Corp" || !parsed.AddEISuffix || parsed.Seller.Siret != req.Seller.Siret || parsed.Buyer.VatNumber != req.Buyer.VatNumber {
+		t.Errorf("Party mismatch: %+v / %+v", parsed.Seller, parsed.Buyer)
+	}
+	if parsed.CorrectionReason != req.CorrectionReason || parsed.CustomMentions != "" {
+		t.Errorf("Notes mismatch: reason %q, mentions %q", parsed.CorrectionReason, parsed.CustomMentions)
+	}
+	if parsed.Regime != req.Regime || parsed.VatDueDateType != VatDueOnPayment {
+		t.Errorf("VAT mismatch: %+v %q", parsed.Regime, parsed.VatDueDateType)
+	}
+	line := parsed.Lines[0]
+	if line.Quantity != 10 || line.UnitPrice != 100 || line.GrossPrice != 120 || !line.PeriodEnd.Equal(req.Lines[0].PeriodEnd) {
+		t.Errorf("Line mismatch: %+v", line)
+	}
+
+	// Regenerating from the parsed request yields the same document
+	again, err := GenerateXMLOnly(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != xmlContent {
+		t.Error("XML regenerated from ParseXML output differs from the original")
+	}
+
+	if _, err := ParseXML([]byte("<nope>")); !errors.Is(err, ErrXML) {
+		t.Errorf("Expected ErrXML for invalid XML, got %v", err)
+	}
+}
+
+func TestLegalIDScheme(t *testing.T) {
+	tests := []struct {
+		name               string
+		siret, siren, rcs  string
+		wantID, wantScheme string
+	}{
+		{name: "SIRET", siret: "52825000400033", wantID: "52825000400033", wantScheme: "0009"},
+		{name: "SIREN", siren: "528250004", wantID: "528250004", wantScheme: "0002"},
+		{name: "RCS", rcs: "RCS Paris 528 250 004", wantID: "RCS Paris 528 250 004"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := sampleRequest()
+			req.Seller.Siret, req.Seller.Siren, req.Seller.RCS = tt.siret, tt.siren, tt.rcs
+			doc, err := BuildCII(&req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := doc.Transaction.Agreement.Seller.LegalOrganization
+			if p == nil || p.Value != tt.wantID || p.SchemeID != tt.wantScheme {
+				t.Fatalf("legal organization = %+v, want %s with scheme %q", p, tt.wantID, tt.wantScheme)
+			}
+
+			// The identifier is read back in the same field, including
+			// from invoices using scheme 0002 for a SIRET
+			xml, err := GenerateXMLOnly(&req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, x := range []string{xml, strings.Replace(xml, `schemeID="0009"`, `schemeID="0002"`, 1)} {
+				parsed, err := ParseXML([]byte(x))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s := parsed.Seller; s.Siret != tt.siret || s.Siren != tt.siren || s.RCS != tt.rcs {
+					t.Errorf("parsed seller SIRET %q, SIREN %q, RCS %q", s.Siret, s.Siren, s.RCS)
+				}
+			}
+		})
+	}
+}
+
+func TestCIIModel(t *testing.T) {
+	req := sampleRequest()
+	req.Charges = []Charge{{Amount: 15, VatRate: 20, Reason: "Frais de port"}}
+	req.Lines[0].DiscountPercent = 10
+	req.Lines[0].GrossPrice = 120
+	req.PrecedingInvoice = &InvoiceReference{Number: "FA-2023-099", Date: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)}
+
+	doc, err := BuildCII(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.Transaction.Settlement.Summation.GrandTotal; got != "1098.00" {
+		t.Errorf("Expected grand total 1098.00, got %s", got)
+	}
+	if p := doc.Transaction.Agreement.Seller.LegalOrganization; p == nil || p.Value != "52825000400033" || p.SchemeID != SchemeSIRET {
+		t.Errorf("Unexpected seller legal organization %+v", p)
+	}
+
+	// Serializing the model gives the generated XML, and parsing it back
+	// gives the same model
+	xmlOnly, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serialized, err := doc.XML(); err != nil || serialized != xmlOnly {
+		t.Errorf("Serialized model differs from the generated XML (%v)", err)
+	}
+	parsed, err := ParseCII([]byte(xmlOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serialized, err := parsed.XML(); err != nil || serialized != xmlOnly {
+		t.Errorf("Parsed model does not serialize back to the same XML (%v)", err)
+	}
+	if _, err := ParseCII([]byte("<nope>")); !errors.Is(err, ErrXML) {
+		t.Errorf("Expected ErrXML for invalid XML, got %v", err)
+	}
+
+	// CustomizeCII edits the embedded XML
+	req.CustomizeCII = func(doc *CrossIndustryInvoice) {
+		doc.Document.Notes = append(doc.Document.Notes, IncludedNote{Content: "Livraison en 2 colis", SubjectCode: "AAI"})
+		doc.Transaction.Agreement.Buyer.GlobalIDs = []Identifier{{Value: "3012345678901", SchemeID: "0088"}}
+	}
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<ram:Content>Livraison en 2 colis</ram:Content>",
+		`<ram:GlobalID schemeID="0088">3012345678901</ram:GlobalID>`,
+	} {
+		if !strings.Contains(res.XML, want) {
+			t.Errorf("Customized XML lacks %s", want)
+		}
+	}
+	embedded, err := ExtractXML(res.PDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(embedded) != res.XML {
+		t.Error("Embedded XML differs from the customized XML")
+	}
+}
+
+func TestCIISchemaOrder(t *testing.T) {
+	// Child sequences of the CII D16B schema, by model type and path
+	schema := map[string][]string{
+		"CrossIndustryInvoice":                  {"ExchangedDocumentContext", "ExchangedDocument", "SupplyChainTradeTransaction"},
+		"ExchangedDocumentContext":              {"TestIndicator", "BusinessProcessSpecifiedDocumentContextParameter", "GuidelineSpecifiedDocumentContextParameter"},
+		"ExchangedDocument":                     {"ID", "Name", "TypeCode", "IssueDateTime", "CopyIndicator", "LanguageID", "IncludedNote", "EffectiveSpecifiedPeriod"},
+		"IncludedNote":                          {"ContentCode", "Content", "SubjectCode"},
+		"TradeTransaction":                      {"IncludedSupplyChainTradeLineItem", "ApplicableHeaderTradeAgreement", "ApplicableHeaderTradeDelivery", "ApplicableHeaderTradeSettlement"},
+		"LineItem":                              {"AssociatedDocumentLineDocument", "SpecifiedTradeProduct", "SpecifiedLineTradeAgreement", "SpecifiedLineTradeDelivery", "SpecifiedLineTradeSettlement"},
+		"LineItem>SpecifiedLineTradeAgreement":  {"BuyerOrderReferencedDocument", "GrossPriceProductTradePrice", "NetPriceProductTradePrice"},
+		"LineItem>SpecifiedLineTradeSettlement": {"ApplicableTradeTax", "BillingSpecifiedPeriod", "SpecifiedTradeAllowanceCharge", "SpecifiedTradeSettlementLineMonetarySummation"},
+		"TradePrice":                            {"ChargeAmount", "BasisQuantity", "AppliedTradeAllowanceCharge"},
+		"Period":                                {"StartDateTime", "EndDateTime"},
+		"TradeAllowanceCharge":                  {"ChargeIndicator", "CalculationPercent", "BasisAmount", "ActualAmount", "ReasonCode", "Reason", "CategoryTradeTax"},
+		"TradeTax":                              {"CalculatedAmount", "TypeCode", "ExemptionReason", "BasisAmount", "CategoryCode", "ExemptionReasonCode", "TaxPointDate", "DueDateTypeCode", "RateApplicablePercent"},
+		"HeaderTradeAgreement":                  {"BuyerReference", "SellerTradeParty", "BuyerTradeParty", "SellerTaxRepresentativeTradeParty", "BuyerOrderReferencedDocument", "ContractReferencedDocument", "AdditionalReferencedDocument", "SpecifiedProcuringProject"},
+		"TradeParty":                            {"ID", "GlobalID", "Name", "SpecifiedLegalOrganization", "PostalTradeAddress", "URIUniversalCommunication", "SpecifiedTaxRegistration"},
+		"TradeParty>SpecifiedLegalOrganization": {"ID", "TradingBusinessName", "PostalTradeAddress"},
+		"TradeAddress":                          {"PostcodeCode", "LineOne", "LineTwo", "LineThree", "CityName", "CountryID", "CountrySubDivisionName"},
+		"ReferencedDocument":                    {"IssuerAssignedID", "URIID", "LineID", "TypeCode", "Name", "AttachmentBinaryObject", "ReferenceTypeCode", "FormattedIssueDateTime"},
+		"HeaderTradeDelivery":                   {"ShipToTradeParty", "ActualDeliverySupplyChainEvent", "DespatchAdviceReferencedDocument"},
+		"HeaderTradeSettlement": {"CreditorReferenceID", "PaymentReference", "TaxCurrencyCode", "InvoiceCurrencyCode", "PayeeTradeParty", "SpecifiedTradeSettlementPaymentMeans",
+			"ApplicableTradeTax", "BillingSpecifiedPeriod", "SpecifiedTradeAllowanceCharge", "SpecifiedTradePaymentTerms", "SpecifiedTradeSettlementHeaderMonetarySummation",
+			"InvoiceReferencedDocument", "ReceivableSpecifiedTradeAccountingAccount"},
+		"PaymentMeans":      {"TypeCode", "Information", "ApplicableTradeSettlementFinancialCard", "PayerPartyDebtorFinancialAccount", "PayeePartyCreditorFinancialAccount"},
+		"PaymentTerms":      {"Description", "DueDateDateTime", "DirectDebitMandateID", "PartialPaymentAmount"},
+		"MonetarySummation": {"LineTotalAmount", "ChargeTotalAmount", "AllowanceTotalAmount", "TaxBasisTotalAmount", "TaxTotalAmount", "RoundingAmount", "GrandTotalAmount", "TotalPrepaidAmount", "DuePayableAmount"},
+	}
+
+	models := []any{
+		CrossIndustryInvoice{}, ExchangedDocumentContext{}, ExchangedDocument{}, IncludedNote{},
+		TradeTransaction{}, LineItem{}, TradePrice{}, Period{}, TradeAllowanceCharge{}, TradeTax{},
+		HeaderTradeAgreement{}, TradeParty{}, TradeAddress{}, ReferencedDocument{},
+		HeaderTradeDelivery{}, HeaderTradeSettlement{}, PaymentMeans{}, PaymentTerms{}, MonetarySummation{},
+	}
+	for _, model := range models {
+		typ := reflect.TypeOf(model)
+		// Children in field order, by path within the type
+		sequences := make(map[string][]string)
+		for i := 0; i < typ.NumField(); i++ {
+			tag, options, _ := strings.Cut(typ.Field(i).Tag.Get("xml"), ",")
+			if typ.Field(i).Name == "XMLName" || tag == "" || strings.Contains(options, "attr") {
+				continue
+			}
+			key := typ.Name()
+			for _, name := range strings.Split(tag, ">") {
+				if seq := sequences[key]; len(seq) == 0 || seq[len(seq)-1] != name {
+					sequences[key] = append(seq, name)
+				}
+				key += ">" + name
+			}
+		}
+		for key, seq := range sequences {
+			order, ok := schema[key]
+			if !ok {
+				if len(seq) > 1 {
+					t.Errorf("No schema sequence for %s", key)
+				}
+				continue
+			}
+			last := -1
+			for _, name := range seq {
+				pos := slices.Index(order, name)
+				if pos <= last {
+					t.Errorf("%s: %s is missing or out of schema order", key, name)
+				}
+				last = pos
+			}
+		}
+	}
+}
+
+func TestXMLFormat(t *testing.T) {
+	req := sampleRequest()
+	pretty, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.XMLFormat = XMLCompact
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := res.XML
+	if strings.Contains(compact, "\n") || strings.Contains(compact, "  ") {
+		t.Error("Compact XML should have no line breaks or indentation")
+	}
+	if !strings.HasPrefix(compact, `<?xml version="1.0" encoding="UTF-8"?><rsm:CrossIndustryInvoice xmlns:rsm=`) {
+		t.Errorf("Unexpected compact XML start: %.80s", compact)
+	}
+	if len(compact) >= len(pretty) {
+		t.Errorf("Compact XML (%d bytes) should be smaller than pretty XML (%d bytes)", len(compact), len(pretty))
+	}
+	if embedded, err := ExtractXML(res.PDF); err != nil || string(embedded) != compact {
+		t.Errorf("Embedded XML is not the compact XML (%v)", err)
+	}
+
+	// Both formats hold the same document
+	doc, err := ParseCII([]byte(compact))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := doc.XML(); err != nil || again != pretty {
+		t.Errorf("Compact XML does not reformat to the pretty XML (%v)", err)
+	}
+	if result, err := ValidateXML([]byte(compact)); err != nil || !result.Valid() {
+		t.Errorf("Compact XML should validate: %v %v", result.Errors, err)
+	}
+
+	req.XMLFormat = "minified"
+	if err := Validate(&req).Err(); err == nil || !strings.Contains(err.Error(), "unknown XML format") {
+		t.Errorf("Expected an unknown XML format error, got %v", err)
+	}
+}
+
+func TestDetectProfile(t *testing.T) {
+	guidelines := []struct {
+		id       string
+		profile  Profile
+		standard string
+		version  string
+	}{
+		{"urn:factur-x.eu:1p0:minimum", ProfileMinimum, "Factur-X", "1.0"},
+		{"urn:factur-x.eu:1p0:basicwl", ProfileBasicWL, "Factur-X", "1.0"},
+		{"urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic", ProfileBasic, "Factur-X", "1.0"},
+		{"urn:cen.eu:en16931:2017", ProfileEN16931, "EN 16931", ""},
+		{"urn:cen.eu:en16931:2017#conformant#urn:factur-x.eu:1p0:extended", ProfileExtended, "Factur-X", "1.0"},
+		{"urn:cen.eu:en16931:2017#conformant#urn:zugferd.de:2p0:extended", ProfileExtended, "ZUGFeRD", "2.0"},
+		{"urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0", ProfileEN16931, "XRechnung", "3.0"},
+	}
+	for _, g := range guidelines {
+		p, ok := profileOfGuideline(g.id)
+		if !ok || p.Profile != g.profile || p.Standard != g.standard || p.Version != g.version {
+			t.Errorf("%s: got %+v", g.id, p)
+		}
+	}
+	if _, ok := profileOfGuideline("urn:example:unknown"); ok {
+		t.Error("Unknown guideline should not be recognized")
+	}
+
+	req := sampleRequest()
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	p, err := DetectPDFProfile(res.PDF)
+	if err != nil || p.Profile != ProfileBasic || p.XMPProfile != ProfileBasic || p.XMPVersion != "1.0" {
+		t.Errorf("Unexpected PDF profile (%v): %+v", err, p)
+	}
+	if result, err := ValidatePDF(res.PDF); err != nil || !result.Valid() || result.Profile != ProfileBasic || len(result.Warnings) != 0 {
+		t.Errorf("Generated PDF should validate as BASIC (%v): %+v", err, result)
+	}
+
+	// A BASIC WL invoice is checked on its declared totals only
+	setGuideline := func(id string) func(*CrossIndustryInvoice) {
+		return func(doc *CrossIndustryInvoice) {
+			doc.Context.Guideline.ID = id
+			doc.Transaction.Lines = nil
+		}
+	}
+	req.CustomizeCII = setGuideline("urn:factur-x.eu:1p0:basicwl")
+	xml, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if result, err := ValidateXML([]byte(xml)); err != nil || !result.Valid() || result.Profile != ProfileBasicWL {
+		t.Errorf("BASIC WL invoice should be valid (%v): %+v", err, result)
+	}
+	tampered := strings.Replace(xml, `<ram:GrandTotalAmount>1200.00<`, `<ram:GrandTotalAmount>1300.00<`, 1)
+	result, err := ValidateXML([]byte(tampered))
+	if err != nil || result.Valid() || result.Errors[0].Field != "GrandTotalAmount" {
+		t.Errorf("Expected a grand total error (%v): %+v", err, result)
+	}
+
+	req.CustomizeCII = setGuideline("urn:example:unknown")
+	xml, _ = GenerateXMLOnly(&req)
+	if result, _ := ValidateXML([]byte(xml)); result.Valid() || result.Errors[0].Field != "GuidelineSpecifiedDocumentContextParameter" {
+		t.Errorf("Expected an unknown profile error: %+v", result)
+	}
+
+	// XMP and XML disagreeing on the profile
+	req.CustomizeCII = setGuideline("urn:factur-x.eu:1p0:minimum")
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	result, err = ValidatePDF(pdf)
+	if err != nil || !result.Valid() || len(result.Warnings) != 1 || result.Warnings[0].Field != "ConformanceLevel" {
+		t.Errorf("Expected a conformance level warning (%v): %+v", err, result)
+	}
+}
+
+// zugferd1Invoice is a ZUGFeRD 1.0 BASIC invoice: its lines have no price
+// nor VAT category.
+const zugferd1Invoice = `<?xml version="1.0" encoding="UTF-8"?>
+<rsm:CrossIndustryDocument xmlns:rsm="urn:ferd:CrossIndustryDocument:invoice:1p0" xmlns:ram="urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:12" xmlns:udt="urn:un:unece:uncefact:data:standard:UnqualifiedDataType:15">
+  <rsm:SpecifiedExchangedDocumentContext>
+    <ram:GuidelineSpecifiedDocumentContextParameter>
+      <ram:ID>urn:ferd:CrossIndustryDocument:invoice:1p0:basic</ram:ID>
+    </ram:GuidelineSpecifiedDocumentContextParameter>
+  </rsm:SpecifiedExchangedDocumentContext>
+  <rsm:HeaderExchangedDocument>
+    <ram:ID>471102</ram:ID>
+    <ram:Name>RECHNUNG</ram:Name>
+    <ram:TypeCode>380</ram:TypeCode>
+    <ram:IssueDateTime><udt:DateTimeString format="102">20130305</udt:DateTimeString></ram:IssueDateTime>
+    <ram:IncludedNote><ram:Content>Rechnung gemäß Bestellung vom 01.03.2013.</ram:Content></ram:IncludedNote>
+  </rsm:HeaderExchangedDocument>
+  <rsm:SpecifiedSupplyChainTradeTransaction>
+    <ram:ApplicableSupplyChainTradeAgreement>
+      <ram:SellerTradeParty>
+        <ram:Name>Lieferant GmbH</ram:Name>
+        <ram:PostalTradeAddress>
+          <ram:PostcodeCode>80333</ram:PostcodeCode>
+          <ram:LineOne>Lieferantenstraße 20</ram:LineOne>
+          <ram:CityName>München</ram:CityName>
+          <ram:CountryID>DE</ram:CountryID>
+        </ram:PostalTradeAddress>
+        <ram:SpecifiedTaxRegistration><ram:ID schemeID="VA">DE123456789</ram:ID></ram:SpecifiedTaxRegistration>
+      </ram:SellerTradeParty>
+      <ram:BuyerTradeParty>
+        <ram:Name>Kunden AG Mitte</ram:Name>
+        <ram:PostalTradeAddress>
+          <ram:PostcodeCode>69876</ram:PostcodeCode>
+          <ram:LineOne>Hans Muster</ram:LineOne>
+          <ram:CityName>Frankfurt</ram:CityName>
+          <ram:CountryID>DE</ram:CountryID>
+        </ram:PostalTradeAddress>
+      </ram:BuyerTradeParty>
+      <ram:BuyerOrderReferencedDocument><ram:ID>PO-4711</ram:ID></ram:BuyerOrderReferencedDocument>
+    </ram:ApplicableSupplyChainTradeAgreement>
+    <ram:ApplicableSupplyChainTradeDelivery>
+      <ram:ActualDeliverySupplyChainEvent>
+        <ram:OccurrenceDateTime><udt:DateTimeString format="102">20130305</udt:DateTimeString></ram:OccurrenceDateTime>
+      </ram:ActualDeliverySupplyChainEvent>
+    </ram:ApplicableSupplyChainTradeDelivery>
+    <ram:ApplicableSupplyChainTradeSettlement>
+      <ram:InvoiceCurrencyCode>EUR</ram:InvoiceCurrencyCode>
+      <ram:ApplicableTradeTax>
+        <ram:CalculatedAmount currencyID="EUR">37.62</ram:CalculatedAmount>
+        <ram:TypeCode>VAT</ram:TypeCode>
+        <ram:BasisAmount currencyID="EUR">198.00</ram:BasisAmount>
+        <ram:CategoryCode>S</ram:CategoryCode>
+        <ram:ApplicablePercent>19.00</ram:ApplicablePercent>
+      </ram:ApplicableTradeTax>
+      <ram:SpecifiedTradePaymentTerms>
+        <ram:Description>Zahlbar innerhalb 30 Tagen netto bis 04.04.2013</ram:Description>
+        <ram:DueDateDateTime><udt:DateTimeString format="102">20130404</udt:DateTimeString></ram:DueDateDateTime>
+      </ram:SpecifiedTradePaymentTerms>
+      <ram:SpecifiedTradeSettlementMonetarySummation>
+        <ram:LineTotalAmount currencyID="EUR">198.00</ram:LineTotalAmount>
+        <ram:ChargeTotalAmount currencyID="EUR">0.00</ram:ChargeTotalAmount>
+        <ram:AllowanceTotalAmount currencyID="EUR">0.00</ram:AllowanceTotalAmount>
+        <ram:TaxBasisTotalAmount currencyID="EUR">198.00</ram:TaxBasisTotalAmount>
+        <ram:TaxTotalAmount currencyID="EUR">37.62</ram:TaxTotalAmount>
+        <ram:GrandTotalAmount currencyID="EUR">235.62</ram:GrandTotalAmount>
+        <ram:DuePayableAmount currencyID="EUR">235.62</ram:DuePayableAmount>
+      </ram:SpecifiedTradeSettlementMonetarySummation>
+    </ram:ApplicableSupplyChainTradeSettlement>
+    <ram:IncludedSupplyChainTradeLineItem>
+      <ram:SpecifiedSupplyChainTradeDelivery><ram:BilledQuantity unitCode="C62">20.0000</ram:BilledQuantity></ram:SpecifiedSupplyChainTradeDelivery>
+      <ram:SpecifiedSupplyChainTradeSettlement>
+        <ram:SpecifiedTradeSettlementMonetarySummation><ram:LineTotalAmount currencyID="EUR">198.00</ram:LineTotalAmount></ram:SpecifiedTradeSettlementMonetarySummation>
+      </ram:SpecifiedSupplyChainTradeSettlement>
+      <ram:SpecifiedTradeProduct><ram:Name>Trennblätter A4</ram:Name></ram:SpecifiedTradeProduct>
+    </ram:IncludedSupplyChainTradeLineItem>
+  </rsm:SpecifiedSupplyChainTradeTransaction>
+</rsm:CrossIndustryDocument>`
+
+func TestZUGFeRD1(t *testing.T) {
+	req, err := ParseXML([]byte(zugferd1Invoice))
+	if err != nil {
+		t.Fatalf("ZUGFeRD 1.0 invoice should be read: %v", err)
+	}
+	if req.Number != "471102" || req.Date != "20130305" || req.Seller.VatNumber != "DE123456789" || req.Buyer.City != "Frankfurt" || req.OrderRef != "PO-4711" {
+		t.Errorf("Unexpected header: %+v", req)
+	}
+	if req.Regime.Rate() != 19 || !req.DueDate.Equal(time.Date(2013, 4, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected VAT or due date: %v %v", req.Regime.Rate(), req.DueDate)
+	}
+	if len(req.Lines) != 1 || req.Lines[0].Description != "Trennblätter A4" || req.Lines[0].Quantity != 20 || req.Lines[0].UnitPrice != 9.9 {
+		t.Errorf("Unexpected lines: %+v", req.Lines)
+	}
+
+	p, err := DetectProfile([]byte(zugferd1Invoice))
+	if err != nil || p.Profile != ProfileBasic || p.Standard != "ZUGFeRD" || p.Version != "1.0" {
+		t.Errorf("Unexpected profile (%v): %+v", err, p)
+	}
+	result, err := ValidateXML([]byte(zugferd1Invoice))
+	if err != nil || !result.Valid() {
+		t.Errorf("ZUGFeRD 1.0 invoice should be valid (%v): %+v", err, result)
+	}
+	fingerprint, err := FingerprintXML([]byte(zugferd1Invoice))
+	if err != nil || len(fingerprint) != 64 {
+		t.Errorf("Unexpected fingerprint %q (%v)", fingerprint, err)
+	}
+}
+
+func TestConvertToUBL(t *testing.T) {
+	req := sampleRequest()
+	req.Charges = []Charge{{Amount: 10, Reason: "Frais de port", VatRate: 20}}
+	req.OrderRef = "PO-42"
+	xmlContent, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	ubl, err := ConvertToUBL([]byte(xmlContent))
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+
+	var doc struct {
+		XMLName   xml.Name
+		ID        string `xml:"ID"`
+		IssueDate string `xml:"IssueDate"`
+		TypeCode  string `xml:"InvoiceTypeCode"`
+		Order     string `xml:"OrderReference>ID"`
+		Seller    string `xml:"AccountingSupplierParty>Party>PartyLegalEntity>RegistrationName"`
+		SellerVAT string `xml:"AccountingSupplierParty>Party>PartyTaxScheme>CompanyID"`
+		TaxAmount string `xml:"TaxTotal>TaxAmount"`
+		Payable   string `xml:"LegalMonetaryTotal>PayableAmount"`
+		Lines     []struct {
+			Quantity string `xml:"InvoicedQuantity"`
+			Price    string `xml:"Price>PriceAmount"`
+		} `xml:"InvoiceLine"`
+	}
+	if err := xml.Unmarshal([]byte(ubl), &doc); err != nil {
+		t.Fatalf("Invalid UBL: %v", err)
+	}
+	if doc.XMLName.Local != "Invoice" || doc.XMLName.Space != "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2" {
+		t.Errorf("Unexpected root: %v", doc.XMLName)
+	}
+	if doc.ID != req.Number || doc.IssueDate != "2024-01-15" || doc.TypeCode != "380" || doc.Order != "PO-42" {
+		t.Errorf("Unexpected header: %+v", doc)
+	}
+	if doc.Seller != "ACME Corp" || doc.SellerVAT != "FR12345678901" || doc.TaxAmount != "202.00" || doc.Payable != "1212.00" {
+		t.Errorf("Unexpected parties or totals: %+v", doc)
+	}
+	if len(doc.Lines) != 1 || doc.Lines[0].Quantity != "10.0000" || doc.Lines[0].Price != "100.0000" {
+		t.Errorf("Unexpected lines: %+v", doc.Lines)
+	}
+	if strings.Contains(ubl, "></cac:") {
+		t.Errorf("UBL should not have empty aggregates:\n%s", ubl)
+	}
+
+	// Credit notes have their own root and line elements
+	req.CustomizeCII = func(doc *CrossIndustryInvoice) { doc.Document.TypeCode = "381" }
+	xmlContent, _ = GenerateXMLOnly(&req)
+	ubl, err = ConvertToUBL([]byte(xmlContent))
+	if err != nil || !strings.Contains(ubl, "<CreditNote xmlns=") || !strings.Contains(ubl, "<cbc:CreditedQuantity") || strings.Contains(ubl, "InvoiceLine") {
+		t.Errorf("Expected a UBL credit note (%v):\n%s", err, ubl)
+	}
+
+	if ubl, err := ConvertToUBL([]byte(zugferd1Invoice)); err != nil || !strings.Contains(ubl, "<cbc:PriceAmount currencyID=\"EUR\">9.9</cbc:PriceAmount>") {
+		t.Errorf("ZUGFeRD 1.0 invoice should convert (%v):\n%s", err, ubl)
+	}
+}
+
+func TestParseUBL(t *testing.T) {
+	req := sampleRequest()
+	req.Charges = []Charge{{Amount: 10, Reason: "Frais de port", VatRate: 20}}
+	req.OrderRef = "PO-42"
+	req.DueDate = time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)
+	req.CustomMentions = "Merci de votre confiance"
+	xmlContent, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	ubl, err := ConvertToUBL([]byte(xmlContent))
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+
+	// UBL and CII give the same request
+	want, err := ParseXML([]byte(xmlContent))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	got, err := ParseUBL([]byte(ubl))
+	if err != nil {
+		t.Fatalf("ParseUBL failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseUBL = %+v\nwant %+v", got, want)
+	}
+
+	pdf, err := ConvertFromUBL([]byte(ubl))
+	if err != nil {
+		t.Fatalf("ConvertFromUBL failed: %v", err)
+	}
+	embedded, err := ExtractXML(pdf)
+	if err != nil {
+		t.Fatalf("ExtractXML failed: %v", err)
+	}
+	if result, err := ValidateXML(embedded); err != nil || !result.Valid() {
+		t.Errorf("Hybrid invoice should be valid: %v %+v", err, result)
+	}
+
+	if _, err := ParseUBL([]byte(xmlContent)); !errors.Is(err, ErrXML) {
+		t.Errorf("ParseUBL should reject CII, got %v", err)
+	}
+	bad := strings.Replace(ubl, "<cbc:IssueDate>2024-01-15<", "<cbc:IssueDate>15/01/2024<", 1)
+	if _, err := ParseUBL([]byte(bad)); !errors.Is(err, ErrXML) {
+		t.Errorf("ParseUBL should reject invalid dates, got %v", err)
+	}
+}
+
+func TestValidateXML(t *testing.T) {
+	req := sampleRequest()
+	xmlContent, _ := GenerateXMLOnly(&req)
+
+	result, err := ValidateXML([]byte(xmlContent))
+	if err != nil || !result.Valid() {
+		t.Fatalf("Generated XML should be valid: %v %+v", err, result.Errors)
+	}
+
+	tampered := strings.Replace(xmlContent, "<ram:GrandTotalAmount>1200.00<", "<ram:GrandTotalAmount>1100.00<", 1)
+	result, err = ValidateXML([]byte(tampered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid() || result.Errors[0].Field != "GrandTotalAmount" {
+		t.Errorf("Expected a GrandTotalAmount error, got %+v", result.Errors)
+	}
+}
+
+func TestExtractXML(t *testing.T) {
+	req := sampleRequest()
+	xmlContent, _ := GenerateXMLOnly(&req)
+	pdf, err := Generate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extracted, err := ExtractXML(pdf)
+	if err != nil {
+		t.Fatalf("ExtractXML failed: %v", err)
+	}
+	if string(extracted) != xmlContent {
+		t.Error("Extracted XML differs from the generated one")
+	}
+
+	if _, err := ExtractXML(compressedVisualPDF(t)); !errors.Is(err, ErrPDF) {
+		t.Errorf("Expected ErrPDF for a PDF without attachment, got %v", err)
+	}
+}
+
+func TestPreviewSVG(t *testing.T) {
+	req := sampleRequest()
+	req.Lines[0].Description = "Prestation d'été – 5 €"
+
+	svg, err := PreviewSVG(req)
+	if err != nil {
+		t.Fatalf("PreviewSVG failed: %v", err)
+	}
+
+	// Must be well-formed XML
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Invalid SVG: %v", err)
+		}
+	}
+
+	for _, want := range []string{"<svg", "FA-2024-001", "Prestation d&apos;été – 5 €", "200,00"} {
+		if !bytes.Contains(svg, []byte(want)) {
+			t.Errorf("SVG should contain %q", want)
+		}
+	}
+}
+
+func TestGenerateResult(t *testing.T) {
+	defer func(saved func() time.Time) { now = saved }(now)
+	now = func() time.Time { return time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC) }
+
+	req := sampleRequest()
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, _ := Generate(req)
+	if !bytes.Equal(res.PDF, pdf) {
+		t.Error("GenerateResult PDF differs from Generate")
+	}
+	if extracted, _ := ExtractXML(res.PDF); string(extracted) != res.XML {
+		t.Error("Result XML differs from the embedded one")
+	}
+	if res.Totals.GrandTotal != ComputeTotals(&req).GrandTotal {
+		t.Errorf("Unexpected totals: %+v", res.Totals)
+	}
+	if !bytes.Contains(res.PDF, []byte("/ID [<"+res.FileID+">")) {
+		t.Errorf("File ID %s not found in the PDF trailer", res.FileID)
+	}
+	sum := sha256.Sum256(res.PDF)
+	if res.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected digest %s", res.SHA256)
+	}
+
+	req.Number = ""
+	if _, err := GenerateResult(req); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected ErrValidation, got %v", err)
+	}
+}
+
+func TestGenerateVerified(t *testing.T) {
+	reqs := []InvoiceRequest{sampleRequest(), sampleRequest(), sampleRequest()}
+	reqs[1].Regime = VatFranchiseAuto()
+	reqs[2].Lines = []InvoiceLine{{Description: "x", Quantity: 3, UnitPrice: 0.1}, {Description: "y", Quantity: 1.333, UnitPrice: 7.77}}
+	reqs[2].PrepaidAmount = 5
+	for i, req := range reqs {
+		if _, err := GenerateVerified(req); err != nil {
+			t.Errorf("Request %d: %v", i, err)
+		}
+	}
+
+	res, err := GenerateResult(sampleRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, doc, err := parseCII([]byte(res.XML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Transaction.Settlement.Summation.GrandTotal = "1.00"
+	if err := checkBRCO(doc, res.Totals); !errors.Is(err, ErrVerification) || !strings.Contains(err.Error(), "BR-CO-15") {
+		t.Errorf("Expected a BR-CO-15 ErrVerification, got %v", err)
+	}
+
+	// Every generation audits the arithmetic of the XML it writes
+	req := sampleRequest()
+	req.CustomizeCII = func(doc *CrossIndustryInvoice) {
+		doc.Transaction.Settlement.Summation.TaxTotal.Value = "240.01"
+	}
+	if _, err := GenerateXMLOnly(&req); !errors.Is(err, ErrVerification) || !strings.Contains(err.Error(), "BR-CO-14") {
+		t.Errorf("Expected a BR-CO-14 ErrVerification, got %v", err)
+	}
+	if _, err := Generate(req); !errors.Is(err, ErrVerification) {
+		t.Errorf("Expected Generate to fail with ErrVerification, got %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	req := sampleRequest()
+	fingerprint, err := Fingerprint(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fingerprint) != 64 {
+		t.Fatalf("Expected a hex SHA-256, got %q", fingerprint)
+	}
+
+	// Presentation options leave the fingerprint unchanged
+	styled := sampleRequest()
+	styled.Layout = &LayoutConfig{Margin: 30}
+	styled.Header = &Header{Tagline: "Conseil"}
+	styled.ObjectStreams = true
+	styled.XMLFormat = XMLCompact
+	styled.IssueDate = time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	styled.Date = ""
+	res, err := GenerateResult(styled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Fingerprint != fingerprint {
+		t.Errorf("Presentation options changed the fingerprint: %s, want %s", res.Fingerprint, fingerprint)
+	}
+	if fromPDF, err := FingerprintPDF(res.PDF); err != nil || fromPDF != fingerprint {
+		t.Errorf("FingerprintPDF = %s (%v), want %s", fromPDF, err, fingerprint)
+	}
+
+	// Embedding into another PDF carries the same data
+	visual, err := Generate(sampleRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedded, err := Embed(visual, sampleRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromPDF, err := FingerprintPDF(embedded); err != nil || fromPDF != fingerprint {
+		t.Errorf("FingerprintPDF of embedded PDF = %s (%v), want %s", fromPDF, err, fingerprint)
+	}
+
+	// Any data change, including CustomizeCII, changes it
+	changed := sampleRequest()
+	changed.Lines[0].UnitPrice = 100.01
+	customized := sampleRequest()
+	customized.CustomizeCII = func(doc *CrossIndustryInvoice) {
+		doc.Transaction.Agreement.BuyerOrder = &ReferencedDocument{IssuerAssignedID: "PO-1"}
+	}
+	for name, r := range map[string]InvoiceRequest{"price": changed, "CustomizeCII": customized} {
+		if other, err := Fingerprint(r); err != nil || other == fingerprint {
+			t.Errorf("%s change should change the fingerprint (%v)", name, err)
+		}
+	}
+
+	if _, err := FingerprintPDF([]byte("not a pdf")); !errors.Is(err, ErrPDF) {
+		t.Errorf("Expected ErrPDF, got %v", err)
+	}
+	if _, err := Fingerprint(InvoiceRequest{}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected ErrValidation, got %v", err)
+	}
+}
+
+func TestPaymentMeans(t *testing.T) {
+	req := sampleRequest()
+	req.Payment = &Payment{PaidOn: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), Method: PaymentCard}
+	xmlContent, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if !strings.Contains(xmlContent, "<ram:TypeCode>48</ram:TypeCode>") {
+		t.Errorf("Expected payment means 48 for a card payment:\n%s", xmlContent)
+	}
+
+	// An explicit code takes precedence and survives a round trip
+	req.Payment = nil
+	req.PaymentMeans = PaymentMeansSEPACreditTransfer
+	xmlContent, err = GenerateXMLOnly(&req)
+	if err != nil || !strings.Contains(xmlContent, "<ram:TypeCode>58</ram:TypeCode>") {
+		t.Fatalf("Expected payment means 58 (%v):\n%s", err, xmlContent)
+	}
+	if parsed, err := ParseXML([]byte(xmlContent)); err != nil || parsed.PaymentMeans != PaymentMeansSEPACreditTransfer {
+		t.Errorf("ParseXML PaymentMeans = %q (%v)", parsed.PaymentMeans, err)
+	}
+	if label := req.PaymentMeans.Label(); label != "virement SEPA" {
+		t.Errorf("Label = %q", label)
+	}
+
+	req.PaymentMeans = "virement"
+	if errs := Validate(&req).Errors; len(errs) == 0 || errs[0].Field != "PaymentMeans" {
+		t.Errorf("Expected an error on PaymentMeans, got %v", errs)
+	}
+	req.PaymentMeans = PaymentMeansCreditTransfer
+	req.DirectDebit = &DirectDebit{MandateID: "RUM-2024-001", CreditorID: "FR12ZZZ123456", DebtorIBAN: "FR7630006000011234567890189"}
+	if errs := Validate(&req).Errors; len(errs) == 0 || errs[0].Field != "PaymentMeans" {
+		t.Errorf("Expected an error on PaymentMeans with a direct debit, got %v", errs)
+	}
+}
+
+func TestSellerLegalMentions(t *testing.T) {
+	req := sampleRequest()
+	req.Seller.LegalForm = "SARL"
+	req.Seller.ShareCapital = 10000
+	req.Seller.RCSCity = "Paris"
+	req.Seller.NAF = "6201Z"
+	req.Seller.TradingName = "ACME"
+	mention := "SARL au capital de 10" + narrowNBSP + "000,00" + narrowNBSP + "€ - RCS Paris 528 250 004 - NAF 6201Z"
+	if got := req.Seller.legalMention(); got != mention {
+		t.Fatalf("legalMention = %q, want %q", got, mention)
+	}
+
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, want := range []string{
+		"<ram:Content>" + mention + "</ram:Content>",
+		"<ram:SubjectCode>ABL</ram:SubjectCode>",
+		"<ram:TradingBusinessName>ACME</ram:TradingBusinessName>",
+	} {
+		if !strings.Contains(res.XML, want) {
+			t.Errorf("Expected %s in XML:\n%s", want, res.XML)
+		}
+	}
+	if !bytes.Contains(res.PDF, []byte("RCS Paris 528 250 004 - NAF 6201Z")) {
+		t.Error("Expected the company mentions in the PDF footer")
+	}
+
+	parsed, err := ParseXML([]byte(res.XML))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	s := parsed.Seller
+	if s.LegalForm != "SARL" || s.ShareCapital != 10000 || s.RCSCity != "Paris" || s.NAF != "6201Z" || s.TradingName != "ACME" || parsed.CustomMentions != "" {
+		t.Errorf("ParseXML seller = %+v, mentions %q", s, parsed.CustomMentions)
+	}
+	ubl, err := ConvertToUBL([]byte(res.XML))
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if parsed, err := ParseUBL([]byte(ubl)); err != nil || parsed.Seller.TradingName != "ACME" || parsed.Seller.NAF != "6201Z" {
+		t.Errorf("ParseUBL seller = %+v (%v)", parsed.Seller, err)
+	}
+
+	// The mentions take a footer line
+	r := req
+	r.Footer = &Footer{Lines: []string{"a", "b", "c", "d"}}
+	if errs := Validate(&r).Errors; len(errs) == 0 || errs[0].Message != "footer cannot exceed 3 lines" {
+		t.Errorf("Expected a footer error, got %v", errs)
+	}
+	for field, c := range map[string]Contact{
+		"Seller.NAF":          {NAF: "620Z"},
+		"Seller.RCSCity":      {RCSCity: "Paris"},
+		"Seller.ShareCapital": {ShareCapital: -1},
+	} {
+		r := req
+		r.Seller.NAF, r.Seller.RCSCity, r.Seller.ShareCapital = c.NAF, c.RCSCity, c.ShareCapital
+		if c.RCSCity != "" {
+			r.Seller.Siret, r.Seller.Siren, r.Seller.RCS = "", "", "RCS Paris 528 250 004"
+		}
+		if errs := Validate(&r).Errors; len(errs) == 0 || errs[0].Field != field {
+			t.Errorf("Expected an error on %s, got %v", field, errs)
+		}
+	}
+	if !validNAF("62.01Z") {
+		t.Error("NAF code with a dot should be valid")
+	}
+}
+
+func TestDirectDebit(t *testing.T) {
+	req := sampleRequest()
+	req.DueDate = time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)
+	req.DirectDebit = &DirectDebit{MandateID: "RUM-2024-001", CreditorID: "FR12ZZZ123456", DebtorIBAN: "FR7630006000011234567890189"}
+	xmlContent, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	for _, want := range []string{
+		"<ram:CreditorReferenceID>FR12ZZZ123456</ram:CreditorReferenceID>",
+		"<ram:TypeCode>59</ram:TypeCode>",
+		"<ram:IBANID>FR7630006000011234567890189</ram:IBANID>",
+		"<ram:DirectDebitMandateID>RUM-2024-001</ram:DirectDebitMandateID>",
+	} {
+		if !strings.Contains(xmlContent, want) {
+			t.Errorf("Expected %s in XML:\n%s", want, xmlContent)
+		}
+	}
+	if got, want := directDebitText(&req), "Prélèvement SEPA le 15/02/2024 sur le compte FR76 **** 0189 - Mandat n° RUM-2024-001 - ICS FR12ZZZ123456"; got != want {
+		t.Errorf("directDebitText = %q, want %q", got, want)
+	}
+
+	parsed, err := ParseXML([]byte(xmlContent))
+	if err != nil || !reflect.DeepEqual(parsed.DirectDebit, req.DirectDebit) {
+		t.Errorf("ParseXML DirectDebit = %+v (%v)", parsed.DirectDebit, err)
+	}
+	ubl, err := ConvertToUBL([]byte(xmlContent))
+	if err != nil {
+		t.Fatalf("Conversion failed: %v", err)
+	}
+	if !strings.Contains(ubl, `<cbc:ID schemeID="SEPA">FR12ZZZ123456</cbc:ID>`) || !strings.Contains(ubl, "<cbc:PaymentMeansCode>59</cbc:PaymentMeansCode>") {
+		t.Errorf("Expected the direct debit in UBL:\n%s", ubl)
+	}
+	if parsed, err := ParseUBL([]byte(ubl)); err != nil || !reflect.DeepEqual(parsed.DirectDebit, req.DirectDebit) || len(parsed.Seller.GlobalIds) != 0 {
+		t.Errorf("ParseUBL DirectDebit = %+v, seller IDs %v (%v)", parsed.DirectDebit, parsed.Seller.GlobalIds, err)
+	}
+
+	for field, dd := range map[string]DirectDebit{
+		"DirectDebit.MandateID":  {CreditorID: "FR12ZZZ123456", DebtorIBAN: "FR7630006000011234567890189"},
+		"DirectDebit.CreditorID": {MandateID: "RUM-2024-001", DebtorIBAN: "FR7630006000011234567890189"},
+		"DirectDebit.DebtorIBAN": {MandateID: "RUM-2024-001", CreditorID: "FR12ZZZ123456", DebtorIBAN: "FR7630006000011234567890188"},
+	} {
+		r := req
+		r.DirectDebit = &dd
+		if errs := Validate(&r).Errors; len(errs) == 0 || errs[0].Field != field {
+			t.Errorf("Expected an error on %s, got %v", field, errs)
+		}
+	}
+	if !validIBAN("fr76 3000 6000 0112 3456 7890 189") {
+		t.Error("IBAN with spaces and lower case should be valid")
+	}
+}
+
+func TestInstallments(t *testing.T) {
+	req := sampleRequest()
+	for month := time.January; month <= time.March; month++ {
+		req.Installments = append(req.Installments, Installment{DueDate: time.Date(2024, month+1, 15, 0, 0, 0, 0, time.UTC), Amount: 400})
+	}
+	res, err := GenerateResult(req)
+	if err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	if n := strings.Count(res.XML, "<ram:SpecifiedTradePaymentTerms>"); n != 3 {
+		t.Errorf("Expected 3 payment terms, got %d:\n%s", n, res.XML)
+	}
+	for _, want := range []string{
+		"urn:factur-x.eu:1p0:extended",
+		"<ram:Description>Échéance 2/3</ram:Description>",
+		`<udt:DateTimeString format="102">20240315</udt:DateTimeString>`,
+		"<ram:PartialPaymentAmount>400.00</ram:PartialPaymentAmount>",
+	} {
+		if !strings.Contains(res.XML, want) {
+			t.Errorf("Expected %s in XML:\n%s", want, res.XML)
+		}
+	}
+	profile, err := DetectPDFProfile(res.PDF)
+	if err != nil || profile.Profile != ProfileExtended || profile.XMPProfile != ProfileExtended {
+		t.Errorf("Expected an EXTENDED document, got %+v (%v)", profile, err)
+	}
+	if result, err := ValidateXML([]byte(res.XML)); err != nil || !result.Valid() {
+		t.Errorf("Installment invoice should be valid: %v %+v", err, result)
+	}
+	parsed, err := ParseXML([]byte(res.XML))
+	if err != nil {
+		t.Fatalf("ParseXML failed: %v", err)
+	}
+	if !reflect.DeepEqual(parsed.Installments, req.Installments) {
+		t.Errorf("Installments = %+v, want %+v", parsed.Installments, req.Installments)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil || !strings.Contains(string(data), `"installments":[{"amount":400,"dueDate":"2024-02-15"}`) {
+		t.Errorf("Unexpected JSON (%v): %s", err, data)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*InvoiceRequest)
+		field  string
+	}{
+		{"total", func(r *InvoiceRequest) { r.Installments[2].Amount = 399.99 }, "Installments"},
+		{"due date", func(r *InvoiceRequest) { r.DueDate = time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC) }, "DueDate"},
+		{"order", func(r *InvoiceRequest) { r.Installments[0], r.Installments[1] = r.Installments[1], r.Installments[0] }, "Installments[1].DueDate"},
+		{"amount", func(r *InvoiceRequest) { r.Installments[0].Amount, r.Installments[1].Amount = 0, 800 }, "Installments[0].Amount"},
+	}
+	for _, tt := range tests {
+		r := req
+		r.Installments = slices.Clone(req.Installments)
+		tt.modify(&r)
+		if errs := Validate(&r).Errors; len(errs) == 0 || errs[0].Field != tt.field {
+			t.Errorf("%s: expected an error on %s, got %v", tt.name, tt.field, errs)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	req := sampleRequest()
+	req.Regime = VatFranchiseAuto()
+	req.PrecedingInvoice = &InvoiceReference{Number: "FA-2023-099", Date: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)}
+	req.DueDate = time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)
+	req.Lines[0].PeriodStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	req.Lines[0].PeriodEnd = time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"regime":{"type":"franchise"}`, `"dueDate":"2024-02-15"`, `"periodEnd":"2024-01-31"`, `"siret":"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s in %s", want, data)
+		}
+	}
+
+	var parsed InvoiceRequest
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want, err := GenerateXMLOnly(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := GenerateXMLOnly(&parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Error("XML generated from the decoded request differs from the original")
+	}
+
+	for _, bad := range []string{
+		`{"number":"A","unknown":1}`,
+		`{"number":"A","date":"15/01/2024"}`,
+		`{"number":"A","regime":{"type":"zero"}}`,
+		`{"number":"A","lines":[{"description":"x","vat":20}]}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &parsed); err == nil {
+			t.Errorf("Expected an error decoding %s", bad)
+		}
+	}
+}
+
+func TestHTTPTransmitter(t *testing.T) {
+	req := sampleRequest()
+	meta := NewTransmissionMetadata(req)
+	if meta.Type != TypeCommercial || meta.SellerSiret != req.Seller.Siret || meta.GrandTotal <= 0 {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if !bytes.Equal(data, []byte("%PDF-test")) || header.Filename != "facture-FA-2024-001.pdf" {
+			http.Error(w, "bad file", http.StatusBadRequest)
+			return
+		}
+		if !strings.Contains(r.FormValue("metadata"), `"number":"FA-2024-001"`) {
+			http.Error(w, "bad metadata", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"trackingId":"TRK-1"}`))
+	}))
+	defer srv.Close()
+
+	tr := &HTTPTransmitter{URL: srv.URL, Token: "secret"}
+	id, err := tr.Send(context.Background(), []byte("%PDF-test"), meta)
+	if err != nil || id != "TRK-1" {
+		t.Fatalf("Send() = %q, %v", id, err)
+	}
+
+	tr.Token = "wrong"
+	if _, err := tr.Send(context.Background(), []byte("%PDF-test"), meta); !errors.Is(err, ErrTransmission) {
+		t.Errorf("Expected errors.Is(err, ErrTransmission), got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Package facturxtest pins the output of an invoice pipeline in golden
+// files, so that a library upgrade changing the generated PDF or XML shows
+// up as a failing test rather than in production.
+//
+// Invoices are generated with a fixed creation date (see Normalize), the
+// only varying part of the output, and compared byte for byte with the
+// files under testdata:
+//
+//	func TestInvoice(t *testing.T) {
+//		req := buildInvoice(order) // the pipeline under test
+//		facturxtest.AssertInvoice(t, "order-42", req)
+//	}
+//
+// Running the tests with FACTURXTEST_UPDATE=1 writes the golden files
+// instead of comparing them; review and commit them like code.
+package facturxtest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// CreationDate is the creation date Normalize gives to invoices.
+var CreationDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Dir is the directory of the golden files.
+var Dir = "testdata"
+
+// Update reports whether golden files are written instead of compared. It
+// is set when the FACTURXTEST_UPDATE environment variable is not empty.
+var Update = os.Getenv("FACTURXTEST_UPDATE") != ""
+
+// Normalize returns the request with its creation date set to
+// CreationDate, so that generating it always produces the same bytes.
+func Normalize(req facturx.InvoiceRequest) facturx.InvoiceRequest {
+	var m facturx.Metadata
+	if req.Metadata != nil {
+		m = *req.Metadata
+	}
+	m.CreationDate = CreationDate
+	req.Metadata = &m
+	return req
+}
+
+// Generate generates the normalized invoice, failing the test if the
+// request is invalid.
+func Generate(t testing.TB, req facturx.InvoiceRequest) *facturx.Result {
+	t.Helper()
+	res, err := facturx.GenerateResult(Normalize(req))
+	if err != nil {
+		t.Fatalf("facturxtest: generating invoice %s: %v", req.Number, err)
+	}
+	return res
+}
+
+// AssertInvoice generates the normalized invoice and compares its PDF and
+// XML with the golden files name.pdf and name.xml.
+func AssertInvoice(t testing.TB, name string, req facturx.InvoiceRequest) {
+	t.Helper()
+	res := Generate(t, req)
+	AssertGolden(t, name+".xml", []byte(res.XML))
+	AssertGolden(t, name+".pdf", res.PDF)
+}
+
+// AssertGolden compares got with the golden file name in Dir, reporting
+// the first difference. With Update, it writes got to the file instead.
+func AssertGolden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join(Dir, name)
+	if Update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("facturxtest: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("facturxtest: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("facturxtest: %v (run with FACTURXTEST_UPDATE=1 to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("facturxtest: %s differs from the golden file: %s", name, firstDifference(got, want))
+	}
+}
+
+// firstDifference describes where got and want first differ, with the
+// line number and both lines for text.
+func firstDifference(got, want []byte) string {
+	i := 0
+	for i < len(got) && i < len(want) && got[i] == want[i] {
+		i++
+	}
+	line := bytes.Count(got[:i], []byte("\n")) + 1
+	start := bytes.LastIndexByte(got[:i], '\n') + 1
+	excerpt := func(b []byte) string {
+		end := start + 120
+		if nl := bytes.IndexByte(b[min(start, len(b)):], '\n'); nl >= 0 {
+			end = min(end, start+nl)
+		}
+		return string(b[min(start, len(b)):min(end, len(b))])
+	}
+	return fmt.Sprintf("byte %d (line %d)\n got: %q\nwant: %q", i, line, excerpt(got), excerpt(want))
+}
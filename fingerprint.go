@@ -0,0 +1,57 @@
+package facturx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Fingerprint returns a stable SHA-256 digest, in hexadecimal, of the data
+// of an invoice: its CII document, after CustomizeCII, in the XMLCompact
+// format. Presentation options (layout, font, header, PDF and XML format
+// options) do not change it, so two submissions of the same invoice share
+// a fingerprint. Supplements count through their references only.
+//
+// FingerprintPDF computes the same digest from the XML embedded in a PDF,
+// to prove that an archived PDF matches the issued data.
+func Fingerprint(req InvoiceRequest) (string, error) {
+	doc, err := BuildCII(&req)
+	if err != nil {
+		return "", err
+	}
+	if req.CustomizeCII != nil {
+		req.CustomizeCII(doc)
+	}
+	return doc.fingerprint()
+}
+
+// FingerprintXML returns the fingerprint of a CII invoice, whatever its
+// formatting. It returns an error wrapping ErrXML if the document cannot
+// be parsed.
+func FingerprintXML(data []byte) (string, error) {
+	doc, err := ParseCII(data)
+	if err != nil {
+		return "", err
+	}
+	return doc.fingerprint()
+}
+
+// FingerprintPDF returns the fingerprint of the invoice embedded in a
+// Factur-X PDF. It returns an error wrapping ErrPDF if the PDF has no
+// readable factur-x.xml, or ErrXML if the XML cannot be parsed.
+func FingerprintPDF(pdf []byte) (string, error) {
+	data, err := ExtractXML(pdf)
+	if err != nil {
+		return "", err
+	}
+	return FingerprintXML(data)
+}
+
+// fingerprint hashes the canonical serialization of the document.
+func (d *CrossIndustryInvoice) fingerprint() (string, error) {
+	canonical, err := d.Marshal(XMLCompact)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -3,36 +3,126 @@ package facturx
 import (
 	_ "embed"
 	"encoding/binary"
+	"fmt"
+	"strings"
 	"sync"
 )
 
 //go:embed assets/LiberationSans-Subset.ttf
 var fontData []byte
 
-// fontMetrics holds parsed font metrics.
-type fontMetrics struct {
+// FontMetrics holds the metrics of a font used to lay out the invoice
+// text, as parsed from its TrueType program (see NewTrueTypeFont).
+type FontMetrics struct {
 	unitsPerEM   uint16
 	glyphWidths  map[uint32]uint16
+	glyphIDs     map[uint32]uint16 // character -> glyph index
 	defaultWidth uint16
 	ascender     int16
 	descender    int16
+	capHeight    int16
+	bbox         [4]int16 // xMin, yMin, xMax, yMax
+}
+
+// FontProvider supplies the font the invoice text is drawn with: its
+// metrics to lay out text, its TrueType program to embed and the encoder
+// of the PDF strings. The PDF font uses WinAnsiEncoding.
+//
+// DefaultFont is used when InvoiceRequest.Font is nil; NewTrueTypeFont
+// provides another TrueType font, e.g. a corporate font or another weight.
+type FontProvider interface {
+	// Name returns the PostScript name of the font, e.g. "LiberationSans".
+	Name() string
+	// Metrics returns the metrics of the font. An error should wrap
+	// ErrFont.
+	Metrics() (*FontMetrics, error)
+	// Data returns the TrueType font program. It is embedded subset to
+	// the glyphs each invoice uses.
+	Data() []byte
+	// Encode converts text to WinAnsiEncoding bytes, e.g. with
+	// EncodeWinAnsi.
+	Encode(text string) []byte
+}
+
+// DefaultFont is the Liberation Sans font embedded in the library.
+var DefaultFont FontProvider = liberationSans{}
+
+// liberationSans is the embedded font.
+type liberationSans struct{}
+
+func (liberationSans) Name() string                   { return "LiberationSans" }
+func (liberationSans) Metrics() (*FontMetrics, error) { return loadFontMetrics() }
+func (liberationSans) Data() []byte                   { return fontData }
+
+func (liberationSans) Encode(text string) []byte {
+	metrics, _ := loadFontMetrics()
+	return EncodeWinAnsi(text, metrics)
+}
+
+// TrueTypeFont is a FontProvider for a TrueType font program.
+type TrueTypeFont struct {
+	name    string
+	data    []byte
+	metrics *FontMetrics
+}
+
+// NewTrueTypeFont returns the font of the TrueType program data (the
+// content of a .ttf file), named name in the PDF. Its character map must
+// have a Unicode subtable. The error wraps ErrFont.
+func NewTrueTypeFont(name string, data []byte) (*TrueTypeFont, error) {
+	if !isPDFName(name) {
+		return nil, fmt.Errorf("%w: invalid font name %q", ErrFont, name)
+	}
+	metrics, err := parseTTF(data)
+	if err != nil {
+		return nil, fmt.Errorf("font %s: %w", name, err)
+	}
+	return &TrueTypeFont{name: name, data: data, metrics: metrics}, nil
+}
+
+func (f *TrueTypeFont) Name() string                   { return f.name }
+func (f *TrueTypeFont) Metrics() (*FontMetrics, error) { return f.metrics, nil }
+func (f *TrueTypeFont) Data() []byte                   { return f.data }
+func (f *TrueTypeFont) Encode(text string) []byte      { return EncodeWinAnsi(text, f.metrics) }
+
+// isPDFName reports whether name can be written as a PDF name without
+// escapes: printable ASCII without delimiters.
+func isPDFName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if c <= ' ' || c > '~' || strings.IndexByte("()<>[]{}/%#", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFont returns the font of req.
+func requestFont(req *InvoiceRequest) FontProvider {
+	if req.Font != nil {
+		return req.Font
+	}
+	return DefaultFont
 }
 
 var (
-	cachedMetrics *fontMetrics
+	cachedMetrics *FontMetrics
+	metricsErr    error
 	metricsOnce   sync.Once
 )
 
-// getFontMetrics returns cached font metrics (parses on first call).
-func getFontMetrics() *fontMetrics {
+// loadFontMetrics parses the embedded font on first call and returns its
+// metrics, or the parse error wrapping ErrFont.
+func loadFontMetrics() (*FontMetrics, error) {
 	metricsOnce.Do(func() {
-		var err error
-		cachedMetrics, err = parseTTF(fontData)
-		if err != nil {
-			panic("failed to parse embedded font: " + err.Error())
+		cachedMetrics, metricsErr = parseTTF(fontData)
+		if metricsErr != nil {
+			metricsErr = fmt.Errorf("embedded font: %w", metricsErr)
 		}
 	})
-	return cachedMetrics
+	return cachedMetrics, metricsErr
 }
 
 // getFontData returns raw font data for PDF embedding.
@@ -41,15 +131,21 @@ func getFontData() []byte {
 }
 
 // charWidth returns the advance width for a character in font units.
-func (m *fontMetrics) charWidth(c rune) uint16 {
+func (m *FontMetrics) charWidth(c rune) uint16 {
 	if w, ok := m.glyphWidths[uint32(c)]; ok {
 		return w
 	}
 	return m.defaultWidth
 }
 
+// hasGlyph reports whether the font defines a glyph for the character.
+func (m *FontMetrics) hasGlyph(c rune) bool {
+	_, ok := m.glyphWidths[uint32(c)]
+	return ok
+}
+
 // stringWidth calculates the width of a string at the given font size in points.
-func (m *fontMetrics) stringWidth(s string, fontSize float64) float64 {
+func (m *FontMetrics) stringWidth(s string, fontSize float64) float64 {
 	var totalWidth uint32
 	for _, c := range s {
 		totalWidth += uint32(m.charWidth(c))
@@ -89,14 +185,30 @@ func findTable(data []byte, tag string) (tableEntry, bool) {
 	return tableEntry{}, false
 }
 
-// parseHead parses the 'head' table to get unitsPerEm.
-func parseHead(data []byte, table tableEntry) (uint16, error) {
+// parseHead parses the 'head' table to get unitsPerEm and the bounding box
+// of all glyphs.
+func parseHead(data []byte, table tableEntry) (unitsPerEM uint16, bbox [4]int16, err error) {
 	offset := int(table.offset)
 	if table.length < 54 || offset+54 > len(data) {
-		return 0, errTableTooSmall
+		return 0, bbox, errTableTooSmall
 	}
-	// unitsPerEm is at offset 18 within head table
-	return binary.BigEndian.Uint16(data[offset+18 : offset+20]), nil
+	// unitsPerEm is at offset 18 within head table, xMin, yMin, xMax and
+	// yMax at offset 36
+	for i := range bbox {
+		bbox[i] = int16(binary.BigEndian.Uint16(data[offset+36+2*i:]))
+	}
+	return binary.BigEndian.Uint16(data[offset+18 : offset+20]), bbox, nil
+}
+
+// parseCapHeight returns the capital height from the 'OS/2' table, or
+// ascender when the table is missing or older than version 2.
+func parseCapHeight(data []byte, ascender int16) int16 {
+	table, ok := findTable(data, "OS/2")
+	offset := int(table.offset)
+	if !ok || table.length < 90 || offset+90 > len(data) || binary.BigEndian.Uint16(data[offset:]) < 2 {
+		return ascender
+	}
+	return int16(binary.BigEndian.Uint16(data[offset+88:]))
 }
 
 // parseHhea parses the 'hhea' table to get numberOfHMetrics and ascender/descender.
@@ -131,10 +243,11 @@ func parseHmtx(data []byte, table tableEntry, numHMetrics uint16) []uint16 {
 	return widths
 }
 
-// parseCmapFormat4 parses a cmap format 4 subtable (Unicode BMP).
-func parseCmapFormat4(data []byte, subtableOffset int, glyphWidthsRaw []uint16) (map[uint32]uint16, error) {
+// parseCmapFormat4 parses a cmap format 4 subtable (Unicode BMP) into
+// character widths and glyph indexes.
+func parseCmapFormat4(data []byte, subtableOffset int, glyphWidthsRaw []uint16) (map[uint32]uint16, map[uint32]uint16, error) {
 	if subtableOffset+14 > len(data) {
-		return nil, errTableTooSmall
+		return nil, nil, errTableTooSmall
 	}
 
 	segCountX2 := int(binary.BigEndian.Uint16(data[subtableOffset+6 : subtableOffset+8]))
@@ -148,6 +261,7 @@ func parseCmapFormat4(data []byte, subtableOffset int, glyphWidthsRaw []uint16)
 	idRangeOffsetOffset := idDeltaOffset + segCountX2
 
 	charToWidth := make(map[uint32]uint16)
+	charToGlyph := make(map[uint32]uint16)
 	defaultWidth := uint16(600)
 	if len(glyphWidthsRaw) > 0 {
 		defaultWidth = glyphWidthsRaw[0]
@@ -199,17 +313,19 @@ func parseCmapFormat4(data []byte, subtableOffset int, glyphWidthsRaw []uint16)
 			}
 
 			charToWidth[code] = width
+			charToGlyph[code] = glyphIndex
 		}
 	}
 
-	return charToWidth, nil
+	return charToWidth, charToGlyph, nil
 }
 
-// parseCmap parses the 'cmap' table to build character -> glyph width mapping.
-func parseCmap(data []byte, table tableEntry, glyphWidthsRaw []uint16) (map[uint32]uint16, error) {
+// parseCmap parses the 'cmap' table to build the character -> glyph width
+// and character -> glyph index mappings.
+func parseCmap(data []byte, table tableEntry, glyphWidthsRaw []uint16) (map[uint32]uint16, map[uint32]uint16, error) {
 	offset := int(table.offset)
 	if offset+4 > len(data) {
-		return nil, errTableTooSmall
+		return nil, nil, errTableTooSmall
 	}
 	numTables := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
 
@@ -255,11 +371,11 @@ func parseCmap(data []byte, table tableEntry, glyphWidthsRaw []uint16) (map[uint
 		}
 	}
 
-	return nil, errNoCmapSubtable
+	return nil, nil, errNoCmapSubtable
 }
 
 // parseTTF parses a TTF font and extracts metrics.
-func parseTTF(data []byte) (*fontMetrics, error) {
+func parseTTF(data []byte) (*FontMetrics, error) {
 	if len(data) < 12 {
 		return nil, errInvalidTTF
 	}
@@ -288,10 +404,13 @@ func parseTTF(data []byte) (*fontMetrics, error) {
 		return nil, errMissingTable
 	}
 
-	unitsPerEM, err := parseHead(data, head)
+	unitsPerEM, bbox, err := parseHead(data, head)
 	if err != nil {
 		return nil, err
 	}
+	if unitsPerEM == 0 {
+		return nil, errInvalidTTF
+	}
 
 	numHMetrics, ascender, descender, err := parseHhea(data, hhea)
 	if err != nil {
@@ -305,17 +424,20 @@ func parseTTF(data []byte) (*fontMetrics, error) {
 		defaultWidth = glyphWidthsRaw[0]
 	}
 
-	glyphWidths, err := parseCmap(data, cmap, glyphWidthsRaw)
+	glyphWidths, glyphIDs, err := parseCmap(data, cmap, glyphWidthsRaw)
 	if err != nil {
 		return nil, err
 	}
 
-	return &fontMetrics{
+	return &FontMetrics{
 		unitsPerEM:   unitsPerEM,
 		glyphWidths:  glyphWidths,
+		glyphIDs:     glyphIDs,
 		defaultWidth: defaultWidth,
 		ascender:     ascender,
 		descender:    descender,
+		capHeight:    parseCapHeight(data, ascender),
+		bbox:         bbox,
 	}, nil
 }
 
@@ -324,6 +446,9 @@ type fontError string
 
 func (e fontError) Error() string { return string(e) }
 
+// Unwrap makes every fontError match ErrFont with errors.Is.
+func (e fontError) Unwrap() error { return ErrFont }
+
 const (
 	errInvalidTTF     fontError = "invalid TTF signature"
 	errMissingTable   fontError = "missing required table"
@@ -0,0 +1,313 @@
+package facturx
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+)
+
+// subsetTables are the TrueType tables kept in a font subset: those PDF
+// viewers use to render glyphs. The OpenType layout tables (GDEF, GPOS,
+// GSUB) are dropped, as PDF text is positioned by the content stream.
+var subsetTables = map[string]bool{
+	"OS/2": true, "cmap": true, "cvt ": true, "fpgm": true, "gasp": true,
+	"glyf": true, "head": true, "hhea": true, "hmtx": true, "loca": true,
+	"maxp": true, "name": true, "post": true, "prep": true,
+}
+
+// embeddedFont returns the font name and the compressed font program
+// stream for a page drawing content: the font is subset to the glyphs the
+// page uses, and its name gets the subset tag PDF requires. It falls back
+// to the full font if the subset cannot be built. The static resources
+// must be loaded.
+func embeddedFont(font FontProvider, metrics *FontMetrics, content []byte) (string, pdfObject) {
+	data := font.Data()
+	subset, err := subsetFont(data, contentGlyphs(content, metrics))
+	if err != nil {
+		if _, ok := font.(liberationSans); ok {
+			return font.Name(), staticFontFile
+		}
+		compressed := flate(data)
+		return font.Name(), pdfObject{
+			content: []byte(fontFileDict(len(compressed), len(data))),
+			stream:  compressed,
+		}
+	}
+	compressed := flate(subset)
+	return subsetTag(subset) + "+" + font.Name(), pdfObject{
+		content: []byte(fontFileDict(len(compressed), len(subset))),
+		stream:  compressed,
+	}
+}
+
+// contentGlyphs returns the glyphs of the font drawn by the WinAnsi
+// encoded strings of a content stream.
+func contentGlyphs(content []byte, metrics *FontMetrics) map[uint16]bool {
+	glyphs := make(map[uint16]bool)
+	p := newPDFParser(content, 0)
+	for {
+		p.skipSpace()
+		if p.pos >= len(content) {
+			break
+		}
+		if p.peek() != '(' {
+			// Operators, numbers and names; delimiters are skipped alone
+			if p.regularToken() == "" {
+				p.pos++
+			}
+			continue
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			break
+		}
+		text, _ := v.(pdfString)
+		for _, r := range decodeWinAnsi(text) {
+			if gid, ok := metrics.glyphIDs[uint32(r)]; ok {
+				glyphs[gid] = true
+			}
+		}
+	}
+	return glyphs
+}
+
+// glyphTable gives access to the glyph outlines of a TrueType font.
+type glyphTable struct {
+	data      []byte
+	glyf      tableEntry
+	loca      tableEntry
+	longLoca  bool
+	numGlyphs int
+}
+
+// readGlyphTable locates the glyph outlines of font data.
+func readGlyphTable(data []byte) (*glyphTable, error) {
+	head, okHead := findTable(data, "head")
+	maxp, okMaxp := findTable(data, "maxp")
+	loca, okLoca := findTable(data, "loca")
+	glyf, okGlyf := findTable(data, "glyf")
+	if !okHead || !okMaxp || !okLoca || !okGlyf {
+		return nil, errMissingTable
+	}
+	if head.length < 54 || int(head.offset)+54 > len(data) || maxp.length < 6 || int(maxp.offset)+6 > len(data) {
+		return nil, errTableTooSmall
+	}
+	t := &glyphTable{
+		data:      data,
+		glyf:      glyf,
+		loca:      loca,
+		longLoca:  binary.BigEndian.Uint16(data[head.offset+50:]) == 1,
+		numGlyphs: int(binary.BigEndian.Uint16(data[maxp.offset+4:])),
+	}
+	if int(loca.offset)+(t.numGlyphs+1)*t.locaSize() > len(data) || int(glyf.offset)+int(glyf.length) > len(data) {
+		return nil, errTableTooSmall
+	}
+	return t, nil
+}
+
+// locaSize returns the size of a 'loca' entry.
+func (t *glyphTable) locaSize() int {
+	if t.longLoca {
+		return 4
+	}
+	return 2
+}
+
+// glyphOffset returns entry i of the 'loca' table.
+func (t *glyphTable) glyphOffset(i int) int {
+	pos := int(t.loca.offset) + i*t.locaSize()
+	if t.longLoca {
+		return int(binary.BigEndian.Uint32(t.data[pos:]))
+	}
+	return 2 * int(binary.BigEndian.Uint16(t.data[pos:]))
+}
+
+// glyph returns the outline data of glyph gid, empty for glyphs without
+// contours.
+func (t *glyphTable) glyph(gid int) ([]byte, error) {
+	start, end := t.glyphOffset(gid), t.glyphOffset(gid+1)
+	if start > end || end > int(t.glyf.length) {
+		return nil, errTableTooSmall
+	}
+	return t.data[int(t.glyf.offset)+start : int(t.glyf.offset)+end], nil
+}
+
+// Composite glyph flags (OpenType 'glyf' table).
+const (
+	compositeArgsAreWords  = 0x0001
+	compositeHasScale      = 0x0008
+	compositeMoreComponent = 0x0020
+	compositeHasXYScale    = 0x0040
+	compositeHasTwoByTwo   = 0x0080
+)
+
+// compositeComponents returns the glyphs a composite glyph is built from.
+func compositeComponents(g []byte) []int {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	var components []int
+	for pos := 10; pos+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[pos:])
+		components = append(components, int(binary.BigEndian.Uint16(g[pos+2:])))
+		pos += 6
+		if flags&compositeArgsAreWords != 0 {
+			pos += 2
+		}
+		switch {
+		case flags&compositeHasScale != 0:
+			pos += 2
+		case flags&compositeHasXYScale != 0:
+			pos += 4
+		case flags&compositeHasTwoByTwo != 0:
+			pos += 8
+		}
+		if flags&compositeMoreComponent == 0 {
+			break
+		}
+	}
+	return components
+}
+
+// subsetFont returns a copy of the TrueType font data keeping the outlines
+// of glyphs only, along with .notdef and the components of composite
+// glyphs. Glyph indexes are unchanged, so the character map and metrics
+// are kept as is and the other glyphs are left empty.
+func subsetFont(data []byte, glyphs map[uint16]bool) ([]byte, error) {
+	t, err := readGlyphTable(data)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[int]bool)
+	queue := []int{0}
+	for gid := range glyphs {
+		queue = append(queue, int(gid))
+	}
+	for len(queue) > 0 {
+		gid := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if keep[gid] || gid >= t.numGlyphs {
+			continue
+		}
+		keep[gid] = true
+		g, err := t.glyph(gid)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, compositeComponents(g)...)
+	}
+
+	// New 'glyf' and 'loca' tables, in the same 'loca' format
+	var glyf bytes.Buffer
+	loca := make([]byte, (t.numGlyphs+1)*t.locaSize())
+	putOffset := func(i int) {
+		if t.longLoca {
+			binary.BigEndian.PutUint32(loca[i*4:], uint32(glyf.Len()))
+		} else {
+			binary.BigEndian.PutUint16(loca[i*2:], uint16(glyf.Len()/2))
+		}
+	}
+	for gid := 0; gid < t.numGlyphs; gid++ {
+		putOffset(gid)
+		if keep[gid] {
+			g, _ := t.glyph(gid)
+			glyf.Write(g)
+			for glyf.Len()%4 != 0 {
+				glyf.WriteByte(0)
+			}
+		}
+	}
+	putOffset(t.numGlyphs)
+
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(data[4:6]))
+	for i := 0; i < numTables; i++ {
+		entry := 12 + i*16
+		if entry+16 > len(data) {
+			return nil, errTableTooSmall
+		}
+		tag := string(data[entry : entry+4])
+		offset := int(binary.BigEndian.Uint32(data[entry+8:]))
+		length := int(binary.BigEndian.Uint32(data[entry+12:]))
+		if offset+length > len(data) {
+			return nil, errTableTooSmall
+		}
+		if subsetTables[tag] {
+			tables[tag] = data[offset : offset+length]
+		}
+	}
+	tables["glyf"], tables["loca"] = glyf.Bytes(), loca
+	head := append([]byte(nil), tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0) // checkSumAdjustment, set below
+	tables["head"] = head
+	return writeFont(data[:4], tables), nil
+}
+
+// writeFont assembles a TrueType font from its tables.
+func writeFont(version []byte, tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	var out bytes.Buffer
+	out.Write(version)
+	for _, v := range []int{n, searchRange, entrySelector, n*16 - searchRange} {
+		out.Write(binary.BigEndian.AppendUint16(nil, uint16(v)))
+	}
+	offset, headOffset := 12+n*16, 0
+	for _, tag := range tags {
+		table := tables[tag]
+		if tag == "head" {
+			headOffset = offset
+		}
+		out.WriteString(tag)
+		out.Write(binary.BigEndian.AppendUint32(nil, fontChecksum(table)))
+		out.Write(binary.BigEndian.AppendUint32(nil, uint32(offset)))
+		out.Write(binary.BigEndian.AppendUint32(nil, uint32(len(table))))
+		offset += (len(table) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		out.Write(tables[tag])
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+
+	font := out.Bytes()
+	binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-fontChecksum(font))
+	return font
+}
+
+// fontChecksum returns the TrueType checksum of data: the sum of its
+// big-endian 32-bit words, zero padded.
+func fontChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// subsetTag returns the six uppercase letters prefixing the name of a font
+// subset, derived from its content.
+func subsetTag(font []byte) string {
+	sum := md5.Sum(font)
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+	return string(tag)
+}
@@ -0,0 +1,256 @@
+package facturx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JSON representation
+//
+// InvoiceRequest and the types it contains marshal to the canonical JSON
+// schema shared by the web API and the command-line tool. Dates are
+// "YYYY-MM-DD" strings, whichever of the time.Time or legacy string field
+// is set, and unmarshal into the time.Time fields. VAT regimes are objects
+// such as {"type": "standard", "rate": 20}. Unknown fields are rejected.
+
+const jsonDateLayout = "2006-01-02"
+
+// VAT regime types in JSON
+const (
+	jsonVatStandard      = "standard"
+	jsonVatFranchise     = "franchise"
+	jsonVatExemptHealth  = "exemptHealth"
+	jsonVatReverseCharge = "reverseCharge"
+	jsonVatMargin        = "margin"
+)
+
+type vatRegimeJSON struct {
+	Type string  `json:"type"`
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// MarshalJSON encodes the regime as {"type": ..., "rate": ...}, the type
+// being "standard", "franchise", "exemptHealth", "reverseCharge" or
+// "margin".
+func (v VatRegime) MarshalJSON() ([]byte, error) {
+	switch v.kind {
+	case vatFranchiseAuto:
+		return json.Marshal(vatRegimeJSON{Type: jsonVatFranchise})
+	case vatExemptHealth:
+		return json.Marshal(vatRegimeJSON{Type: jsonVatExemptHealth})
+	case vatReverseCharge:
+		return json.Marshal(vatRegimeJSON{Type: jsonVatReverseCharge})
+	case vatMargin:
+		return json.Marshal(vatRegimeJSON{Type: jsonVatMargin})
+	}
+	return json.Marshal(vatRegimeJSON{Type: jsonVatStandard, Rate: v.rate})
+}
+
+// UnmarshalJSON decodes a regime encoded by MarshalJSON.
+func (v *VatRegime) UnmarshalJSON(data []byte) error {
+	var r vatRegimeJSON
+	if err := decodeStrict(data, &r); err != nil {
+		return err
+	}
+	switch r.Type {
+	case jsonVatStandard:
+		*v = VatStandard(r.Rate)
+	case jsonVatFranchise:
+		*v = VatFranchiseAuto()
+	case jsonVatExemptHealth:
+		*v = VatExemptHealth()
+	case jsonVatReverseCharge:
+		*v = VatReverseCharge()
+	case jsonVatMargin:
+		*v = VatMarginScheme()
+	default:
+		return fmt.Errorf("facturx: unknown VAT regime type %q", r.Type)
+	}
+	return nil
+}
+
+func (r InvoiceRequest) MarshalJSON() ([]byte, error) {
+	type plain InvoiceRequest
+	n := normalizeDates(r)
+	return json.Marshal(struct {
+		plain
+		Date         string `json:"date"`
+		DueDate      string `json:"dueDate,omitempty"`
+		DeliveryDate string `json:"deliveryDate,omitempty"`
+		TaxPointDate string `json:"taxPointDate,omitempty"`
+	}{
+		plain:        plain(r),
+		Date:         reformatDate(n.Date, ciiDateLayout),
+		DueDate:      formatJSONDate(r.DueDate),
+		DeliveryDate: formatJSONDate(r.DeliveryDate),
+		TaxPointDate: formatJSONDate(r.TaxPointDate),
+	})
+}
+
+func (r *InvoiceRequest) UnmarshalJSON(data []byte) error {
+	type plain InvoiceRequest
+	v := struct {
+		*plain
+		Date         string `json:"date"`
+		DueDate      string `json:"dueDate"`
+		DeliveryDate string `json:"deliveryDate"`
+		TaxPointDate string `json:"taxPointDate"`
+	}{plain: (*plain)(r)}
+	if err := decodeStrict(data, &v); err != nil {
+		return err
+	}
+	return parseJSONDates(map[string]jsonDate{
+		"date":         {v.Date, &r.IssueDate},
+		"dueDate":      {v.DueDate, &r.DueDate},
+		"deliveryDate": {v.DeliveryDate, &r.DeliveryDate},
+		"taxPointDate": {v.TaxPointDate, &r.TaxPointDate},
+	})
+}
+
+func (l InvoiceLine) MarshalJSON() ([]byte, error) {
+	type plain InvoiceLine
+	date := formatJSONDate(l.ServiceDate)
+	if date == "" {
+		date = reformatDate(l.Date, displayDateLayout)
+	}
+	return json.Marshal(struct {
+		plain
+		Date        string `json:"date,omitempty"`
+		PeriodStart string `json:"periodStart,omitempty"`
+		PeriodEnd   string `json:"periodEnd,omitempty"`
+	}{
+		plain:       plain(l),
+		Date:        date,
+		PeriodStart: formatJSONDate(l.PeriodStart),
+		PeriodEnd:   formatJSONDate(l.PeriodEnd),
+	})
+}
+
+func (l *InvoiceLine) UnmarshalJSON(data []byte) error {
+	type plain InvoiceLine
+	v := struct {
+		*plain
+		Date        string `json:"date"`
+		PeriodStart string `json:"periodStart"`
+		PeriodEnd   string `json:"periodEnd"`
+	}{plain: (*plain)(l)}
+	if err := decodeStrict(data, &v); err != nil {
+		return err
+	}
+	return parseJSONDates(map[string]jsonDate{
+		"date":        {v.Date, &l.ServiceDate},
+		"periodStart": {v.PeriodStart, &l.PeriodStart},
+		"periodEnd":   {v.PeriodEnd, &l.PeriodEnd},
+	})
+}
+
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type plain Payment
+	date := formatJSONDate(p.PaidOn)
+	if date == "" {
+		date = reformatDate(p.Date, displayDateLayout)
+	}
+	return json.Marshal(struct {
+		plain
+		Date string `json:"date"`
+	}{plain(p), date})
+}
+
+func (p *Payment) UnmarshalJSON(data []byte) error {
+	type plain Payment
+	v := struct {
+		*plain
+		Date string `json:"date"`
+	}{plain: (*plain)(p)}
+	if err := decodeStrict(data, &v); err != nil {
+		return err
+	}
+	return parseJSONDates(map[string]jsonDate{"date": {v.Date, &p.PaidOn}})
+}
+
+func (ref InvoiceReference) MarshalJSON() ([]byte, error) {
+	type plain InvoiceReference
+	return json.Marshal(struct {
+		plain
+		Date string `json:"date,omitempty"`
+	}{plain(ref), formatJSONDate(ref.Date)})
+}
+
+func (ref *InvoiceReference) UnmarshalJSON(data []byte) error {
+	type plain InvoiceReference
+	v := struct {
+		*plain
+		Date string `json:"date"`
+	}{plain: (*plain)(ref)}
+	if err := decodeStrict(data, &v); err != nil {
+		return err
+	}
+	return parseJSONDates(map[string]jsonDate{"date": {v.Date, &ref.Date}})
+}
+
+func (inst Installment) MarshalJSON() ([]byte, error) {
+	type plain Installment
+	return json.Marshal(struct {
+		plain
+		DueDate string `json:"dueDate"`
+	}{plain(inst), formatJSONDate(inst.DueDate)})
+}
+
+func (inst *Installment) UnmarshalJSON(data []byte) error {
+	type plain Installment
+	v := struct {
+		*plain
+		DueDate string `json:"dueDate"`
+	}{plain: (*plain)(inst)}
+	if err := decodeStrict(data, &v); err != nil {
+		return err
+	}
+	return parseJSONDates(map[string]jsonDate{"dueDate": {v.DueDate, &inst.DueDate}})
+}
+
+// decodeStrict decodes a single JSON value, rejecting unknown fields.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// jsonDate is a date read from JSON and its destination.
+type jsonDate struct {
+	value string
+	dst   *time.Time
+}
+
+// parseJSONDates parses YYYY-MM-DD dates, empty ones being left unset.
+func parseJSONDates(dates map[string]jsonDate) error {
+	for field, d := range dates {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.Parse(jsonDateLayout, d.value)
+		if err != nil {
+			return fmt.Errorf("facturx: invalid %s %q, expected YYYY-MM-DD", field, d.value)
+		}
+		*d.dst = t
+	}
+	return nil
+}
+
+func formatJSONDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(jsonDateLayout)
+}
+
+// reformatDate converts a legacy date string in layout to YYYY-MM-DD,
+// returning it unchanged if it cannot be parsed.
+func reformatDate(s, layout string) string {
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return s
+	}
+	return t.Format(jsonDateLayout)
+}
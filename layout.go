@@ -0,0 +1,251 @@
+package facturx
+
+import "strings"
+
+// LayoutWarning reports text that did not fit its area on the PDF, even
+// at the smallest font size, and was truncated.
+type LayoutWarning struct {
+	// Field is the request field holding the text (e.g.
+	// "Lines[2].Description"), or the area for generated text.
+	Field string `json:"field"`
+	// Text is the full text that did not fit.
+	Text string `json:"text"`
+}
+
+// minFontScale is how far text may shrink before it is truncated.
+const minFontScale = 0.75
+
+// textLayout measures the strings of the page with the font metrics and
+// collects the warnings for those that overflow their area.
+type textLayout struct {
+	font     FontProvider
+	metrics  *FontMetrics
+	warnings []LayoutWarning
+}
+
+// fit returns text and the font size at which it fits in width. The size
+// shrinks down to minFontScale; beyond that the text is truncated with
+// "..." and a warning is recorded for field.
+func (l *textLayout) fit(field, text string, width, size float64) (string, float64) {
+	fitted, size := fitText(l.metrics, text, width, size)
+	if fitted != text {
+		l.warnings = append(l.warnings, LayoutWarning{Field: field, Text: text})
+	}
+	return fitted, size
+}
+
+// truncate shortens text with "..." until it fits in width at size,
+// recording a warning for field when it had to.
+func (l *textLayout) truncate(field, text string, width, size float64) string {
+	truncated := truncateText(l.metrics, text, width, size)
+	if truncated != text {
+		l.warnings = append(l.warnings, LayoutWarning{Field: field, Text: text})
+	}
+	return truncated
+}
+
+// wrap splits text into lines no wider than width at size.
+func (l *textLayout) wrap(text string, width, size float64) []string {
+	return wrapText(l.metrics, text, width, size)
+}
+
+// fitText returns text and the font size at which it fits in width,
+// shrinking the size down to minFontScale, then truncating the text.
+func fitText(metrics *FontMetrics, text string, width, size float64) (string, float64) {
+	w := metrics.stringWidth(text, size)
+	if w <= width {
+		return text, size
+	}
+	if scaled := size * width / w; scaled >= size*minFontScale {
+		return text, scaled
+	}
+	size *= minFontScale
+	return truncateText(metrics, text, width, size), size
+}
+
+// truncateText shortens text with "..." until it fits in width at size.
+func truncateText(metrics *FontMetrics, text string, width, size float64) string {
+	if metrics.stringWidth(text, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && metrics.stringWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimRight(string(runes), " ") + "..."
+}
+
+// wrapText splits text into lines no wider than width at size, breaking
+// between words. A single word wider than width keeps a line of its own.
+func wrapText(metrics *FontMetrics, text string, width, size float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && metrics.stringWidth(candidate, size) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	return append(lines, line)
+}
+
+// TextMeasurer measures text the way the PDF engine lays it out, so that
+// external layout code and custom renderers get the same widths and line
+// breaks as the generated invoices.
+type TextMeasurer struct {
+	metrics *FontMetrics
+}
+
+// NewTextMeasurer returns a measurer for font, or DefaultFont when font is
+// nil. The error wraps ErrFont.
+func NewTextMeasurer(font FontProvider) (*TextMeasurer, error) {
+	if font == nil {
+		font = DefaultFont
+	}
+	metrics, err := font.Metrics()
+	if err != nil {
+		return nil, err
+	}
+	return &TextMeasurer{metrics: metrics}, nil
+}
+
+// Width returns the width of text in points at font size.
+func (m *TextMeasurer) Width(text string, size float64) float64 {
+	return m.metrics.stringWidth(text, size)
+}
+
+// Wrap splits text into lines no wider than maxWidth points at size,
+// breaking between words as for the legal mentions. A single word wider
+// than maxWidth keeps a line of its own.
+func (m *TextMeasurer) Wrap(text string, maxWidth, size float64) []string {
+	return wrapText(m.metrics, text, maxWidth, size)
+}
+
+// Fit returns text and the font size at which it fits in maxWidth points,
+// as for the parties, descriptions and footer: the size shrinks down to
+// three quarters of size, then the text is truncated with "...".
+func (m *TextMeasurer) Fit(text string, maxWidth, size float64) (string, float64) {
+	return fitText(m.metrics, text, maxWidth, size)
+}
+
+// Page size in points (A4).
+const a4Width, a4Height = 595.28, 841.89
+
+// LayoutConfig adjusts the geometry of the PDF page, e.g. to widen the
+// description column. Zero fields keep their defaults.
+type LayoutConfig struct {
+	// Margin is the left and right page margin, in points (default 50).
+	Margin float64 `json:"margin,omitempty"`
+	// DateWidth is the width of the line table's Date column, shown when
+	// a line has a date (default 65). The Description column follows it.
+	DateWidth float64 `json:"dateWidth,omitempty"`
+	// Quantity, UnitPrice, Discount and Total are the x positions of the
+	// line table columns, in points from the left margin. They default to
+	// 295, 355, 390 and 440; Quantity and UnitPrice move 50 points left
+	// when the Remise column is shown.
+	Quantity  float64 `json:"quantity,omitempty"`
+	UnitPrice float64 `json:"unitPrice,omitempty"`
+	Discount  float64 `json:"discount,omitempty"`
+	Total     float64 `json:"total,omitempty"`
+	// RowHeight is the height of a line table row, in points (default 22).
+	RowHeight float64 `json:"rowHeight,omitempty"`
+}
+
+// tableColumns are the absolute x positions of the line table columns.
+type tableColumns struct {
+	date, desc, qty, price, discount, total float64
+}
+
+// orDefault returns v, or def when v is unset.
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// margin returns the page margin; c may be nil.
+func (c *LayoutConfig) margin() float64 {
+	if c == nil {
+		return 50
+	}
+	return orDefault(c.Margin, 50)
+}
+
+// rowHeight returns the line table row height; c may be nil.
+func (c *LayoutConfig) rowHeight() float64 {
+	if c == nil {
+		return 22
+	}
+	return orDefault(c.RowHeight, 22)
+}
+
+// columns returns the line table columns for the optional Date and Remise
+// columns; c may be nil.
+func (c *LayoutConfig) columns(hasDate, hasDiscount bool) tableColumns {
+	var cfg LayoutConfig
+	if c != nil {
+		cfg = *c
+	}
+	margin := c.margin()
+	qty, price := 295.0, 355.0
+	if hasDiscount {
+		qty, price = 245.0, 305.0
+	}
+	cols := tableColumns{
+		date:     margin,
+		desc:     margin,
+		qty:      margin + orDefault(cfg.Quantity, qty),
+		price:    margin + orDefault(cfg.UnitPrice, price),
+		discount: margin + orDefault(cfg.Discount, 390),
+		total:    margin + orDefault(cfg.Total, 440),
+	}
+	if hasDate {
+		cols.desc += orDefault(cfg.DateWidth, 65)
+	}
+	return cols
+}
+
+// validateLayout checks that the layout leaves room for every column.
+func validateLayout(req *InvoiceRequest) error {
+	c := req.Layout
+	if c == nil {
+		return nil
+	}
+	for _, v := range []float64{c.Margin, c.DateWidth, c.Quantity, c.UnitPrice, c.Discount, c.Total, c.RowHeight} {
+		if v < 0 {
+			return ValidationError{Field: "Layout", Message: "layout values cannot be negative"}
+		}
+	}
+	if c.margin() < 10 || c.margin() > 150 {
+		return ValidationError{Field: "Layout.Margin", Message: "margin must be between 10 and 150 points"}
+	}
+	if c.rowHeight() < 14 || c.rowHeight() > 60 {
+		return ValidationError{Field: "Layout.RowHeight", Message: "row height must be between 14 and 60 points"}
+	}
+
+	// Each column needs some room, and the total amount up to the margin
+	hasDiscount := false
+	for _, line := range req.Lines {
+		if line.DiscountPercent > 0 {
+			hasDiscount = true
+		}
+	}
+	cols := c.columns(true, hasDiscount)
+	xs := []float64{cols.desc, cols.qty, cols.price}
+	if hasDiscount {
+		xs = append(xs, cols.discount)
+	}
+	xs = append(xs, cols.total)
+	for i := 1; i < len(xs); i++ {
+		if xs[i]-xs[i-1] < 20 || cols.total > a4Width-c.margin()-50 {
+			return ValidationError{Field: "Layout", Message: "table columns must be in order and fit the page"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package facturx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Limits holds sanity thresholds protecting against fat-finger invoices
+// (e.g. 1 000 000 € typed instead of 1 000 €). A zero threshold disables
+// the corresponding check.
+type Limits struct {
+	// MaxLineAmount is the maximum net amount of a single line (EUR), in
+	// absolute value.
+	MaxLineAmount float64 `json:"maxLineAmount,omitempty"`
+	// MaxGrandTotal is the maximum invoice total including tax (EUR).
+	MaxGrandTotal float64 `json:"maxGrandTotal,omitempty"`
+	// MaxQuantity is the maximum quantity of a single line, in absolute value.
+	MaxQuantity float64 `json:"maxQuantity,omitempty"`
+	// MaxUnitPrice is the maximum unit price of a line (EUR), in absolute
+	// value.
+	MaxUnitPrice float64 `json:"maxUnitPrice,omitempty"`
+	// MaxAgeYears is the maximum age of the issue date, in years, catching
+	// mistyped years.
+	MaxAgeYears int `json:"maxAgeYears,omitempty"`
+	// Strict reports exceeded limits as validation errors instead of warnings.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// DefaultLimits returns conservative thresholds suited to small businesses.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxLineAmount: 100000,
+		MaxGrandTotal: 500000,
+		MaxQuantity:   10000,
+	}
+}
+
+// Warning is a non-blocking validation finding.
+type Warning struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Field, w.Message)
+}
+
+// ValidationResult holds the outcome of validating an invoice request.
+type ValidationResult struct {
+	// Errors prevent the invoice from being generated.
+	Errors []ValidationError `json:"errors"`
+	// Warnings are suspicious values the caller may want to confirm.
+	Warnings []Warning `json:"warnings"`
+	// Profile is the profile the document declares, set by ValidateXML
+	// when it is known.
+	Profile Profile `json:"profile,omitempty"`
+}
+
+// Valid reports whether the request has no blocking errors.
+func (r ValidationResult) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Err returns the first validation error, or nil if the request is valid.
+func (r ValidationResult) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return r.Errors[0]
+}
+
+// Validate checks the invoice request and returns errors and warnings.
+//
+// Unlike Generate, it does not stop at sanity limits: exceeded limits are
+// reported as warnings unless Limits.Strict is set. Implausible dates and
+// amounts (see checkPlausibility) are always warnings.
+func Validate(req *InvoiceRequest) ValidationResult {
+	var result ValidationResult
+
+	r := normalizeDates(*req)
+	req = &r
+
+	if err := validate(req); err != nil {
+		var ve ValidationError
+		if errors.As(err, &ve) {
+			result.Errors = append(result.Errors, ve)
+		} else {
+			result.Errors = append(result.Errors, ValidationError{Message: err.Error()})
+		}
+		return result
+	}
+
+	if req.Limits != nil {
+		for _, finding := range checkLimits(req, req.Limits) {
+			if req.Limits.Strict {
+				result.Errors = append(result.Errors, ValidationError{Field: finding.Field, Message: finding.Message})
+			} else {
+				result.Warnings = append(result.Warnings, finding)
+			}
+		}
+	}
+	result.Warnings = append(result.Warnings, checkPlausibility(req)...)
+
+	return result
+}
+
+// checkPlausibility returns the values of a valid request that are allowed
+// but usually mistakes: an issue date in the future, a due date before the
+// issue date and a zero total.
+func checkPlausibility(req *InvoiceRequest) []Warning {
+	var findings []Warning
+
+	if req.Date > formatCIIDate(now()) {
+		findings = append(findings, Warning{Field: "Date", Message: "issue date is in the future"})
+	}
+	if !req.DueDate.IsZero() && formatCIIDate(req.DueDate) < req.Date {
+		findings = append(findings, Warning{Field: "DueDate", Message: "due date is before the issue date"})
+	}
+	for i, inst := range req.Installments {
+		if formatCIIDate(inst.DueDate) < req.Date {
+			findings = append(findings, Warning{Field: fmt.Sprintf("Installments[%d].DueDate", i), Message: "due date is before the issue date"})
+		}
+	}
+	if calculateInvoice(req).grandTotal == 0 {
+		findings = append(findings, Warning{Field: "Lines", Message: "invoice total is zero"})
+	}
+
+	return findings
+}
+
+// checkLimits returns a finding for every threshold exceeded by the request.
+func checkLimits(req *InvoiceRequest, limits *Limits) []Warning {
+	var findings []Warning
+
+	calc := calculateInvoice(req)
+	for i, line := range req.Lines {
+		lineAmount := calc.lineAmounts[i].Float()
+
+		// Refund lines are checked on their magnitude
+		if limits.MaxQuantity > 0 && math.Abs(line.Quantity) > limits.MaxQuantity {
+			findings = append(findings, Warning{
+				Field:   fmt.Sprintf("Lines[%d].Quantity", i),
+				Message: fmt.Sprintf("quantity %.2f exceeds limit %.2f", line.Quantity, limits.MaxQuantity),
+			})
+		}
+		if limits.MaxUnitPrice > 0 && math.Abs(line.UnitPrice) > limits.MaxUnitPrice {
+			findings = append(findings, Warning{
+				Field:   fmt.Sprintf("Lines[%d].UnitPrice", i),
+				Message: fmt.Sprintf("unit price %.2f exceeds limit %.2f", line.UnitPrice, limits.MaxUnitPrice),
+			})
+		}
+		if limits.MaxLineAmount > 0 && math.Abs(lineAmount) > limits.MaxLineAmount {
+			findings = append(findings, Warning{
+				Field:   fmt.Sprintf("Lines[%d]", i),
+				Message: fmt.Sprintf("line amount %.2f exceeds limit %.2f", lineAmount, limits.MaxLineAmount),
+			})
+		}
+	}
+
+	if limits.MaxAgeYears > 0 && req.Date < formatCIIDate(now().AddDate(-limits.MaxAgeYears, 0, 0)) {
+		findings = append(findings, Warning{
+			Field:   "Date",
+			Message: fmt.Sprintf("issue date is more than %d years old", limits.MaxAgeYears),
+		})
+	}
+
+	if limits.MaxGrandTotal > 0 {
+		grandTotal := calc.grandTotal.Float()
+		if grandTotal > limits.MaxGrandTotal {
+			findings = append(findings, Warning{
+				Field:   "Lines",
+				Message: fmt.Sprintf("grand total %.2f exceeds limit %.2f", grandTotal, limits.MaxGrandTotal),
+			})
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,66 @@
+package facturx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Locale selects how numbers and amounts are written on the PDF; the zero
+// value is LocaleFrench. The XML always uses dot decimals, as EN 16931
+// requires.
+type Locale string
+
+const (
+	// LocaleFrench writes amounts as "1 234,56 €", with narrow no-break
+	// spaces between thousands and before the euro sign.
+	LocaleFrench Locale = "fr"
+	// LocaleEnglish writes amounts as "€1,234.56".
+	LocaleEnglish Locale = "en"
+)
+
+// narrowNBSP is the French thousands separator (U+202F). The PDF font
+// encoding has no such glyph and prints a no-break space instead.
+const narrowNBSP = "\u202F"
+
+// decimal formats a with 2 decimals and grouped thousands.
+func (l Locale) decimal(a amount) string {
+	group, point := narrowNBSP, ","
+	if l == LocaleEnglish {
+		group, point = ",", "."
+	}
+	s, negative := strings.CutPrefix(a.String(), "-")
+	units, cents, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i := range len(units) {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteByte(units[i])
+	}
+	b.WriteString(point)
+	b.WriteString(cents)
+	return b.String()
+}
+
+// money formats a as a euro amount.
+func (l Locale) money(a amount) string {
+	if l != LocaleEnglish {
+		return l.decimal(a) + narrowNBSP + "€"
+	}
+	if a < 0 {
+		return "-€" + l.decimal(-a)
+	}
+	return "€" + l.decimal(a)
+}
+
+// percent formats a percentage with as many decimals as needed.
+func (l Locale) percent(v float64) string {
+	if l == LocaleEnglish {
+		return strconv.FormatFloat(v, 'f', -1, 64) + "%"
+	}
+	return formatFrenchDecimal(v) + narrowNBSP + "%"
+}
@@ -0,0 +1,279 @@
+// Package mail sends Factur-X invoices by email, the PDF attached.
+//
+// Example:
+//
+//	s := &mail.Sender{
+//		SMTP: mail.SMTPConfig{Host: "smtp.example.com", Port: 587, Username: "user", Password: "secret"},
+//		From: "factures@example.com",
+//		Lang: "fr",
+//	}
+//	err := s.SendInvoice([]string{"client@example.com"}, req, pdf)
+//
+// Subject and body are Go text/template strings executed with an
+// InvoiceData; the defaults exist in French and English.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// SMTPConfig locates and authenticates against the SMTP server.
+type SMTPConfig struct {
+	Host string
+	// Port defaults to 587. Port 465 uses implicit TLS; other ports upgrade
+	// with STARTTLS when the server offers it.
+	Port int
+	// Username and Password enable PLAIN authentication when Username is set.
+	Username string
+	Password string
+}
+
+// InvoiceData is the data available to subject and body templates.
+type InvoiceData struct {
+	Number     string
+	Date       string // formatted for the language
+	SellerName string
+	BuyerName  string
+	GrandTotal string // formatted amount with currency, e.g. "1200.00 EUR"
+}
+
+// Default templates, by language.
+var (
+	DefaultSubjects = map[string]string{
+		"fr": "Facture {{.Number}} - {{.SellerName}}",
+		"en": "Invoice {{.Number}} from {{.SellerName}}",
+	}
+	DefaultBodies = map[string]string{
+		"fr": `Bonjour,
+
+Veuillez trouver ci-joint la facture {{.Number}} du {{.Date}}, d'un montant de {{.GrandTotal}}.
+
+Cordialement,
+{{.SellerName}}
+`,
+		"en": `Hello,
+
+Please find attached invoice {{.Number}} dated {{.Date}}, for a total of {{.GrandTotal}}.
+
+Best regards,
+{{.SellerName}}
+`,
+	}
+)
+
+// Sender sends invoices through an SMTP server.
+type Sender struct {
+	SMTP SMTPConfig
+	// From is the sender address, optionally with a display name
+	// ("Société <factures@example.com>").
+	From string
+	// Lang selects the default templates and date format: "fr" (default)
+	// or "en".
+	Lang string
+	// Subject and Body override the default templates when set.
+	Subject string
+	Body    string
+}
+
+// SendInvoice emails pdf, the generated invoice for req, to the given
+// recipients.
+func (s *Sender) SendInvoice(to []string, req facturx.InvoiceRequest, pdf []byte) error {
+	if len(to) == 0 {
+		return errors.New("mail: no recipient")
+	}
+	from, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("mail: invalid sender %q: %w", s.From, err)
+	}
+	msg, err := s.message(from, to, req, pdf)
+	if err != nil {
+		return err
+	}
+	return s.send(from.Address, to, msg)
+}
+
+// message builds the MIME message: a text part and the PDF attachment.
+func (s *Sender) message(from *netmail.Address, to []string, req facturx.InvoiceRequest, pdf []byte) ([]byte, error) {
+	lang := s.Lang
+	if _, ok := DefaultBodies[lang]; !ok {
+		lang = "fr"
+	}
+	subjectTmpl, bodyTmpl := s.Subject, s.Body
+	if subjectTmpl == "" {
+		subjectTmpl = DefaultSubjects[lang]
+	}
+	if bodyTmpl == "" {
+		bodyTmpl = DefaultBodies[lang]
+	}
+	data := invoiceData(req, lang)
+	subject, err := render("subject", subjectTmpl, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := render("body", bodyTmpl, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", randomID(), domain(from.Address))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(text)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+
+	name := "facture-" + req.Number + ".pdf"
+	attachment, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("application/pdf", map[string]string{"name": name})},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(pdf)
+	for len(encoded) > 76 {
+		attachment.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	attachment.Write([]byte(encoded + "\r\n"))
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// send delivers msg over SMTP.
+func (s *Sender) send(from string, to []string, msg []byte) error {
+	port := s.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(s.SMTP.Host, strconv.Itoa(port))
+	var auth smtp.Auth
+	if s.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", s.SMTP.Username, s.SMTP.Password, s.SMTP.Host)
+	}
+	if port != 465 {
+		if err := smtp.SendMail(addr, auth, from, to, msg); err != nil {
+			return fmt.Errorf("mail: %w", err)
+		}
+		return nil
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: s.SMTP.Host})
+	if err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	c, err := smtp.NewClient(conn, s.SMTP.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mail: %w", err)
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("mail: %w", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("mail: %w", err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return c.Quit()
+}
+
+func invoiceData(req facturx.InvoiceRequest, lang string) InvoiceData {
+	date := req.IssueDate
+	if date.IsZero() {
+		date, _ = time.Parse("20060102", req.Date)
+	}
+	layout := "02/01/2006"
+	if lang == "en" {
+		layout = "2006-01-02"
+	}
+	total := fmt.Sprintf("%.2f EUR", facturx.ComputeTotals(&req).GrandTotal)
+	if lang == "fr" {
+		total = strings.Replace(total, ".", ",", 1)
+	}
+	return InvoiceData{
+		Number:     req.Number,
+		Date:       date.Format(layout),
+		SellerName: req.Seller.Name,
+		BuyerName:  req.Buyer.Name,
+		GrandTotal: total,
+	}
+}
+
+func render(name, text string, data InvoiceData) (string, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("mail: %s template: %w", name, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("mail: %s template: %w", name, err)
+	}
+	return b.String(), nil
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domain(addr string) string {
+	if _, d, ok := strings.Cut(addr, "@"); ok {
+		return d
+	}
+	return "localhost"
+}
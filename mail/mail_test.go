@@ -0,0 +1,193 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// delivery is a message received by fakeSMTP.
+type delivery struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// fakeSMTP starts an SMTP server on the loopback interface accepting one
+// message, without TLS nor authentication. The message is sent on the
+// returned channel.
+func fakeSMTP(t *testing.T) (SMTPConfig, <-chan delivery) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan delivery, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var d delivery
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 localhost")
+			case "MAIL":
+				d.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+				tp.PrintfLine("250 OK")
+			case "RCPT":
+				d.to = append(d.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 Go ahead")
+				if d.data, err = tp.ReadDotBytes(); err != nil {
+					return
+				}
+				tp.PrintfLine("250 OK")
+				received <- d
+			case "QUIT":
+				tp.PrintfLine("221 Bye")
+				return
+			default:
+				tp.PrintfLine("502 Unsupported")
+			}
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return SMTPConfig{Host: host, Port: p}, received
+}
+
+func sampleInvoice() facturx.InvoiceRequest {
+	return facturx.InvoiceRequest{
+		Number:  "FA-2024-001",
+		Date:    "20240115",
+		DueDate: time.Date(2024, 2, 14, 0, 0, 0, 0, time.UTC),
+		Seller:  facturx.Contact{Name: "ACME Corp", Address: "123 Rue de Paris", ZipCode: "75001", City: "Paris", Siret: "52825000400033"},
+		Buyer:   facturx.Contact{Name: "Client SA", Address: "456 Avenue des Champs", ZipCode: "69001", City: "Lyon"},
+		Lines:   []facturx.InvoiceLine{{Description: "Conseil", Quantity: 2, UnitPrice: 500}},
+		Regime:  facturx.VatStandard(20),
+	}
+}
+
+func TestSendInvoice(t *testing.T) {
+	cfg, received := fakeSMTP(t)
+	s := &Sender{SMTP: cfg, From: "ACME <factures@acme.example>"}
+	req := sampleInvoice()
+	pdf := []byte("%PDF-1.7\n\x00\x01\xff binary content\n%%EOF")
+
+	if err := s.SendInvoice([]string{"client@example.com"}, req, pdf); err != nil {
+		t.Fatalf("SendInvoice: %v", err)
+	}
+	var d delivery
+	select {
+	case d = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	if d.from != "factures@acme.example" || !slices.Equal(d.to, []string{"client@example.com"}) {
+		t.Errorf("envelope = %s -> %v", d.from, d.to)
+	}
+
+	msg, err := netmail.ReadMessage(bytes.NewReader(d.data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Facture FA-2024-001 - ACME Corp" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if to := msg.Header.Get("To"); to != "client@example.com" {
+		t.Errorf("To = %q", to)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, %v", msg.Header.Get("Content-Type"), err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(text) // quoted-printable is decoded by the reader
+	if !strings.Contains(string(body), "la facture FA-2024-001 du 15/01/2024, d'un montant de 1200,00 EUR") {
+		t.Errorf("body = %q", body)
+	}
+
+	attachment, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := attachment.FileName(); name != "facture-FA-2024-001.pdf" {
+		t.Errorf("attachment name = %q", name)
+	}
+	if ct := attachment.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/pdf") {
+		t.Errorf("attachment Content-Type = %q", ct)
+	}
+	got, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pdf) {
+		t.Errorf("attachment = %q, want %q", got, pdf)
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("unexpected extra part: %v", err)
+	}
+}
+
+func TestSubjectHeaderInjection(t *testing.T) {
+	cfg, received := fakeSMTP(t)
+	s := &Sender{SMTP: cfg, From: "factures@acme.example", Lang: "en"}
+	req := sampleInvoice()
+	req.Seller.Name = "ACME\r\nBcc: victim@example.com"
+
+	if err := s.SendInvoice([]string{"client@example.com"}, req, []byte("%PDF")); err != nil {
+		t.Fatalf("SendInvoice: %v", err)
+	}
+	d := <-received
+	msg, err := netmail.ReadMessage(bytes.NewReader(d.data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("injected Bcc header: %q", bcc)
+	}
+	raw := msg.Header.Get("Subject")
+	if !strings.HasPrefix(raw, "=?utf-8?q?") || strings.ContainsAny(raw, "\r\n") {
+		t.Errorf("Subject is not Q-encoded: %q", raw)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Invoice FA-2024-001 from ACME\r\nBcc: victim@example.com" {
+		t.Errorf("decoded Subject = %q", subject)
+	}
+}
@@ -0,0 +1,203 @@
+package facturx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UNTDID 4451 text subject codes used for invoice notes (BT-21).
+const (
+	noteSubjectGeneral   = "AAI" // General information
+	noteSubjectTax       = "TXD" // Tax declaration
+	noteSubjectPenalties = "PMD" // Late payment penalties
+	noteSubjectRecovery  = "PMT" // Fixed recovery indemnity
+	noteSubjectDiscount  = "AAB" // Cash discount
+	noteSubjectLegal     = "ABL" // Legal information
+)
+
+// Payment conditions mentions (art. L441-9, L441-10 and D441-5 du Code de
+// commerce)
+const (
+	legalPenaltyText     = "Pénalités de retard : trois fois le taux d'intérêt légal"
+	penaltyPrefix        = "Pénalités de retard : "
+	penaltySuffix        = " % par an"
+	recoveryText         = "Indemnité forfaitaire pour frais de recouvrement en cas de retard de paiement : 40 €"
+	noDiscountText       = "Escompte : néant"
+	discountPrefix       = "Escompte de "
+	discountSuffix       = " % pour paiement anticipé"
+	discountWithinPrefix = " % pour paiement sous "
+)
+
+// legalNote is a mandatory mention generated from structured request fields.
+// It is printed in the legal mentions area of the PDF and emitted as an
+// invoice note (BG-1) in the XML.
+type legalNote struct {
+	subjectCode string
+	text        string
+}
+
+// legalNotes returns the mentions derived from the request, in display order.
+func legalNotes(req *InvoiceRequest) []legalNote {
+	var notes []legalNote
+
+	// Company mentions of the seller: legal form, share capital, RCS, NAF
+	if mention := req.Seller.legalMention(); mention != "" {
+		notes = append(notes, legalNote{subjectCode: noteSubjectLegal, text: mention})
+	}
+
+	if req.Type == TypeDownPayment {
+		text := "Facture d'acompte, à déduire de la facture finale"
+		if req.OrderRef != "" {
+			text = fmt.Sprintf("Facture d'acompte sur la commande N° %s, à déduire de la facture finale", req.OrderRef)
+		}
+		notes = append(notes, legalNote{subjectCode: noteSubjectGeneral, text: text})
+	}
+
+	// Mandatory mention for self-billing (art. 242 nonies A, I-13° de l'annexe II du CGI)
+	if req.Type == TypeSelfBilled {
+		notes = append(notes, legalNote{subjectCode: noteSubjectGeneral, text: "Autofacturation"})
+	}
+
+	if req.Type == TypeCorrective && req.PrecedingInvoice != nil {
+		text := fmt.Sprintf("Facture rectificative de la facture N° %s", req.PrecedingInvoice.Number)
+		if !req.PrecedingInvoice.Date.IsZero() {
+			text += fmt.Sprintf(" du %s", formatDisplayDate(req.PrecedingInvoice.Date))
+		}
+		if req.CorrectionReason != "" {
+			text += fmt.Sprintf(". Motif : %s", req.CorrectionReason)
+		}
+		notes = append(notes, legalNote{subjectCode: noteSubjectGeneral, text: text})
+	}
+
+	if req.Regime.kind == vatReverseCharge {
+		notes = append(notes, legalNote{subjectCode: noteSubjectTax, text: reverseChargeMentions["fr"]})
+		if lang := countryLanguage(req.Buyer.CountryCode); lang != "fr" {
+			notes = append(notes, legalNote{subjectCode: noteSubjectTax, text: reverseChargeMentions[lang]})
+		}
+	}
+
+	if lp := req.LatePayment; lp != nil {
+		notes = append(notes, lp.notes()...)
+	}
+
+	// Discount conditions are mandatory between French businesses, "néant"
+	// if none
+	if req.CashDiscount != nil {
+		notes = append(notes, legalNote{subjectCode: noteSubjectDiscount, text: req.CashDiscount.text()})
+	} else if id, _ := req.Buyer.legalID(); req.Seller.isFrench() && (id != "" || req.Buyer.VatNumber != "") {
+		notes = append(notes, legalNote{subjectCode: noteSubjectDiscount, text: noDiscountText})
+	}
+
+	switch req.VatDueDateType {
+	case VatDueOnInvoice:
+		notes = append(notes, legalNote{subjectCode: noteSubjectTax, text: "Option pour le paiement de la taxe d'après les débits"})
+	case VatDueOnPayment:
+		notes = append(notes, legalNote{subjectCode: noteSubjectTax, text: "TVA acquittée sur les encaissements"})
+	}
+
+	return notes
+}
+
+// notes returns the late payment mentions: penalties and recovery
+// indemnity.
+func (lp *LatePaymentTerms) notes() []legalNote {
+	penalty := legalPenaltyText
+	if lp.PenaltyRate > 0 {
+		penalty = penaltyPrefix + formatFrenchDecimal(lp.PenaltyRate) + penaltySuffix
+	}
+	return []legalNote{
+		{subjectCode: noteSubjectPenalties, text: penalty},
+		{subjectCode: noteSubjectRecovery, text: recoveryText},
+	}
+}
+
+// text returns the cash discount mention, also used as payment terms.
+func (d *CashDiscount) text() string {
+	if d.Days > 0 {
+		return fmt.Sprintf("%s%s%s%d jours", discountPrefix, formatFrenchDecimal(d.Percent), discountWithinPrefix, d.Days)
+	}
+	return discountPrefix + formatFrenchDecimal(d.Percent) + discountSuffix
+}
+
+// parseLatePayment recovers the late payment terms from the notes generated
+// by LatePaymentTerms.notes, or returns nil.
+func parseLatePayment(notes []IncludedNote) *LatePaymentTerms {
+	for _, n := range notes {
+		if n.SubjectCode != noteSubjectRecovery || strings.TrimSpace(n.Content) != recoveryText {
+			continue
+		}
+		lp := &LatePaymentTerms{}
+		for _, n := range notes {
+			rate, ok := strings.CutPrefix(strings.TrimSpace(n.Content), penaltyPrefix)
+			if rate, found := strings.CutSuffix(rate, penaltySuffix); ok && found && n.SubjectCode == noteSubjectPenalties {
+				lp.PenaltyRate = parseFrenchDecimal(rate)
+			}
+		}
+		return lp
+	}
+	return nil
+}
+
+// parseCashDiscount recovers the cash discount from the note generated by
+// CashDiscount.text, or returns nil.
+func parseCashDiscount(notes []IncludedNote) *CashDiscount {
+	for _, n := range notes {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(n.Content), discountPrefix)
+		if n.SubjectCode != noteSubjectDiscount || !ok {
+			continue
+		}
+		if percent, ok := strings.CutSuffix(rest, discountSuffix); ok {
+			return &CashDiscount{Percent: parseFrenchDecimal(percent)}
+		}
+		if percent, days, ok := strings.Cut(rest, discountWithinPrefix); ok {
+			n, _ := strconv.Atoi(strings.TrimSuffix(days, " jours"))
+			return &CashDiscount{Percent: parseFrenchDecimal(percent), Days: n}
+		}
+	}
+	return nil
+}
+
+// formatFrenchDecimal formats a rate with a decimal comma ("10,5").
+func formatFrenchDecimal(v float64) string {
+	return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", ",", 1)
+}
+
+// parseFrenchDecimal parses a rate formatted by formatFrenchDecimal, or
+// returns 0.
+func parseFrenchDecimal(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	return v
+}
+
+// reverseChargeMentions holds the reverse charge mention per language.
+var reverseChargeMentions = map[string]string{
+	"fr": "Autoliquidation : TVA due par le preneur (art. 283-2 du CGI, art. 196 de la directive 2006/112/CE)",
+	"en": "Reverse charge: VAT to be accounted for by the recipient (Article 196 of Directive 2006/112/EC)",
+	"de": "Steuerschuldnerschaft des Leistungsempfängers (Art. 196 der Richtlinie 2006/112/EG)",
+	"es": "Inversión del sujeto pasivo (art. 196 de la Directiva 2006/112/CE)",
+	"it": "Inversione contabile (art. 196 della direttiva 2006/112/CE)",
+	"nl": "Btw verlegd (art. 196 van Richtlijn 2006/112/EG)",
+	"pt": "Autoliquidação (art. 196.º da Diretiva 2006/112/CE)",
+}
+
+// countryLanguage returns the language used for mentions addressed to a buyer
+// in the given country. Unknown countries default to English.
+func countryLanguage(countryCode string) string {
+	switch strings.ToUpper(strings.TrimSpace(countryCode)) {
+	case "FR", "BE", "LU", "MC":
+		return "fr"
+	case "DE", "AT":
+		return "de"
+	case "ES":
+		return "es"
+	case "IT":
+		return "it"
+	case "NL":
+		return "nl"
+	case "PT":
+		return "pt"
+	default:
+		return "en"
+	}
+}
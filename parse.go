@@ -0,0 +1,589 @@
+package facturx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseXML reads a CII invoice (the XML embedded in Factur-X PDFs) back
+// into an InvoiceRequest. Only what InvoiceRequest can represent is read:
+// invoices with several VAT breakdowns are rejected, and notes that are
+// not regenerated from structured fields end up in CustomMentions.
+//
+// The result is not validated; use Validate or ValidateXML for that.
+func ParseXML(data []byte) (*InvoiceRequest, error) {
+	req, _, err := parseCII(data)
+	return req, err
+}
+
+// ValidateXML parses a CII invoice, validates it like a generation request
+// and checks that the declared totals match the amounts recomputed from
+// its lines. It returns an error only if the document cannot be parsed.
+//
+// The rules follow the profile the document declares (see DetectProfile):
+// MINIMUM and BASIC WL invoices have no lines, so only their header and
+// the consistency of their declared totals are checked.
+func ValidateXML(data []byte) (ValidationResult, error) {
+	doc, err := ParseCII(data)
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	var result ValidationResult
+	profile, err := doc.profile()
+	if err == nil {
+		result.Profile = profile.Profile
+	} else {
+		// Checked against the rules of the profile this package writes
+		profile.Profile = ProfileBasic
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   "GuidelineSpecifiedDocumentContextParameter",
+			Message: "unknown Factur-X profile",
+		})
+	}
+	if !profile.Profile.hasLines() {
+		validateSummary(doc, &result)
+		return result, nil
+	}
+
+	req, err := requestFromCII(doc)
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	requestResult := Validate(req)
+	result.Errors = append(result.Errors, requestResult.Errors...)
+	result.Warnings = requestResult.Warnings
+	if !requestResult.Valid() {
+		return result, nil
+	}
+
+	calc := calculateInvoice(req)
+	sum := doc.Transaction.Settlement.Summation
+	type totalCheck struct {
+		field    string
+		rule     string
+		declared string
+		computed amount
+	}
+	checks := []totalCheck{
+		{"LineTotalAmount", "BR-CO-10", sum.LineTotal, calc.lineTotal},
+		{"TaxBasisTotalAmount", "BR-CO-13", sum.TaxBasisTotal, calc.taxBase},
+		{"TaxTotalAmount", "BR-CO-14", sum.TaxTotal.Value, calc.taxTotal},
+		{"GrandTotalAmount", "BR-CO-15", sum.GrandTotal, calc.grandTotal},
+		{"DuePayableAmount", "BR-CO-16", sum.DuePayable, calc.dueAmount},
+	}
+	if len(req.Charges) > 0 {
+		checks = append(checks, totalCheck{"ChargeTotalAmount", "BR-CO-12", sum.ChargeTotal, calc.chargeTotal})
+	}
+	for i, line := range doc.Transaction.Lines {
+		checks = append(checks, totalCheck{fmt.Sprintf("Lines[%d].LineTotalAmount", i), "", line.LineTotal, calc.lineAmounts[i]})
+	}
+	for _, c := range checks {
+		declared, err := parseCIIAmount(c.declared)
+		if err != nil {
+			result.Errors = append(result.Errors, ValidationError{Field: c.field, Message: "missing or invalid amount"})
+			continue
+		}
+		if declared != c.computed {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   c.field,
+				Message: fmt.Sprintf("declared %s, computed %s", declared, c.computed),
+				Rule:    c.rule,
+			})
+		}
+	}
+	return result, nil
+}
+
+// ValidatePDF validates the XML embedded in a Factur-X PDF like
+// ValidateXML. The PDF/A requirements the PDF fails (see CheckPDFA), and
+// an XMP conformance level naming another profile than the XML, are
+// reported as warnings. It returns an error wrapping ErrPDF if the PDF has
+// no readable Factur-X XML, or ErrXML if that XML cannot be parsed.
+func ValidatePDF(pdf []byte) (ValidationResult, error) {
+	issues, err := CheckPDFA(pdf)
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	data, err := ExtractXML(pdf)
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	result, err := ValidateXML(data)
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	// PDF/A findings don't make the invoice itself invalid
+	for _, issue := range issues {
+		result.Warnings = append(result.Warnings, Warning{Field: "PDF/A", Message: issue.Message})
+	}
+	if profile, err := DetectPDFProfile(pdf); err == nil && profile.XMPProfile != "" && profile.XMPProfile != profile.Profile {
+		result.Warnings = append(result.Warnings, Warning{
+			Field:   "ConformanceLevel",
+			Message: fmt.Sprintf("XMP metadata declare the %s profile, the XML %s", profile.XMPProfile, profile.Profile),
+		})
+	}
+	return result, nil
+}
+
+// validateSummary checks an invoice of a profile without lines: its
+// header, and the BR-CO rules relating its declared totals and VAT
+// breakdown.
+func validateSummary(doc *CrossIndustryInvoice, result *ValidationResult) {
+	addError := func(field, message string) {
+		result.Errors = append(result.Errors, ValidationError{Field: field, Message: message})
+	}
+	if strings.TrimSpace(doc.Document.ID) == "" {
+		addError("Number", "invoice number cannot be empty")
+	}
+	if _, err := parseCIIDate(strings.TrimSpace(string(doc.Document.IssueDate))); err != nil {
+		addError("Date", "invalid date values")
+	}
+	if strings.TrimSpace(doc.Transaction.Agreement.Seller.Name) == "" {
+		addError("Seller.Name", "seller name cannot be empty")
+	}
+	if strings.TrimSpace(doc.Transaction.Agreement.Buyer.Name) == "" {
+		addError("Buyer.Name", "buyer name cannot be empty")
+	}
+
+	valid := true
+	parse := func(field, s string, required bool) amount {
+		if !required && strings.TrimSpace(s) == "" {
+			return 0
+		}
+		a, err := parseCIIAmount(s)
+		if err != nil {
+			addError(field, "missing or invalid amount")
+			valid = false
+		}
+		return a
+	}
+
+	settlement := doc.Transaction.Settlement
+	sum := settlement.Summation
+	taxBasis := parse("TaxBasisTotalAmount", sum.TaxBasisTotal, true)
+	taxTotal := parse("TaxTotalAmount", sum.TaxTotal.Value, false)
+	grandTotal := parse("GrandTotalAmount", sum.GrandTotal, true)
+	prepaid := parse("TotalPrepaidAmount", sum.TotalPrepaid, false)
+	duePayable := parse("DuePayableAmount", sum.DuePayable, true)
+	type totalCheck struct {
+		field              string
+		rule               string
+		declared, computed amount
+	}
+	checks := []totalCheck{
+		{"GrandTotalAmount", "BR-CO-15", grandTotal, taxBasis + taxTotal},
+		{"DuePayableAmount", "BR-CO-16", duePayable, grandTotal - prepaid},
+	}
+
+	// BASIC WL declares the line total, allowances, charges and VAT
+	// breakdown
+	if result.Profile == ProfileBasicWL {
+		lineTotal := parse("LineTotalAmount", sum.LineTotal, true)
+		chargeTotal := parse("ChargeTotalAmount", sum.ChargeTotal, false)
+		allowanceTotal := parse("AllowanceTotalAmount", sum.AllowanceTotal, false)
+		var charges, allowances, vatAmount amount
+		for i, c := range settlement.AllowanceCharges {
+			a := parse(fmt.Sprintf("Charges[%d].ActualAmount", i), c.ActualAmount, true)
+			if c.ChargeIndicator {
+				charges += a
+			} else {
+				allowances += a
+			}
+		}
+		for i, tax := range settlement.Taxes {
+			vatAmount += parse(fmt.Sprintf("ApplicableTradeTax[%d].CalculatedAmount", i), tax.CalculatedAmount, true)
+		}
+		checks = append(checks,
+			totalCheck{"ChargeTotalAmount", "BR-CO-12", chargeTotal, charges},
+			totalCheck{"AllowanceTotalAmount", "BR-CO-11", allowanceTotal, allowances},
+			totalCheck{"TaxBasisTotalAmount", "BR-CO-13", taxBasis, lineTotal + chargeTotal - allowanceTotal},
+			totalCheck{"TaxTotalAmount", "BR-CO-14", taxTotal, vatAmount},
+		)
+	}
+	if !valid {
+		return
+	}
+	for _, c := range checks {
+		if c.declared != c.computed {
+			result.Errors = append(result.Errors, ValidationError{
+				Field:   c.field,
+				Message: fmt.Sprintf("declared %s, computed %s", c.declared, c.computed),
+				Rule:    c.rule,
+			})
+		}
+	}
+}
+
+// parseCII decodes a CII document and maps it onto an InvoiceRequest.
+func parseCII(data []byte) (*InvoiceRequest, *CrossIndustryInvoice, error) {
+	doc, err := ParseCII(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := requestFromCII(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return req, doc, nil
+}
+
+// requestFromCII maps a CII document onto an InvoiceRequest.
+func requestFromCII(doc *CrossIndustryInvoice) (*InvoiceRequest, error) {
+	settlement := &doc.Transaction.Settlement
+	if len(settlement.Taxes) == 0 {
+		return nil, fmt.Errorf("%w: no VAT breakdown", ErrXML)
+	}
+	if len(settlement.Taxes) > 1 {
+		return nil, fmt.Errorf("%w: several VAT breakdowns are not supported", ErrXML)
+	}
+	if c := settlement.Currency; c != "" && c != "EUR" {
+		return nil, fmt.Errorf("%w: currency %s is not supported", ErrXML, c)
+	}
+
+	tax := settlement.Taxes[0]
+	rate, err := parseCIIDecimal(tax.RateApplicablePercent, "RateApplicablePercent")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &InvoiceRequest{
+		Number:         strings.TrimSpace(doc.Document.ID),
+		Type:           InvoiceType(strings.TrimSpace(doc.Document.TypeCode)),
+		Date:           strings.TrimSpace(string(doc.Document.IssueDate)),
+		Seller:         partyContact(&doc.Transaction.Agreement.Seller),
+		Buyer:          partyContact(&doc.Transaction.Agreement.Buyer),
+		Regime:         parseVatRegime(tax, rate),
+		VatDueDateType: VatDueDateType(tax.DueDateTypeCode),
+	}
+	if order := doc.Transaction.Agreement.BuyerOrder; order != nil {
+		req.OrderRef = order.IssuerAssignedID
+	}
+	if advice := doc.Transaction.Delivery.DespatchAdvice; advice != nil {
+		req.DespatchAdviceRef = advice.IssuerAssignedID
+	}
+
+	if name, ok := strings.CutSuffix(req.Seller.Name, ", Entrepreneur Individuel"); ok {
+		req.Seller.Name, req.AddEISuffix = name, true
+	}
+
+	if req.TaxPointDate, err = parseOptionalCIIDate(tax.TaxPointDate, "TaxPointDate"); err != nil {
+		return nil, err
+	}
+	// SEPA direct debit (payment means 59)
+	for _, means := range settlement.PaymentMeans {
+		if PaymentMeansCode(strings.TrimSpace(means.TypeCode)) != PaymentMeansSEPADirectDebit {
+			continue
+		}
+		dd := &DirectDebit{CreditorID: strings.TrimSpace(settlement.CreditorReferenceID)}
+		if means.DebtorAccount != nil {
+			dd.DebtorIBAN = strings.TrimSpace(means.DebtorAccount.IBAN)
+		}
+		if len(settlement.PaymentTerms) > 0 {
+			dd.MandateID = strings.TrimSpace(settlement.PaymentTerms[0].DirectDebitMandateID)
+		}
+		req.DirectDebit = dd
+		break
+	}
+
+	// The payment means code, unless implied by the direct debit
+	if len(settlement.PaymentMeans) > 0 {
+		if code := PaymentMeansCode(strings.TrimSpace(settlement.PaymentMeans[0].TypeCode)); code != paymentMeansCode(req) {
+			req.PaymentMeans = code
+		}
+	}
+
+	// Payment terms with a partial amount are installments
+	for i, terms := range settlement.PaymentTerms {
+		if terms.PartialPaymentAmount == "" {
+			continue
+		}
+		var inst Installment
+		if inst.Amount, err = parseCIIDecimal(terms.PartialPaymentAmount, fmt.Sprintf("PaymentTerms[%d].PartialPaymentAmount", i)); err != nil {
+			return nil, err
+		}
+		if inst.DueDate, err = parseOptionalCIIDate(terms.DueDate, fmt.Sprintf("PaymentTerms[%d].DueDateDateTime", i)); err != nil {
+			return nil, err
+		}
+		req.Installments = append(req.Installments, inst)
+	}
+	if len(settlement.PaymentTerms) > 0 && req.Installments == nil {
+		if req.DueDate, err = parseOptionalCIIDate(settlement.PaymentTerms[0].DueDate, "DueDateDateTime"); err != nil {
+			return nil, err
+		}
+	}
+	if event := doc.Transaction.Delivery.ActualDelivery; event != nil {
+		if req.DeliveryDate, err = parseOptionalCIIDate(event.Date, "OccurrenceDateTime"); err != nil {
+			return nil, err
+		}
+	}
+	if settlement.Summation.TotalPrepaid != "" {
+		prepaid, err := parseCIIDecimal(settlement.Summation.TotalPrepaid, "TotalPrepaidAmount")
+		if err != nil {
+			return nil, err
+		}
+		req.PrepaidAmount = prepaid
+	}
+	if p := settlement.InvoiceReference; p != nil {
+		date, err := parseOptionalCIIDate(p.IssueDate, "InvoiceReferencedDocument")
+		if err != nil {
+			return nil, err
+		}
+		req.PrecedingInvoice = &InvoiceReference{Number: p.IssuerAssignedID, Date: date}
+	}
+
+	for i, c := range settlement.AllowanceCharges {
+		charge, err := parseCharge(&c, i)
+		if err != nil {
+			return nil, err
+		}
+		req.Charges = append(req.Charges, charge)
+	}
+
+	for i, l := range doc.Transaction.Lines {
+		line, err := parseLineItem(&l, i)
+		if err != nil {
+			return nil, err
+		}
+		req.Lines = append(req.Lines, line)
+	}
+
+	req.CustomMentions, req.CorrectionReason = splitNotes(req, doc.Document.Notes)
+	return req, nil
+}
+
+// partyContact maps a CII trade party onto a Contact.
+func partyContact(p *TradeParty) Contact {
+	c := Contact{
+		Name:        strings.TrimSpace(p.Name),
+		Address:     p.Address.LineOne,
+		ZipCode:     p.Address.Postcode,
+		City:        p.Address.City,
+		CountryCode: p.Address.CountryID,
+	}
+	if p.TradingName != nil {
+		c.TradingName = strings.TrimSpace(*p.TradingName)
+	}
+	var legalID string
+	if p.LegalOrganization != nil {
+		legalID = strings.TrimSpace(p.LegalOrganization.Value)
+	}
+	// SIRET (scheme 0009) and SIREN (scheme 0002) are told apart by their
+	// length, as invoices from other tools may use 0002 for both; other
+	// identifiers are RCS numbers
+	switch id := legalID; {
+	case len(id) == 14 && isDigits(id):
+		c.Siret = id
+	case len(id) == 9 && isDigits(id):
+		c.Siren = id
+	default:
+		c.RCS = id
+	}
+	for _, id := range p.IDs {
+		c.ProfessionalIds = append(c.ProfessionalIds, ProfessionalId{Value: strings.TrimSpace(id.Value)})
+	}
+	for _, id := range p.GlobalIDs {
+		c.GlobalIds = append(c.GlobalIds, GlobalId{Scheme: id.SchemeID, Value: strings.TrimSpace(id.Value)})
+	}
+	for _, reg := range p.TaxRegistrations {
+		if reg.ID.SchemeID == "VA" {
+			c.VatNumber = strings.TrimSpace(reg.ID.Value)
+		}
+	}
+	return c
+}
+
+// parseLineItem maps a CII line item onto an InvoiceLine.
+func parseLineItem(l *LineItem, i int) (InvoiceLine, error) {
+	field := func(name string) string { return fmt.Sprintf("Lines[%d].%s", i, name) }
+
+	line := InvoiceLine{Description: l.Name}
+	var err error
+	if line.Quantity, err = parseCIIDecimal(l.BilledQuantity.Value, field("BilledQuantity")); err != nil {
+		return line, err
+	}
+	if line.UnitPrice, err = parseCIIDecimal(l.NetPrice.ChargeAmount, field("NetPriceProductTradePrice")); err != nil {
+		return line, err
+	}
+	if l.GrossPrice != nil && l.GrossPrice.ChargeAmount != "" {
+		if line.GrossPrice, err = parseCIIDecimal(l.GrossPrice.ChargeAmount, field("GrossPriceProductTradePrice")); err != nil {
+			return line, err
+		}
+	}
+	// Line discount (BG-27) and eco-contribution (BG-28)
+	for _, a := range l.AllowanceCharges {
+		switch {
+		case !a.ChargeIndicator && a.CalculationPercent != "" && line.DiscountPercent == 0:
+			if line.DiscountPercent, err = parseCIIDecimal(a.CalculationPercent, field("CalculationPercent")); err != nil {
+				return line, err
+			}
+		case a.ChargeIndicator && strings.TrimSpace(a.Reason) == ecoContributionReason:
+			if line.EcoContribution, err = parseCIIDecimal(a.ActualAmount, field("ActualAmount")); err != nil {
+				return line, err
+			}
+		}
+	}
+	if p := l.BillingPeriod; p != nil {
+		if line.PeriodStart, err = parseOptionalCIIDate(p.Start, field("StartDateTime")); err != nil {
+			return line, err
+		}
+		if line.PeriodEnd, err = parseOptionalCIIDate(p.End, field("EndDateTime")); err != nil {
+			return line, err
+		}
+	}
+	// A one-day period is how a service date is written
+	if !line.PeriodStart.IsZero() && line.PeriodStart.Equal(line.PeriodEnd) {
+		line.ServiceDate, line.PeriodStart, line.PeriodEnd = line.PeriodStart, time.Time{}, time.Time{}
+	}
+	return line, nil
+}
+
+// parseCharge maps a document-level charge onto a Charge. Document-level
+// allowances have no InvoiceRequest equivalent.
+func parseCharge(c *TradeAllowanceCharge, i int) (Charge, error) {
+	field := func(name string) string { return fmt.Sprintf("Charges[%d].%s", i, name) }
+
+	if !c.ChargeIndicator {
+		return Charge{}, fmt.Errorf("%w: document-level allowances are not supported", ErrXML)
+	}
+	charge := Charge{Reason: strings.TrimSpace(c.Reason), ReasonCode: strings.TrimSpace(c.ReasonCode)}
+	var err error
+	if charge.Amount, err = parseCIIDecimal(c.ActualAmount, field("ActualAmount")); err != nil {
+		return charge, err
+	}
+	var rate string
+	if c.CategoryTax != nil {
+		rate = c.CategoryTax.RateApplicablePercent
+	}
+	if charge.VatRate, err = parseCIIDecimal(rate, field("RateApplicablePercent")); err != nil {
+		return charge, err
+	}
+	return charge, nil
+}
+
+// parseVatRegime maps a VAT breakdown onto the matching regime constructor.
+// Unknown categories keep their codes as is.
+func parseVatRegime(tax TradeTax, rate float64) VatRegime {
+	for _, r := range []VatRegime{VatFranchiseAuto(), VatExemptHealth(), VatReverseCharge(), VatMarginScheme()} {
+		if tax.CategoryCode == r.categoryCode && tax.ExemptionReasonCode == r.exemptionCode {
+			return r
+		}
+	}
+	if tax.CategoryCode == "S" {
+		return VatStandard(rate)
+	}
+	return VatRegime{
+		kind:          vatStandard,
+		rate:          rate,
+		categoryCode:  tax.CategoryCode,
+		exemptionCode: tax.ExemptionReasonCode,
+		exemptionText: tax.ExemptionReason,
+	}
+}
+
+// splitNotes separates free notes from those legalNotes regenerates, and
+// recovers the correction reason from the corrective invoice note and the
+// late payment and cash discount terms from their notes.
+func splitNotes(req *InvoiceRequest, notes []IncludedNote) (mentions, correctionReason string) {
+	req.LatePayment = parseLatePayment(notes)
+	req.CashDiscount = parseCashDiscount(notes)
+	for _, n := range notes {
+		if req.Type == TypeCorrective && strings.HasPrefix(n.Content, "Facture rectificative de la facture") {
+			if _, reason, ok := strings.Cut(n.Content, ". Motif : "); ok {
+				correctionReason = reason
+			}
+		}
+	}
+	req.CorrectionReason = correctionReason
+	for _, n := range notes {
+		if n.SubjectCode == noteSubjectLegal {
+			parseLegalMention(&req.Seller, strings.TrimSpace(n.Content))
+		}
+	}
+
+	generated := make(map[string]bool)
+	for _, n := range legalNotes(req) {
+		generated[n.text] = true
+	}
+	var free []string
+	for _, n := range notes {
+		if text := strings.TrimSpace(n.Content); text != "" && !generated[text] {
+			free = append(free, text)
+		}
+	}
+	return strings.Join(free, "\n"), correctionReason
+}
+
+// parseLegalMention sets the company mentions of c from a legal
+// information note written by Contact.legalMention. Notes in another format
+// leave c unchanged and are kept as free mentions.
+func parseLegalMention(c *Contact, text string) {
+	m := *c
+	for _, part := range strings.Split(text, " - ") {
+		switch {
+		case strings.HasPrefix(part, "RCS "):
+			// The RCS number is the SIREN, already read from the legal
+			// organization
+			fields := strings.Fields(strings.TrimPrefix(part, "RCS "))
+			if len(fields) > 3 {
+				m.RCSCity = strings.Join(fields[:len(fields)-3], " ")
+			}
+		case strings.HasPrefix(part, "NAF "):
+			m.NAF = strings.TrimPrefix(part, "NAF ")
+		case strings.HasPrefix(part, "Capital social : "):
+			m.ShareCapital = parseFrenchMoney(strings.TrimPrefix(part, "Capital social : "))
+		default:
+			form, capital, ok := strings.Cut(part, " au capital de ")
+			m.LegalForm = form
+			if ok {
+				m.ShareCapital = parseFrenchMoney(capital)
+			}
+		}
+	}
+	if m.legalMention() == text {
+		*c = m
+	}
+}
+
+// parseFrenchMoney parses an amount formatted by LocaleFrench.money, or
+// returns 0.
+func parseFrenchMoney(s string) float64 {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "€")
+	s = strings.NewReplacer(narrowNBSP, "", " ", "", "\u00a0", "").Replace(s)
+	return parseFrenchDecimal(s)
+}
+
+// isDigits reports whether s contains only ASCII digits.
+func isDigits(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }) < 0
+}
+
+func parseCIIDecimal(s, field string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: invalid number %q", ErrXML, field, s)
+	}
+	return v, nil
+}
+
+// parseCIIAmount parses a monetary amount into cents.
+func parseCIIAmount(s string) (amount, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	return toAmount(v), nil
+}
+
+func parseOptionalCIIDate(date Date, field string) (time.Time, error) {
+	s := strings.TrimSpace(string(date))
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := parseCIIDate(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s: invalid date %q", ErrXML, field, s)
+	}
+	return t, nil
+}
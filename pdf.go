@@ -2,14 +2,66 @@ package facturx
 
 import (
 	"bytes"
+	"crypto/md5"
 	_ "embed"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
 )
 
 //go:embed assets/sRGB-IEC61966-2.1.icc
 var srgbICCProfile []byte
 
+// Static resources shared by every generated PDF, computed once. The
+// objects have no number; their bytes are shared and must not be modified.
+var (
+	staticOnce     sync.Once
+	staticErr      error
+	staticICC      pdfObject // compressed sRGB profile stream
+	staticFontFile pdfObject // compressed full font program stream
+	staticWidths   string
+)
+
+// loadStaticResources compresses the ICC profile and font program and
+// encodes the font widths on first use, so that every invoice reuses the
+// same bytes instead of encoding ~300KB of resources again. It returns an
+// error wrapping ErrFont if the embedded font cannot be parsed.
+func loadStaticResources() error {
+	staticOnce.Do(func() {
+		icc := flate(srgbICCProfile)
+		staticICC = pdfObject{
+			content: []byte(fmt.Sprintf("<< /N 3 /Length %d /Filter /FlateDecode >>", len(icc))),
+			stream:  icc,
+		}
+		metrics, err := loadFontMetrics()
+		if err != nil {
+			staticErr = err
+			return
+		}
+		font := getFontData()
+		compressed := flate(font)
+		staticFontFile = pdfObject{
+			content: []byte(fontFileDict(len(compressed), len(font))),
+			stream:  compressed,
+		}
+		staticWidths = generateFontWidths(metrics)
+	})
+	return staticErr
+}
+
+// WarmUp prepares the resources shared by every invoice (font metrics,
+// compressed ICC profile and font program), which Generate otherwise does
+// on first use. Services can call it at startup to fail fast: it returns
+// an error wrapping ErrFont if the embedded font is unusable, in which
+// case every generation would fail with the same error.
+func WarmUp() error {
+	return loadStaticResources()
+}
+
 // pdfBuilder builds a PDF document.
 type pdfBuilder struct {
 	objects []pdfObject
@@ -43,8 +95,8 @@ func (b *pdfBuilder) addObject(content []byte, stream []byte) int {
 	return num
 }
 
-// build generates the complete PDF with a file ID.
-func (b *pdfBuilder) build(fileID string) []byte {
+// build generates the complete PDF with a file ID (hex).
+func (b *pdfBuilder) build(idHex string) []byte {
 	b.buffer.Reset()
 	b.offsets = make([]int, 0, len(b.objects))
 
@@ -77,9 +129,6 @@ func (b *pdfBuilder) build(fileID string) []byte {
 		fmt.Fprintf(&b.buffer, "%010d 00000 n \n", offset)
 	}
 
-	// Generate file ID
-	idHex := generateFileID(fileID)
-
 	// Trailer with ID (required for PDF/A)
 	b.buffer.WriteString("trailer\n")
 	fmt.Fprintf(&b.buffer, "<< /Size %d /Root 1 0 R /Info 2 0 R /ID [<%s> <%s>] >>\n",
@@ -114,33 +163,62 @@ func generateFileID(input string) string {
 	return result.String()
 }
 
-// generatePDF generates complete PDF/A-3 with embedded Factur-X XML.
-func generatePDF(req *InvoiceRequest, xmlContent string) []byte {
+// generatePDF generates complete PDF/A-3 with embedded Factur-X XML, and
+// reports the text that had to be truncated to fit the page.
+func generatePDF(req *InvoiceRequest, xmlContent string) ([]byte, []LayoutWarning, error) {
 	builder := newPDFBuilder()
 
-	// Calculate invoice totals for display
-	lineTotal, taxTotal, grandTotal, vatRate, vatText := calculateTotals(req)
+	// Calculate invoice totals for display (same values as the XML)
+	calc := calculateInvoice(req)
+	vatText := vatMention(req)
 
 	// Font metrics for text layout
-	metrics := getFontMetrics()
-	fontDataBytes := getFontData()
+	if err := loadStaticResources(); err != nil {
+		return nil, nil, err
+	}
+	font := requestFont(req)
+	metrics, err := font.Metrics()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Page dimensions (A4 in points: 595.28 x 841.89)
-	pageWidth := 595.28
-	pageHeight := 841.89
-	margin := 50.0
+	pageWidth := a4Width
+	pageHeight := a4Height
+	margin := req.Layout.margin()
 
 	// ========================================================================
 	// Create PDF objects
 	// ========================================================================
 
+	// Supplements follow the other objects, each as a file stream and its
+	// filespec
+	firstSupplementNum := 16
+	if req.AttachmentAnnotation {
+		firstSupplementNum = 18
+	}
+	files := []attachment{{name: specOf(req).fileName, filespecNum: 7}}
+	for i, s := range req.Supplements {
+		files = append(files, attachment{name: s.FileName, filespecNum: firstSupplementNum + 2*i + 1})
+	}
+	af := make([]string, len(files))
+	for i, f := range files {
+		af[i] = fmt.Sprintf("%d 0 R", f.filespecNum)
+	}
+	sortAttachments(files)
+	nameTree := make([]string, len(files))
+	for i, f := range files {
+		nameTree[i] = fmt.Sprintf("(%s) %d 0 R", escapePDFString(f.name), f.filespecNum)
+	}
+
 	// Object 1: Catalog (root)
-	catalogContent := "<< /Type /Catalog /Pages 3 0 R /MarkInfo << /Marked true >> /StructTreeRoot 4 0 R /Metadata 5 0 R /OutputIntents [6 0 R] /Names << /EmbeddedFiles << /Names [(factur-x.xml) 7 0 R] >> >> /AF [7 0 R] >>"
+	catalogContent := fmt.Sprintf("<< /Type /Catalog /Pages 3 0 R /MarkInfo << /Marked true >> /StructTreeRoot 4 0 R /Metadata 5 0 R /OutputIntents [6 0 R] /Names << /EmbeddedFiles << /Names [%s] >> >> /AF [%s] >>",
+		strings.Join(nameTree, " "), strings.Join(af, " "))
 	builder.addObject([]byte(catalogContent), nil) // Obj 1
 
 	// Object 2: Document Info
-	infoContent := fmt.Sprintf("<< /Title (Facture %s) /Producer (facturx-go) /CreationDate (D:%s) /ModDate (D:%s) >>",
-		escapePDFString(req.Number), req.Date, req.Date)
+	created := creationTime(req)
+	infoContent := infoDict(req, created)
 	builder.addObject([]byte(infoContent), nil) // Obj 2
 
 	// Object 3: Pages
@@ -152,64 +230,198 @@ func generatePDF(req *InvoiceRequest, xmlContent string) []byte {
 	builder.addObject([]byte(structTreeContent), nil) // Obj 4
 
 	// Object 5: XMP Metadata
-	xmp := generateXMPMetadata(req)
+	xmp := generateXMPMetadata(req, created)
 	xmpContent := fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>", len(xmp))
 	builder.addObject([]byte(xmpContent), []byte(xmp)) // Obj 5
 
 	// Object 6: OutputIntent for PDF/A
-	outputIntentContent := "<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /RegistryName (http://www.color.org) /Info (sRGB IEC61966-2.1) /DestOutputProfile 9 0 R >>"
+	outputIntentContent := fmt.Sprintf(outputIntentFormat, 9)
 	builder.addObject([]byte(outputIntentContent), nil) // Obj 6
 
 	// Object 7: Embedded file filespec
-	filespecContent := "<< /Type /Filespec /F (factur-x.xml) /UF (factur-x.xml) /Desc (Factur-X XML invoice) /AFRelationship /Data /EF << /F 10 0 R /UF 10 0 R >> >>"
+	filespecContent := filespecDict(req, 10)
 	builder.addObject([]byte(filespecContent), nil) // Obj 7
 
 	// Object 8: Page
-	pageContent := fmt.Sprintf("<< /Type /Page /Parent 3 0 R /MediaBox [0 0 %.2f %.2f] /Contents 11 0 R /Resources << /Font << /F1 12 0 R >> >> >>",
-		pageWidth, pageHeight)
+	annots := ""
+	if req.AttachmentAnnotation {
+		annots = " /Annots [16 0 R]"
+	}
+	pageContent := fmt.Sprintf("<< /Type /Page /Parent 3 0 R /MediaBox [0 0 %.2f %.2f] /Contents 11 0 R /Resources << /Font << /F1 12 0 R >> >>%s >>",
+		pageWidth, pageHeight, annots)
 	builder.addObject([]byte(pageContent), nil) // Obj 8
 
 	// Object 9: ICC Profile
-	iccHex := bytesToHex(srgbICCProfile)
-	iccContent := fmt.Sprintf("<< /N 3 /Length %d /Filter /ASCIIHexDecode >>", len(iccHex))
-	builder.addObject([]byte(iccContent), iccHex) // Obj 9
+	builder.addObject(staticICC.content, staticICC.stream) // Obj 9
 
 	// Object 10: Embedded XML file
 	xmlBytes := []byte(xmlContent)
-	embeddedFileContent := fmt.Sprintf("<< /Type /EmbeddedFile /Subtype /text#2Fxml /Length %d /Params << /Size %d >> >>",
-		len(xmlBytes), len(xmlBytes))
+	embeddedFileContent := embeddedFileDict(req, xmlBytes)
 	builder.addObject([]byte(embeddedFileContent), xmlBytes) // Obj 10
 
 	// Object 11: Page content stream
-	contentStream := generatePageContent(req, lineTotal, taxTotal, grandTotal, vatRate, vatText, metrics, pageWidth, pageHeight, margin)
+	layout := &textLayout{font: font, metrics: metrics}
+	contentStream := generatePageContent(req, &calc, vatText, layout, pageWidth, pageHeight, margin)
 	contentObj := fmt.Sprintf("<< /Length %d >>", len(contentStream))
 	builder.addObject([]byte(contentObj), contentStream) // Obj 11
 
-	// Object 12: Font dictionary
-	fontDictContent := "<< /Type /Font /Subtype /TrueType /BaseFont /LiberationSans /FirstChar 32 /LastChar 255 /FontDescriptor 13 0 R /Encoding /WinAnsiEncoding /Widths 14 0 R >>"
+	// Object 12: Font dictionary, for the subset of the glyphs drawn
+	fontName, fontFile := embeddedFont(font, metrics, contentStream)
+	fontDictContent := fmt.Sprintf("<< /Type /Font /Subtype /TrueType /BaseFont /%s /FirstChar 32 /LastChar 255 /FontDescriptor 13 0 R /Encoding /WinAnsiEncoding /Widths 14 0 R >>", fontName)
 	builder.addObject([]byte(fontDictContent), nil) // Obj 12
 
 	// Object 13: Font descriptor
-	fontDescriptorContent := fmt.Sprintf("<< /Type /FontDescriptor /FontName /LiberationSans /Flags 32 /FontBBox [-543 -303 1300 979] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight 729 /StemV 80 /FontFile2 15 0 R >>",
-		metrics.ascender, metrics.descender)
-	builder.addObject([]byte(fontDescriptorContent), nil) // Obj 13
+	builder.addObject([]byte(fontDescriptorDict(fontName, metrics)), nil) // Obj 13
 
 	// Object 14: Font widths array (characters 32-255)
-	widths := generateFontWidths(metrics)
+	widths := staticWidths
+	if _, ok := font.(liberationSans); !ok {
+		widths = generateFontWidths(metrics)
+	}
 	widthsContent := fmt.Sprintf("[%s]", widths)
 	builder.addObject([]byte(widthsContent), nil) // Obj 14
 
-	// Object 15: Embedded font file (raw binary)
-	fontContent := fmt.Sprintf("<< /Length %d /Length1 %d >>", len(fontDataBytes), len(fontDataBytes))
-	builder.addObject([]byte(fontContent), fontDataBytes) // Obj 15
+	// Object 15: Embedded font file
+	builder.addObject(fontFile.content, fontFile.stream) // Obj 15
+
+	if req.AttachmentAnnotation {
+		// Object 16: File attachment annotation, in the top margin
+		x, y := pageWidth-margin-attachmentIconWidth, pageHeight-40
+		annotContent := fmt.Sprintf("<< /Type /Annot /Subtype /FileAttachment /Rect [%.2f %.2f %.2f %.2f] /FS 7 0 R /Name /Paperclip /Contents %s /F 4 /AP << /N 17 0 R >> >>",
+			x, y, x+attachmentIconWidth, y+attachmentIconHeight, pdfTextString(attachmentDescription(req)))
+		builder.addObject([]byte(annotContent), nil) // Obj 16
+
+		// Object 17: Annotation appearance (required by PDF/A)
+		builder.addObject([]byte(fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 %d %d] /Length %d >>",
+			attachmentIconWidth, attachmentIconHeight, len(paperclipIcon))), []byte(paperclipIcon)) // Obj 17
+	}
+
+	for _, s := range req.Supplements {
+		fileNum := builder.addObject([]byte(s.fileDict(req.Date)), s.Data)
+		builder.addObject([]byte(s.filespecDict(fileNum)), nil)
+	}
+
+	if req.ObjectStreams {
+		id := pdfFileID(req)
+		return writeObjectStreamPDF(builder.objects, fmt.Sprintf("/Root 1 0 R /Info 2 0 R /ID [<%s> <%s>]", id, id)), layout.warnings, nil
+	}
+	return builder.build(pdfFileID(req)), layout.warnings, nil
+}
+
+// Size and drawing of the attachment annotation icon.
+const (
+	attachmentIconWidth  = 12
+	attachmentIconHeight = 18
+	paperclipIcon        = "q 0.35 0.35 0.35 RG 1.2 w 1 J 1 j 4 5 m 4 14 l 4 17.3 9.5 17.3 9.5 14 c 9.5 3.5 l 9.5 0.6 2 0.6 2 3.5 c 2 12 l S Q"
+)
+
+// pdfFileID returns the file ID of an invoice PDF, derived from its number
+// and date.
+func pdfFileID(req *InvoiceRequest) string {
+	return generateFileID(fmt.Sprintf("%s_%s", req.Number, req.Date))
+}
 
-	// Generate file ID from invoice number and date
-	fileID := fmt.Sprintf("%s_%s", req.Number, req.Date)
-	return builder.build(fileID)
+// Dictionaries shared by generated and embedded (see Embed) documents.
+const (
+	// outputIntentFormat takes the ICC profile object number.
+	outputIntentFormat = "<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) /RegistryName (http://www.color.org) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>"
+	// filespecFormat takes the file name twice, the description, the
+	// relationship and the embedded file object number twice.
+	filespecFormat = "<< /Type /Filespec /F (%s) /UF (%s) /Desc %s /AFRelationship /%s /EF << /F %d 0 R /UF %d 0 R >> >>"
+)
+
+// filespecDict returns the file specification of the factur-x.xml
+// attachment whose stream is object fileNum.
+func filespecDict(req *InvoiceRequest, fileNum int) string {
+	spec := specOf(req)
+	return fmt.Sprintf(filespecFormat, spec.fileName, spec.fileName, pdfTextString(attachmentDescription(req)),
+		spec.relationship, fileNum, fileNum)
 }
 
-// generateFontWidths generates font widths for characters 32-255 (scaled to 1000 units).
-func generateFontWidths(metrics *fontMetrics) string {
+// attachmentDescription returns the description of the factur-x.xml
+// attachment.
+func attachmentDescription(req *InvoiceRequest) string {
+	if req.AttachmentDescription != "" {
+		return req.AttachmentDescription
+	}
+	return "Factur-X XML invoice " + req.Number
+}
+
+// producer is the Producer and CreatorTool of generated documents.
+const producer = "facturx-go"
+
+// now returns the creation time of generated documents; tests replace it
+// to get reproducible output.
+var now = time.Now
+
+// creationTime returns the creation timestamp written to the Info
+// dictionary and the XMP metadata, which PDF/A requires to match.
+func creationTime(req *InvoiceRequest) time.Time {
+	if m := req.Metadata; m != nil && !m.CreationDate.IsZero() {
+		return m.CreationDate.UTC().Truncate(time.Second)
+	}
+	return now().UTC().Truncate(time.Second)
+}
+
+// documentMetadata returns the metadata of the request with the defaults
+// applied.
+func documentMetadata(req *InvoiceRequest) Metadata {
+	m := Metadata{Title: "Facture " + req.Number, Author: req.Seller.Name, Producer: producer}
+	if o := req.Metadata; o != nil {
+		if o.Title != "" {
+			m.Title = o.Title
+		}
+		if o.Author != "" {
+			m.Author = o.Author
+		}
+		if o.Producer != "" {
+			m.Producer = o.Producer
+		}
+		m.Subject = o.Subject
+	}
+	return m
+}
+
+// infoDict returns the document information dictionary, matching the XMP
+// metadata of generateXMPMetadata.
+func infoDict(req *InvoiceRequest, created time.Time) string {
+	m := documentMetadata(req)
+	date := created.Format("D:20060102150405+00'00'")
+	subject := ""
+	if m.Subject != "" {
+		subject = " /Subject " + pdfTextString(m.Subject)
+	}
+	return fmt.Sprintf("<< /Title %s /Author %s%s /Creator (%s) /Producer %s /CreationDate (%s) /ModDate (%s) >>",
+		pdfTextString(m.Title), pdfTextString(m.Author), subject, producer, pdfTextString(m.Producer), date, date)
+}
+
+// embeddedFileDict returns the stream dictionary of the factur-x.xml
+// attachment, with the MIME type and the size, date and MD5 checksum
+// parameters expected by PDF/A-3 validators.
+func embeddedFileDict(req *InvoiceRequest, xml []byte) string {
+	return fmt.Sprintf("<< /Type /EmbeddedFile /Subtype /application#2Fxml /Length %d /Params << /Size %d /ModDate (D:%s) /CheckSum <%X> >> >>",
+		len(xml), len(xml), req.Date, md5.Sum(xml))
+}
+
+// fontFileDict returns the stream dictionary of a compressed TrueType font
+// program of length1 bytes.
+func fontFileDict(length, length1 int) string {
+	return fmt.Sprintf("<< /Length %d /Length1 %d /Filter /FlateDecode >>", length, length1)
+}
+
+// fontDescriptorDict returns the font descriptor of the font named name,
+// in glyph space units (1000 per em). The font program is object 15.
+func fontDescriptorDict(name string, metrics *FontMetrics) string {
+	scale := func(v int16) int {
+		return int(math.Round(float64(v) * 1000 / float64(metrics.unitsPerEM)))
+	}
+	return fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 15 0 R >>",
+		name, scale(metrics.bbox[0]), scale(metrics.bbox[1]), scale(metrics.bbox[2]), scale(metrics.bbox[3]),
+		scale(metrics.ascender), scale(metrics.descender), scale(metrics.capHeight))
+}
+
+// generateFontWidths generates font widths for WinAnsi codes 32-255 (scaled to 1000 units).
+func generateFontWidths(metrics *FontMetrics) string {
 	scale := 1000.0 / float64(metrics.unitsPerEM)
 	var widths strings.Builder
 
@@ -217,7 +429,11 @@ func generateFontWidths(metrics *fontMetrics) string {
 		if code > 32 {
 			widths.WriteByte(' ')
 		}
-		width := metrics.charWidth(rune(code))
+		r := rune(code)
+		if code >= 0x80 && code <= 0x9F && winAnsiHigh[code-0x80] != 0 {
+			r = winAnsiHigh[code-0x80]
+		}
+		width := metrics.charWidth(r)
 		scaled := int(float64(width)*scale + 0.5)
 		fmt.Fprintf(&widths, "%d", scaled)
 	}
@@ -225,16 +441,6 @@ func generateFontWidths(metrics *fontMetrics) string {
 	return widths.String()
 }
 
-// bytesToHex converts bytes to ASCII hex encoding.
-func bytesToHex(data []byte) []byte {
-	hex := make([]byte, 0, len(data)*2+1)
-	for _, b := range data {
-		hex = append(hex, fmt.Sprintf("%02X", b)...)
-	}
-	hex = append(hex, '>')
-	return hex
-}
-
 // escapePDFString escapes a string for PDF.
 func escapePDFString(s string) string {
 	var result strings.Builder
@@ -254,29 +460,74 @@ func escapePDFString(s string) string {
 	return result.String()
 }
 
+// pdfTextString returns s as a PDF text string: a literal string when it is
+// printable ASCII, UTF-16BE hexadecimal otherwise.
+func pdfTextString(s string) string {
+	ascii := true
+	for _, c := range s {
+		if c < 0x20 || c > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + escapePDFString(s) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
 // generateXMPMetadata generates XMP metadata for PDF/A-3 and Factur-X.
-func generateXMPMetadata(req *InvoiceRequest) string {
+//
+// The document ID is derived from the PDF file ID, so that every rendition
+// of an invoice shares it; the instance ID also depends on the creation
+// time.
+func generateXMPMetadata(req *InvoiceRequest, created time.Time) string {
+	fileID := pdfFileID(req)
+	spec := specOf(req)
+	m := documentMetadata(req)
+	timestamp := created.Format("2006-01-02T15:04:05+00:00")
+	description := ""
+	if m.Subject != "" {
+		description = fmt.Sprintf(`
+      <dc:description>
+        <rdf:Alt>
+          <rdf:li xml:lang="x-default">%s</rdf:li>
+        </rdf:Alt>
+      </dc:description>`, escapeXMLAttr(m.Subject))
+	}
 	return fmt.Sprintf(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
 <x:xmpmeta xmlns:x="adobe:ns:meta/">
   <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
     <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
       <dc:title>
         <rdf:Alt>
-          <rdf:li xml:lang="x-default">Facture %s</rdf:li>
+          <rdf:li xml:lang="x-default">%s</rdf:li>
         </rdf:Alt>
       </dc:title>
       <dc:creator>
         <rdf:Seq>
           <rdf:li>%s</rdf:li>
         </rdf:Seq>
-      </dc:creator>
+      </dc:creator>%s
     </rdf:Description>
     <rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
-      <pdf:Producer>facturx-go</pdf:Producer>
+      <pdf:Producer>%s</pdf:Producer>
     </rdf:Description>
     <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
-      <xmp:CreateDate>%s-%s-%sT00:00:00+00:00</xmp:CreateDate>
-      <xmp:ModifyDate>%s-%s-%sT00:00:00+00:00</xmp:ModifyDate>
+      <xmp:CreatorTool>%s</xmp:CreatorTool>
+      <xmp:CreateDate>%s</xmp:CreateDate>
+      <xmp:ModifyDate>%s</xmp:ModifyDate>
+      <xmp:MetadataDate>%s</xmp:MetadataDate>
+    </rdf:Description>
+    <rdf:Description rdf:about="" xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/">
+      <xmpMM:DocumentID>uuid:%s</xmpMM:DocumentID>
+      <xmpMM:InstanceID>uuid:%s</xmpMM:InstanceID>
     </rdf:Description>
     <rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
       <pdfaid:part>3</pdfaid:part>
@@ -322,18 +573,31 @@ func generateXMPMetadata(req *InvoiceRequest) string {
       </pdfaExtension:schemas>
     </rdf:Description>
     <rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
-      <fx:DocumentFileName>factur-x.xml</fx:DocumentFileName>
+      <fx:DocumentFileName>%s</fx:DocumentFileName>
       <fx:DocumentType>INVOICE</fx:DocumentType>
-      <fx:Version>1.0</fx:Version>
-      <fx:ConformanceLevel>BASIC</fx:ConformanceLevel>
+      <fx:Version>%s</fx:Version>
+      <fx:ConformanceLevel>%s</fx:ConformanceLevel>
     </rdf:Description>
   </rdf:RDF>
 </x:xmpmeta>
 <?xpacket end="w"?>`,
-		escapeXMLAttr(req.Number),
-		escapeXMLAttr(req.Seller.Name),
-		req.Date[0:4], req.Date[4:6], req.Date[6:8],
-		req.Date[0:4], req.Date[4:6], req.Date[6:8])
+		escapeXMLAttr(m.Title),
+		escapeXMLAttr(m.Author),
+		description,
+		escapeXMLAttr(m.Producer),
+		producer,
+		timestamp, timestamp, timestamp,
+		uuidFromHex(fileID),
+		uuidFromHex(generateFileID(fileID+timestamp)),
+		spec.fileName,
+		spec.xmpVersion,
+		profileOf(req))
+}
+
+// uuidFromHex formats 32 hexadecimal digits as a UUID.
+func uuidFromHex(h string) string {
+	h = strings.ToLower(h)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
 }
 
 // escapeXMLAttr escapes string for XML attribute.
@@ -345,42 +609,26 @@ func escapeXMLAttr(s string) string {
 	return s
 }
 
-// calculateTotals calculates invoice totals.
-func calculateTotals(req *InvoiceRequest) (lineTotal, taxTotal, grandTotal, vatRate, vatText string) {
-	var lineTotalVal float64
-	for _, line := range req.Lines {
-		lineTotalVal += line.Quantity * line.UnitPrice
-	}
-
-	var vatRateVal float64
-	var vatTextVal string
-	switch req.Regime.kind {
-	case vatFranchiseAuto:
-		vatRateVal = 0
-		vatTextVal = "TVA non applicable, art. 293 B du CGI"
-	case vatExemptHealth:
-		vatRateVal = 0
-		vatTextVal = "Exonération de TVA, art. 261-4-1° du CGI"
-	default:
-		vatRateVal = req.Regime.rate
-		vatTextVal = fmt.Sprintf("TVA %.0f%%", req.Regime.rate)
+// vatMention returns the VAT legal mention displayed on the invoice.
+func vatMention(req *InvoiceRequest) string {
+	if req.Regime.exemptionText != "" {
+		return req.Regime.exemptionText
 	}
-
-	taxTotalVal := lineTotalVal * vatRateVal / 100.0
-	grandTotalVal := lineTotalVal + taxTotalVal
-
-	return fmt.Sprintf("%.2f", lineTotalVal),
-		fmt.Sprintf("%.2f", taxTotalVal),
-		fmt.Sprintf("%.2f", grandTotalVal),
-		fmt.Sprintf("%.2f", vatRateVal),
-		vatTextVal
+	return fmt.Sprintf("TVA %.0f%%", req.Regime.rate)
 }
 
 // generatePageContent generates page content stream (visual invoice layout).
-func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, vatRate, vatText string,
-	metrics *fontMetrics, pageWidth, pageHeight, margin float64) []byte {
+func generatePageContent(req *InvoiceRequest, calc *invoiceCalculation, vatText string,
+	layout *textLayout, pageWidth, pageHeight, margin float64) []byte {
 
 	var content bytes.Buffer
+	metrics := layout.metrics
+
+	// writeFit writes text shrunk or truncated to width (see textLayout.fit)
+	writeFit := func(field, text string, x, y, width, size, r, g, b float64) {
+		text, size = layout.fit(field, text, width, size)
+		writeTextColored(&content, layout.font, text, x, y, size, r, g, b)
+	}
 
 	// Color definitions (RGB 0-1) - Deiz theme
 	const (
@@ -390,6 +638,14 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 		lightBgR, lightBgG, lightBgB = 0.976, 0.965, 0.945 // Cream #F9F6F1
 	)
 
+	// Under the margin scheme no VAT may appear, so amounts are not "HT"
+	marginScheme := req.Regime.kind == vatMargin
+	loc := req.Locale
+	ht := " HT"
+	if marginScheme {
+		ht = ""
+	}
+
 	// Start with graphics state
 	content.WriteString("q\n")
 
@@ -408,14 +664,21 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	headerBlockHeight := titleFontSize + titleNumberGap + numberFontSize
 	blockTopY := headerCenterY + headerBlockHeight/2
 
-	writeTextColored(&content, "FACTURE", margin, blockTopY-titleFontSize+6, titleFontSize, 1, 1, 1)
+	// Long titles (e.g. "FACTURE D'ACOMPTE") shrink to stay clear of the date badge
+	title := req.Type.Title()
+	titleSize := titleFontSize
+	titleMaxWidth := pageWidth - 2*margin - 100
+	if w := metrics.stringWidth(title, titleSize); w > titleMaxWidth {
+		titleSize *= titleMaxWidth / w
+	}
+	writeTextColored(&content, layout.font, title, margin, blockTopY-titleFontSize+6, titleSize, 1, 1, 1)
 	invoiceInfo := fmt.Sprintf("N° %s", req.Number)
-	writeTextColored(&content, invoiceInfo, margin, blockTopY-titleFontSize-titleNumberGap-2, numberFontSize, 0.8, 0.8, 0.8)
+	writeFit("Number", invoiceInfo, margin, blockTopY-titleFontSize-titleNumberGap-2, pageWidth-2*margin-100, numberFontSize, 0.8, 0.8, 0.8)
 
 	// ========================================================================
 	// Date badge (centered vertically)
 	// ========================================================================
-	dateStr := fmt.Sprintf("%s/%s/%s", req.Date[6:8], req.Date[4:6], req.Date[0:4])
+	dateStr := ciiToDisplayDate(req.Date)
 	dateFontSize := 10.0
 	dateBoxHeight := 24.0
 	dateBoxWidth := 80.0
@@ -427,7 +690,31 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	dateTextWidth := metrics.stringWidth(dateStr, dateFontSize)
 	dateTextX := dateBoxX + (dateBoxWidth-dateTextWidth)/2
 	dateTextY := dateBoxY + (dateBoxHeight-dateFontSize)/2 + 1
-	writeTextColored(&content, dateStr, dateTextX, dateTextY, dateFontSize, primaryR, primaryG, primaryB)
+	writeTextColored(&content, layout.font, dateStr, dateTextX, dateTextY, dateFontSize, primaryR, primaryG, primaryB)
+
+	// ========================================================================
+	// Letterhead: tagline and contact line, right-aligned against the date
+	// ========================================================================
+	// Long titles leave no room for it
+	letterheadRight := dateBoxX - 15
+	letterheadWidth := letterheadRight - (margin + metrics.stringWidth(title, titleSize) + 20)
+	if h := req.Header; h != nil && letterheadWidth > 0 {
+		writeRight := func(field, text string, y, size, gray float64) {
+			text, size = layout.fit(field, text, letterheadWidth, size)
+			w := metrics.stringWidth(text, size)
+			writeTextColored(&content, layout.font, text, letterheadRight-w, y, size, gray, gray, gray)
+		}
+		tagline, contact := strings.TrimSpace(h.Tagline), h.contactLine()
+		switch {
+		case tagline != "" && contact != "":
+			writeRight("Header.Tagline", tagline, headerCenterY+2, 11.0, 1)
+			writeRight("Header", contact, headerCenterY-12, 8.0, 0.8)
+		case tagline != "":
+			writeRight("Header.Tagline", tagline, headerCenterY-4, 11.0, 1)
+		case contact != "":
+			writeRight("Header", contact, headerCenterY-3, 8.0, 0.8)
+		}
+	}
 
 	// ========================================================================
 	// Accent line under header
@@ -451,20 +738,30 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", lightBgR, lightBgG, lightBgB)
 	fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re f\n", margin-10, yParties-70-float64(sellerExtraLines)*11, blockWidth+20, blockHeight)
 
-	writeTextColored(&content, "Émetteur", margin, yParties, 11.0, primaryR, primaryG, primaryB)
+	// In self-billing the buyer issues the invoice on behalf of the supplier
+	sellerLabel, buyerLabel := "Émetteur", "Destinataire"
+	if req.Type == TypeSelfBilled {
+		sellerLabel, buyerLabel = "Fournisseur", "Client (émetteur de la facture)"
+	}
+
+	writeTextColored(&content, layout.font, sellerLabel, margin, yParties, 11.0, primaryR, primaryG, primaryB)
 	sellerName := req.Seller.Name
 	if req.AddEISuffix {
 		sellerName = req.Seller.Name + ", EI"
 	}
-	writeTextColored(&content, sellerName, margin, yParties-18, 10.0, 0.2, 0.2, 0.2)
-	writeTextColored(&content, req.Seller.Address, margin, yParties-33, 9.0, grayR, grayG, grayB)
-	writeTextColored(&content, fmt.Sprintf("%s %s", req.Seller.ZipCode, req.Seller.City), margin, yParties-46, 9.0, grayR, grayG, grayB)
-	writeTextColored(&content, fmt.Sprintf("SIRET: %s", req.Seller.Siret), margin, yParties-59, 9.0, grayR, grayG, grayB)
+	writeFit("Seller.Name", sellerName, margin, yParties-18, blockWidth, 10.0, 0.2, 0.2, 0.2)
+	writeFit("Seller.Address", req.Seller.Address, margin, yParties-33, blockWidth, 9.0, grayR, grayG, grayB)
+	writeFit("Seller.City", fmt.Sprintf("%s %s", req.Seller.ZipCode, req.Seller.City), margin, yParties-46, blockWidth, 9.0, grayR, grayG, grayB)
+	writeFit("Seller", legalIDText(&req.Seller), margin, yParties-59, blockWidth, 9.0, grayR, grayG, grayB)
 
 	// Display professional IDs (ADELI, RPPS, etc.)
 	sellerIdY := yParties - 72.0
-	for _, profId := range req.Seller.ProfessionalIds {
-		writeTextColored(&content, fmt.Sprintf("%s: %s", profId.Type, profId.Value), margin, sellerIdY, 9.0, grayR, grayG, grayB)
+	for i, profId := range req.Seller.ProfessionalIds {
+		label := "N° " + profId.Value
+		if profId.Type != "" {
+			label = fmt.Sprintf("N° %s: %s", profId.Type, profId.Value)
+		}
+		writeFit(fmt.Sprintf("Seller.ProfessionalIds[%d]", i), label, margin, sellerIdY, blockWidth, 9.0, grayR, grayG, grayB)
 		sellerIdY -= 11.0
 	}
 
@@ -473,19 +770,24 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", lightBgR, lightBgG, lightBgB)
 	fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re f\n", buyerX-10, yParties-70-float64(sellerExtraLines)*11, blockWidth+20, blockHeight)
 
-	writeTextColored(&content, "Destinataire", buyerX, yParties, 11.0, primaryR, primaryG, primaryB)
-	writeTextColored(&content, req.Buyer.Name, buyerX, yParties-18, 10.0, 0.2, 0.2, 0.2)
-	writeTextColored(&content, req.Buyer.Address, buyerX, yParties-33, 9.0, grayR, grayG, grayB)
-	writeTextColored(&content, fmt.Sprintf("%s %s", req.Buyer.ZipCode, req.Buyer.City), buyerX, yParties-46, 9.0, grayR, grayG, grayB)
-	if req.Buyer.Siret != "" {
-		writeTextColored(&content, fmt.Sprintf("SIRET: %s", req.Buyer.Siret), buyerX, yParties-59, 9.0, grayR, grayG, grayB)
+	writeTextColored(&content, layout.font, buyerLabel, buyerX, yParties, 11.0, primaryR, primaryG, primaryB)
+	writeFit("Buyer.Name", req.Buyer.Name, buyerX, yParties-18, blockWidth, 10.0, 0.2, 0.2, 0.2)
+	writeFit("Buyer.Address", req.Buyer.Address, buyerX, yParties-33, blockWidth, 9.0, grayR, grayG, grayB)
+	writeFit("Buyer.City", fmt.Sprintf("%s %s", req.Buyer.ZipCode, req.Buyer.City), buyerX, yParties-46, blockWidth, 9.0, grayR, grayG, grayB)
+	if text := legalIDText(&req.Buyer); text != "" {
+		writeFit("Buyer", text, buyerX, yParties-59, blockWidth, 9.0, grayR, grayG, grayB)
 	}
 
 	// ========================================================================
 	// Table - adjust position based on seller block height
 	// ========================================================================
 	tableTop := pageHeight - 230.0 - float64(sellerExtraLines)*11.0
-	rowHeight := 22.0
+
+	// Document references line between the parties and the table
+	if refs := documentReferences(req); len(refs) > 0 {
+		writeFit("References", strings.Join(refs, "   |   "), margin, tableTop+33, pageWidth-2*margin, 8.0, grayR, grayG, grayB)
+	}
+	rowHeight := req.Layout.rowHeight()
 
 	// Check if any line has a date
 	hasAnyDate := false
@@ -496,65 +798,68 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 		}
 	}
 
-	// Column positions depend on whether we show the Date column
-	var colDate, colDesc, colQty, colPrice, colTotal float64
-	var descMaxLen int
-	if hasAnyDate {
-		colDate = margin
-		colDesc = margin + 65.0
-		colQty = margin + 295.0
-		colPrice = margin + 355.0
-		colTotal = margin + 440.0
-		descMaxLen = 35
-	} else {
-		colDesc = margin
-		colQty = margin + 295.0
-		colPrice = margin + 355.0
-		colTotal = margin + 440.0
-		descMaxLen = 45
+	// Check if any line has a discount
+	hasAnyDiscount := false
+	for _, line := range req.Lines {
+		if line.DiscountPercent > 0 {
+			hasAnyDiscount = true
+			break
+		}
 	}
 
+	// Column positions depend on whether we show the Date and Remise columns
+	cols := req.Layout.columns(hasAnyDate, hasAnyDiscount)
+	colDate, colDesc, colQty, colPrice, colDiscount, colTotal := cols.date, cols.desc, cols.qty, cols.price, cols.discount, cols.total
+
 	// Table header background
 	fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", primaryR, primaryG, primaryB)
 	fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re f\n", margin-10, tableTop-5, pageWidth-2*margin+20, 25.0)
 
 	// Table header text in white
 	if hasAnyDate {
-		writeTextColored(&content, "Date", colDate, tableTop+3, 10.0, 1, 1, 1)
+		writeTextColored(&content, layout.font, "Date", colDate, tableTop+3, 10.0, 1, 1, 1)
+	}
+	writeTextColored(&content, layout.font, "Description", colDesc, tableTop+3, 10.0, 1, 1, 1)
+	writeTextColored(&content, layout.font, "Qté", colQty, tableTop+3, 10.0, 1, 1, 1)
+	writeTextColored(&content, layout.font, "Prix unit.", colPrice, tableTop+3, 10.0, 1, 1, 1)
+	if hasAnyDiscount {
+		writeTextColored(&content, layout.font, "Remise", colDiscount, tableTop+3, 10.0, 1, 1, 1)
 	}
-	writeTextColored(&content, "Description", colDesc, tableTop+3, 10.0, 1, 1, 1)
-	writeTextColored(&content, "Qté", colQty, tableTop+3, 10.0, 1, 1, 1)
-	writeTextColored(&content, "Prix unit.", colPrice, tableTop+3, 10.0, 1, 1, 1)
-	writeTextColored(&content, "Total HT", colTotal, tableTop+3, 10.0, 1, 1, 1)
+	writeTextColored(&content, layout.font, "Total"+ht, colTotal, tableTop+3, 10.0, 1, 1, 1)
 
 	// Table rows with alternating backgrounds
 	y := tableTop - 25.0
 	for i, line := range req.Lines {
-		lineAmount := line.Quantity * line.UnitPrice
+		lineAmount := calc.lineAmounts[i]
+
+		// Detail rows (catalogue price, billing period...) extend the line
+		details := lineDetails(&line, req.Locale)
+		lineHeight := rowHeight + float64(len(details))*10.0
 
 		// Alternating row background
 		if i%2 == 0 {
 			fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", lightBgR, lightBgG, lightBgB)
-			fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re f\n", margin-10, y-5, pageWidth-2*margin+20, rowHeight)
+			fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re f\n", margin-10, y-5-(lineHeight-rowHeight), pageWidth-2*margin+20, lineHeight)
 		}
 
 		// Date column (only if any line has a date)
 		if hasAnyDate && line.Date != "" {
-			writeTextColored(&content, line.Date, colDate, y+3, 9.0, 0.2, 0.2, 0.2)
+			writeTextColored(&content, layout.font, line.Date, colDate, y+3, 9.0, 0.2, 0.2, 0.2)
 		}
 
-		// Truncate description if too long
-		desc := line.Description
-		if len(desc) > descMaxLen {
-			desc = desc[:descMaxLen-3] + "..."
+		writeFit(fmt.Sprintf("Lines[%d].Description", i), line.Description, colDesc, y+3, colQty-colDesc-10, 10.0, 0.2, 0.2, 0.2)
+		writeTextColored(&content, layout.font, loc.decimal(toAmount(line.Quantity)), colQty, y+3, 10.0, 0.2, 0.2, 0.2)
+		writeTextColored(&content, layout.font, loc.money(toAmount(line.UnitPrice)), colPrice, y+3, 10.0, 0.2, 0.2, 0.2)
+		if line.DiscountPercent > 0 {
+			writeTextColored(&content, layout.font, loc.percent(line.DiscountPercent), colDiscount, y+3, 10.0, 0.2, 0.2, 0.2)
 		}
+		writeTextColored(&content, layout.font, loc.money(lineAmount), colTotal, y+3, 10.0, 0.2, 0.2, 0.2)
 
-		writeTextColored(&content, desc, colDesc, y+3, 10.0, 0.2, 0.2, 0.2)
-		writeTextColored(&content, fmt.Sprintf("%.2f", line.Quantity), colQty, y+3, 10.0, 0.2, 0.2, 0.2)
-		writeTextColored(&content, fmt.Sprintf("%.2f EUR", line.UnitPrice), colPrice, y+3, 10.0, 0.2, 0.2, 0.2)
-		writeTextColored(&content, fmt.Sprintf("%.2f EUR", lineAmount), colTotal, y+3, 10.0, 0.2, 0.2, 0.2)
+		for j, detail := range details {
+			writeFit(fmt.Sprintf("Lines[%d]", i), detail, colDesc, y-7-float64(j)*10.0, pageWidth-margin-colDesc, 7.0, grayR, grayG, grayB)
+		}
 
-		y -= rowHeight
+		y -= lineHeight
 	}
 
 	// Bottom line of table
@@ -568,8 +873,39 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	tableRightEdge := pageWidth - margin + 10
 	totalsBoxW := 180.0
 	totalsBoxX := tableRightEdge - totalsBoxW
-	totalsBoxY := y - 85
-	totalsBoxH := 80.0
+	// Rows above the highlighted band; a prepaid amount turns the band into "Net à payer"
+	type totalsRow struct{ label, value string }
+	var totalsRows []totalsRow
+	if len(req.Charges) > 0 {
+		// Charges such as "Frais de port" between the lines and the tax base
+		totalsRows = append(totalsRows, totalsRow{"Sous-total" + ht + ":", loc.money(calc.lineTotal)})
+		for i, c := range req.Charges {
+			// The label must end before the value column
+			label := layout.truncate(fmt.Sprintf("Charges[%d].Reason", i), c.Reason, 78, 10.0)
+			if label == "" {
+				label = "Frais"
+			}
+			totalsRows = append(totalsRows, totalsRow{label + ":", loc.money(toAmount(c.Amount))})
+		}
+	}
+	bandLabel, bandValue := "Total:", loc.money(calc.grandTotal)
+	if !marginScheme {
+		totalsRows = append(totalsRows,
+			totalsRow{"Total HT:", loc.money(calc.taxBase)},
+			totalsRow{fmt.Sprintf("TVA (%s):", loc.percent(calc.vatRate)), loc.money(calc.taxTotal)},
+		)
+		bandLabel = "Total TTC:"
+	}
+	if calc.prepaidAmount != 0 {
+		totalsRows = append(totalsRows,
+			totalsRow{bandLabel, loc.money(calc.grandTotal)},
+			totalsRow{"Acompte versé:", loc.money(-calc.prepaidAmount)},
+		)
+		bandLabel, bandValue = "Net à payer:", loc.money(calc.dueAmount)
+	}
+
+	totalsBoxH := 44.0 + 18.0*float64(len(totalsRows))
+	totalsBoxY := y - 5 - totalsBoxH
 
 	// Totals background
 	fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", lightBgR, lightBgG, lightBgB)
@@ -585,17 +921,17 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	totalsValueX := totalsBoxX + 100
 	totalsY := totalsBoxY + totalsBoxH - 20
 
-	writeTextColored(&content, "Total HT:", totalsLabelX, totalsY, 10.0, 0.2, 0.2, 0.2)
-	writeTextColored(&content, fmt.Sprintf("%s EUR", lineTotal), totalsValueX, totalsY, 10.0, 0.2, 0.2, 0.2)
-
-	writeTextColored(&content, fmt.Sprintf("TVA (%s%%):", vatRate), totalsLabelX, totalsY-18, 10.0, 0.2, 0.2, 0.2)
-	writeTextColored(&content, fmt.Sprintf("%s EUR", taxTotal), totalsValueX, totalsY-18, 10.0, 0.2, 0.2, 0.2)
+	for i, row := range totalsRows {
+		rowY := totalsY - float64(i)*18
+		writeTextColored(&content, layout.font, row.label, totalsLabelX, rowY, 10.0, 0.2, 0.2, 0.2)
+		writeTextColored(&content, layout.font, row.value, totalsValueX, rowY, 10.0, 0.2, 0.2, 0.2)
+	}
 
 	// Grand total highlight
 	fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", primaryR, primaryG, primaryB)
 	fmt.Fprintf(&content, "%.2f %.2f %.2f 22 re f\n", totalsBoxX, totalsBoxY, totalsBoxW)
-	writeTextColored(&content, "Total TTC:", totalsLabelX, totalsBoxY+6, 11.0, 1, 1, 1)
-	writeTextColored(&content, fmt.Sprintf("%s EUR", grandTotal), totalsValueX, totalsBoxY+6, 11.0, 1, 1, 1)
+	writeTextColored(&content, layout.font, bandLabel, totalsLabelX, totalsBoxY+6, 11.0, 1, 1, 1)
+	writeTextColored(&content, layout.font, bandValue, totalsValueX, totalsBoxY+6, 11.0, 1, 1, 1)
 
 	// ========================================================================
 	// Payment badge (if paid)
@@ -618,13 +954,47 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 		// Text centered
 		paymentTextX := paymentBadgeX + 12
 		paymentTextY := paymentBadgeY + (paymentBadgeH-paymentFontSize)/2 + 2
-		writeTextColored(&content, paymentText, paymentTextX, paymentTextY, paymentFontSize, primaryR, primaryG, primaryB)
+		writeTextColored(&content, layout.font, paymentText, paymentTextX, paymentTextY, paymentFontSize, primaryR, primaryG, primaryB)
 	}
 
 	// ========================================================================
-	// Legal mentions
+	// Installment schedule (échéancier) under the totals, left-aligned
 	// ========================================================================
 	mentionsY := 110.0
+	if len(req.Installments) > 0 {
+		scheduleX := margin - 10
+		scheduleW := 220.0
+		scheduleAmountX := margin + 120
+		scheduleY := totalsBoxY - 25
+		writeTextColored(&content, layout.font, "Échéancier", margin, scheduleY, 11.0, primaryR, primaryG, primaryB)
+
+		scheduleY -= 20
+		fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", primaryR, primaryG, primaryB)
+		fmt.Fprintf(&content, "%.2f %.2f %.2f 16 re f\n", scheduleX, scheduleY-4, scheduleW)
+		writeTextColored(&content, layout.font, "Échéance", margin, scheduleY+1, 9.0, 1, 1, 1)
+		writeTextColored(&content, layout.font, "Montant", scheduleAmountX, scheduleY+1, 9.0, 1, 1, 1)
+		for i, inst := range req.Installments {
+			scheduleY -= 15
+			// Rows running into the legal mentions are dropped
+			if scheduleY-4 < mentionsY+20 {
+				layout.warnings = append(layout.warnings, LayoutWarning{
+					Field: fmt.Sprintf("Installments[%d]", i),
+					Text:  formatDisplayDate(inst.DueDate),
+				})
+				continue
+			}
+			if i%2 == 1 {
+				fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", lightBgR, lightBgG, lightBgB)
+				fmt.Fprintf(&content, "%.2f %.2f %.2f 15 re f\n", scheduleX, scheduleY-4, scheduleW)
+			}
+			writeTextColored(&content, layout.font, formatDisplayDate(inst.DueDate), margin, scheduleY, 9.0, 0.2, 0.2, 0.2)
+			writeTextColored(&content, layout.font, loc.money(toAmount(inst.Amount)), scheduleAmountX, scheduleY, 9.0, 0.2, 0.2, 0.2)
+		}
+	}
+
+	// ========================================================================
+	// Legal mentions
+	// ========================================================================
 
 	// Small accent line
 	fmt.Fprintf(&content, "%.3f %.3f %.3f RG\n", accentR, accentG, accentB)
@@ -632,23 +1002,79 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	fmt.Fprintf(&content, "%.2f %.2f m %.2f %.2f l S\n", margin, mentionsY+15, margin+40, mentionsY+15)
 	fmt.Fprintf(&content, "1 w\n")
 
-	writeTextColored(&content, "Mentions legales", margin, mentionsY, 9.0, primaryR, primaryG, primaryB)
-	writeTextColored(&content, vatText, margin, mentionsY-14, 8.0, grayR, grayG, grayB)
+	writeTextColored(&content, layout.font, "Mentions legales", margin, mentionsY, 9.0, primaryR, primaryG, primaryB)
+
+	footerLines := []string{fmt.Sprintf("Document genere conformement a la norme Factur-X 1.0 (Profil %s)", profileOf(req))}
+	if req.Footer != nil {
+		footerLines = req.Footer.Lines
+	}
+	footerFields := make([]string, len(footerLines))
+	for i := range footerLines {
+		footerFields[i] = fmt.Sprintf("Footer.Lines[%d]", i)
+	}
+	if mention := req.Seller.legalMention(); mention != "" {
+		footerLines = append([]string{mention}, footerLines...)
+		footerFields = append([]string{"Seller.LegalForm"}, footerFields...)
+	}
+	// The mentions stop above the footer band, which grows upwards by one
+	// 9pt line per extra line
+	var footerExtra, footerTop float64
+	if len(footerLines) > 0 {
+		footerExtra = 9.0 * float64(len(footerLines)-1)
+		footerTop = 35 + footerExtra
+	}
+
+	// Long mentions wrap to the page width; what does not fit above the
+	// footer is dropped and reported under field
+	cmY := mentionsY - 14.0
+	writeMention := func(field, text string) {
+		for _, line := range layout.wrap(text, pageWidth-2*margin, 8.0) {
+			if cmY-3 < footerTop {
+				layout.warnings = append(layout.warnings, LayoutWarning{Field: field, Text: line})
+				continue
+			}
+			writeTextColored(&content, layout.font, line, margin, cmY, 8.0, grayR, grayG, grayB)
+			cmY -= 11.0
+		}
+	}
+	writeMention("VatRegime", vatText)
+	cmY -= 3.0
+	for _, note := range legalNotes(req) {
+		// The company mentions are printed in the footer
+		if note.subjectCode == noteSubjectLegal {
+			continue
+		}
+		writeMention("LegalNotes", note.text)
+	}
+	if !req.DueDate.IsZero() {
+		writeMention("DueDate", fmt.Sprintf("Date d'échéance : %s", formatDisplayDate(req.DueDate)))
+	}
+	// Paid invoices show their payment method in the badge
+	if req.DirectDebit != nil {
+		writeMention("DirectDebit", directDebitText(req))
+	} else if label := req.PaymentMeans.Label(); label != "" && req.Payment == nil {
+		writeMention("PaymentMeans", "Mode de paiement : "+label)
+	}
+	if !req.DeliveryDate.IsZero() {
+		writeMention("DeliveryDate", fmt.Sprintf("Date de livraison : %s", formatDisplayDate(req.DeliveryDate)))
+	}
 
 	if req.CustomMentions != "" {
-		cmY := mentionsY - 28.0
 		for _, line := range strings.Split(req.CustomMentions, "\n") {
-			writeTextColored(&content, line, margin, cmY, 8.0, grayR, grayG, grayB)
-			cmY -= 11.0
+			writeMention("CustomMentions", line)
 		}
 	}
 
 	// ========================================================================
 	// Footer
 	// ========================================================================
-	fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", lightBgR, lightBgG, lightBgB)
-	fmt.Fprintf(&content, "0 0 %.2f 35 re f\n", pageWidth)
-	writeTextColored(&content, "Document genere conformement a la norme Factur-X 1.0 (Profil BASIC)", margin, 14, 7.0, grayR, grayG, grayB)
+	if len(footerLines) > 0 {
+		fmt.Fprintf(&content, "%.3f %.3f %.3f rg\n", lightBgR, lightBgG, lightBgB)
+		fmt.Fprintf(&content, "0 0 %.2f %.2f re f\n", pageWidth, footerTop)
+		for i, line := range footerLines {
+			writeFit(footerFields[i], line, margin, 14+footerExtra-9.0*float64(i), pageWidth-2*margin, 7.0, grayR, grayG, grayB)
+		}
+	}
 
 	// End graphics state
 	content.WriteString("Q\n")
@@ -656,141 +1082,166 @@ func generatePageContent(req *InvoiceRequest, lineTotal, taxTotal, grandTotal, v
 	return content.Bytes()
 }
 
+// documentReferences returns the references printed above the line table.
+func documentReferences(req *InvoiceRequest) []string {
+	var refs []string
+	if req.OrderRef != "" {
+		refs = append(refs, fmt.Sprintf("Commande N° %s", req.OrderRef))
+	}
+	if req.PrecedingInvoice != nil {
+		label := "Facture précédente"
+		if req.Type == TypeCorrective {
+			label = "Rectifie la facture"
+		}
+		ref := fmt.Sprintf("%s N° %s", label, req.PrecedingInvoice.Number)
+		if !req.PrecedingInvoice.Date.IsZero() {
+			ref += fmt.Sprintf(" du %s", formatDisplayDate(req.PrecedingInvoice.Date))
+		}
+		refs = append(refs, ref)
+	}
+	if req.DespatchAdviceRef != "" {
+		refs = append(refs, fmt.Sprintf("Bon de livraison N° %s", req.DespatchAdviceRef))
+	}
+	return refs
+}
+
+// directDebitText returns the SEPA direct debit mention, with the debited
+// account masked but for its country code and last four characters.
+func directDebitText(req *InvoiceRequest) string {
+	dd := req.DirectDebit
+	iban := compactIBAN(dd.DebtorIBAN)
+	if len(iban) > 8 {
+		iban = iban[:4] + " **** " + iban[len(iban)-4:]
+	}
+	when := "à l'échéance"
+	switch {
+	case len(req.Installments) > 0:
+		when = "à chaque échéance"
+	case !req.DueDate.IsZero():
+		when = "le " + formatDisplayDate(req.DueDate)
+	}
+	return fmt.Sprintf("Prélèvement SEPA %s sur le compte %s - Mandat n° %s - ICS %s",
+		when, iban, strings.TrimSpace(dd.MandateID), strings.TrimSpace(dd.CreditorID))
+}
+
+// legalIDText returns the legal identifier line printed under a party,
+// falling back to the VAT number for parties established outside France.
+func legalIDText(c *Contact) string {
+	switch {
+	case c.Siret != "":
+		return "SIRET: " + c.Siret
+	case c.Siren != "":
+		return "SIREN: " + c.Siren
+	case strings.TrimSpace(c.RCS) != "":
+		return strings.TrimSpace(c.RCS)
+	case c.VatNumber != "" && !c.isFrench():
+		return "TVA: " + c.VatNumber
+	default:
+		return ""
+	}
+}
+
+// lineDetails returns the small detail rows printed under a line description.
+func lineDetails(line *InvoiceLine, loc Locale) []string {
+	var details []string
+
+	// Catalogue price / discount / net price
+	if line.GrossPrice > 0 {
+		details = append(details, fmt.Sprintf("Prix catalogue %s / remise %s / prix net %s",
+			loc.money(toAmount(line.GrossPrice)), loc.money(toAmount(line.GrossPrice-line.UnitPrice)), loc.money(toAmount(line.UnitPrice))))
+	}
+
+	// Mandatory eco-participation mention
+	if line.EcoContribution != 0 {
+		details = append(details, fmt.Sprintf("Dont éco-participation DEEE : %s HT", loc.money(toAmount(line.EcoContribution))))
+	}
+
+	// Billing period
+	switch {
+	case !line.PeriodStart.IsZero() && !line.PeriodEnd.IsZero():
+		details = append(details, fmt.Sprintf("Période du %s au %s", formatDisplayDate(line.PeriodStart), formatDisplayDate(line.PeriodEnd)))
+	case !line.PeriodStart.IsZero():
+		details = append(details, fmt.Sprintf("Période à partir du %s", formatDisplayDate(line.PeriodStart)))
+	case !line.PeriodEnd.IsZero():
+		details = append(details, fmt.Sprintf("Période jusqu'au %s", formatDisplayDate(line.PeriodEnd)))
+	}
+
+	return details
+}
+
 // writeTextColored writes text at position with specified RGB color (0-1 range).
-func writeTextColored(content *bytes.Buffer, text string, x, y, size, r, g, b float64) {
-	encoded := encodeWinAnsi(text)
+func writeTextColored(content *bytes.Buffer, font FontProvider, text string, x, y, size, r, g, b float64) {
+	encoded := escapeWinAnsi(font.Encode(text))
 	content.WriteString("BT\n")
 	fmt.Fprintf(content, "%.3f %.3f %.3f rg\n", r, g, b)
-	fmt.Fprintf(content, "/F1 %.0f Tf\n", size)
+	// Shrunk text keeps its fractional size: "/F1 8.75 Tf"
+	fmt.Fprintf(content, "/F1 %s Tf\n", strconv.FormatFloat(math.Round(size*100)/100, 'f', -1, 64))
 	fmt.Fprintf(content, "%.2f %.2f Td\n", x, y)
 	fmt.Fprintf(content, "(%s) Tj\n", encoded)
 	content.WriteString("ET\n")
 }
 
-// encodeWinAnsi encodes text to WinAnsiEncoding and escapes for PDF string.
-// Uses octal escapes for non-ASCII characters.
-func encodeWinAnsi(s string) string {
-	var result strings.Builder
-	result.Grow(len(s) * 2)
+// winAnsiCodes maps the characters of WinAnsi codes 0x80-0x9F to their
+// code.
+var winAnsiCodes = func() map[rune]byte {
+	codes := make(map[rune]byte)
+	for i, r := range winAnsiHigh {
+		if r != 0 {
+			codes[r] = byte(0x80 + i)
+		}
+	}
+	return codes
+}()
+
+// EncodeWinAnsi converts text to WinAnsiEncoding, as FontProvider.Encode
+// does for TrueType fonts. Characters absent from WinAnsi, or without a
+// glyph in metrics, become '?'; the narrow no-break space of French
+// amounts becomes a no-break space. metrics may be nil to skip the glyph
+// check.
+func EncodeWinAnsi(text string, metrics *FontMetrics) []byte {
+	out := make([]byte, 0, len(text))
+	for _, c := range text {
+		if c == '\n' || c == '\r' || c == '\t' || (c >= 32 && c < 127) {
+			out = append(out, byte(c))
+			continue
+		}
+		if c == '\u202F' {
+			c = '\u00A0'
+		}
+		code, ok := winAnsiCodes[c]
+		if !ok && c >= 0xA0 && c <= 0xFF {
+			// Latin-1 supplement maps 1:1 to WinAnsi
+			code, ok = byte(c), true
+		}
+		if !ok || (metrics != nil && c != '\u00A0' && !metrics.hasGlyph(c)) {
+			code = '?'
+		}
+		out = append(out, code)
+	}
+	return out
+}
 
-	for _, c := range s {
+// escapeWinAnsi escapes encoded text for a PDF string, with octal escapes
+// for the bytes outside ASCII.
+func escapeWinAnsi(encoded []byte) string {
+	var result strings.Builder
+	result.Grow(len(encoded) * 2)
+	for _, c := range encoded {
 		switch c {
-		case '(':
-			result.WriteString("\\(")
-		case ')':
-			result.WriteString("\\)")
-		case '\\':
-			result.WriteString("\\\\")
+		case '(', ')', '\\':
+			result.WriteByte('\\')
+			result.WriteByte(c)
 		case '\n':
 			result.WriteString("\\n")
 		case '\r':
 			result.WriteString("\\r")
 		case '\t':
 			result.WriteString("\\t")
-		// Map common Unicode to WinAnsi using octal escapes
-		case 'é':
-			result.WriteString("\\351")
-		case 'è':
-			result.WriteString("\\350")
-		case 'ê':
-			result.WriteString("\\352")
-		case 'ë':
-			result.WriteString("\\353")
-		case 'à':
-			result.WriteString("\\340")
-		case 'â':
-			result.WriteString("\\342")
-		case 'ä':
-			result.WriteString("\\344")
-		case 'ù':
-			result.WriteString("\\371")
-		case 'û':
-			result.WriteString("\\373")
-		case 'ü':
-			result.WriteString("\\374")
-		case 'ô':
-			result.WriteString("\\364")
-		case 'ö':
-			result.WriteString("\\366")
-		case 'î':
-			result.WriteString("\\356")
-		case 'ï':
-			result.WriteString("\\357")
-		case 'ç':
-			result.WriteString("\\347")
-		case 'œ':
-			result.WriteString("\\234")
-		case 'Œ':
-			result.WriteString("\\214")
-		case 'æ':
-			result.WriteString("\\346")
-		case 'Æ':
-			result.WriteString("\\306")
-		case '€':
-			result.WriteString("\\200")
-		case '°':
-			result.WriteString("\\260")
-		case '²':
-			result.WriteString("\\262")
-		case '³':
-			result.WriteString("\\263")
-		// Typographic quotes and punctuation
-		case '\u2018': // Left single quote
-			result.WriteString("\\221")
-		case '\u2019': // Right single quote / apostrophe
-			result.WriteString("\\222")
-		case '\u201C': // Left double quote
-			result.WriteString("\\223")
-		case '\u201D': // Right double quote
-			result.WriteString("\\224")
-		case '\u2013': // En dash
-			result.WriteString("\\226")
-		case '\u2014': // Em dash
-			result.WriteString("\\227")
-		case '\u2026': // Ellipsis
-			result.WriteString("\\205")
-		case '\u2030': // Per mille
-			result.WriteString("\\211")
-		case '\u00AB': // Left guillemet «
-			result.WriteString("\\253")
-		case '\u00BB': // Right guillemet »
-			result.WriteString("\\273")
-		case 'É':
-			result.WriteString("\\311")
-		case 'È':
-			result.WriteString("\\310")
-		case 'Ê':
-			result.WriteString("\\312")
-		case 'Ë':
-			result.WriteString("\\313")
-		case 'À':
-			result.WriteString("\\300")
-		case 'Â':
-			result.WriteString("\\302")
-		case 'Ä':
-			result.WriteString("\\304")
-		case 'Ç':
-			result.WriteString("\\307")
-		case 'Ô':
-			result.WriteString("\\324")
-		case 'Ö':
-			result.WriteString("\\326")
-		case 'Ù':
-			result.WriteString("\\331")
-		case 'Û':
-			result.WriteString("\\333")
-		case 'Ü':
-			result.WriteString("\\334")
-		case 'Î':
-			result.WriteString("\\316")
-		case 'Ï':
-			result.WriteString("\\317")
 		default:
 			if c >= 32 && c < 127 {
-				result.WriteRune(c)
+				result.WriteByte(c)
 			} else {
-				// Other characters: replace with ?
-				result.WriteByte('?')
+				fmt.Fprintf(&result, "\\%03o", c)
 			}
 		}
 	}
@@ -0,0 +1,294 @@
+package facturx
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// PDFAIssue is a PDF/A-3 requirement a document fails, as reported by
+// CheckPDFA.
+type PDFAIssue struct {
+	// Rule is the area of the requirement: "header", "trailer",
+	// "metadata", "output intent", "fonts", "streams", "actions",
+	// "annotations", "forms" or "embedded files".
+	Rule string `json:"rule"`
+	// Object is the number of the offending object, 0 for the document.
+	Object int `json:"object,omitempty"`
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+func (i PDFAIssue) String() string {
+	if i.Object != 0 {
+		return fmt.Sprintf("%s (object %d): %s", i.Rule, i.Object, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.Rule, i.Message)
+}
+
+// CheckPDFA checks the main PDF/A-3 requirements on a document: file
+// header and identifier, XMP metadata declaring PDF/A-3, an output intent
+// with its ICC profile, embedded fonts, attachment relationships, and the
+// absence of forbidden features (JavaScript and other actions, external
+// streams, LZW compression, hidden or unprintable annotations, XFA forms).
+//
+// It is a quick self-check, not a full validator such as veraPDF: passing
+// it does not prove conformance. It returns an error wrapping ErrPDF if
+// the document cannot be read, which includes encrypted documents.
+func CheckPDFA(pdf []byte) ([]PDFAIssue, error) {
+	doc, err := readPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	catalog, _, err := doc.catalog()
+	if err != nil {
+		return nil, err
+	}
+	c := &pdfaChecker{doc: doc}
+
+	// The header comment marks the file as binary
+	if !hasBinaryComment(pdf) {
+		c.report("header", 0, "file header must be %PDF-1.n followed by a binary comment")
+	}
+	if ids, ok := doc.trailer["ID"].(pdfArray); !ok || len(ids) != 2 {
+		c.report("trailer", 0, "trailer must have a file identifier (/ID)")
+	}
+
+	c.checkMetadata(catalog)
+	c.checkOutputIntents(catalog)
+	if form, _ := doc.resolve(catalog["AcroForm"]); form != nil {
+		formDict, _ := form.(pdfDict)
+		if formDict["NeedAppearances"] == true || formDict["XFA"] != nil {
+			c.report("forms", 0, "interactive forms cannot use NeedAppearances or XFA")
+		}
+	}
+	c.checkEmbeddedFiles(catalog)
+
+	for _, num := range doc.objectNumbers() {
+		v, err := doc.object(num)
+		if err != nil {
+			return nil, err
+		}
+		c.checkObject(num, v)
+	}
+	sort.SliceStable(c.issues, func(i, j int) bool { return c.issues[i].Object < c.issues[j].Object })
+	return c.issues, nil
+}
+
+// hasBinaryComment reports whether the %PDF-1.n header line is followed by
+// a comment of at least four bytes above 127.
+func hasBinaryComment(pdf []byte) bool {
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.")) {
+		return false
+	}
+	eol := bytes.IndexAny(pdf, "\r\n")
+	if eol < 0 {
+		return false
+	}
+	rest := bytes.TrimLeft(pdf[eol:], "\r\n")
+	if len(rest) < 5 || rest[0] != '%' {
+		return false
+	}
+	for _, c := range rest[1:5] {
+		if c < 128 {
+			return false
+		}
+	}
+	return true
+}
+
+// pdfaForbiddenActions are the action types PDF/A forbids.
+var pdfaForbiddenActions = map[pdfName]bool{
+	"JavaScript": true, "Launch": true, "Sound": true, "Movie": true,
+	"ResetForm": true, "ImportData": true, "Hide": true, "SetOCGState": true,
+	"Rendition": true, "Trans": true, "GoTo3DView": true,
+}
+
+// pdfaForbiddenAnnotations are the annotation types PDF/A forbids.
+var pdfaForbiddenAnnotations = map[pdfName]bool{
+	"3D": true, "Sound": true, "Screen": true, "Movie": true,
+}
+
+// pdfaChecker collects the issues found in a document.
+type pdfaChecker struct {
+	doc    *pdfDocument
+	issues []PDFAIssue
+}
+
+func (c *pdfaChecker) report(rule string, object int, message string) {
+	c.issues = append(c.issues, PDFAIssue{Rule: rule, Object: object, Message: message})
+}
+
+// checkMetadata checks the XMP metadata stream and its PDF/A
+// identification.
+func (c *pdfaChecker) checkMetadata(catalog pdfDict) {
+	ref, _ := catalog["Metadata"].(pdfRef)
+	v, _ := c.doc.resolve(catalog["Metadata"])
+	stream, ok := v.(*pdfStream)
+	if !ok {
+		c.report("metadata", 0, "catalog has no XMP metadata stream")
+		return
+	}
+	if stream.dict["Filter"] != nil {
+		c.report("metadata", ref.num, "XMP metadata stream must not be filtered")
+		return
+	}
+	if m := xmpPart.FindSubmatch(stream.data); m == nil || string(m[1]) != "3" {
+		c.report("metadata", ref.num, "XMP metadata does not declare PDF/A-3 (pdfaid:part)")
+	}
+	if !xmpConformance.Match(stream.data) {
+		c.report("metadata", ref.num, "XMP metadata has no valid pdfaid:conformance")
+	}
+}
+
+// PDF/A identification, as an element or an attribute.
+var (
+	xmpPart        = regexp.MustCompile(`pdfaid:part(?:>|=["'])\s*(\d)`)
+	xmpConformance = regexp.MustCompile(`pdfaid:conformance(?:>|=["'])\s*[ABU]\b`)
+)
+
+// checkOutputIntents checks for a PDF/A output intent with its profile.
+func (c *pdfaChecker) checkOutputIntents(catalog pdfDict) {
+	v, _ := c.doc.resolve(catalog["OutputIntents"])
+	intents, _ := v.(pdfArray)
+	for _, intent := range intents {
+		iv, _ := c.doc.resolve(intent)
+		dict, _ := iv.(pdfDict)
+		if dict["S"] != pdfName("GTS_PDFA1") {
+			continue
+		}
+		profile, _ := c.doc.resolve(dict["DestOutputProfile"])
+		if _, ok := profile.(*pdfStream); ok {
+			return
+		}
+	}
+	c.report("output intent", 0, "catalog has no PDF/A output intent with an ICC profile")
+}
+
+// checkEmbeddedFiles checks the file specifications of the attachments.
+func (c *pdfaChecker) checkEmbeddedFiles(catalog pdfDict) {
+	names, _ := c.doc.resolve(catalog["Names"])
+	namesDict, _ := names.(pdfDict)
+	tree, _ := c.doc.resolve(namesDict["EmbeddedFiles"])
+	treeDict, _ := tree.(pdfDict)
+	files := make(map[string]pdfValue)
+	if err := c.doc.collectNameTree(treeDict, files, 0); err != nil {
+		return
+	}
+	for _, spec := range files {
+		ref, _ := spec.(pdfRef)
+		v, _ := c.doc.resolve(spec)
+		dict, _ := v.(pdfDict)
+		if dict["F"] == nil || dict["UF"] == nil || dict["AFRelationship"] == nil {
+			c.report("embedded files", ref.num, "file specification needs /F, /UF and /AFRelationship")
+		}
+		ef, _ := c.doc.resolve(dict["EF"])
+		efDict, _ := ef.(pdfDict)
+		file, _ := c.doc.resolve(efDict["F"])
+		if stream, ok := file.(*pdfStream); !ok || stream.dict["Subtype"] == nil {
+			c.report("embedded files", ref.num, "embedded file has no MIME type (/Subtype)")
+		}
+	}
+}
+
+// checkObject checks an object and the dictionaries nested in it.
+func (c *pdfaChecker) checkObject(num int, v pdfValue) {
+	switch v := v.(type) {
+	case *pdfStream:
+		if v.dict["F"] != nil || v.dict["FFilter"] != nil {
+			c.report("streams", num, "streams cannot reference external files")
+		}
+		filters, _ := v.dict["Filter"].(pdfArray)
+		if f, ok := v.dict["Filter"].(pdfName); ok {
+			filters = pdfArray{f}
+		}
+		for _, f := range filters {
+			if f == pdfName("LZWDecode") {
+				c.report("streams", num, "LZW compression is forbidden")
+			}
+		}
+		c.checkObject(num, v.dict)
+	case pdfArray:
+		for _, item := range v {
+			c.checkObject(num, item)
+		}
+	case pdfDict:
+		c.checkDict(num, v)
+		for _, item := range v {
+			c.checkObject(num, item)
+		}
+	}
+}
+
+// checkDict checks a dictionary by its type.
+func (c *pdfaChecker) checkDict(num int, d pdfDict) {
+	if d["AA"] != nil {
+		c.report("actions", num, "additional actions (/AA) are forbidden")
+	}
+	if s, ok := d["S"].(pdfName); ok && pdfaForbiddenActions[s] {
+		c.report("actions", num, fmt.Sprintf("%s actions are forbidden", s))
+	} else if d["JS"] != nil {
+		c.report("actions", num, "JavaScript is forbidden")
+	}
+
+	switch d["Type"] {
+	case pdfName("Font"):
+		c.checkFont(num, d)
+	case pdfName("Page"):
+		annots, _ := c.doc.resolve(d["Annots"])
+		list, _ := annots.(pdfArray)
+		for _, a := range list {
+			annotNum := num
+			if ref, ok := a.(pdfRef); ok {
+				annotNum = ref.num
+			}
+			av, _ := c.doc.resolve(a)
+			if annot, ok := av.(pdfDict); ok {
+				c.checkAnnotation(annotNum, annot)
+			}
+		}
+	}
+}
+
+// checkFont checks that a font embeds its program.
+func (c *pdfaChecker) checkFont(num int, font pdfDict) {
+	switch font["Subtype"] {
+	case pdfName("Type3"):
+		return // glyphs are content streams
+	case pdfName("Type0"):
+		return // checked on its descendant CIDFont
+	}
+	v, _ := c.doc.resolve(font["FontDescriptor"])
+	descriptor, _ := v.(pdfDict)
+	if descriptor["FontFile"] == nil && descriptor["FontFile2"] == nil && descriptor["FontFile3"] == nil {
+		c.report("fonts", num, "font program is not embedded")
+	}
+}
+
+// Annotation flags (ISO 32000-1, 12.5.3).
+const (
+	annotInvisible = 1 << 0
+	annotHidden    = 1 << 1
+	annotPrint     = 1 << 2
+	annotNoView    = 1 << 5
+)
+
+// checkAnnotation checks the type, flags and appearance of an annotation.
+func (c *pdfaChecker) checkAnnotation(num int, annot pdfDict) {
+	subtype, _ := annot["Subtype"].(pdfName)
+	if pdfaForbiddenAnnotations[subtype] {
+		c.report("annotations", num, fmt.Sprintf("%s annotations are forbidden", subtype))
+		return
+	}
+	if subtype == "Popup" {
+		return
+	}
+	flags, _ := annot["F"].(int)
+	if flags&annotPrint == 0 || flags&(annotInvisible|annotHidden|annotNoView) != 0 {
+		c.report("annotations", num, "annotation must be printable and visible")
+	}
+	if subtype != "Link" && annot["AP"] == nil {
+		c.report("annotations", num, "annotation has no appearance stream")
+	}
+}
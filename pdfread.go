@@ -0,0 +1,870 @@
+package facturx
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ============================================================================
+// Minimal PDF reader
+// ============================================================================
+//
+// Just enough of ISO 32000 to load an existing document's objects: classic
+// cross-reference tables, cross-reference streams and object streams (Flate
+// only). Encrypted documents are rejected.
+
+// PDF object model.
+type (
+	pdfName   string
+	pdfString []byte
+	pdfArray  []pdfValue
+	pdfDict   map[string]pdfValue
+	pdfRef    struct{ num, gen int }
+	pdfValue  interface{}
+)
+
+// pdfStream is a stream object: its dictionary and raw (still encoded) data.
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// xrefEntry locates an object: at a byte offset, or inside an object stream.
+type xrefEntry struct {
+	offset     int
+	gen        int
+	free       bool
+	compressed bool
+	stream     int // object stream number, when compressed
+	index      int // index within the object stream, when compressed
+}
+
+// pdfDocument is a parsed PDF file.
+type pdfDocument struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer pdfDict
+	version string
+	// startxref is the offset of the last cross-reference section.
+	startxref int
+
+	objStms map[int]*objStm // decoded object streams, by object number
+}
+
+// objStm is a decoded object stream.
+type objStm struct {
+	data    []byte
+	offsets []int
+}
+
+func pdfErrorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrPDF}, args...)...)
+}
+
+// readPDF parses the cross-reference sections and trailer of a PDF file.
+func readPDF(data []byte) (*pdfDocument, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, pdfErrorf("missing %%PDF header")
+	}
+	doc := &pdfDocument{
+		data:    data,
+		xref:    make(map[int]xrefEntry),
+		objStms: make(map[int]*objStm),
+	}
+	if eol := bytes.IndexAny(data, "\r\n"); eol > 5 {
+		doc.version = string(bytes.TrimSpace(data[5:eol]))
+	}
+
+	idx := bytes.LastIndex(data, []byte("startxref"))
+	if idx < 0 {
+		return nil, pdfErrorf("startxref not found")
+	}
+	p := newPDFParser(data, idx+len("startxref"))
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	offset, ok := v.(int)
+	if !ok {
+		return nil, pdfErrorf("invalid startxref value")
+	}
+	doc.startxref = offset
+
+	seen := make(map[int]bool)
+	for offset > 0 && !seen[offset] {
+		seen[offset] = true
+		trailer, err := doc.readXrefSection(offset)
+		if err != nil {
+			return nil, err
+		}
+		if doc.trailer == nil {
+			doc.trailer = trailer
+		}
+		// Hybrid-reference files keep their compressed entries in /XRefStm
+		if stm, ok := trailer["XRefStm"].(int); ok && !seen[stm] {
+			seen[stm] = true
+			if _, err := doc.readXrefSection(stm); err != nil {
+				return nil, err
+			}
+		}
+		prev, _ := trailer["Prev"].(int)
+		offset = prev
+	}
+
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, pdfErrorf("encrypted documents are not supported")
+	}
+	if _, ok := doc.trailer["Root"].(pdfRef); !ok {
+		return nil, pdfErrorf("trailer has no /Root")
+	}
+	return doc, nil
+}
+
+// readXrefSection reads one cross-reference section (table or stream) and
+// returns its trailer dictionary. Entries already known from a newer
+// section are kept.
+func (doc *pdfDocument) readXrefSection(offset int) (pdfDict, error) {
+	if offset < 0 || offset >= len(doc.data) {
+		return nil, pdfErrorf("xref offset %d out of range", offset)
+	}
+	p := newPDFParser(doc.data, offset)
+	p.skipSpace()
+	if p.consumeKeyword("xref") {
+		return doc.readXrefTable(p)
+	}
+
+	_, stream, err := doc.parseIndirectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := stream.(*pdfStream)
+	if !ok || s.dict["Type"] != pdfName("XRef") {
+		return nil, pdfErrorf("no cross-reference at offset %d", offset)
+	}
+	return s.dict, doc.readXrefStream(s)
+}
+
+func (doc *pdfDocument) readXrefTable(p *pdfParser) (pdfDict, error) {
+	for {
+		p.skipSpace()
+		if p.consumeKeyword("trailer") {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := v.(pdfDict)
+			if !ok {
+				return nil, pdfErrorf("invalid trailer")
+			}
+			return trailer, nil
+		}
+		startV, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		countV, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		start, ok1 := startV.(int)
+		count, ok2 := countV.(int)
+		if !ok1 || !ok2 || start < 0 || count < 0 {
+			return nil, pdfErrorf("invalid xref subsection header")
+		}
+		for i := 0; i < count; i++ {
+			offV, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			genV, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			kind := p.next()
+			off, _ := offV.(int)
+			gen, _ := genV.(int)
+			if _, known := doc.xref[start+i]; known {
+				continue
+			}
+			doc.xref[start+i] = xrefEntry{offset: off, gen: gen, free: kind != 'n'}
+		}
+	}
+}
+
+func (doc *pdfDocument) readXrefStream(s *pdfStream) error {
+	data, err := decodeStream(s)
+	if err != nil {
+		return err
+	}
+	w, ok := s.dict["W"].(pdfArray)
+	if !ok || len(w) != 3 {
+		return pdfErrorf("invalid /W in xref stream")
+	}
+	var widths [3]int
+	rowLen := 0
+	for i := range widths {
+		widths[i], _ = w[i].(int)
+		rowLen += widths[i]
+	}
+	if rowLen == 0 {
+		return pdfErrorf("invalid /W in xref stream")
+	}
+
+	size, _ := s.dict["Size"].(int)
+	index := pdfArray{0, size}
+	if idx, ok := s.dict["Index"].(pdfArray); ok {
+		index = idx
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int)
+		count, _ := index[i+1].(int)
+		for n := 0; n < count; n++ {
+			if pos+rowLen > len(data) {
+				return pdfErrorf("truncated xref stream")
+			}
+			var fields [3]int
+			for f := 0; f < 3; f++ {
+				for b := 0; b < widths[f]; b++ {
+					fields[f] = fields[f]<<8 | int(data[pos])
+					pos++
+				}
+			}
+			if widths[0] == 0 {
+				fields[0] = 1 // default type
+			}
+			num := start + n
+			if _, known := doc.xref[num]; known {
+				continue
+			}
+			switch fields[0] {
+			case 0:
+				doc.xref[num] = xrefEntry{free: true}
+			case 1:
+				doc.xref[num] = xrefEntry{offset: fields[1], gen: fields[2]}
+			case 2:
+				doc.xref[num] = xrefEntry{compressed: true, stream: fields[1], index: fields[2]}
+			}
+		}
+	}
+	return nil
+}
+
+// objectNumbers returns the numbers of all objects in use, sorted.
+func (doc *pdfDocument) objectNumbers() []int {
+	nums := make([]int, 0, len(doc.xref))
+	for num, entry := range doc.xref {
+		if num > 0 && !entry.free {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// object returns the value of an indirect object (nil if it doesn't exist).
+func (doc *pdfDocument) object(num int) (pdfValue, error) {
+	entry, ok := doc.xref[num]
+	if !ok || entry.free {
+		return nil, nil
+	}
+	if !entry.compressed {
+		gotNum, v, err := doc.parseIndirectAt(entry.offset)
+		if err != nil {
+			return nil, err
+		}
+		if gotNum != num {
+			return nil, pdfErrorf("xref entry for object %d points to object %d", num, gotNum)
+		}
+		return v, nil
+	}
+
+	// Object streams cannot themselves be compressed, which also rules out
+	// a stream containing itself
+	if container := doc.xref[entry.stream]; container.compressed {
+		return nil, pdfErrorf("object stream %d is inside another object stream", entry.stream)
+	}
+	stm, err := doc.objectStream(entry.stream)
+	if err != nil {
+		return nil, err
+	}
+	if entry.index < 0 || entry.index >= len(stm.offsets) {
+		return nil, pdfErrorf("object %d: index out of range in object stream %d", num, entry.stream)
+	}
+	return newPDFParser(stm.data, stm.offsets[entry.index]).parseValue()
+}
+
+// resolve follows a reference to its target value; other values are returned as is.
+func (doc *pdfDocument) resolve(v pdfValue) (pdfValue, error) {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v, nil
+		}
+		var err error
+		if v, err = doc.object(ref.num); err != nil {
+			return nil, err
+		}
+	}
+	return nil, pdfErrorf("reference loop")
+}
+
+// catalog returns the document catalog and its object number.
+func (doc *pdfDocument) catalog() (pdfDict, int, error) {
+	root := doc.trailer["Root"].(pdfRef)
+	v, err := doc.object(root.num)
+	if err != nil {
+		return nil, 0, err
+	}
+	cat, ok := v.(pdfDict)
+	if !ok {
+		return nil, 0, pdfErrorf("document catalog is not a dictionary")
+	}
+	return cat, root.num, nil
+}
+
+func (doc *pdfDocument) objectStream(num int) (*objStm, error) {
+	if stm, ok := doc.objStms[num]; ok {
+		return stm, nil
+	}
+	v, err := doc.object(num)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(*pdfStream)
+	if !ok {
+		return nil, pdfErrorf("object %d is not an object stream", num)
+	}
+	data, err := decodeStream(s)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := s.dict["N"].(int)
+	first, _ := s.dict["First"].(int)
+	if n < 0 || n > len(data) || first < 0 || first > len(data) {
+		return nil, pdfErrorf("object stream %d: invalid /N or /First", num)
+	}
+	p := newPDFParser(data, 0)
+	offsets := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := p.parseValue(); err != nil {
+			return nil, err
+		}
+		offV, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		off, ok := offV.(int)
+		if !ok || off < 0 {
+			return nil, pdfErrorf("object stream %d: invalid offset", num)
+		}
+		offsets = append(offsets, first+off)
+	}
+	stm := &objStm{data: data, offsets: offsets}
+	doc.objStms[num] = stm
+	return stm, nil
+}
+
+// parseIndirectAt parses "num gen obj ... endobj" at the given offset.
+func (doc *pdfDocument) parseIndirectAt(offset int) (int, pdfValue, error) {
+	if offset < 0 || offset >= len(doc.data) {
+		return 0, nil, pdfErrorf("offset %d out of range", offset)
+	}
+	p := newPDFParser(doc.data, offset)
+	numV, err := p.parseValue()
+	if err != nil {
+		return 0, nil, err
+	}
+	num, ok := numV.(int)
+	if !ok {
+		return 0, nil, pdfErrorf("expected object number at offset %d", offset)
+	}
+	if _, err := p.parseValue(); err != nil {
+		return 0, nil, err
+	}
+	p.skipSpace()
+	if !p.consumeKeyword("obj") {
+		return 0, nil, pdfErrorf("expected obj keyword at offset %d", offset)
+	}
+	v, err := p.parseValue()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dict, isDict := v.(pdfDict)
+	p.skipSpace()
+	if !isDict || !p.consumeKeyword("stream") {
+		return num, v, nil
+	}
+
+	// Stream data starts after the EOL following the keyword
+	if p.peek() == '\r' {
+		p.pos++
+	}
+	if p.peek() == '\n' {
+		p.pos++
+	}
+	start := p.pos
+
+	length := -1
+	if l, err := doc.resolve(dict["Length"]); err == nil {
+		if n, ok := l.(int); ok {
+			length = n
+		}
+	}
+	end := start + length
+	if length < 0 || end > len(doc.data) || !bytes.HasPrefix(bytes.TrimLeft(doc.data[end:], "\r\n "), []byte("endstream")) {
+		// Missing or wrong /Length: fall back to the endstream keyword
+		rel := bytes.Index(doc.data[start:], []byte("endstream"))
+		if rel < 0 {
+			return 0, nil, pdfErrorf("unterminated stream in object %d", num)
+		}
+		end = start + rel
+		for end > start && (doc.data[end-1] == '\n' || doc.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return num, &pdfStream{dict: dict, data: doc.data[start:end]}, nil
+}
+
+// decodeStream returns the decoded data of a stream. Only FlateDecode
+// (with optional PNG predictors) is supported, which covers xref and
+// object streams in practice.
+func decodeStream(s *pdfStream) ([]byte, error) {
+	var filters pdfArray
+	switch f := s.dict["Filter"].(type) {
+	case nil:
+		return s.data, nil
+	case pdfName:
+		filters = pdfArray{f}
+	case pdfArray:
+		filters = f
+	}
+	if len(filters) != 1 || filters[0] != pdfName("FlateDecode") {
+		return nil, pdfErrorf("unsupported stream filter %v", s.dict["Filter"])
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(s.data))
+	if err != nil {
+		return nil, pdfErrorf("flate: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil && len(data) == 0 {
+		return nil, pdfErrorf("flate: %v", err)
+	}
+
+	parms, _ := s.dict["DecodeParms"].(pdfDict)
+	if predictor, _ := parms["Predictor"].(int); predictor >= 10 {
+		columns, ok := parms["Columns"].(int)
+		if !ok {
+			columns = 1
+		}
+		return unpredictPNG(data, columns)
+	}
+	return data, nil
+}
+
+// unpredictPNG reverses PNG row predictors (one filter byte per row).
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	rowLen := columns + 1
+	if len(data)%rowLen != 0 {
+		return nil, pdfErrorf("invalid predictor data length")
+	}
+	out := make([]byte, 0, len(data)/rowLen*columns)
+	prev := make([]byte, columns)
+	for r := 0; r < len(data); r += rowLen {
+		filter, row := data[r], data[r+1:r+rowLen]
+		cur := make([]byte, columns)
+		for i := 0; i < columns; i++ {
+			var left, upLeft byte
+			if i > 0 {
+				left, upLeft = cur[i-1], prev[i-1]
+			}
+			up := prev[i]
+			switch filter {
+			case 0:
+				cur[i] = row[i]
+			case 1:
+				cur[i] = row[i] + left
+			case 2:
+				cur[i] = row[i] + up
+			case 3:
+				cur[i] = row[i] + byte((int(left)+int(up))/2)
+			case 4:
+				cur[i] = row[i] + paeth(left, up, upLeft)
+			default:
+				return nil, pdfErrorf("unknown PNG predictor %d", filter)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ============================================================================
+// Object parser
+// ============================================================================
+
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+func newPDFParser(data []byte, pos int) *pdfParser {
+	return &pdfParser{data: data, pos: pos}
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (p *pdfParser) peek() byte {
+	if p.pos >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *pdfParser) next() byte {
+	c := p.peek()
+	p.pos++
+	return c
+}
+
+// skipSpace skips whitespace and comments.
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// consumeKeyword consumes kw if it is the next token.
+func (p *pdfParser) consumeKeyword(kw string) bool {
+	end := p.pos + len(kw)
+	if end > len(p.data) || string(p.data[p.pos:end]) != kw {
+		return false
+	}
+	if end < len(p.data) && !isPDFSpace(p.data[end]) && !isPDFDelimiter(p.data[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// regularToken reads a run of regular characters.
+func (p *pdfParser) regularToken() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isPDFSpace(p.data[p.pos]) && !isPDFDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// parseValue parses the next direct object. Integers followed by
+// "gen R" are returned as references.
+func (p *pdfParser) parseValue() (pdfValue, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, pdfErrorf("unexpected end of data")
+	}
+
+	switch c := p.data[p.pos]; c {
+	case '/':
+		p.pos++
+		return pdfName(decodeNameEscapes(p.regularToken())), nil
+	case '(':
+		return p.parseLiteralString()
+	case '<':
+		if p.pos+1 < len(p.data) && p.data[p.pos+1] == '<' {
+			return p.parseDict()
+		}
+		return p.parseHexString()
+	case '[':
+		p.pos++
+		var arr pdfArray
+		for {
+			p.skipSpace()
+			if p.peek() == ']' {
+				p.pos++
+				return arr, nil
+			}
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	}
+
+	start := p.pos
+	tok := p.regularToken()
+	switch tok {
+	case "":
+		return nil, pdfErrorf("unexpected character %q at offset %d", p.data[p.pos], p.pos)
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if n, err := strconv.Atoi(tok); err == nil {
+		// Look ahead for "gen R"
+		save := p.pos
+		p.skipSpace()
+		if gen, err := strconv.Atoi(p.regularToken()); err == nil && p.pos > save {
+			p.skipSpace()
+			if p.consumeKeyword("R") {
+				return pdfRef{num: n, gen: gen}, nil
+			}
+		}
+		p.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f, nil
+	}
+	return nil, pdfErrorf("unexpected token %q at offset %d", tok, start)
+}
+
+func (p *pdfParser) parseDict() (pdfValue, error) {
+	p.pos += 2
+	dict := make(pdfDict)
+	for {
+		p.skipSpace()
+		if p.peek() == '>' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '>' {
+			p.pos += 2
+			return dict, nil
+		}
+		k, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(pdfName)
+		if !ok {
+			return nil, pdfErrorf("dictionary key is not a name at offset %d", p.pos)
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		dict[string(key)] = v
+	}
+}
+
+func (p *pdfParser) parseLiteralString() (pdfValue, error) {
+	p.pos++ // (
+	var out []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.next()
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out), nil
+			}
+		case '\\':
+			e := p.next()
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.peek() == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.peek() >= '0' && p.peek() <= '7'; i++ {
+						v = v*8 + int(p.next()-'0')
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, pdfErrorf("unterminated string")
+}
+
+func (p *pdfParser) parseHexString() (pdfValue, error) {
+	p.pos++ // <
+	var digits []byte
+	for p.pos < len(p.data) {
+		c := p.next()
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			out := make([]byte, len(digits)/2)
+			for i := range out {
+				out[i] = unhex(digits[2*i])<<4 | unhex(digits[2*i+1])
+			}
+			return pdfString(out), nil
+		}
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	return nil, pdfErrorf("unterminated hex string")
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
+
+// decodeNameEscapes decodes #xx sequences in a name.
+func decodeNameEscapes(s string) string {
+	if !bytes.Contains([]byte(s), []byte("#")) {
+		return s
+	}
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			out = append(out, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// ============================================================================
+// Object serialization
+// ============================================================================
+
+// writePDFValue serializes a direct object. Dictionary keys are sorted so
+// output is deterministic.
+func writePDFValue(buf *bytes.Buffer, v pdfValue) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case pdfName:
+		buf.WriteByte('/')
+		for i := 0; i < len(v); i++ {
+			c := v[i]
+			if c < 0x21 || c > 0x7E || c == '#' || isPDFDelimiter(c) {
+				fmt.Fprintf(buf, "#%02X", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	case pdfString:
+		if isPrintableASCII(v) {
+			buf.WriteByte('(')
+			buf.WriteString(escapePDFString(string(v)))
+			buf.WriteByte(')')
+			return
+		}
+		buf.WriteByte('<')
+		buf.WriteString(hex.EncodeToString(v))
+		buf.WriteByte('>')
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", v.num, v.gen)
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFValue(buf, item)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			buf.WriteByte(' ')
+			writePDFValue(buf, pdfName(k))
+			buf.WriteByte(' ')
+			writePDFValue(buf, v[k])
+		}
+		buf.WriteString(" >>")
+	}
+}
+
+func isPrintableASCII(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
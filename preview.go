@@ -0,0 +1,205 @@
+package facturx
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerSubsystem("svg-preview")
+}
+
+// PreviewSVG renders the first page of the invoice as an SVG image, from
+// the same content stream as the PDF. It is meant for on-screen previews:
+// text uses the viewer's Liberation Sans (or Arial) instead of the embedded
+// font, so line breaks and widths may differ very slightly from the PDF.
+func PreviewSVG(req InvoiceRequest) ([]byte, error) {
+	req = normalizeDates(req)
+	if err := Validate(&req).Err(); err != nil {
+		return nil, err
+	}
+
+	font := requestFont(&req)
+	metrics, err := font.Metrics()
+	if err != nil {
+		return nil, err
+	}
+
+	calc := calculateInvoice(&req)
+	pageWidth, pageHeight, margin := a4Width, a4Height, req.Layout.margin()
+	content := generatePageContent(&req, &calc, vatMention(&req), &textLayout{font: font, metrics: metrics}, pageWidth, pageHeight, margin)
+	return contentToSVG(content, pageWidth, pageHeight)
+}
+
+// svgState is the graphics state tracked while converting a content stream.
+type svgState struct {
+	fill, stroke string
+	lineWidth    float64
+	fontSize     float64
+}
+
+// contentToSVG converts a page content stream to SVG. Only the operators
+// emitted by generatePageContent are supported: q Q rg RG w re f S m l
+// BT ET Tf Td Tj.
+func contentToSVG(content []byte, width, height float64) ([]byte, error) {
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%.2f" height="%.2f" viewBox="0 0 %.2f %.2f">`+"\n", width, height, width, height)
+	fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="#fff"/>`+"\n")
+	svg.WriteString(`<g font-family="Liberation Sans, Arial, Helvetica, sans-serif">` + "\n")
+
+	state := svgState{fill: "#000", stroke: "#000", lineWidth: 1}
+	var stack []svgState
+	var operands []pdfValue
+	var rects [][4]float64
+	var path []float64 // pairs of points of the current path
+	var textX, textY float64
+
+	num := func(i int) float64 {
+		switch v := operands[i].(type) {
+		case int:
+			return float64(v)
+		case float64:
+			return v
+		}
+		return 0
+	}
+	need := func(op string, n int) error {
+		if len(operands) < n {
+			return pdfErrorf("content stream: %s expects %d operands", op, n)
+		}
+		operands = operands[len(operands)-n:]
+		return nil
+	}
+
+	p := newPDFParser(content, 0)
+	for {
+		p.skipSpace()
+		if p.pos >= len(content) {
+			break
+		}
+		if c := p.peek(); c == '(' || c == '/' || c == '[' || c == '<' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			operands = append(operands, v)
+			continue
+		}
+
+		op := p.regularToken()
+		if op == "" {
+			return nil, pdfErrorf("content stream: unexpected character %q", p.peek())
+		}
+		var err error
+		switch op {
+		case "q":
+			stack = append(stack, state)
+		case "Q":
+			if len(stack) > 0 {
+				state, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+		case "rg", "RG":
+			if err = need(op, 3); err == nil {
+				color := fmt.Sprintf("#%02x%02x%02x", colorByte(num(0)), colorByte(num(1)), colorByte(num(2)))
+				if op == "rg" {
+					state.fill = color
+				} else {
+					state.stroke = color
+				}
+			}
+		case "w":
+			if err = need(op, 1); err == nil {
+				state.lineWidth = num(0)
+			}
+		case "re":
+			if err = need(op, 4); err == nil {
+				rects = append(rects, [4]float64{num(0), num(1), num(2), num(3)})
+			}
+		case "m", "l":
+			if err = need(op, 2); err == nil {
+				path = append(path, num(0), num(1))
+			}
+		case "f", "S":
+			for _, r := range rects {
+				x, y, w, h := r[0], height-r[1]-r[3], r[2], r[3]
+				if op == "f" {
+					fmt.Fprintf(&svg, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"/>`+"\n", x, y, w, h, state.fill)
+				} else {
+					fmt.Fprintf(&svg, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="none" stroke="%s" stroke-width="%.2f"/>`+"\n", x, y, w, h, state.stroke, state.lineWidth)
+				}
+			}
+			if op == "S" && len(path) >= 4 {
+				var points []string
+				for i := 0; i+1 < len(path); i += 2 {
+					points = append(points, fmt.Sprintf("%.2f,%.2f", path[i], height-path[i+1]))
+				}
+				fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%.2f"/>`+"\n", strings.Join(points, " "), state.stroke, state.lineWidth)
+			}
+			rects, path = nil, nil
+		case "BT":
+			textX, textY = 0, 0
+		case "ET":
+		case "Tf":
+			if err = need(op, 2); err == nil {
+				state.fontSize = num(1)
+			}
+		case "Td":
+			if err = need(op, 2); err == nil {
+				textX, textY = textX+num(0), textY+num(1)
+			}
+		case "Tj":
+			if err = need(op, 1); err == nil {
+				text, _ := operands[0].(pdfString)
+				fmt.Fprintf(&svg, `<text x="%.2f" y="%.2f" font-size="%s" fill="%s" xml:space="preserve">%s</text>`+"\n",
+					textX, height-textY, strconv.FormatFloat(state.fontSize, 'f', -1, 64), state.fill, escapeXML(decodeWinAnsi(text)))
+			}
+		default:
+			err = pdfErrorf("content stream: unsupported operator %s", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+		operands = operands[:0]
+	}
+
+	svg.WriteString("</g>\n</svg>\n")
+	return svg.Bytes(), nil
+}
+
+// colorByte converts a 0-1 color component to 0-255.
+func colorByte(v float64) int {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 1:
+		return 255
+	}
+	return int(v*255 + 0.5)
+}
+
+// winAnsiHigh maps WinAnsi codes 0x80-0x9F to Unicode (0 for unused codes).
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// decodeWinAnsi converts WinAnsi-encoded bytes to a UTF-8 string.
+func decodeWinAnsi(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c >= 0x80 && c <= 0x9F:
+			if r := winAnsiHigh[c-0x80]; r != 0 {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteRune('?')
+			}
+		default:
+			// ASCII and Latin-1 match Unicode code points
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
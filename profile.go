@@ -0,0 +1,222 @@
+package facturx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Profile is a Factur-X (and ZUGFeRD 2) profile, from the least to the
+// most detailed. Its value is the XMP conformance level of the profile.
+// This package generates ProfileBasic documents; the others are detected
+// when reading invoices.
+type Profile string
+
+const (
+	// ProfileMinimum carries the header and totals only, without lines or
+	// VAT breakdown.
+	ProfileMinimum Profile = "MINIMUM"
+	// ProfileBasicWL ("without lines") adds the VAT breakdown and
+	// document-level allowances and charges.
+	ProfileBasicWL Profile = "BASIC WL"
+	// ProfileBasic adds the invoice lines.
+	ProfileBasic Profile = "BASIC"
+	// ProfileEN16931 is the full EN 16931 semantic model.
+	ProfileEN16931 Profile = "EN 16931"
+	// ProfileExtended extends EN 16931 with elements for complex
+	// invoicing.
+	ProfileExtended Profile = "EXTENDED"
+)
+
+// hasLines reports whether invoices of the profile carry their lines.
+func (p Profile) hasLines() bool {
+	return p != ProfileMinimum && p != ProfileBasicWL
+}
+
+// extendedGuideline is the guideline identifier of Factur-X 1.0 EXTENDED,
+// which only conforms to EN 16931 as it extends it.
+const extendedGuideline = "urn:cen.eu:en16931:2017#conformant#urn:factur-x.eu:1p0:extended"
+
+// profileOf returns the profile a generated invoice declares: BASIC,
+// unless it needs elements only EXTENDED has (installments).
+func profileOf(req *InvoiceRequest) Profile {
+	if len(req.Installments) > 0 {
+		return ProfileExtended
+	}
+	return ProfileBasic
+}
+
+// guidelineOf returns the guideline identifier (BT-24) of a generated
+// invoice.
+func guidelineOf(req *InvoiceRequest) string {
+	if profileOf(req) == ProfileExtended {
+		return extendedGuideline
+	}
+	return specOf(req).guideline
+}
+
+// DocumentProfile is the profile a document declares.
+type DocumentProfile struct {
+	// Profile is the profile of the guideline identifier.
+	Profile Profile `json:"profile"`
+	// Standard is the specification the guideline refers to: "Factur-X",
+	// "ZUGFeRD", "XRechnung" (an EN 16931 profile) or "EN 16931".
+	Standard string `json:"standard"`
+	// Version is the version of the specification in the guideline, such
+	// as "1.0" for Factur-X 1p0 or "2.0" for ZUGFeRD 2p0.
+	Version string `json:"version,omitempty"`
+	// Guideline is the specification identifier of the XML (BT-24).
+	Guideline string `json:"guideline"`
+	// XMPProfile and XMPVersion are the fx:ConformanceLevel and fx:Version
+	// of the PDF XMP metadata, empty when reading XML alone.
+	XMPProfile Profile `json:"xmpProfile,omitempty"`
+	XMPVersion string  `json:"xmpVersion,omitempty"`
+}
+
+// DetectProfile returns the profile a CII invoice declares in its
+// GuidelineSpecifiedDocumentContextParameter. It returns an error
+// wrapping ErrXML if the document cannot be parsed or its guideline is
+// unknown.
+func DetectProfile(data []byte) (DocumentProfile, error) {
+	doc, err := ParseCII(data)
+	if err != nil {
+		return DocumentProfile{}, err
+	}
+	return doc.profile()
+}
+
+// DetectPDFProfile is like DetectProfile for the XML embedded in a
+// Factur-X PDF, and also reads the profile and version the XMP metadata
+// declare. It returns an error wrapping ErrPDF if the PDF cannot be read.
+func DetectPDFProfile(pdf []byte) (DocumentProfile, error) {
+	data, err := ExtractXML(pdf)
+	if err != nil {
+		return DocumentProfile{}, err
+	}
+	profile, err := DetectProfile(data)
+	if err != nil {
+		return DocumentProfile{}, err
+	}
+	xmp, err := xmpMetadata(pdf)
+	if err != nil {
+		return DocumentProfile{}, err
+	}
+	if m := xmpConformanceLevel.FindSubmatch(xmp); m != nil {
+		profile.XMPProfile = xmpProfiles[strings.ToUpper(string(m[1]))]
+	}
+	if m := xmpFacturXVersion.FindSubmatch(xmp); m != nil {
+		profile.XMPVersion = string(m[1])
+	}
+	return profile, nil
+}
+
+// profile returns the profile of the document guideline.
+func (d *CrossIndustryInvoice) profile() (DocumentProfile, error) {
+	id := strings.TrimSpace(d.Context.Guideline.ID)
+	profile, ok := profileOfGuideline(id)
+	if !ok {
+		return DocumentProfile{}, fmt.Errorf("%w: unknown guideline %q", ErrXML, id)
+	}
+	return profile, nil
+}
+
+// profileOfGuideline recognizes the Factur-X, ZUGFeRD and XRechnung
+// guideline identifiers, such as
+// "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic".
+func profileOfGuideline(id string) (DocumentProfile, bool) {
+	profile := DocumentProfile{Guideline: id}
+	if id == "urn:cen.eu:en16931:2017" {
+		profile.Profile, profile.Standard = ProfileEN16931, "EN 16931"
+		return profile, true
+	}
+
+	// ZUGFeRD 1.0: urn:ferd:CrossIndustryDocument:invoice:1p0:<level>
+	if rest, ok := strings.CutPrefix(id, "urn:ferd:CrossIndustryDocument:invoice:"); ok {
+		version, level, _ := strings.Cut(rest, ":")
+		profile.Profile, ok = zugferd1Profiles[level]
+		profile.Standard, profile.Version = "ZUGFeRD", strings.ReplaceAll(version, "p", ".")
+		return profile, ok
+	}
+
+	// The last URN names the specification: urn:<domain>:<version>:<level>
+	spec := id[strings.LastIndex(id, "#")+1:]
+	parts := strings.Split(spec, ":")
+	if len(parts) != 4 || parts[0] != "urn" {
+		return profile, false
+	}
+	switch parts[1] {
+	case "factur-x.eu":
+		profile.Standard = "Factur-X"
+	case "zugferd.de":
+		profile.Standard = "ZUGFeRD"
+	case "xeinkauf.de":
+		// urn:xeinkauf.de:kosit:xrechnung_3.0
+		version, ok := strings.CutPrefix(parts[3], "xrechnung_")
+		if !ok {
+			return profile, false
+		}
+		profile.Profile, profile.Standard, profile.Version = ProfileEN16931, "XRechnung", version
+		return profile, true
+	default:
+		return profile, false
+	}
+	level, ok := guidelineProfiles[parts[3]]
+	profile.Profile, profile.Version = level, strings.ReplaceAll(parts[2], "p", ".")
+	return profile, ok
+}
+
+// guidelineProfiles maps the last part of guideline identifiers to their
+// profile.
+var guidelineProfiles = map[string]Profile{
+	"minimum":  ProfileMinimum,
+	"basicwl":  ProfileBasicWL,
+	"basic":    ProfileBasic,
+	"en16931":  ProfileEN16931,
+	"comfort":  ProfileEN16931, // ZUGFeRD 2.0 name of EN 16931
+	"extended": ProfileExtended,
+}
+
+// zugferd1Profiles maps the ZUGFeRD 1.0 profiles to the closest Factur-X
+// profile.
+var zugferd1Profiles = map[string]Profile{
+	"basic":    ProfileBasic,
+	"comfort":  ProfileEN16931,
+	"extended": ProfileExtended,
+}
+
+// xmpProfiles maps the XMP conformance levels to their profile.
+var xmpProfiles = map[string]Profile{
+	"MINIMUM":   ProfileMinimum,
+	"BASIC WL":  ProfileBasicWL,
+	"BASIC":     ProfileBasic,
+	"EN 16931":  ProfileEN16931,
+	"COMFORT":   ProfileEN16931,
+	"XRECHNUNG": ProfileEN16931,
+	"EXTENDED":  ProfileExtended,
+}
+
+// Factur-X identification in XMP, as an element or an attribute, whatever
+// the namespace prefix (fx for Factur-X, zf for ZUGFeRD).
+var (
+	xmpConformanceLevel = regexp.MustCompile(`\w+:ConformanceLevel(?:>|=["'])\s*([A-Za-z0-9 ]*[A-Za-z0-9])`)
+	xmpFacturXVersion   = regexp.MustCompile(`\w+:Version(?:>|=["'])\s*([0-9][0-9.p]*)`)
+)
+
+// xmpMetadata returns the XMP metadata stream of a PDF, empty if it has
+// none.
+func xmpMetadata(pdf []byte) ([]byte, error) {
+	doc, err := readPDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	catalog, _, err := doc.catalog()
+	if err != nil {
+		return nil, err
+	}
+	v, _ := doc.resolve(catalog["Metadata"])
+	stream, ok := v.(*pdfStream)
+	if !ok {
+		return nil, nil
+	}
+	return decodeStream(stream)
+}
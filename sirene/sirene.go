@@ -0,0 +1,255 @@
+// Package sirene looks up French establishments in the INSEE Sirene
+// directory, to check that a SIRET exists and is active before invoicing it
+// and to prefill a facturx.Contact from it.
+//
+// Lookups go through the Directory interface; Client implements it with
+// the Sirene API of api.insee.fr, which requires a free API key:
+//
+//	dir, err := sirene.NewClientFromEnv() // INSEE_API_KEY
+//	e, err := dir.Lookup(ctx, "52825000400033")
+//	if err == nil && e.Active {
+//		req.Buyer = e.Contact()
+//	}
+package sirene
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/audrenbdb/facturx"
+)
+
+var (
+	// ErrNotFound is returned by Lookup for a SIRET unknown to the
+	// directory.
+	ErrNotFound = errors.New("sirene: establishment not found")
+	// ErrInvalidSiret is returned by Lookup, without querying the
+	// directory, for a SIRET that is not 14 digits or whose check digit is
+	// wrong.
+	ErrInvalidSiret = errors.New("sirene: invalid SIRET")
+)
+
+// Establishment is an establishment (établissement) of the directory.
+type Establishment struct {
+	Siret string `json:"siret"`
+	Siren string `json:"siren"`
+	// Name is the company name (dénomination), or the first name and last
+	// name of an individual entrepreneur.
+	Name string `json:"name"`
+	// TradingName is the sign or usual name of the establishment, if any.
+	TradingName string `json:"tradingName,omitempty"`
+	Address     string `json:"street,omitempty"`
+	ZipCode     string `json:"postalCode,omitempty"`
+	City        string `json:"city,omitempty"`
+	// NAF is the main activity code of the establishment, e.g. "62.01Z".
+	NAF string `json:"naf,omitempty"`
+	// Active is false for a closed establishment, which should not be
+	// invoiced.
+	Active bool `json:"active"`
+}
+
+// Contact returns the establishment as an invoice party established in
+// France.
+func (e *Establishment) Contact() facturx.Contact {
+	return facturx.Contact{
+		Name:        e.Name,
+		Address:     e.Address,
+		ZipCode:     e.ZipCode,
+		City:        e.City,
+		CountryCode: "FR",
+		Siret:       e.Siret,
+		TradingName: e.TradingName,
+		NAF:         e.NAF,
+	}
+}
+
+// Directory looks up establishments by SIRET.
+type Directory interface {
+	// Lookup returns the establishment with the given SIRET, or
+	// ErrNotFound.
+	Lookup(ctx context.Context, siret string) (*Establishment, error)
+}
+
+// DefaultBaseURL is the Sirene API of the INSEE portal.
+const DefaultBaseURL = "https://api.insee.fr/api-sirene/3.11"
+
+// Client is a Directory querying the INSEE Sirene API.
+type Client struct {
+	// BaseURL is the API root; empty means DefaultBaseURL.
+	BaseURL string
+	// APIKey is the key of an application subscribed to the Sirene API on
+	// portail-api.insee.fr.
+	APIKey string
+	// Client is the HTTP client; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// NewClientFromEnv returns a client using the API key in INSEE_API_KEY and,
+// if set, the API root in INSEE_SIRENE_URL.
+func NewClientFromEnv() (*Client, error) {
+	c := &Client{BaseURL: os.Getenv("INSEE_SIRENE_URL"), APIKey: os.Getenv("INSEE_API_KEY")}
+	if c.APIKey == "" {
+		return nil, errors.New("sirene: INSEE_API_KEY is required")
+	}
+	return c, nil
+}
+
+// Lookup fetches the establishment from the /siret endpoint.
+func (c *Client) Lookup(ctx context.Context, siret string) (*Establishment, error) {
+	siret = strings.ReplaceAll(siret, " ", "")
+	if !validSiret(siret) {
+		return nil, ErrInvalidSiret
+	}
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(base, "/")+"/siret/"+url.PathEscape(siret), nil)
+	if err != nil {
+		return nil, fmt.Errorf("sirene: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-INSEE-Api-Key-Integration", c.APIKey)
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sirene: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("sirene: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("sirene: API returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var reply struct {
+		Establishment siretResponse `json:"etablissement"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("sirene: invalid response: %w", err)
+	}
+	return reply.Establishment.establishment(), nil
+}
+
+// validSiret reports whether siret is 14 digits with a valid Luhn check
+// digit, or a La Poste establishment (SIREN 356000000) whose digits sum to a
+// multiple of 5.
+func validSiret(siret string) bool {
+	if len(siret) != 14 {
+		return false
+	}
+	luhn, sum := 0, 0
+	for i := 0; i < len(siret); i++ {
+		if siret[i] < '0' || siret[i] > '9' {
+			return false
+		}
+		digit := int(siret[i] - '0')
+		sum += digit
+		if i%2 == 0 {
+			if digit *= 2; digit > 9 {
+				digit -= 9
+			}
+		}
+		luhn += digit
+	}
+	return luhn%10 == 0 || (siret[:9] == "356000000" && sum%5 == 0)
+}
+
+// siretResponse is the "etablissement" object of the /siret endpoint.
+type siretResponse struct {
+	Siret     string `json:"siret"`
+	Siren     string `json:"siren"`
+	LegalUnit struct {
+		Name      string `json:"denominationUniteLegale"`
+		LastName  string `json:"nomUniteLegale"`
+		UsageName string `json:"nomUsageUniteLegale"`
+		FirstName string `json:"prenom1UniteLegale"`
+	} `json:"uniteLegale"`
+	Address struct {
+		Complement string `json:"complementAdresseEtablissement"`
+		Number     string `json:"numeroVoieEtablissement"`
+		Repetition string `json:"indiceRepetitionEtablissement"`
+		StreetType string `json:"typeVoieEtablissement"`
+		Street     string `json:"libelleVoieEtablissement"`
+		ZipCode    string `json:"codePostalEtablissement"`
+		City       string `json:"libelleCommuneEtablissement"`
+		// Establishments abroad have a foreign city and no French one
+		ForeignCity string `json:"libelleCommuneEtrangerEtablissement"`
+	} `json:"adresseEtablissement"`
+	// Periods are the successive states of the establishment, the current
+	// one first
+	Periods []struct {
+		State        string `json:"etatAdministratifEtablissement"`
+		Sign         string `json:"enseigne1Etablissement"`
+		UsualName    string `json:"denominationUsuelleEtablissement"`
+		MainActivity string `json:"activitePrincipaleEtablissement"`
+	} `json:"periodesEtablissement"`
+}
+
+// establishment maps the API response onto an Establishment.
+func (r *siretResponse) establishment() *Establishment {
+	e := &Establishment{Siret: r.Siret, Siren: r.Siren, Name: strings.TrimSpace(r.LegalUnit.Name)}
+	if e.Name == "" {
+		// Individual entrepreneur: usage name first, then birth name
+		last := r.LegalUnit.UsageName
+		if last == "" {
+			last = r.LegalUnit.LastName
+		}
+		e.Name = strings.TrimSpace(strings.TrimSpace(r.LegalUnit.FirstName) + " " + strings.TrimSpace(last))
+	}
+
+	a := &r.Address
+	street := strings.Join(strings.Fields(strings.Join([]string{a.Number + a.Repetition, streetTypes[a.StreetType], a.Street}, " ")), " ")
+	if street == "" {
+		street = strings.TrimSpace(a.Complement)
+	}
+	e.Address, e.ZipCode, e.City = street, a.ZipCode, a.City
+	if e.City == "" {
+		e.City = a.ForeignCity
+	}
+
+	if len(r.Periods) > 0 {
+		p := r.Periods[0]
+		e.Active = p.State == "A"
+		e.TradingName = strings.TrimSpace(p.Sign)
+		if e.TradingName == "" {
+			e.TradingName = strings.TrimSpace(p.UsualName)
+		}
+		e.NAF = p.MainActivity
+	}
+	return e
+}
+
+// streetTypes spells out the most common street type codes of the
+// directory; other codes are dropped.
+var streetTypes = map[string]string{
+	"ALL":  "ALLEE",
+	"AV":   "AVENUE",
+	"BD":   "BOULEVARD",
+	"CHE":  "CHEMIN",
+	"CRS":  "COURS",
+	"IMP":  "IMPASSE",
+	"PL":   "PLACE",
+	"QUAI": "QUAI",
+	"RTE":  "ROUTE",
+	"RUE":  "RUE",
+	"SQ":   "SQUARE",
+	"ZA":   "ZA",
+	"ZI":   "ZI",
+}
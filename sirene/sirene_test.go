@@ -0,0 +1,135 @@
+package sirene
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/audrenbdb/facturx"
+)
+
+const establishmentJSON = `{
+  "header": {"statut": 200, "message": "ok"},
+  "etablissement": {
+    "siren": "528250004",
+    "siret": "52825000400033",
+    "uniteLegale": {"denominationUniteLegale": "ACME CONSEIL"},
+    "adresseEtablissement": {
+      "numeroVoieEtablissement": "12",
+      "indiceRepetitionEtablissement": "B",
+      "typeVoieEtablissement": "AV",
+      "libelleVoieEtablissement": "DES CHAMPS ELYSEES",
+      "codePostalEtablissement": "75008",
+      "libelleCommuneEtablissement": "PARIS 8"
+    },
+    "periodesEtablissement": [
+      {"etatAdministratifEtablissement": "A", "enseigne1Etablissement": "ACME", "activitePrincipaleEtablissement": "70.22Z"},
+      {"etatAdministratifEtablissement": "F"}
+    ]
+  }
+}`
+
+func TestLookup(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if key := r.Header.Get("X-INSEE-Api-Key-Integration"); key != "secret" {
+			t.Errorf("API key header = %q", key)
+		}
+		switch r.URL.Path {
+		case "/siret/52825000400033":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(establishmentJSON))
+		case "/siret/10900000000009":
+			http.Error(w, `{"header":{"statut":404,"message":"Aucun élément trouvé"}}`, http.StatusNotFound)
+		case "/siret/35600000000048":
+			http.Error(w, `{"header":{"statut":429,"message":"Too many requests"}}`, http.StatusTooManyRequests)
+		default:
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	c := &Client{BaseURL: srv.URL + "/", APIKey: "secret", Client: srv.Client()}
+	ctx := context.Background()
+
+	e, err := c.Lookup(ctx, "528 250 004 00033")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	want := facturx.Contact{
+		Name:        "ACME CONSEIL",
+		Address:     "12B AVENUE DES CHAMPS ELYSEES",
+		ZipCode:     "75008",
+		City:        "PARIS 8",
+		CountryCode: "FR",
+		Siret:       "52825000400033",
+		TradingName: "ACME",
+		NAF:         "70.22Z",
+	}
+	if got := e.Contact(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Contact() = %+v, want %+v", got, want)
+	}
+	if !e.Active || e.Siren != "528250004" {
+		t.Errorf("Active = %v, Siren = %q", e.Active, e.Siren)
+	}
+
+	errorTests := []struct {
+		name  string
+		siret string
+		is    error
+		text  string
+	}{
+		{"unknown", "10900000000009", ErrNotFound, ""},
+		{"rate limited", "35600000000048", nil, "429"},
+		{"server error", "73282932000074", nil, "500"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.Lookup(ctx, tt.siret)
+			if err == nil {
+				t.Fatal("Lookup succeeded")
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("error = %v, want %v", err, tt.is)
+			}
+			if tt.is == nil && (errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), tt.text)) {
+				t.Errorf("error = %v, want an API error with %s", err, tt.text)
+			}
+		})
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("%d API calls, want 4", n)
+	}
+}
+
+func TestLookupInvalidSiret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+	}))
+	defer srv.Close()
+	c := &Client{BaseURL: srv.URL, APIKey: "secret", Client: srv.Client()}
+
+	for _, siret := range []string{"", "5282500040003", "528250004000330", "5282500040003A", "52825000400034", "../../siren/1"} {
+		if _, err := c.Lookup(context.Background(), siret); !errors.Is(err, ErrInvalidSiret) {
+			t.Errorf("Lookup(%q) = %v, want ErrInvalidSiret", siret, err)
+		}
+	}
+}
+
+func TestEstablishmentIndividual(t *testing.T) {
+	var r siretResponse
+	r.LegalUnit.FirstName = "JEANNE"
+	r.LegalUnit.LastName = "DURAND"
+	r.LegalUnit.UsageName = "MARTIN"
+	r.Address.Complement = "LIEU-DIT LES CHENES"
+	r.Address.ForeignCity = "GENEVE"
+	e := r.establishment()
+	if e.Name != "JEANNE MARTIN" || e.Address != "LIEU-DIT LES CHENES" || e.City != "GENEVE" || e.Active {
+		t.Errorf("establishment() = %+v", e)
+	}
+}
@@ -0,0 +1,91 @@
+package facturx
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supplement is a PDF document embedded in the invoice next to
+// factur-x.xml, such as the signed quote or the contract the invoice
+// relates to, so that the whole commercial trail travels in one file. It is
+// attached with /AFRelationship /Supplement and referenced in the XML as an
+// additional supporting document (BG-24).
+type Supplement struct {
+	// ID is the reference of the document, e.g. the quote number (BT-122).
+	ID string `json:"id"`
+	// FileName is the name of the attachment, in ASCII and ending in
+	// ".pdf", e.g. "devis-D2026-014.pdf".
+	FileName string `json:"fileName"`
+	// Description is shown by PDF readers and written in the XML (BT-123).
+	// Optional.
+	Description string `json:"description,omitempty"`
+	// Data is the PDF document (base64 in JSON).
+	Data []byte `json:"data"`
+}
+
+// AddSupplement embeds the PDF document data, referenced as id, in the
+// invoice.
+func (r *InvoiceRequest) AddSupplement(id, fileName string, data []byte) {
+	r.Supplements = append(r.Supplements, Supplement{ID: id, FileName: fileName, Data: data})
+}
+
+// supplementTypeCode is the UNTDID 1001 code of an additional supporting
+// document (BT-122 with TypeCode 916).
+const supplementTypeCode = "916"
+
+// validateSupplements checks the embedded documents of req.
+func validateSupplements(req *InvoiceRequest) error {
+	names := map[string]bool{strings.ToLower(specOf(req).fileName): true}
+	for i, s := range req.Supplements {
+		field := fmt.Sprintf("Supplements[%d]", i)
+		if strings.TrimSpace(s.ID) == "" {
+			return ValidationError{Field: field + ".ID", Message: "supplement ID cannot be empty"}
+		}
+		if !isPrintableASCII([]byte(s.FileName)) || !strings.HasSuffix(strings.ToLower(s.FileName), ".pdf") || strings.ContainsAny(s.FileName, `/\`) {
+			return ValidationError{Field: field + ".FileName", Message: "supplement file name must be ASCII and end in .pdf"}
+		}
+		if names[strings.ToLower(s.FileName)] {
+			return ValidationError{Field: field + ".FileName", Message: "supplement file names must be unique"}
+		}
+		names[strings.ToLower(s.FileName)] = true
+		if !bytes.HasPrefix(s.Data, []byte("%PDF-")) {
+			return ValidationError{Field: field + ".Data", Message: "supplement must be a PDF document"}
+		}
+	}
+	return nil
+}
+
+// description returns the description of the attachment.
+func (s *Supplement) description() string {
+	if s.Description != "" {
+		return s.Description
+	}
+	return "Supporting document " + s.ID
+}
+
+// fileDict returns the stream dictionary of the embedded document.
+func (s *Supplement) fileDict(modDate string) string {
+	return fmt.Sprintf("<< /Type /EmbeddedFile /Subtype /application#2Fpdf /Length %d /Params << /Size %d /ModDate (D:%s) /CheckSum <%X> >> >>",
+		len(s.Data), len(s.Data), modDate, md5.Sum(s.Data))
+}
+
+// filespecDict returns the file specification of the document whose
+// stream is object fileNum.
+func (s *Supplement) filespecDict(fileNum int) string {
+	name := escapePDFString(s.FileName)
+	return fmt.Sprintf(filespecFormat, name, name, pdfTextString(s.description()), "Supplement", fileNum, fileNum)
+}
+
+// attachment is an entry of the embedded files name tree.
+type attachment struct {
+	name        string
+	filespecNum int
+}
+
+// sortAttachments sorts name tree entries by name, as PDF requires.
+func sortAttachments(files []attachment) {
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+}
@@ -0,0 +1,73 @@
+package facturx
+
+// Totals holds the computed amounts of an invoice, exactly as they are
+// written into the CII XML and printed on the PDF.
+type Totals struct {
+	// Lines holds the net amount of each line (BT-131), in request order.
+	Lines []float64 `json:"lines"`
+	// LineTotal is the sum of line net amounts (BT-106).
+	LineTotal float64 `json:"lineTotal"`
+	// Charges is the sum of document-level charges such as shipping (BT-108).
+	Charges float64 `json:"charges"`
+	// TaxBasis is the invoice total without VAT (BT-109).
+	TaxBasis float64 `json:"taxBasis"`
+	// TaxTotal is the total VAT amount (BT-110).
+	TaxTotal float64 `json:"taxTotal"`
+	// GrandTotal is the invoice total with VAT (BT-112).
+	GrandTotal float64 `json:"grandTotal"`
+	// Prepaid is the amount already paid (BT-113).
+	Prepaid float64 `json:"prepaid"`
+	// DuePayable is the amount due for payment (BT-115).
+	DuePayable float64 `json:"duePayable"`
+	// VAT holds the VAT breakdown per category and rate (BG-23).
+	VAT []VatBreakdown `json:"vat"`
+}
+
+// VatBreakdown is one entry of the VAT breakdown (BG-23).
+type VatBreakdown struct {
+	// CategoryCode is the VAT category code (BT-118), e.g. "S" or "E".
+	CategoryCode string `json:"categoryCode"`
+	// Rate is the VAT rate in percent (BT-119).
+	Rate float64 `json:"rate"`
+	// Basis is the taxable amount (BT-116).
+	Basis float64 `json:"basis"`
+	// Amount is the VAT amount (BT-117).
+	Amount float64 `json:"amount"`
+	// ExemptionReason is the exemption reason text (BT-120), if any.
+	ExemptionReason string `json:"exemptionReason,omitempty"`
+	// ExemptionCode is the exemption reason code (BT-121), if any.
+	ExemptionCode string `json:"exemptionCode,omitempty"`
+}
+
+// ComputeTotals computes the invoice totals without generating any document.
+//
+// The returned values are guaranteed to match the amounts Generate writes into
+// the XML, which makes it suitable for live totals in user interfaces. The
+// request is not validated.
+func ComputeTotals(req *InvoiceRequest) Totals {
+	calc := calculateInvoice(req)
+
+	lines := make([]float64, len(calc.lineAmounts))
+	for i, a := range calc.lineAmounts {
+		lines[i] = a.Float()
+	}
+
+	return Totals{
+		Lines:      lines,
+		LineTotal:  calc.lineTotal.Float(),
+		Charges:    calc.chargeTotal.Float(),
+		TaxBasis:   calc.taxBase.Float(),
+		TaxTotal:   calc.taxTotal.Float(),
+		GrandTotal: calc.grandTotal.Float(),
+		Prepaid:    calc.prepaidAmount.Float(),
+		DuePayable: calc.dueAmount.Float(),
+		VAT: []VatBreakdown{{
+			CategoryCode:    calc.vatCategoryCode,
+			Rate:            calc.vatRate,
+			Basis:           calc.taxBase.Float(),
+			Amount:          calc.taxTotal.Float(),
+			ExemptionReason: calc.vatExemptionText,
+			ExemptionCode:   calc.vatExemptionCode,
+		}},
+	}
+}
@@ -0,0 +1,133 @@
+package facturx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// TransmissionMetadata describes an invoice sent to a platform alongside its
+// PDF. Platforms read the same data from the embedded XML, but use these
+// fields to route the invoice before parsing it.
+type TransmissionMetadata struct {
+	// Number is the invoice number (BT-1).
+	Number string `json:"number"`
+	// Type is the invoice type code (BT-3).
+	Type InvoiceType `json:"type"`
+	// Date is the invoice date in YYYYMMDD format.
+	Date string `json:"date"`
+	// SellerSiret and BuyerSiret identify the parties; BuyerSiret is empty
+	// for B2C invoices.
+	SellerSiret string `json:"sellerSiret"`
+	BuyerSiret  string `json:"buyerSiret,omitempty"`
+	// GrandTotal is the invoice total with VAT (BT-112).
+	GrandTotal float64 `json:"grandTotal"`
+}
+
+// NewTransmissionMetadata returns the metadata of an invoice request.
+func NewTransmissionMetadata(req InvoiceRequest) TransmissionMetadata {
+	r := normalizeDates(req)
+	typ := r.Type
+	if typ == "" {
+		typ = TypeCommercial
+	}
+	return TransmissionMetadata{
+		Number:      r.Number,
+		Type:        typ,
+		Date:        r.Date,
+		SellerSiret: r.Seller.Siret,
+		BuyerSiret:  r.Buyer.Siret,
+		GrandTotal:  ComputeTotals(&r).GrandTotal,
+	}
+}
+
+// Transmitter sends a Factur-X invoice to a dematerialisation platform: a
+// plateforme de dématérialisation partenaire (PDP) or the public portal
+// (PPF), as required by the French e-invoicing mandate.
+//
+// Send returns the identifier assigned by the platform, used to follow the
+// invoice lifecycle. Failures wrap ErrTransmission.
+type Transmitter interface {
+	Send(ctx context.Context, pdf []byte, meta TransmissionMetadata) (trackingID string, err error)
+}
+
+// HTTPTransmitter is a reference Transmitter for platforms exposing an
+// upload endpoint. It posts a multipart form with the PDF in the "file"
+// field and the JSON metadata in the "metadata" field, and expects a 2xx
+// JSON response with the tracking identifier in "trackingId" (or "id").
+//
+// Platform APIs differ in details such as authentication and field names;
+// HTTPTransmitter covers the common case and serves as a model for
+// platform-specific implementations.
+type HTTPTransmitter struct {
+	// URL is the upload endpoint.
+	URL string
+	// Token, if set, is sent as a bearer token.
+	Token string
+	// Client is the HTTP client; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// Send uploads the invoice.
+func (t *HTTPTransmitter) Send(ctx context.Context, pdf []byte, meta TransmissionMetadata) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "facture-"+meta.Number+".pdf")
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTransmission, err)
+	}
+	fw.Write(pdf)
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTransmission, err)
+	}
+	mw.WriteField("metadata", string(metaJSON))
+	mw.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.URL, &body)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTransmission, err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTransmission, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTransmission, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%w: platform returned %s: %s", ErrTransmission, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var reply struct {
+		TrackingID string `json:"trackingId"`
+		ID         string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return "", fmt.Errorf("%w: invalid platform response: %v", ErrTransmission, err)
+	}
+	if reply.TrackingID == "" {
+		reply.TrackingID = reply.ID
+	}
+	if reply.TrackingID == "" {
+		return "", fmt.Errorf("%w: platform response has no tracking identifier", ErrTransmission)
+	}
+	return reply.TrackingID, nil
+}
@@ -0,0 +1,477 @@
+package facturx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// UBL 2.1 namespaces.
+const (
+	nsUBLInvoice    = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	nsUBLCreditNote = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+	nsUBLCAC        = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	nsUBLCBC        = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// ConvertToUBL converts a CII invoice (see ParseCII) to an EN 16931 UBL
+// 2.1 invoice, for platforms that do not accept CII. It returns an error
+// wrapping ErrXML if the document cannot be parsed or has invalid dates.
+func ConvertToUBL(data []byte) (string, error) {
+	doc, err := ParseCII(data)
+	if err != nil {
+		return "", err
+	}
+	return doc.UBL()
+}
+
+// UBL returns the document as an EN 16931 UBL 2.1 invoice, following the
+// CEN syntax binding: a CreditNote for type code 381, an Invoice
+// otherwise. Amounts are copied as written; elements this model does not
+// hold have no UBL counterpart. It returns an error wrapping ErrXML if a
+// date is invalid.
+func (d *CrossIndustryInvoice) UBL() (string, error) {
+	u, err := d.ubl()
+	if err != nil {
+		return "", err
+	}
+	out, err := xml.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(out) + "\n", nil
+}
+
+// ublDocument is a UBL Invoice or CreditNote, in the order of the UBL 2.1
+// schema.
+type ublDocument struct {
+	XMLName            xml.Name
+	XMLNS              string               `xml:"xmlns,attr"`
+	XMLNSCAC           string               `xml:"xmlns:cac,attr"`
+	XMLNSCBC           string               `xml:"xmlns:cbc,attr"`
+	CustomizationID    string               `xml:"cbc:CustomizationID"`
+	ID                 string               `xml:"cbc:ID"`
+	IssueDate          string               `xml:"cbc:IssueDate"`
+	DueDate            string               `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode    string               `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode string               `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Notes              []string             `xml:"cbc:Note"`
+	TaxPointDate       string               `xml:"cbc:TaxPointDate,omitempty"`
+	Currency           string               `xml:"cbc:DocumentCurrencyCode"`
+	OrderReference     *ublReference        `xml:"cac:OrderReference"`
+	BillingReference   *ublBillingReference `xml:"cac:BillingReference"`
+	DespatchReference  *ublReference        `xml:"cac:DespatchDocumentReference"`
+	Additional         []ublReference       `xml:"cac:AdditionalDocumentReference"`
+	Supplier           ublParty             `xml:"cac:AccountingSupplierParty>cac:Party"`
+	Customer           ublParty             `xml:"cac:AccountingCustomerParty>cac:Party"`
+	Delivery           *ublDelivery         `xml:"cac:Delivery"`
+	PaymentMeans       []ublPaymentMeans    `xml:"cac:PaymentMeans"`
+	PaymentTerms       *ublPaymentTerms     `xml:"cac:PaymentTerms"`
+	AllowanceCharges   []ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	TaxTotal           ublTaxTotal          `xml:"cac:TaxTotal"`
+	MonetaryTotal      ublMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines       []ublLine            `xml:"cac:InvoiceLine"`
+	CreditNoteLines    []ublLine            `xml:"cac:CreditNoteLine"`
+}
+
+// ublReference is a referenced document.
+type ublReference struct {
+	ID          string `xml:"cbc:ID"`
+	IssueDate   string `xml:"cbc:IssueDate,omitempty"`
+	TypeCode    string `xml:"cbc:DocumentTypeCode,omitempty"`
+	Description string `xml:"cbc:DocumentDescription,omitempty"`
+}
+
+// ublBillingReference references the preceding invoice.
+type ublBillingReference struct {
+	Invoice ublReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+// ublDelivery holds the actual delivery date.
+type ublDelivery struct {
+	Date string `xml:"cbc:ActualDeliveryDate"`
+}
+
+// ublPaymentMeans is a payment means, with the mandate of a direct debit.
+type ublPaymentMeans struct {
+	Code    string      `xml:"cbc:PaymentMeansCode"`
+	Mandate *ublMandate `xml:"cac:PaymentMandate"`
+}
+
+// ublMandate is a direct debit mandate (BT-89) and debited account
+// (BT-91).
+type ublMandate struct {
+	ID           string `xml:"cbc:ID,omitempty"`
+	PayerAccount string `xml:"cac:PayerFinancialAccount>cbc:ID,omitempty"`
+}
+
+// ublPaymentTerms holds the payment terms.
+type ublPaymentTerms struct {
+	Note string `xml:"cbc:Note"`
+}
+
+// ublParty is the seller or the buyer.
+type ublParty struct {
+	Identifications []ublPartyID   `xml:"cac:PartyIdentification"`
+	TradingName     *ublPartyName  `xml:"cac:PartyName"`
+	Address         ublAddress     `xml:"cac:PostalAddress"`
+	TaxSchemes      []ublPartyTax  `xml:"cac:PartyTaxScheme"`
+	LegalEntity     ublLegalEntity `xml:"cac:PartyLegalEntity"`
+}
+
+// ublPartyName is the trading name of a party (BT-28, BT-45).
+type ublPartyName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+// ublPartyID is an identifier of a party (BT-29, BT-46).
+type ublPartyID struct {
+	ID ublID `xml:"cbc:ID"`
+}
+
+// ublID is an identifier with its optional scheme.
+type ublID struct {
+	Value    string `xml:",chardata"`
+	SchemeID string `xml:"schemeID,attr,omitempty"`
+}
+
+// ublAddress is a postal address.
+type ublAddress struct {
+	Street     string `xml:"cbc:StreetName,omitempty"`
+	City       string `xml:"cbc:CityName,omitempty"`
+	PostalZone string `xml:"cbc:PostalZone,omitempty"`
+	Country    string `xml:"cac:Country>cbc:IdentificationCode"`
+}
+
+// ublPartyTax is a VAT registration.
+type ublPartyTax struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	TaxScheme string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+// ublLegalEntity is the registered name and legal identifier of a party.
+type ublLegalEntity struct {
+	Name      string `xml:"cbc:RegistrationName"`
+	CompanyID *ublID `xml:"cbc:CompanyID"`
+}
+
+// ublAmount is an amount with its currency.
+type ublAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"currencyID,attr"`
+}
+
+// ublAllowanceCharge is an allowance or charge on the document, a line or
+// a price.
+type ublAllowanceCharge struct {
+	ChargeIndicator bool            `xml:"cbc:ChargeIndicator"`
+	ReasonCode      string          `xml:"cbc:AllowanceChargeReasonCode,omitempty"`
+	Reason          string          `xml:"cbc:AllowanceChargeReason,omitempty"`
+	Percent         string          `xml:"cbc:MultiplierFactorNumeric,omitempty"`
+	Amount          ublAmount       `xml:"cbc:Amount"`
+	BaseAmount      *ublAmount      `xml:"cbc:BaseAmount"`
+	TaxCategory     *ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+// ublTaxCategory is a VAT category and rate.
+type ublTaxCategory struct {
+	ID                  string `xml:"cbc:ID"`
+	Percent             string `xml:"cbc:Percent,omitempty"`
+	ExemptionReasonCode string `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	ExemptionReason     string `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme           string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+// ublTaxTotal is the VAT total and breakdown.
+type ublTaxTotal struct {
+	TaxAmount ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+// ublTaxSubtotal is a VAT breakdown.
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	Category      ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+// ublMonetaryTotal holds the document totals.
+type ublMonetaryTotal struct {
+	LineExtension  ublAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusive   ublAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusive   ublAmount  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotal *ublAmount `xml:"cbc:AllowanceTotalAmount"`
+	ChargeTotal    *ublAmount `xml:"cbc:ChargeTotalAmount"`
+	Prepaid        *ublAmount `xml:"cbc:PrepaidAmount"`
+	Payable        ublAmount  `xml:"cbc:PayableAmount"`
+}
+
+// ublLine is an invoice or credit note line.
+type ublLine struct {
+	ID               string               `xml:"cbc:ID"`
+	InvoicedQuantity *ublQuantity         `xml:"cbc:InvoicedQuantity"`
+	CreditedQuantity *ublQuantity         `xml:"cbc:CreditedQuantity"`
+	LineExtension    ublAmount            `xml:"cbc:LineExtensionAmount"`
+	Period           *ublPeriod           `xml:"cac:InvoicePeriod"`
+	AllowanceCharges []ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	Name             string               `xml:"cac:Item>cbc:Name"`
+	TaxCategory      ublTaxCategory       `xml:"cac:Item>cac:ClassifiedTaxCategory"`
+	Price            ublPrice             `xml:"cac:Price"`
+}
+
+// ublQuantity is a quantity with its unit.
+type ublQuantity struct {
+	Value    string `xml:",chardata"`
+	UnitCode string `xml:"unitCode,attr,omitempty"`
+}
+
+// ublPeriod is a billing period.
+type ublPeriod struct {
+	Start string `xml:"cbc:StartDate,omitempty"`
+	End   string `xml:"cbc:EndDate,omitempty"`
+}
+
+// ublPrice is the net price of an item, with the discount applied to its
+// gross price.
+type ublPrice struct {
+	Amount    ublAmount           `xml:"cbc:PriceAmount"`
+	Allowance *ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+}
+
+// ubl maps the document onto its UBL counterpart.
+func (d *CrossIndustryInvoice) ubl() (*ublDocument, error) {
+	var dateErr error
+	date := func(field string, v Date) string {
+		s := strings.TrimSpace(string(v))
+		if s == "" {
+			return ""
+		}
+		t, err := parseCIIDate(s)
+		if err != nil && dateErr == nil {
+			dateErr = fmt.Errorf("%w: %s: invalid date %q", ErrXML, field, s)
+		}
+		return t.Format("2006-01-02")
+	}
+
+	settlement := &d.Transaction.Settlement
+	currency := settlement.Currency
+	if currency == "" {
+		currency = "EUR"
+	}
+	amount := func(v string) ublAmount { return ublAmount{Value: v, Currency: currency} }
+	optionalAmount := func(v string) *ublAmount {
+		if strings.TrimSpace(v) == "" {
+			return nil
+		}
+		a := amount(v)
+		return &a
+	}
+
+	u := &ublDocument{
+		XMLNS:           nsUBLInvoice,
+		XMLNSCAC:        nsUBLCAC,
+		XMLNSCBC:        nsUBLCBC,
+		CustomizationID: "urn:cen.eu:en16931:2017",
+		ID:              d.Document.ID,
+		IssueDate:       date("IssueDateTime", d.Document.IssueDate),
+		Currency:        currency,
+		Supplier:        ublPartyOf(&d.Transaction.Agreement.Seller),
+		Customer:        ublPartyOf(&d.Transaction.Agreement.Buyer),
+	}
+	creditNote := d.Document.TypeCode == "381" // commercial credit note
+	if creditNote {
+		u.XMLName.Local, u.XMLNS, u.CreditNoteTypeCode = "CreditNote", nsUBLCreditNote, d.Document.TypeCode
+	} else {
+		u.XMLName.Local, u.InvoiceTypeCode = "Invoice", d.Document.TypeCode
+	}
+
+	// The subject code of a note (BT-21) prefixes its text
+	for _, n := range d.Document.Notes {
+		if n.SubjectCode != "" {
+			u.Notes = append(u.Notes, "#"+n.SubjectCode+"#"+n.Content)
+		} else {
+			u.Notes = append(u.Notes, n.Content)
+		}
+	}
+
+	agreement := &d.Transaction.Agreement
+	if agreement.BuyerOrder != nil {
+		u.OrderReference = &ublReference{ID: agreement.BuyerOrder.IssuerAssignedID}
+	}
+	for _, a := range agreement.Additional {
+		u.Additional = append(u.Additional, ublReference{ID: a.IssuerAssignedID, TypeCode: a.TypeCode, Description: a.Name})
+	}
+	if ref := settlement.InvoiceReference; ref != nil {
+		u.BillingReference = &ublBillingReference{Invoice: ublReference{
+			ID:        ref.IssuerAssignedID,
+			IssueDate: date("InvoiceReferencedDocument", ref.IssueDate),
+		}}
+	}
+	delivery := &d.Transaction.Delivery
+	if delivery.DespatchAdvice != nil {
+		u.DespatchReference = &ublReference{ID: delivery.DespatchAdvice.IssuerAssignedID}
+	}
+	if delivery.ActualDelivery != nil {
+		u.Delivery = &ublDelivery{Date: date("OccurrenceDateTime", delivery.ActualDelivery.Date)}
+	}
+
+	// The SEPA creditor identifier (BT-90) identifies the seller, with
+	// scheme SEPA; the mandate is part of the payment means
+	if id := strings.TrimSpace(settlement.CreditorReferenceID); id != "" {
+		u.Supplier.Identifications = append(u.Supplier.Identifications, ublPartyID{ID: ublID{Value: id, SchemeID: "SEPA"}})
+	}
+	for _, m := range settlement.PaymentMeans {
+		means := ublPaymentMeans{Code: m.TypeCode}
+		mandate := ublMandate{}
+		if len(settlement.PaymentTerms) > 0 {
+			mandate.ID = settlement.PaymentTerms[0].DirectDebitMandateID
+		}
+		if m.DebtorAccount != nil {
+			mandate.PayerAccount = m.DebtorAccount.IBAN
+		}
+		if mandate != (ublMandate{}) {
+			means.Mandate = &mandate
+		}
+		u.PaymentMeans = append(u.PaymentMeans, means)
+	}
+
+	// A credit note has no due date element in UBL 2.1. EN 16931 has a
+	// single due date, so installments are reduced to the first one.
+	if len(settlement.PaymentTerms) > 0 {
+		terms := &settlement.PaymentTerms[0]
+		if terms.Description != "" {
+			u.PaymentTerms = &ublPaymentTerms{Note: terms.Description}
+		}
+		if !creditNote {
+			u.DueDate = date("DueDateDateTime", terms.DueDate)
+		}
+	}
+
+	for _, c := range settlement.AllowanceCharges {
+		ac := ublAllowanceChargeOf(c, amount)
+		if c.CategoryTax != nil {
+			category := ublTaxCategoryOf(*c.CategoryTax)
+			ac.TaxCategory = &category
+		}
+		u.AllowanceCharges = append(u.AllowanceCharges, ac)
+	}
+
+	u.TaxTotal.TaxAmount = amount(settlement.Summation.TaxTotal.Value)
+	for _, tax := range settlement.Taxes {
+		if u.TaxPointDate == "" {
+			u.TaxPointDate = date("TaxPointDate", tax.TaxPointDate)
+		}
+		u.TaxTotal.Subtotals = append(u.TaxTotal.Subtotals, ublTaxSubtotal{
+			TaxableAmount: amount(tax.BasisAmount),
+			TaxAmount:     amount(tax.CalculatedAmount),
+			Category:      ublTaxCategoryOf(tax),
+		})
+	}
+
+	sum := &settlement.Summation
+	u.MonetaryTotal = ublMonetaryTotal{
+		LineExtension:  amount(sum.LineTotal),
+		TaxExclusive:   amount(sum.TaxBasisTotal),
+		TaxInclusive:   amount(sum.GrandTotal),
+		AllowanceTotal: optionalAmount(sum.AllowanceTotal),
+		ChargeTotal:    optionalAmount(sum.ChargeTotal),
+		Prepaid:        optionalAmount(sum.TotalPrepaid),
+		Payable:        amount(sum.DuePayable),
+	}
+
+	for _, l := range d.Transaction.Lines {
+		line := ublLine{
+			ID:            l.LineID,
+			LineExtension: amount(l.LineTotal),
+			Name:          l.Name,
+			TaxCategory:   ublTaxCategory{ID: l.Tax.CategoryCode, Percent: l.Tax.RateApplicablePercent, TaxScheme: "VAT"},
+			Price:         ublPrice{Amount: amount(l.NetPrice.ChargeAmount)},
+		}
+		quantity := &ublQuantity{Value: l.BilledQuantity.Value, UnitCode: l.BilledQuantity.UnitCode}
+		if creditNote {
+			line.CreditedQuantity = quantity
+		} else {
+			line.InvoicedQuantity = quantity
+		}
+		if p := l.BillingPeriod; p != nil {
+			line.Period = &ublPeriod{Start: date("StartDateTime", p.Start), End: date("EndDateTime", p.End)}
+		}
+		for _, c := range l.AllowanceCharges {
+			line.AllowanceCharges = append(line.AllowanceCharges, ublAllowanceChargeOf(c, amount))
+		}
+		if g := l.GrossPrice; g != nil && g.Allowance != nil {
+			line.Price.Allowance = &ublAllowanceCharge{
+				Amount:     amount(g.Allowance.ActualAmount),
+				BaseAmount: optionalAmount(g.ChargeAmount),
+			}
+		}
+		if creditNote {
+			u.CreditNoteLines = append(u.CreditNoteLines, line)
+		} else {
+			u.InvoiceLines = append(u.InvoiceLines, line)
+		}
+	}
+
+	if dateErr != nil {
+		return nil, dateErr
+	}
+	return u, nil
+}
+
+// ublPartyOf maps a CII trade party onto a UBL party.
+func ublPartyOf(p *TradeParty) ublParty {
+	party := ublParty{
+		Address: ublAddress{
+			Street:     p.Address.LineOne,
+			City:       p.Address.City,
+			PostalZone: p.Address.Postcode,
+			Country:    p.Address.CountryID,
+		},
+		LegalEntity: ublLegalEntity{Name: p.Name},
+	}
+	if p.TradingName != nil {
+		party.TradingName = &ublPartyName{Name: *p.TradingName}
+	}
+	for _, id := range p.IDs {
+		party.Identifications = append(party.Identifications, ublPartyID{ID: ublID{Value: id.Value, SchemeID: id.SchemeID}})
+	}
+	for _, id := range p.GlobalIDs {
+		party.Identifications = append(party.Identifications, ublPartyID{ID: ublID{Value: id.Value, SchemeID: id.SchemeID}})
+	}
+	for _, reg := range p.TaxRegistrations {
+		if reg.ID.SchemeID == "VA" {
+			party.TaxSchemes = append(party.TaxSchemes, ublPartyTax{CompanyID: reg.ID.Value, TaxScheme: "VAT"})
+		}
+	}
+	if id := p.LegalOrganization; id != nil {
+		party.LegalEntity.CompanyID = &ublID{Value: id.Value, SchemeID: id.SchemeID}
+	}
+	return party
+}
+
+// ublTaxCategoryOf maps a CII VAT category onto a UBL tax category.
+func ublTaxCategoryOf(tax TradeTax) ublTaxCategory {
+	return ublTaxCategory{
+		ID:                  tax.CategoryCode,
+		Percent:             tax.RateApplicablePercent,
+		ExemptionReasonCode: tax.ExemptionReasonCode,
+		ExemptionReason:     tax.ExemptionReason,
+		TaxScheme:           "VAT",
+	}
+}
+
+// ublAllowanceChargeOf maps a CII allowance or charge onto UBL.
+func ublAllowanceChargeOf(c TradeAllowanceCharge, amount func(string) ublAmount) ublAllowanceCharge {
+	ac := ublAllowanceCharge{
+		ChargeIndicator: c.ChargeIndicator,
+		ReasonCode:      c.ReasonCode,
+		Reason:          c.Reason,
+		Percent:         c.CalculationPercent,
+		Amount:          amount(c.ActualAmount),
+	}
+	if strings.TrimSpace(c.BasisAmount) != "" {
+		base := amount(c.BasisAmount)
+		ac.BaseAmount = &base
+	}
+	return ac
+}
@@ -0,0 +1,404 @@
+package facturx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UBL invoices are read through the types below, by local name, and
+// mapped onto the CrossIndustryInvoice model: the reverse of UBL. The
+// InvoiceRequest is then recovered like from a CII invoice, so UBL input
+// has the same limits as ParseXML.
+
+// ParseUBL reads an EN 16931 UBL 2.1 invoice or credit note into an
+// InvoiceRequest, like ParseXML for CII. Payment means and other elements
+// InvoiceRequest cannot represent are ignored. It returns an error
+// wrapping ErrXML if the document is not a UBL invoice or cannot be
+// mapped.
+//
+// The result is not validated; use Validate for that.
+func ParseUBL(data []byte) (*InvoiceRequest, error) {
+	doc, err := parseUBLDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return requestFromCII(doc)
+}
+
+// ConvertFromUBL turns an EN 16931 UBL invoice into a Factur-X PDF/A-3,
+// regenerating the PDF and the CII XML from the invoice data, for systems
+// that only produce UBL. It returns the errors of ParseUBL and Generate.
+func ConvertFromUBL(data []byte) ([]byte, error) {
+	req, err := ParseUBL(data)
+	if err != nil {
+		return nil, err
+	}
+	return Generate(*req)
+}
+
+// ublInput is a UBL Invoice or CreditNote.
+type ublInput struct {
+	CustomizationID    string                    `xml:"CustomizationID"`
+	ID                 string                    `xml:"ID"`
+	IssueDate          string                    `xml:"IssueDate"`
+	DueDate            string                    `xml:"DueDate"`
+	InvoiceTypeCode    string                    `xml:"InvoiceTypeCode"`
+	CreditNoteTypeCode string                    `xml:"CreditNoteTypeCode"`
+	Notes              []string                  `xml:"Note"`
+	TaxPointDate       string                    `xml:"TaxPointDate"`
+	Currency           string                    `xml:"DocumentCurrencyCode"`
+	OrderReference     *ublInputReference        `xml:"OrderReference"`
+	BillingReference   *ublInputReference        `xml:"BillingReference>InvoiceDocumentReference"`
+	DespatchReference  *ublInputReference        `xml:"DespatchDocumentReference"`
+	Additional         []ublInputReference       `xml:"AdditionalDocumentReference"`
+	Supplier           ublInputParty             `xml:"AccountingSupplierParty>Party"`
+	Customer           ublInputParty             `xml:"AccountingCustomerParty>Party"`
+	DeliveryDate       string                    `xml:"Delivery>ActualDeliveryDate"`
+	PaymentMeans       []ublInputPaymentMeans    `xml:"PaymentMeans"`
+	PaymentTerms       []string                  `xml:"PaymentTerms>Note"`
+	AllowanceCharges   []ublInputAllowanceCharge `xml:"AllowanceCharge"`
+	TaxTotals          []ublInputTaxTotal        `xml:"TaxTotal"`
+	MonetaryTotal      ublInputMonetaryTotal     `xml:"LegalMonetaryTotal"`
+	InvoiceLines       []ublInputLine            `xml:"InvoiceLine"`
+	CreditNoteLines    []ublInputLine            `xml:"CreditNoteLine"`
+}
+
+// ublInputReference is a referenced document.
+type ublInputReference struct {
+	ID          string `xml:"ID"`
+	IssueDate   string `xml:"IssueDate"`
+	TypeCode    string `xml:"DocumentTypeCode"`
+	Description string `xml:"DocumentDescription"`
+}
+
+// ublInputPaymentMeans is a payment means, with the due date of credit
+// notes and the mandate of direct debits.
+type ublInputPaymentMeans struct {
+	Code         string `xml:"PaymentMeansCode"`
+	DueDate      string `xml:"PaymentDueDate"`
+	MandateID    string `xml:"PaymentMandate>ID"`
+	PayerAccount string `xml:"PaymentMandate>PayerFinancialAccount>ID"`
+}
+
+// ublInputParty is the seller or the buyer.
+type ublInputParty struct {
+	Identifications []ublID `xml:"PartyIdentification>ID"`
+	Name            string  `xml:"PartyName>Name"`
+	Address         struct {
+		Street     string `xml:"StreetName"`
+		City       string `xml:"CityName"`
+		PostalZone string `xml:"PostalZone"`
+		Country    string `xml:"Country>IdentificationCode"`
+	} `xml:"PostalAddress"`
+	TaxSchemes []struct {
+		CompanyID string `xml:"CompanyID"`
+		TaxScheme string `xml:"TaxScheme>ID"`
+	} `xml:"PartyTaxScheme"`
+	RegistrationName string `xml:"PartyLegalEntity>RegistrationName"`
+	CompanyID        *ublID `xml:"PartyLegalEntity>CompanyID"`
+}
+
+// ublInputAllowanceCharge is an allowance or charge on the document, a
+// line or a price.
+type ublInputAllowanceCharge struct {
+	ChargeIndicator bool                 `xml:"ChargeIndicator"`
+	ReasonCode      string               `xml:"AllowanceChargeReasonCode"`
+	Reason          string               `xml:"AllowanceChargeReason"`
+	Percent         string               `xml:"MultiplierFactorNumeric"`
+	Amount          string               `xml:"Amount"`
+	BaseAmount      string               `xml:"BaseAmount"`
+	TaxCategory     *ublInputTaxCategory `xml:"TaxCategory"`
+}
+
+// ublInputTaxCategory is a VAT category and rate.
+type ublInputTaxCategory struct {
+	ID                  string `xml:"ID"`
+	Percent             string `xml:"Percent"`
+	ExemptionReasonCode string `xml:"TaxExemptionReasonCode"`
+	ExemptionReason     string `xml:"TaxExemptionReason"`
+}
+
+// ublInputTaxTotal is the VAT total and breakdown. The VAT total in
+// accounting currency (BT-111) has no breakdown.
+type ublInputTaxTotal struct {
+	TaxAmount ublAmount `xml:"TaxAmount"`
+	Subtotals []struct {
+		TaxableAmount string              `xml:"TaxableAmount"`
+		TaxAmount     string              `xml:"TaxAmount"`
+		Category      ublInputTaxCategory `xml:"TaxCategory"`
+	} `xml:"TaxSubtotal"`
+}
+
+// ublInputMonetaryTotal holds the document totals.
+type ublInputMonetaryTotal struct {
+	LineExtension  string `xml:"LineExtensionAmount"`
+	TaxExclusive   string `xml:"TaxExclusiveAmount"`
+	TaxInclusive   string `xml:"TaxInclusiveAmount"`
+	AllowanceTotal string `xml:"AllowanceTotalAmount"`
+	ChargeTotal    string `xml:"ChargeTotalAmount"`
+	Prepaid        string `xml:"PrepaidAmount"`
+	Payable        string `xml:"PayableAmount"`
+}
+
+// ublInputLine is an invoice or credit note line.
+type ublInputLine struct {
+	ID               string                    `xml:"ID"`
+	InvoicedQuantity *ublQuantity              `xml:"InvoicedQuantity"`
+	CreditedQuantity *ublQuantity              `xml:"CreditedQuantity"`
+	LineExtension    string                    `xml:"LineExtensionAmount"`
+	Period           *ublInputPeriod           `xml:"InvoicePeriod"`
+	AllowanceCharges []ublInputAllowanceCharge `xml:"AllowanceCharge"`
+	Name             string                    `xml:"Item>Name"`
+	TaxCategory      ublInputTaxCategory       `xml:"Item>ClassifiedTaxCategory"`
+	Price            string                    `xml:"Price>PriceAmount"`
+	PriceAllowance   *ublInputAllowanceCharge  `xml:"Price>AllowanceCharge"`
+}
+
+// ublInputPeriod is a billing period.
+type ublInputPeriod struct {
+	Start string `xml:"StartDate"`
+	End   string `xml:"EndDate"`
+}
+
+// parseUBLDocument reads a UBL invoice or credit note into the CII model.
+func parseUBLDocument(data []byte) (*CrossIndustryInvoice, error) {
+	switch root := xmlRoot(data); root {
+	case "Invoice", "CreditNote":
+	default:
+		return nil, fmt.Errorf("%w: root element %q is not a UBL invoice", ErrXML, root)
+	}
+	var u ublInput
+	if err := xml.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrXML, err)
+	}
+	return u.cii()
+}
+
+// cii maps a UBL invoice onto the CII model.
+func (u *ublInput) cii() (*CrossIndustryInvoice, error) {
+	var dateErr error
+	date := func(field, s string) Date {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return ""
+		}
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil && dateErr == nil {
+			dateErr = fmt.Errorf("%w: %s: invalid date %q", ErrXML, field, s)
+		}
+		return Date(t.Format("20060102"))
+	}
+
+	doc := &CrossIndustryInvoice{
+		Context: ExchangedDocumentContext{Guideline: DocumentContextParameter{ID: u.CustomizationID}},
+		Document: ExchangedDocument{
+			ID:        u.ID,
+			TypeCode:  u.InvoiceTypeCode,
+			IssueDate: date("IssueDate", u.IssueDate),
+		},
+	}
+	if u.CreditNoteTypeCode != "" {
+		doc.Document.TypeCode = u.CreditNoteTypeCode
+	}
+
+	// The subject code of a note (BT-21) prefixes its text: #AAB#...
+	for _, n := range u.Notes {
+		note := IncludedNote{Content: n}
+		if rest, ok := strings.CutPrefix(n, "#"); ok {
+			if code, content, ok := strings.Cut(rest, "#"); ok {
+				note = IncludedNote{Content: content, SubjectCode: code}
+			}
+		}
+		doc.Document.Notes = append(doc.Document.Notes, note)
+	}
+
+	agreement := &doc.Transaction.Agreement
+	agreement.Seller = u.Supplier.tradeParty()
+	agreement.Buyer = u.Customer.tradeParty()
+	if u.OrderReference != nil {
+		agreement.BuyerOrder = &ReferencedDocument{IssuerAssignedID: u.OrderReference.ID}
+	}
+	for _, a := range u.Additional {
+		agreement.Additional = append(agreement.Additional, ReferencedDocument{IssuerAssignedID: a.ID, TypeCode: a.TypeCode, Name: a.Description})
+	}
+	delivery := &doc.Transaction.Delivery
+	if u.DespatchReference != nil {
+		delivery.DespatchAdvice = &ReferencedDocument{IssuerAssignedID: u.DespatchReference.ID}
+	}
+	if u.DeliveryDate != "" {
+		delivery.ActualDelivery = &SupplyChainEvent{Date: date("ActualDeliveryDate", u.DeliveryDate)}
+	}
+
+	settlement := &doc.Transaction.Settlement
+	settlement.Currency = u.Currency
+	if ref := u.BillingReference; ref != nil {
+		settlement.InvoiceReference = &ReferencedDocument{
+			IssuerAssignedID: ref.ID,
+			IssueDate:        date("InvoiceDocumentReference", ref.IssueDate),
+		}
+	}
+	// Credit notes give their due date in the payment means
+	dueDate := u.DueDate
+	var mandateID string
+	for _, m := range u.PaymentMeans {
+		if dueDate == "" {
+			dueDate = m.DueDate
+		}
+		means := PaymentMeans{TypeCode: m.Code}
+		if m.PayerAccount != "" {
+			means.DebtorAccount = &FinancialAccount{IBAN: m.PayerAccount}
+		}
+		if mandateID == "" {
+			mandateID = m.MandateID
+		}
+		settlement.PaymentMeans = append(settlement.PaymentMeans, means)
+	}
+	// The SEPA creditor identifier is a seller identifier
+	for _, id := range u.Supplier.Identifications {
+		if id.SchemeID == "SEPA" {
+			settlement.CreditorReferenceID = id.Value
+		}
+	}
+	if dueDate != "" || len(u.PaymentTerms) > 0 || mandateID != "" {
+		settlement.PaymentTerms = []PaymentTerms{{
+			Description:          strings.Join(u.PaymentTerms, "\n"),
+			DueDate:              date("DueDate", dueDate),
+			DirectDebitMandateID: mandateID,
+		}}
+	}
+
+	for _, c := range u.AllowanceCharges {
+		charge := c.tradeAllowanceCharge()
+		if c.TaxCategory != nil {
+			tax := c.TaxCategory.tradeTax()
+			charge.CategoryTax = &tax
+		}
+		settlement.AllowanceCharges = append(settlement.AllowanceCharges, charge)
+	}
+
+	for _, total := range u.TaxTotals {
+		if len(total.Subtotals) == 0 {
+			continue
+		}
+		settlement.Summation.TaxTotal = CurrencyAmount{Value: total.TaxAmount.Value, CurrencyID: total.TaxAmount.Currency}
+		for _, s := range total.Subtotals {
+			tax := s.Category.tradeTax()
+			tax.BasisAmount, tax.CalculatedAmount = s.TaxableAmount, s.TaxAmount
+			settlement.Taxes = append(settlement.Taxes, tax)
+		}
+		break
+	}
+	if len(settlement.Taxes) > 0 {
+		settlement.Taxes[0].TaxPointDate = date("TaxPointDate", u.TaxPointDate)
+	}
+
+	m := &u.MonetaryTotal
+	settlement.Summation.LineTotal = m.LineExtension
+	settlement.Summation.ChargeTotal = m.ChargeTotal
+	settlement.Summation.AllowanceTotal = m.AllowanceTotal
+	settlement.Summation.TaxBasisTotal = m.TaxExclusive
+	settlement.Summation.GrandTotal = m.TaxInclusive
+	settlement.Summation.TotalPrepaid = m.Prepaid
+	settlement.Summation.DuePayable = m.Payable
+
+	for _, l := range append(u.InvoiceLines, u.CreditNoteLines...) {
+		line := LineItem{
+			LineID:    l.ID,
+			Name:      l.Name,
+			NetPrice:  TradePrice{ChargeAmount: l.Price},
+			Tax:       l.TaxCategory.tradeTax(),
+			LineTotal: l.LineExtension,
+		}
+		quantity := l.InvoicedQuantity
+		if quantity == nil {
+			quantity = l.CreditedQuantity
+		}
+		if quantity != nil {
+			line.BilledQuantity = Quantity{Value: quantity.Value, UnitCode: quantity.UnitCode}
+		}
+		if p := l.Period; p != nil {
+			line.BillingPeriod = &Period{Start: date("StartDate", p.Start), End: date("EndDate", p.End)}
+		}
+		for _, c := range l.AllowanceCharges {
+			line.AllowanceCharges = append(line.AllowanceCharges, c.tradeAllowanceCharge())
+		}
+		// The gross price is the base of the price discount
+		if a := l.PriceAllowance; a != nil && strings.TrimSpace(a.BaseAmount) != "" {
+			line.GrossPrice = &TradePrice{
+				ChargeAmount: a.BaseAmount,
+				Allowance:    &TradeAllowanceCharge{ActualAmount: a.Amount},
+			}
+		}
+		doc.Transaction.Lines = append(doc.Transaction.Lines, line)
+	}
+
+	if dateErr != nil {
+		return nil, dateErr
+	}
+	return doc, nil
+}
+
+// tradeParty maps a UBL party onto a CII trade party.
+func (p *ublInputParty) tradeParty() TradeParty {
+	party := TradeParty{
+		Name: p.RegistrationName,
+		Address: TradeAddress{
+			Postcode:  p.Address.PostalZone,
+			LineOne:   p.Address.Street,
+			City:      p.Address.City,
+			CountryID: p.Address.Country,
+		},
+	}
+	// The party name is the trading name (BT-28), or the only name given
+	if strings.TrimSpace(party.Name) == "" {
+		party.Name = p.Name
+	} else if name := strings.TrimSpace(p.Name); name != "" && name != party.Name {
+		party.TradingName = &name
+	}
+	for _, id := range p.Identifications {
+		// ISO 6523 schemes are 4 digits; others name professional
+		// identifiers such as ADELI or RPPS
+		switch {
+		case id.SchemeID == "SEPA":
+		case len(id.SchemeID) == 4 && isDigits(id.SchemeID):
+			party.GlobalIDs = append(party.GlobalIDs, Identifier{Value: id.Value, SchemeID: id.SchemeID})
+		default:
+			party.IDs = append(party.IDs, Identifier{Value: id.Value, SchemeID: id.SchemeID})
+		}
+	}
+	for _, s := range p.TaxSchemes {
+		if strings.TrimSpace(s.TaxScheme) == "VAT" {
+			party.TaxRegistrations = append(party.TaxRegistrations, TaxRegistration{ID: Identifier{Value: s.CompanyID, SchemeID: "VA"}})
+		}
+	}
+	if id := p.CompanyID; id != nil {
+		party.LegalOrganization = &Identifier{Value: id.Value, SchemeID: id.SchemeID}
+	}
+	return party
+}
+
+// tradeTax maps a UBL tax category onto a CII VAT category.
+func (c *ublInputTaxCategory) tradeTax() TradeTax {
+	return TradeTax{
+		TypeCode:              "VAT",
+		CategoryCode:          c.ID,
+		RateApplicablePercent: c.Percent,
+		ExemptionReasonCode:   c.ExemptionReasonCode,
+		ExemptionReason:       c.ExemptionReason,
+	}
+}
+
+// tradeAllowanceCharge maps a UBL allowance or charge onto CII, without
+// its VAT category.
+func (c *ublInputAllowanceCharge) tradeAllowanceCharge() TradeAllowanceCharge {
+	return TradeAllowanceCharge{
+		ChargeIndicator:    c.ChargeIndicator,
+		CalculationPercent: c.Percent,
+		BasisAmount:        c.BaseAmount,
+		ActualAmount:       c.Amount,
+		ReasonCode:         c.ReasonCode,
+		Reason:             c.Reason,
+	}
+}
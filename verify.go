@@ -0,0 +1,168 @@
+package facturx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GenerateVerified is like GenerateResult, but checks the invoice before
+// returning it: the XML is read back from the PDF and parsed, its totals
+// are recomputed from its lines, the EN 16931 BR-CO consistency rules
+// are checked on the declared amounts and the PDF goes through CheckPDFA.
+//
+// A failed check reveals a bug in the library rather than in the request;
+// it is reported as an error satisfying errors.Is(err, ErrVerification).
+func GenerateVerified(req InvoiceRequest) (*Result, error) {
+	res, err := GenerateResult(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyResult(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// verifyResult checks a generated invoice against its own XML.
+func verifyResult(res *Result) error {
+	embedded, err := ExtractXML(res.PDF)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	if string(embedded) != res.XML {
+		return fmt.Errorf("%w: embedded XML differs from the generated one", ErrVerification)
+	}
+	issues, err := CheckPDFA(res.PDF)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%w: PDF/A %s", ErrVerification, issues[0])
+	}
+
+	// Declared amounts against the amounts recomputed from the parsed lines
+	result, err := ValidateXML(embedded)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	_, doc, err := parseCII(embedded)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	return checkBRCO(doc, res.Totals)
+}
+
+// checkBRCO checks the BR-CO rules relating the declared totals of a CII
+// document, and that they are the totals computed for the request.
+func checkBRCO(doc *CrossIndustryInvoice, totals Totals) error {
+	if err := checkArithmetic(doc); err != nil {
+		return err
+	}
+	sum := doc.Transaction.Settlement.Summation
+	grandTotal, err := parseCIIAmount(sum.GrandTotal)
+	if err != nil {
+		return fmt.Errorf("%w: GrandTotalAmount: invalid amount %q", ErrVerification, sum.GrandTotal)
+	}
+	duePayable, err := parseCIIAmount(sum.DuePayable)
+	if err != nil {
+		return fmt.Errorf("%w: DuePayableAmount: invalid amount %q", ErrVerification, sum.DuePayable)
+	}
+	checks := []struct {
+		rule               string
+		declared, expected amount
+	}{
+		{"requested grand total", grandTotal, toAmount(totals.GrandTotal)},
+		{"requested amount due", duePayable, toAmount(totals.DuePayable)},
+	}
+	for _, c := range checks {
+		if c.declared != c.expected {
+			return fmt.Errorf("%w: %s: declared %s, expected %s", ErrVerification, c.rule, c.declared, c.expected)
+		}
+	}
+	return nil
+}
+
+// auditXML reads back the amounts of a generated CII XML, as written with
+// their rounding, and checks the BR-CO arithmetic on them, so that an
+// invoice a receiving platform would reject is never returned.
+func auditXML(data string) error {
+	_, doc, err := parseCII([]byte(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	return checkArithmetic(doc)
+}
+
+// checkArithmetic checks the BR-CO rules relating the declared totals of a
+// CII document: line total (BR-CO-10), charge total (BR-CO-12), tax basis
+// (BR-CO-13), tax total (BR-CO-14), grand total (BR-CO-15), amount due
+// (BR-CO-16) and the basis of the VAT breakdown. Amounts must match to the
+// cent.
+func checkArithmetic(doc *CrossIndustryInvoice) error {
+	var parseErr error
+	parse := func(field, s string) amount {
+		if strings.TrimSpace(s) == "" {
+			return 0
+		}
+		a, err := parseCIIAmount(s)
+		if err != nil && parseErr == nil {
+			parseErr = fmt.Errorf("%w: %s: invalid amount %q", ErrVerification, field, s)
+		}
+		return a
+	}
+
+	settlement := doc.Transaction.Settlement
+	sum := settlement.Summation
+	lineTotal := parse("LineTotalAmount", sum.LineTotal)
+	chargeTotal := parse("ChargeTotalAmount", sum.ChargeTotal)
+	taxBasis := parse("TaxBasisTotalAmount", sum.TaxBasisTotal)
+	taxTotal := parse("TaxTotalAmount", sum.TaxTotal.Value)
+	grandTotal := parse("GrandTotalAmount", sum.GrandTotal)
+	prepaid := parse("TotalPrepaidAmount", sum.TotalPrepaid)
+	duePayable := parse("DuePayableAmount", sum.DuePayable)
+
+	var lines amount
+	for i, line := range doc.Transaction.Lines {
+		lines += parse(fmt.Sprintf("Lines[%d].LineTotalAmount", i), line.LineTotal)
+	}
+	var charges amount
+	for i, c := range settlement.AllowanceCharges {
+		charges += parse(fmt.Sprintf("Charges[%d].ActualAmount", i), c.ActualAmount)
+	}
+	var vatBasis, vatAmount amount
+	for _, tax := range settlement.Taxes {
+		vatBasis += parse("ApplicableTradeTax.BasisAmount", tax.BasisAmount)
+		vatAmount += parse("ApplicableTradeTax.CalculatedAmount", tax.CalculatedAmount)
+	}
+	if parseErr != nil {
+		return parseErr
+	}
+
+	// Profiles without lines (BASIC WL) or VAT breakdown (MINIMUM) only
+	// have the rules on their header totals
+	hasLines := len(doc.Transaction.Lines) > 0
+	hasBreakdown := len(settlement.Taxes) > 0
+	checks := []struct {
+		rule               string
+		declared, expected amount
+		applies            bool
+	}{
+		{"BR-CO-10 line total", lineTotal, lines, hasLines},
+		{"BR-CO-12 charge total", chargeTotal, charges, true},
+		{"BR-CO-13 tax basis", taxBasis, lineTotal + chargeTotal, strings.TrimSpace(sum.LineTotal) != ""},
+		{"BR-CO-14 tax total", taxTotal, vatAmount, hasBreakdown},
+		{"BR-CO-15 grand total", grandTotal, taxBasis + taxTotal, true},
+		{"BR-CO-16 amount due", duePayable, grandTotal - prepaid, true},
+		{"VAT breakdown basis", vatBasis, taxBasis, hasBreakdown},
+	}
+	for _, c := range checks {
+		if c.applies && c.declared != c.expected {
+			return fmt.Errorf("%w: %s: declared %s, expected %s", ErrVerification, c.rule, c.declared, c.expected)
+		}
+	}
+	return nil
+}
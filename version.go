@@ -0,0 +1,57 @@
+package facturx
+
+// Version is the Factur-X specification version generated documents
+// follow. It selects the identifiers written in the XMP metadata, the XML
+// and the attachment; the zero value is Version1p0.
+type Version string
+
+const (
+	// Version1p0 is Factur-X 1.0 (2017), understood by every recipient.
+	Version1p0 Version = "1.0"
+	// Version1p07 is Factur-X 1.0.07. It keeps the 1.0 XMP version and
+	// BASIC guideline identifiers but declares the XML as an alternative
+	// representation of the invoice (/AFRelationship /Alternative) rather
+	// than supporting data.
+	Version1p07 Version = "1.0.07"
+)
+
+// versionSpec holds the identifiers a Factur-X version writes.
+type versionSpec struct {
+	// xmpVersion is the fx:Version XMP property.
+	xmpVersion string
+	// guideline is the specification identifier of the XML (BT-24).
+	guideline string
+	// fileName is the name of the XML attachment, also declared in XMP.
+	fileName string
+	// relationship is the /AFRelationship of the attachment.
+	relationship string
+}
+
+var versionSpecs = map[Version]versionSpec{
+	Version1p0: {
+		xmpVersion:   "1.0",
+		guideline:    "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic",
+		fileName:     "factur-x.xml",
+		relationship: "Data",
+	},
+	Version1p07: {
+		xmpVersion:   "1.0",
+		guideline:    "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic",
+		fileName:     "factur-x.xml",
+		relationship: "Alternative",
+	},
+}
+
+// Versions lists the supported Factur-X versions, oldest first.
+func Versions() []Version {
+	return []Version{Version1p0, Version1p07}
+}
+
+// specOf returns the identifiers of the version requested by req, which
+// must have been validated.
+func specOf(req *InvoiceRequest) versionSpec {
+	if spec, ok := versionSpecs[req.FacturXVersion]; ok {
+		return spec
+	}
+	return versionSpecs[Version1p0]
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/archive"
+)
+
+// archiveStore keeps every generated invoice, or is nil when archiving is
+// disabled.
+var archiveStore archive.Store
+
+// archiveInvoice stores a generated PDF and its XML, under the name of the
+// API key owner (see archive.Sub) so that clients numbering their invoices
+// alike do not collide. Failures are logged without failing the request:
+// the invoice has been generated already.
+func archiveInvoice(log *slog.Logger, owner string, req facturx.InvoiceRequest, pdf []byte) {
+	if archiveStore == nil {
+		return
+	}
+	store := archiveStore
+	if owner != "" {
+		store = archive.Sub(store, owner)
+	}
+	inv, err := archive.NewInvoice(req, pdf)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err = store.Put(ctx, inv)
+	}
+	switch {
+	case errors.Is(err, archive.ErrExists):
+		log.Warn("Invoice already archived", "number", req.Number)
+	case err != nil:
+		log.Error("Archiving failed", "number", req.Number, "err", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/archive"
+)
+
+func TestArchiveInvoicePerOwner(t *testing.T) {
+	saved := archiveStore
+	t.Cleanup(func() { archiveStore = saved })
+	root := archive.Dir(t.TempDir())
+	archiveStore = root
+
+	req := facturx.InvoiceRequest{
+		Number: "F-001",
+		Date:   "20240115",
+		Seller: facturx.Contact{Name: "ACME Corp", Address: "123 Rue de Paris", ZipCode: "75001", City: "Paris", CountryCode: "FR", Siret: "52825000400033"},
+		Buyer:  facturx.Contact{Name: "Client SA", Address: "456 Avenue des Champs", ZipCode: "69001", City: "Lyon", CountryCode: "FR"},
+		Lines:  []facturx.InvoiceLine{{Description: "Conseil", Quantity: 1, UnitPrice: 100}},
+		Regime: facturx.VatStandard(20),
+	}
+	pdfs := map[string][]byte{}
+	for _, owner := range []string{"alice", "bob", ""} {
+		req.Lines[0].UnitPrice += 100
+		pdf, err := facturx.Generate(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pdfs[owner] = pdf
+		archiveInvoice(slog.Default(), owner, req, pdf)
+	}
+
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	stores := map[string]archive.Store{
+		"alice": archive.Sub(root, "alice"),
+		"bob":   archive.Sub(root, "bob"),
+		"":      root,
+	}
+	for owner, store := range stores {
+		inv, err := store.Get(t.Context(), "F-001", date)
+		if err != nil {
+			t.Errorf("invoice of %q: %v", owner, err)
+		} else if string(inv.PDF) != string(pdfs[owner]) {
+			t.Errorf("invoice of %q was archived for another owner", owner)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiKey is a named client key. The name identifies the client in logs
+// without revealing the key; the tier selects its rate limit quota (the
+// default quota when empty).
+type apiKey struct {
+	name string
+	key  string
+	tier string
+}
+
+type apiKeyContextKey struct{}
+
+// parseAPIKeys parses "name:key[:tier]" entries separated by commas.
+func parseAPIKeys(s string) ([]apiKey, error) {
+	var keys []apiKey
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid API key entry %q, expected name:key[:tier]", entry)
+		}
+		k := apiKey{name: parts[0], key: parts[1]}
+		if len(parts) == 3 {
+			k.tier = parts[2]
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// readAPIKeysFile reads API keys from a file with one "name key [tier]"
+// entry per line. Blank lines and lines starting with # are ignored.
+func readAPIKeysFile(path string) ([]apiKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []apiKey
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"name key [tier]\"", path, n)
+		}
+		k := apiKey{name: fields[0], key: fields[1]}
+		if len(fields) == 3 {
+			k.tier = fields[2]
+		}
+		keys = append(keys, k)
+	}
+	return keys, scanner.Err()
+}
+
+// requireAPIKey rejects requests without a valid API key, given as
+// "Authorization: Bearer <key>" or "X-API-Key: <key>". It lets every
+// request through when no key is configured.
+func requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(cfg.APIKeys) == 0 {
+			next(w, r)
+			return
+		}
+
+		given := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); given == "" && strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		key, ok := lookupAPIKey(given)
+		if !ok {
+			logger(r).Warn("Rejected request without a valid API key", "ip", getClientIP(r))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			sendError(w, tr(r, "Clé d'API manquante ou invalide"), http.StatusUnauthorized)
+			return
+		}
+		setRequestKey(r, key.name)
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// lookupAPIKey returns the configured key matching the given one. Every
+// key is compared in constant time so that timing does not reveal partial
+// matches.
+func lookupAPIKey(given string) (apiKey, bool) {
+	if given == "" {
+		return apiKey{}, false
+	}
+	var match apiKey
+	found := false
+	for _, k := range cfg.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(k.key)) == 1 && !found {
+			match, found = k, true
+		}
+	}
+	return match, found
+}
+
+// requestAPIKey returns the API key the request authenticated with.
+func requestAPIKey(r *http.Request) (apiKey, bool) {
+	key, ok := r.Context().Value(apiKeyContextKey{}).(apiKey)
+	return key, ok
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// withBodyLimit caps every request body at cfg.MaxBodySize.
+func withBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeJSON decodes a single JSON value from the request body into v,
+// rejecting unknown fields and trailing data. It writes the error response
+// and returns false on failure.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errTrailingData
+	}
+	if err != nil {
+		status, message := decodeErrorMessage(r, err)
+		sendError(w, message, status)
+		return false
+	}
+	return true
+}
+
+var errTrailingData = errors.New("trailing data after JSON value")
+
+// decodeErrorMessage maps a JSON decoding error to a status and a message
+// for the client, in the request's language.
+func decodeErrorMessage(r *http.Request, err error) (int, string) {
+	var maxBytes *http.MaxBytesError
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytes):
+		return http.StatusRequestEntityTooLarge, tr(r, "Requête trop volumineuse (maximum %d octets)", maxBytes.Limit)
+	case errors.Is(err, io.EOF):
+		return http.StatusBadRequest, tr(r, "Corps de requête vide")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, tr(r, "JSON incomplet")
+	case errors.Is(err, errTrailingData):
+		return http.StatusBadRequest, tr(r, "Données inattendues après l'objet JSON")
+	case errors.As(err, &syntax):
+		return http.StatusBadRequest, tr(r, "JSON invalide à l'octet %d", syntax.Offset)
+	case errors.As(err, &typeErr):
+		return http.StatusBadRequest, tr(r, "Type invalide pour le champ %q : %s attendu", typeErr.Field, typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return http.StatusBadRequest, tr(r, "Champ inconnu : %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return http.StatusBadRequest, tr(r, "Format de requête invalide : %v", err)
+}
+
+// sendUploadError writes the response for a failed file upload.
+func sendUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		sendError(w, tr(r, "Fichier trop volumineux (maximum %d octets)", maxBytes.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	sendError(w, tr(r, "Fichier invalide : %v", err), http.StatusBadRequest)
+}
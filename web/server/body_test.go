@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveBodyLimit serves r through the middlewares and upload handlers of
+// the server, with a body limit of 1 KiB.
+func serveBodyLimit(t *testing.T, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	savedCfg, savedLimiter := cfg, limiter
+	t.Cleanup(func() { cfg, limiter = savedCfg, savedLimiter })
+	cfg = &Config{MaxBodySize: 1024, RateLimitRequests: 1000, RateLimitWindow: time.Hour}
+	limiter = newRateLimiter(newMemoryStore())
+	withOriginCheck, err := newOriginCheck(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/generate", requireAPIKey(handleGenerate))
+	mux.HandleFunc("/api/generate/csv", requireAPIKey(handleGenerateCSV))
+	mux.HandleFunc("/api/validate", requireAPIKey(handleValidate))
+	mux.HandleFunc("/api/extract", requireAPIKey(handleExtract))
+	w := httptest.NewRecorder()
+	withRequestLog(withCORS(withOriginCheck(withBodyLimit(mux)))).ServeHTTP(w, r)
+	return w
+}
+
+// multipartBody returns a multipart form with the given file in field.
+func multipartBody(t *testing.T, field string, file []byte) (string, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile(field, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(file)
+	mw.Close()
+	return mw.FormDataContentType(), &buf
+}
+
+func TestBodyLimit(t *testing.T) {
+	big := bytes.Repeat([]byte("a"), 2048)
+	bigJSON := `{"number": "` + string(big) + `"}`
+	multipartType, bigMultipart := multipartBody(t, "file", big)
+	noFileType, noFile := multipartBody(t, "other", []byte("%PDF-"))
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+		wantMessage string
+	}{
+		{"oversized JSON invoice", "/api/generate", "application/json", bigJSON, http.StatusRequestEntityTooLarge, "Requête trop volumineuse (maximum 1024 octets)"},
+		{"malformed JSON invoice", "/api/generate", "application/json", `{"number": `, http.StatusBadRequest, "JSON incomplet"},
+		{"oversized JSON to validate", "/api/validate", "application/json", bigJSON, http.StatusRequestEntityTooLarge, "Requête trop volumineuse (maximum 1024 octets)"},
+		{"oversized XML to validate", "/api/validate", "application/xml", "<a>" + string(big) + "</a>", http.StatusRequestEntityTooLarge, "Fichier trop volumineux (maximum 1024 octets)"},
+		{"oversized PDF", "/api/extract", "application/pdf", "%PDF-" + string(big), http.StatusRequestEntityTooLarge, "Fichier trop volumineux (maximum 1024 octets)"},
+		{"oversized multipart upload", "/api/extract", multipartType, bigMultipart.String(), http.StatusRequestEntityTooLarge, "Fichier trop volumineux (maximum 1024 octets)"},
+		{"multipart upload without a file", "/api/extract", noFileType, noFile.String(), http.StatusBadRequest, "Fichier invalide : http: no such file"},
+		{"oversized CSV", "/api/generate/csv", "text/csv", "number\n" + string(big), http.StatusRequestEntityTooLarge, "Fichier trop volumineux (maximum 1024 octets)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := serveBodyLimit(t, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+			var body struct{ Message string }
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Message != tt.wantMessage {
+				t.Errorf("body = %s, want message %q", w.Body, tt.wantMessage)
+			}
+		})
+	}
+}
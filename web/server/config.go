@@ -0,0 +1,262 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+)
+
+// Config holds the server settings. Each setting can be given as a flag or
+// as a FACTURX_* environment variable (see envVars); flags take precedence.
+type Config struct {
+	Addr              string
+	RateLimitRequests int
+	RateLimitWindow   time.Duration
+	RateLimitTiers    map[string]quota // named quotas assigned to API keys
+	RedisURL          string           // shared rate limit store; empty keeps it in memory
+	MaxBodySize       int64            // in bytes
+	TrustedProxies    []netip.Prefix
+	LogLevel          slog.Level
+	LogFormat         string // text or json
+
+	// TLS: either a certificate and key, or domains for Let's Encrypt
+	TLSCert     string
+	TLSKey      string
+	TLSDomains  []string
+	TLSCacheDir string
+	HTTPAddr    string // plain HTTP listener redirecting to HTTPS
+
+	// API keys required on the /api endpoints; none disables authentication
+	APIKeys []apiKey
+
+	// Asynchronous jobs: results are kept JobTTL after completion
+	JobTTL              time.Duration
+	WebhookSecret       string
+	WebhookAllowPrivate bool // allow webhooks to private addresses
+
+	// Invoice templates, stored as JSON
+	TemplatesFile string
+
+	// Archive of generated invoices: a directory or s3://bucket/prefix;
+	// empty disables archiving
+	Archive string
+
+	// INSEE API key enabling SIRET lookups (/api/companies); empty
+	// disables them
+	SireneAPIKey string
+
+	// Factur-X specification version of generated invoices
+	FacturXVersion facturx.Version
+	// Write generated PDFs with object and cross-reference streams
+	ObjectStreams bool
+
+	// CORS: origins allowed to call the API ("*" for any); none disables CORS
+	CORSOrigins []string
+	CORSMethods []string
+	CORSHeaders []string
+	CORSMaxAge  time.Duration
+}
+
+// envVars maps flag names to their environment variable.
+var envVars = map[string]string{
+	"addr":                  "FACTURX_ADDR",
+	"rate-limit-requests":   "FACTURX_RATE_LIMIT_REQUESTS",
+	"rate-limit-window":     "FACTURX_RATE_LIMIT_WINDOW",
+	"rate-limit-tiers":      "FACTURX_RATE_LIMIT_TIERS",
+	"redis-url":             "FACTURX_REDIS_URL",
+	"max-body-size":         "FACTURX_MAX_BODY_SIZE",
+	"trusted-proxies":       "FACTURX_TRUSTED_PROXIES",
+	"log-level":             "FACTURX_LOG_LEVEL",
+	"log-format":            "FACTURX_LOG_FORMAT",
+	"tls-cert":              "FACTURX_TLS_CERT",
+	"tls-key":               "FACTURX_TLS_KEY",
+	"tls-domains":           "FACTURX_TLS_DOMAINS",
+	"tls-cache-dir":         "FACTURX_TLS_CACHE_DIR",
+	"http-addr":             "FACTURX_HTTP_ADDR",
+	"api-keys":              "FACTURX_API_KEYS",
+	"api-keys-file":         "FACTURX_API_KEYS_FILE",
+	"job-ttl":               "FACTURX_JOB_TTL",
+	"webhook-secret":        "FACTURX_WEBHOOK_SECRET",
+	"webhook-allow-private": "FACTURX_WEBHOOK_ALLOW_PRIVATE",
+	"templates-file":        "FACTURX_TEMPLATES_FILE",
+	"archive":               "FACTURX_ARCHIVE",
+	"sirene-api-key":        "FACTURX_SIRENE_API_KEY",
+	"facturx-version":       "FACTURX_VERSION",
+	"object-streams":        "FACTURX_OBJECT_STREAMS",
+	"cors-origins":          "FACTURX_CORS_ORIGINS",
+	"cors-methods":          "FACTURX_CORS_METHODS",
+	"cors-headers":          "FACTURX_CORS_HEADERS",
+	"cors-max-age":          "FACTURX_CORS_MAX_AGE",
+}
+
+// loadConfig reads the configuration from the environment and args.
+func loadConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	var err error
+	fs := flag.NewFlagSet("facturx-server", flag.ContinueOnError)
+
+	fs.StringVar(&cfg.Addr, "addr", ":9473", "listen address")
+	fs.IntVar(&cfg.RateLimitRequests, "rate-limit-requests", 10, "invoices allowed per client and window")
+	fs.DurationVar(&cfg.RateLimitWindow, "rate-limit-window", time.Hour, "rate limit window")
+	tiers := fs.String("rate-limit-tiers", "", "comma-separated tier=requests/window quotas, e.g. free=10/1h,pro=1000/1h")
+	fs.StringVar(&cfg.RedisURL, "redis-url", "", "redis://[:password@]host[:port][/db] to share rate limits between instances")
+	fs.Int64Var(&cfg.MaxBodySize, "max-body-size", 10<<20, "maximum upload size in bytes")
+	proxies := fs.String("trusted-proxies", "127.0.0.0/8,::1", "comma-separated IPs or CIDRs of the reverse proxies allowed to set X-Forwarded-For and X-Real-IP (empty: none)")
+	level := fs.String("log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", "text", "log format: text or json")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "TLS certificate file (PEM)")
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "TLS private key file (PEM)")
+	domains := fs.String("tls-domains", "", "comma-separated domains to get Let's Encrypt certificates for")
+	fs.StringVar(&cfg.TLSCacheDir, "tls-cache-dir", "certs", "directory caching Let's Encrypt certificates")
+	fs.StringVar(&cfg.HTTPAddr, "http-addr", "", "plain HTTP address redirecting to HTTPS (and answering ACME challenges)")
+	keys := fs.String("api-keys", "", "comma-separated name:key pairs required on the API (empty: no authentication)")
+	keysFile := fs.String("api-keys-file", "", "file of API keys, one \"name key [tier]\" entry per line")
+	fs.DurationVar(&cfg.JobTTL, "job-ttl", time.Hour, "how long finished job results are kept")
+	fs.StringVar(&cfg.WebhookSecret, "webhook-secret", "", "secret signing job webhooks (X-Facturx-Signature)")
+	fs.BoolVar(&cfg.WebhookAllowPrivate, "webhook-allow-private", false, "allow job webhooks to loopback and private addresses")
+	fs.StringVar(&cfg.TemplatesFile, "templates-file", "templates.json", "JSON file storing invoice templates")
+	fs.StringVar(&cfg.Archive, "archive", "", "directory or s3://bucket/prefix archiving every generated PDF and XML (empty: disabled)")
+	fs.StringVar(&cfg.SireneAPIKey, "sirene-api-key", "", "INSEE Sirene API key enabling SIRET lookups (empty: disabled)")
+	version := fs.String("facturx-version", string(facturx.Version1p0), "Factur-X specification version of generated invoices: 1.0 or 1.0.07")
+	fs.BoolVar(&cfg.ObjectStreams, "object-streams", false, "write generated PDFs with compressed object and cross-reference streams (PDF 1.5)")
+	origins := fs.String("cors-origins", "", "comma-separated origins allowed to call the API, or * (empty: no CORS)")
+	methods := fs.String("cors-methods", "GET,POST", "comma-separated methods allowed in cross-origin requests")
+	headers := fs.String("cors-headers", "Content-Type,Authorization,X-API-Key", "comma-separated headers allowed in cross-origin requests")
+	fs.DurationVar(&cfg.CORSMaxAge, "cors-max-age", 10*time.Minute, "how long browsers may cache preflight responses")
+
+	// Environment first, so that flags override it
+	for name, key := range envVars {
+		if v, ok := os.LookupEnv(key); ok {
+			if err := fs.Set(name, v); err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", key, v, err)
+			}
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if cfg.RateLimitRequests < 1 || cfg.RateLimitWindow <= 0 {
+		return nil, fmt.Errorf("rate limit must allow at least 1 request over a positive window")
+	}
+	if cfg.MaxBodySize <= 0 {
+		return nil, fmt.Errorf("max body size must be positive")
+	}
+	if err := cfg.LogLevel.UnmarshalText([]byte(*level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", *level)
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return nil, fmt.Errorf("invalid log format %q", cfg.LogFormat)
+	}
+	for _, p := range strings.Split(*proxies, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		prefix, err := parsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", p)
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, prefix)
+	}
+	cfg.TLSDomains = splitList(*domains)
+	cfg.CORSOrigins = splitList(*origins)
+	cfg.CORSMethods = splitList(*methods)
+	cfg.CORSHeaders = splitList(*headers)
+
+	if cfg.RateLimitTiers, err = parseTiers(*tiers); err != nil {
+		return nil, err
+	}
+	apiKeys, err := parseAPIKeys(*keys)
+	if err != nil {
+		return nil, err
+	}
+	cfg.APIKeys = apiKeys
+	if *keysFile != "" {
+		fileKeys, err := readAPIKeysFile(*keysFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.APIKeys = append(cfg.APIKeys, fileKeys...)
+	}
+	for _, k := range cfg.APIKeys {
+		if _, ok := cfg.RateLimitTiers[k.tier]; k.tier != "" && !ok {
+			return nil, fmt.Errorf("API key %s: unknown rate limit tier %q", k.name, k.tier)
+		}
+	}
+
+	cfg.FacturXVersion = facturx.Version(*version)
+	if !slices.Contains(facturx.Versions(), cfg.FacturXVersion) {
+		return nil, fmt.Errorf("invalid Factur-X version %q", *version)
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("tls-cert and tls-key must be set together")
+	}
+	if cfg.TLSCert != "" && len(cfg.TLSDomains) > 0 {
+		return nil, fmt.Errorf("tls-domains cannot be combined with tls-cert")
+	}
+	if cfg.HTTPAddr != "" && !cfg.TLS() {
+		return nil, fmt.Errorf("http-addr requires TLS")
+	}
+	return cfg, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseTiers parses "name=requests/window" quotas separated by commas.
+func parseTiers(s string) (map[string]quota, error) {
+	tiers := make(map[string]quota)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, spec, _ := strings.Cut(entry, "=")
+		requests, window, _ := strings.Cut(spec, "/")
+		q := quota{}
+		var err1, err2 error
+		q.limit, err1 = strconv.Atoi(requests)
+		q.window, err2 = time.ParseDuration(window)
+		if name == "" || err1 != nil || err2 != nil || q.limit < 1 || q.window <= 0 {
+			return nil, fmt.Errorf("invalid rate limit tier %q, expected name=requests/window", entry)
+		}
+		tiers[name] = q
+	}
+	return tiers, nil
+}
+
+// parsePrefix parses a CIDR or a single IP address. IPv4-mapped IPv6
+// addresses are read as IPv4, like client addresses.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// TLS reports whether the server terminates TLS itself.
+func (c *Config) TLS() bool {
+	return c.TLSCert != "" || len(c.TLSDomains) > 0
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveChain serves r through the middlewares of the server, as set up by
+// main, in front of a handler answering 200.
+func serveChain(t *testing.T, origins []string, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = &Config{
+		CORSOrigins: origins,
+		CORSMethods: []string{"GET", "POST"},
+		CORSHeaders: []string{"Content-Type"},
+		MaxBodySize: 1 << 20,
+	}
+	withOriginCheck, err := newOriginCheck(cfg.CORSOrigins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	withRequestLog(withCORS(withOriginCheck(withBodyLimit(ok)))).ServeHTTP(w, r)
+	return w
+}
+
+func TestOriginCheck(t *testing.T) {
+	const allowed = "https://app.example.com"
+	tests := []struct {
+		name    string
+		origins []string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"cross-site POST", []string{allowed}, "POST", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"cross-site POST without CORS origins", nil, "POST", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusForbidden},
+		{"cross-origin POST from an old browser", []string{allowed}, "POST", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"POST from a CORS origin", []string{allowed}, "POST", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": allowed}, http.StatusOK},
+		{"same-origin POST", []string{allowed}, "POST", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://invoices.example"}, http.StatusOK},
+		{"POST without browser headers", []string{allowed}, "POST", nil, http.StatusOK},
+		{"cross-site GET", []string{allowed}, "GET", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusOK},
+		{"cross-site POST with a wildcard origin", []string{"*"}, "POST", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://invoices.example/api/generate", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := serveChain(t, tt.origins, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+			if w.Header().Get("X-Request-ID") == "" {
+				t.Error("request not logged: no X-Request-ID")
+			}
+			if tt.want != http.StatusForbidden {
+				return
+			}
+			var body struct{ Message string }
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Message != "Requête provenant d'une autre origine refusée" {
+				t.Errorf("body = %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestOriginCheckCORSHeaders(t *testing.T) {
+	const allowed = "https://app.example.com"
+	r := httptest.NewRequest("POST", "http://invoices.example/api/generate", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	r.Header.Set("Origin", allowed)
+	w := serveChain(t, []string{allowed}, r)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != allowed {
+		t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, allowed)
+	}
+
+	// A preflight is an OPTIONS request, which the check lets through
+	r = httptest.NewRequest("OPTIONS", "http://invoices.example/api/generate", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	r.Header.Set("Origin", allowed)
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	if w := serveChain(t, []string{allowed}, r); w.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d, want 204", w.Code)
+	}
+}
+
+func TestNewOriginCheckInvalidOrigin(t *testing.T) {
+	if _, err := newOriginCheck([]string{"app.example.com/path"}); err == nil {
+		t.Error("newOriginCheck accepted an invalid origin")
+	}
+}
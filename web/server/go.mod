@@ -4,4 +4,10 @@ go 1.25
 
 require github.com/audrenbdb/facturx v0.0.0
 
+require (
+	golang.org/x/crypto v0.40.0
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
+)
+
 replace github.com/audrenbdb/facturx => ../..
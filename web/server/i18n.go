@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+	"github.com/audrenbdb/facturx/csvimport"
+)
+
+// Error messages are written in French in the code; english translates
+// them, keyed by the French format string. Messages missing from the
+// catalog are served in French.
+var english = map[string]string{
+	// Requests
+	"Corps de requête vide":                         "Empty request body",
+	"JSON incomplet":                                "Incomplete JSON",
+	"Données inattendues après l'objet JSON":        "Unexpected data after the JSON value",
+	"JSON invalide à l'octet %d":                    "Invalid JSON at byte %d",
+	"Type invalide pour le champ %q : %s attendu":   "Invalid type for field %q: expected %s",
+	"Champ inconnu : %s":                            "Unknown field: %s",
+	"Format de requête invalide : %v":               "Invalid request format: %v",
+	"Requête trop volumineuse (maximum %d octets)":  "Request too large (maximum %d bytes)",
+	"Fichier trop volumineux (maximum %d octets)":   "File too large (maximum %d bytes)",
+	"Fichier invalide : %v":                         "Invalid file: %v",
+	"PDF invalide : %v":                             "Invalid PDF: %v",
+	"XML invalide : %v":                             "Invalid XML: %v",
+	"format de date invalide":                       "invalid date format",
+	"Clé d'API manquante ou invalide":               "Missing or invalid API key",
+	"Requête provenant d'une autre origine refusée": "Cross-origin request rejected",
+
+	// Rate limit
+	"Rate limit dépassé. Limite : %d factures %s. Réessayez dans %d minutes.": "Rate limit exceeded. Limit: %d invoices %s. Try again in %d minutes.",
+	"par heure":     "per hour",
+	"par minute":    "per minute",
+	"par jour":      "per day",
+	"toutes les %s": "every %s",
+
+	// Generation
+	"Facture invalide":                            "Invalid invoice",
+	"Erreur de génération : %v":                   "Generation error: %v",
+	"Erreur de prévisualisation : %v":             "Preview error: %v",
+	"Le lot doit contenir entre 1 et %d factures": "A batch must contain between 1 and %d invoices",
+	"CSV invalide : %v":                           "Invalid CSV: %v",
+	"Séparateur invalide : %q":                    "Invalid separator: %q",
+	"Ligne %d : valeur invalide (%v)":             "Line %d: invalid value (%v)",
+
+	// Jobs
+	"URL de webhook invalide":                    "Invalid webhook URL",
+	"File d'attente pleine, réessayez plus tard": "Queue full, try again later",
+	"Tâche introuvable":                          "Job not found",
+	"Résultat indisponible : la tâche n'est pas terminée ou a échoué": "Result unavailable: the job has not finished or has failed",
+
+	// Templates
+	"Modèle inconnu : %s": "Unknown template: %s",
+	"Modèles indisponibles : le serveur n'a pas de clé d'API":               "Templates unavailable: the server has no API key",
+	"Nombre maximal de modèles atteint (%d)":                                "Maximum number of templates reached (%d)",
+	"Modèle introuvable":                                                    "Template not found",
+	"Identifiant de modèle invalide (lettres, chiffres, - et _ uniquement)": "Invalid template ID (letters, digits, - and _ only)",
+	"Un modèle porte déjà cet identifiant":                                  "A template with this ID already exists",
+	"L'identifiant du corps ne correspond pas à l'URL":                      "The ID in the body does not match the URL",
+	"Impossible d'enregistrer les modèles":                                  "Templates could not be saved",
+	"Régime de TVA invalide":                                                "Invalid VAT regime",
+
+	// Sirene
+	"Recherche SIRET non configurée":                               "SIRET lookup is not configured",
+	"SIRET invalide (14 chiffres avec une clé de contrôle valide)": "Invalid SIRET (14 digits with a valid check digit)",
+	"SIRET inconnu du répertoire Sirene":                           "SIRET not found in the Sirene directory",
+	"Répertoire Sirene indisponible":                               "Sirene directory unavailable",
+
+	// Samples
+	"Exemple introuvable":                              "Sample not found",
+	"Profil d'exemple inconnu : %s (disponibles : %s)": "Unknown sample persona: %s (available: %s)",
+}
+
+// french translates the library's validation messages, which are English.
+var french = map[string]string{
+	"invoice number cannot be empty":                                 "le numéro de facture est obligatoire",
+	"date must be in YYYYMMDD format":                                "la date doit être au format AAAAMMJJ",
+	"date must contain only digits":                                  "la date ne doit contenir que des chiffres",
+	"invalid date values":                                            "date invalide",
+	"unsupported invoice type code":                                  "type de facture non pris en charge",
+	"corrective invoice must reference the corrected invoice":        "une facture rectificative doit référencer la facture corrigée",
+	"preceding invoice number cannot be empty":                       "le numéro de la facture corrigée est obligatoire",
+	"prepaid amount cannot be negative":                              "l'acompte ne peut pas être négatif",
+	"invoice must have at least one line":                            "la facture doit comporter au moins une ligne",
+	"quantity cannot be zero":                                        "la quantité ne peut pas être nulle",
+	"eco-contribution must have the sign of the quantity":            "l'éco-participation doit être du signe de la quantité",
+	"charge amount must be positive":                                 "le montant des frais doit être positif",
+	"charge reason cannot be empty":                                  "le motif des frais est obligatoire",
+	"charge VAT rate must match the invoice VAT rate":                "le taux de TVA des frais doit être celui de la facture",
+	"unit price cannot be negative":                                  "le prix unitaire ne peut pas être négatif",
+	"gross price cannot be lower than unit price":                    "le prix brut ne peut pas être inférieur au prix unitaire",
+	"discount must be between 0 and 100 percent":                     "la remise doit être comprise entre 0 et 100 %",
+	"penalty rate cannot be negative":                                "le taux des pénalités de retard ne peut pas être négatif",
+	"cash discount must be between 0 and 100 percent":                "l'escompte doit être compris entre 0 et 100 %",
+	"cash discount days cannot be negative":                          "le délai d'escompte ne peut pas être négatif",
+	"billing period end cannot be before start":                      "la fin de période ne peut pas précéder son début",
+	"date must be in DD/MM/YYYY format":                              "la date doit être au format JJ/MM/AAAA",
+	"seller name cannot be empty":                                    "le nom du vendeur est obligatoire",
+	"buyer name cannot be empty":                                     "le nom de l'acheteur est obligatoire",
+	"VAT rate cannot be negative":                                    "le taux de TVA ne peut pas être négatif",
+	"tax point date and VAT due date type are mutually exclusive":    "la date d'exigibilité et le type d'exigibilité de la TVA sont incompatibles",
+	"unknown VAT due date type code":                                 "type d'exigibilité de la TVA inconnu",
+	"due date and installments are mutually exclusive":               "la date d'échéance et l'échéancier sont incompatibles",
+	"installment due date is required":                               "la date de l'échéance est obligatoire",
+	"installments must be in due date order":                         "les échéances doivent être classées par date",
+	"installment amount must be positive":                            "le montant de l'échéance doit être positif",
+	"direct debit mandate reference is required":                     "la référence unique du mandat de prélèvement est obligatoire",
+	"SEPA creditor identifier is required":                           "l'identifiant créancier SEPA est obligatoire",
+	"invalid IBAN":                                                   "IBAN invalide",
+	"payment means must be a UNTDID 4461 code":                       "le moyen de paiement doit être un code UNTDID 4461",
+	"direct debit requires payment means 59":                         "le prélèvement impose le moyen de paiement 59",
+	"seller VAT number is required for reverse charge":               "le numéro de TVA du vendeur est obligatoire en autoliquidation",
+	"buyer VAT number is required for reverse charge":                "le numéro de TVA de l'acheteur est obligatoire en autoliquidation",
+	"value must be a finite number":                                  "la valeur doit être un nombre fini",
+	"font name must be printable ASCII without spaces or delimiters": "le nom de police doit être en ASCII imprimable, sans espace ni délimiteur",
+	"unknown Factur-X version":                                       "version Factur-X inconnue",
+	"SIRET must be 14 digits":                                        "le SIRET doit comporter 14 chiffres",
+	"SIRET must contain only digits":                                 "le SIRET ne doit contenir que des chiffres",
+	"SIRET, SIREN or RCS number is required":                         "le SIRET, le SIREN ou le numéro RCS est obligatoire",
+	"SIREN must be 9 digits":                                         "le SIREN doit comporter 9 chiffres",
+	"SIREN checksum invalid (Luhn)":                                  "SIREN invalide (clé de Luhn)",
+	"SIRET must start with the SIREN":                                "le SIRET doit commencer par le SIREN",
+	"unknown locale":                                                 "format régional inconnu",
+	"unknown XML format":                                             "format XML inconnu",
+	"SIRET and SIREN only apply to French sellers":                   "le SIRET et le SIREN ne concernent que les vendeurs établis en France",
+	"seller VAT number is required outside France":                   "le numéro de TVA du vendeur est obligatoire hors de France",
+	"seller VAT number must start with its country prefix":           "le numéro de TVA du vendeur doit commencer par le préfixe de son pays",
+	"franchise en base only applies to French sellers":               "la franchise en base (art. 293 B du CGI) ne concerne que les vendeurs établis en France",
+	"SIRET checksum invalid (Luhn)":                                  "SIRET invalide (clé de Luhn)",
+	"scheme must be a 4-digit ISO 6523 code":                         "le schéma doit être un code ISO 6523 à 4 chiffres",
+	"identifier value cannot be empty":                               "l'identifiant est obligatoire",
+	"country code must be 2 letters":                                 "le code pays doit comporter 2 lettres",
+	"country code must contain only letters":                         "le code pays ne doit contenir que des lettres",
+	"share capital cannot be negative":                               "le capital social ne peut pas être négatif",
+	"RCS city requires a SIRET or SIREN":                             "la ville du RCS impose un SIRET ou un SIREN",
+	"NAF code must be 4 digits and a letter":                         "le code NAF doit comporter 4 chiffres et une lettre",
+	"missing or invalid amount":                                      "montant absent ou invalide",
+	"unknown Factur-X profile":                                       "profil Factur-X inconnu",
+	"layout values cannot be negative":                               "les dimensions de mise en page ne peuvent pas être négatives",
+	"margin must be between 10 and 150 points":                       "la marge doit être comprise entre 10 et 150 points",
+	"row height must be between 14 and 60 points":                    "la hauteur de ligne doit être comprise entre 14 et 60 points",
+	"table columns must be in order and fit the page":                "les colonnes du tableau doivent être dans l'ordre et tenir dans la page",
+	"supplement ID cannot be empty":                                  "la référence du document joint est obligatoire",
+	"supplement file name must be ASCII and end in .pdf":             "le nom du document joint doit être en ASCII et finir par .pdf",
+	"supplement file names must be unique":                           "les noms des documents joints doivent être uniques",
+	"supplement must be a PDF document":                              "le document joint doit être un PDF",
+	"file header must be %PDF-1.n followed by a binary comment":      "l'en-tête du fichier doit être %PDF-1.n suivi d'un commentaire binaire",
+	"trailer must have a file identifier (/ID)":                      "le trailer doit comporter un identifiant de fichier (/ID)",
+	"catalog has no XMP metadata stream":                             "le catalogue n'a pas de métadonnées XMP",
+	"XMP metadata stream must not be filtered":                       "le flux de métadonnées XMP ne doit pas être compressé",
+	"XMP metadata does not declare PDF/A-3 (pdfaid:part)":            "les métadonnées XMP ne déclarent pas PDF/A-3 (pdfaid:part)",
+	"XMP metadata has no valid pdfaid:conformance":                   "les métadonnées XMP n'ont pas de pdfaid:conformance valide",
+	"catalog has no PDF/A output intent with an ICC profile":         "le catalogue n'a pas d'OutputIntent PDF/A avec profil ICC",
+	"interactive forms cannot use NeedAppearances or XFA":            "les formulaires ne peuvent pas utiliser NeedAppearances ni XFA",
+	"file specification needs /F, /UF and /AFRelationship":           "la pièce jointe doit comporter /F, /UF et /AFRelationship",
+	"embedded file has no MIME type (/Subtype)":                      "la pièce jointe n'a pas de type MIME (/Subtype)",
+	"streams cannot reference external files":                        "un flux ne peut pas référencer un fichier externe",
+	"LZW compression is forbidden":                                   "la compression LZW est interdite",
+	"additional actions (/AA) are forbidden":                         "les actions additionnelles (/AA) sont interdites",
+	"JavaScript is forbidden":                                        "le JavaScript est interdit",
+	"font program is not embedded":                                   "une police n'est pas incorporée",
+	"annotation must be printable and visible":                       "une annotation doit être imprimable et visible",
+	"issue date is in the future":                                    "la date d'émission est dans le futur",
+	"due date is before the issue date":                              "l'échéance est antérieure à la date d'émission",
+	"invoice total is zero":                                          "le montant de la facture est nul",
+	"annotation has no appearance stream":                            "une annotation n'a pas d'apparence (/AP)",
+}
+
+// frenchPatterns translates library messages containing values.
+var frenchPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`^quantity (\S+) exceeds limit (\S+)$`), "la quantité $1 dépasse la limite de $2"},
+	{regexp.MustCompile(`^line amount (\S+) exceeds limit (\S+)$`), "le montant de ligne $1 dépasse la limite de $2"},
+	{regexp.MustCompile(`^grand total (\S+) exceeds limit (\S+)$`), "le total TTC $1 dépasse la limite de $2"},
+	{regexp.MustCompile(`^unit price (\S+) exceeds limit (\S+)$`), "le prix unitaire $1 dépasse la limite de $2"},
+	{regexp.MustCompile(`^issue date is more than (\d+) years old$`), "la date d'émission remonte à plus de $1 ans"},
+	{regexp.MustCompile(`^declared (\S+), computed (\S+)$`), "déclaré $1, calculé $2"},
+	{regexp.MustCompile(`^XMP metadata declare the (.+) profile, the XML (.+)$`), "les métadonnées XMP déclarent le profil $1, le XML $2"},
+	{regexp.MustCompile(`^installments add up to (\S+), the amount due is (\S+)$`), "les échéances totalisent $1, le montant dû est de $2"},
+	{regexp.MustCompile(`^footer cannot exceed (\d+) lines$`), "le pied de page ne peut pas dépasser $1 lignes"},
+	{regexp.MustCompile(`^(\S+) actions are forbidden$`), "les actions $1 sont interdites"},
+	{regexp.MustCompile(`^(\S+) annotations are forbidden$`), "les annotations $1 sont interdites"},
+}
+
+// language returns "en" or "fr" from the Accept-Language header, French
+// being the default.
+func language(r *http.Request) string {
+	best, bestQ := "fr", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if (primary == "fr" || primary == "en") && q > bestQ {
+			best, bestQ = primary, q
+		}
+	}
+	return best
+}
+
+// tr formats a French message in the request's language.
+func tr(r *http.Request, format string, args ...any) string {
+	return trLang(language(r), format, args...)
+}
+
+// trLang formats a French message in lang.
+func trLang(lang, format string, args ...any) string {
+	if lang == "en" {
+		if translated, ok := english[format]; ok {
+			format = translated
+		}
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// trError translates an error whose message is a catalog entry, such as
+// those returned by api.GenerateRequest.ToInvoiceRequest.
+func trError(lang string, err error) string {
+	msg := err.Error()
+	if translated, ok := english[msg]; ok && lang == "en" {
+		return translated
+	}
+	return msg
+}
+
+// translateIssue converts a library validation finding to a JSON issue in
+// lang, with the field addressed as in the JSON request.
+func translateIssue(lang, field, message string) api.IssueJSON {
+	if lang == "fr" {
+		if translated, ok := french[message]; ok {
+			message = translated
+		} else {
+			for _, p := range frenchPatterns {
+				if p.re.MatchString(message) {
+					message = p.re.ReplaceAllString(message, p.repl)
+					break
+				}
+			}
+		}
+	}
+	return api.IssueJSON{Field: jsonField(field), Message: message}
+}
+
+// jsonFields maps library field names to the GenerateRequest JSON names.
+var jsonFields = map[string]string{
+	"Number":      "number",
+	"Date":        "date",
+	"Lines":       "lines",
+	"Regime":      "lines[0].vatRegime",
+	"Name":        "name",
+	"Siret":       "siret",
+	"Siren":       "siren",
+	"VatNumber":   "vatNumber",
+	"Address":     "street",
+	"ZipCode":     "postalCode",
+	"City":        "city",
+	"Seller":      "seller",
+	"Buyer":       "buyer",
+	"Quantity":    "quantity",
+	"UnitPrice":   "unitPrice",
+	"Description": "description",
+	"Layout":      "layout",
+	"Margin":      "margin",
+	"RowHeight":   "rowHeight",
+	"Supplements": "supplements",
+	"ID":          "id",
+	"FileName":    "fileName",
+	"Data":        "data",
+	"XMLFormat":   "xmlFormat",
+}
+
+// jsonField converts a library field path such as "Lines[0].UnitPrice" to
+// its JSON path ("lines[0].unitPrice"). Fields without a JSON counterpart,
+// such as XML element names, are returned unchanged.
+func jsonField(field string) string {
+	if field == "" {
+		return field
+	}
+	parts := strings.Split(field, ".")
+	for i, part := range parts {
+		name, index, _ := strings.Cut(part, "[")
+		mapped, ok := jsonFields[name]
+		if !ok {
+			return field
+		}
+		if index != "" {
+			mapped += "[" + index
+		}
+		parts[i] = mapped
+	}
+	return strings.Join(parts, ".")
+}
+
+// issueFromError converts a generation error to an issue in lang.
+func issueFromError(lang string, err error) api.IssueJSON {
+	var verr facturx.ValidationError
+	if errors.As(err, &verr) {
+		return translateIssue(lang, verr.Field, verr.Message)
+	}
+	var rowErr *csvimport.RowError
+	if errors.As(err, &rowErr) {
+		return api.IssueJSON{Field: rowErr.Column, Message: trLang(lang, "Ligne %d : valeur invalide (%v)", rowErr.Line, rowErr.Err)}
+	}
+	return api.IssueJSON{Message: trError(lang, err)}
+}
+
+// validationReport converts a validation result to its JSON representation
+// in the request's language.
+func validationReport(r *http.Request, result facturx.ValidationResult) api.ValidationReport {
+	lang := language(r)
+	report := api.NewValidationReport(result)
+	for i, e := range result.Errors {
+		report.Errors[i] = translateIssue(lang, e.Field, e.Message)
+		report.Errors[i].Rule = e.Rule
+	}
+	for i, w := range result.Warnings {
+		report.Warnings[i] = translateIssue(lang, w.Field, w.Message)
+	}
+	return report
+}
+
+// sendGenerationError reports a failed generation. An invalid invoice gets
+// a 422 with the offending field; other errors are reported with status,
+// formatted with the catalog entry format.
+func sendGenerationError(w http.ResponseWriter, r *http.Request, err error, status int, format string) {
+	var verr facturx.ValidationError
+	if errors.As(err, &verr) {
+		sendErrorResponse(w, ErrorResponse{
+			Message: tr(r, "Facture invalide"),
+			Errors:  []api.IssueJSON{translateIssue(language(r), verr.Field, verr.Message)},
+		}, http.StatusUnprocessableEntity)
+		return
+	}
+	sendError(w, tr(r, format, err), status)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestFrenchLibraryMessages checks that every validation message of the
+// library, found as a Message literal in its sources, has a French
+// translation.
+func TestFrenchLibraryMessages(t *testing.T) {
+	files, err := filepath.Glob("../../*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal := regexp.MustCompile(`Message:\s+("(?:[^"\\]|\\.)*")`)
+	found := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range literal.FindAllStringSubmatch(string(src), -1) {
+			message, err := strconv.Unquote(m[1])
+			if err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			found++
+			if got := translateIssue("fr", "", message).Message; got == message {
+				t.Errorf("%s: no French translation for %q", filepath.Base(file), message)
+			}
+		}
+	}
+	if found < 50 {
+		t.Errorf("found %d messages in the library sources, expected more", found)
+	}
+}
+
+func TestFrenchPatterns(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"quantity 2000.00 exceeds limit 1000.00", "la quantité 2000.00 dépasse la limite de 1000.00"},
+		{"issue date is more than 10 years old", "la date d'émission remonte à plus de 10 ans"},
+		{"declared 1300.00, computed 1200.00", "déclaré 1300.00, calculé 1200.00"},
+		{"installments add up to 100.00, the amount due is 120.00", "les échéances totalisent 100.00, le montant dû est de 120.00"},
+		{"footer cannot exceed 4 lines", "le pied de page ne peut pas dépasser 4 lignes"},
+		{"an unknown message", "an unknown message"},
+	}
+	for _, tt := range tests {
+		if got := translateIssue("fr", "", tt.message).Message; got != tt.want {
+			t.Errorf("translateIssue(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+		if got := translateIssue("en", "", tt.message).Message; got != tt.message {
+			t.Errorf("translateIssue(en, %q) = %q", tt.message, got)
+		}
+	}
+}
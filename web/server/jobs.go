@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/audrenbdb/facturx/api"
+)
+
+// maxJobSize caps the number of invoices in an asynchronous job.
+const maxJobSize = 1000
+
+// Job statuses
+const (
+	jobPending = "pending"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// JobRequest is the body of POST /api/jobs.
+type JobRequest struct {
+	Invoices []api.GenerateRequest `json:"invoices"`
+	Webhook  string                `json:"webhook,omitempty"`
+}
+
+// JobStatus is the JSON representation of a job, returned by the jobs
+// endpoints and posted to the webhook.
+type JobStatus struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Generated  int        `json:"generated"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	ResultURL  string     `json:"resultUrl,omitempty"`
+}
+
+// job is a batch generation running in the background. Its result, a ZIP
+// archive as returned by /api/generate/batch, is kept in memory until the
+// job expires.
+type job struct {
+	mu       sync.Mutex
+	status   JobStatus
+	owner    string // API key name, empty for anonymous jobs
+	lang     string // language of index.json messages
+	webhook  string
+	invoices []api.GenerateRequest // cleared once generated
+	result   []byte
+}
+
+func (j *job) snapshot() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// jobQueue runs jobs with a fixed number of workers.
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	pending chan *job
+	client  *http.Client
+}
+
+var jobs *jobQueue
+
+func newJobQueue(workers int) *jobQueue {
+	q := &jobQueue{
+		jobs:    make(map[string]*job),
+		pending: make(chan *job, 100),
+		client:  webhookClient(),
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// enqueue registers a job, or returns false when the queue is full.
+func (q *jobQueue) enqueue(j *job) bool {
+	q.mu.Lock()
+	q.expire()
+	q.jobs[j.status.ID] = j
+	q.mu.Unlock()
+
+	select {
+	case q.pending <- j:
+		return true
+	default:
+		q.mu.Lock()
+		delete(q.jobs, j.status.ID)
+		q.mu.Unlock()
+		return false
+	}
+}
+
+func (q *jobQueue) get(id string) (*job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	j, ok := q.jobs[id]
+	return j, ok
+}
+
+// expire drops finished jobs older than cfg.JobTTL. q.mu must be held.
+func (q *jobQueue) expire() {
+	for id, j := range q.jobs {
+		if s := j.snapshot(); s.FinishedAt != nil && time.Since(*s.FinishedAt) > cfg.JobTTL {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *jobQueue) work() {
+	for j := range q.pending {
+		q.run(j)
+	}
+}
+
+// run generates the job's archive, then notifies the webhook in the
+// background, so that retries do not hold up the worker.
+func (q *jobQueue) run(j *job) {
+	j.mu.Lock()
+	j.status.Status = jobRunning
+	reqs := j.invoices
+	j.mu.Unlock()
+
+	var buf bytes.Buffer
+	generated, err := writeBatchArchive(context.Background(), &buf, batchInvoices(reqs, j.lang), j.owner, j.lang, func() {
+		j.mu.Lock()
+		j.status.Processed++
+		j.mu.Unlock()
+	})
+
+	now := time.Now()
+	j.mu.Lock()
+	j.invoices = nil
+	j.status.FinishedAt = &now
+	j.status.Generated = generated
+	if err != nil {
+		j.status.Status = jobFailed
+		j.status.Error = err.Error()
+	} else {
+		j.status.Status = jobDone
+		j.status.ResultURL = "/api/jobs/" + j.status.ID + "/result"
+		j.result = buf.Bytes()
+	}
+	status := j.status
+	j.mu.Unlock()
+
+	slog.Info("Job finished", "job", status.ID, "status", status.Status, "generated", generated)
+	if j.webhook != "" {
+		go q.notify(j.webhook, status)
+	}
+}
+
+// notify posts the job status to its webhook, retrying with backoff. The
+// body is signed with HMAC-SHA256 using cfg.WebhookSecret, in the
+// X-Facturx-Signature header as "sha256=<hex>".
+func (q *jobQueue) notify(webhook string, status JobStatus) {
+	body, _ := json.Marshal(status)
+	for attempt, delay := 1, time.Second; attempt <= 3; attempt, delay = attempt+1, delay*5 {
+		req, err := http.NewRequest("POST", webhook, bytes.NewReader(body))
+		if err != nil {
+			slog.Error("Webhook failed", "job", status.ID, "err", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Facturx-Event", "job."+status.Status)
+		if cfg.WebhookSecret != "" {
+			req.Header.Set("X-Facturx-Signature", "sha256="+signWebhook(body, cfg.WebhookSecret))
+		}
+
+		resp, err := q.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return
+			}
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+		slog.Warn("Webhook failed", "job", status.ID, "attempt", attempt, "err", err)
+		if attempt < 3 {
+			time.Sleep(delay)
+		}
+	}
+}
+
+// webhookDenied lists the non-public ranges that netip does not classify
+// as private: shared address space (carrier-grade NAT), IETF protocol
+// assignments, benchmarking, reserved, and the IPv6 prefixes embedding an
+// IPv4 address, which could be a private one.
+var webhookDenied = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/96"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// publicAddr reports whether a webhook may connect to ip.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || !ip.IsGlobalUnicast() {
+		return false
+	}
+	for _, prefix := range webhookDenied {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookClient returns the HTTP client for webhooks. Unless
+// cfg.WebhookAllowPrivate is set, it refuses to connect to loopback,
+// private, link-local and other non-public addresses, so that callers
+// cannot use webhooks to reach the server's internal network.
+func webhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if cfg.WebhookAllowPrivate {
+				return nil
+			}
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr.Addr()) {
+				return fmt.Errorf("webhook address %s is not public", addr.Addr().Unmap())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body.
+func signWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleJobs enqueues an asynchronous batch generation (POST /api/jobs).
+// Every invoice counts against the rate limit.
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req JobRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.Invoices) == 0 || len(req.Invoices) > maxJobSize {
+		sendError(w, tr(r, "Le lot doit contenir entre 1 et %d factures", maxJobSize), http.StatusBadRequest)
+		return
+	}
+	for i := range req.Invoices {
+		if err := applyTemplate(r, &req.Invoices[i]); err != nil {
+			sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Webhook != "" {
+		if u, err := url.Parse(req.Webhook); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			sendError(w, tr(r, "URL de webhook invalide"), http.StatusBadRequest)
+			return
+		}
+	}
+	if !checkRateLimitN(w, r, len(req.Invoices)) {
+		return
+	}
+
+	j := &job{
+		status: JobStatus{
+			ID:        newRequestID(),
+			Status:    jobPending,
+			Total:     len(req.Invoices),
+			CreatedAt: time.Now(),
+		},
+		lang:     language(r),
+		webhook:  req.Webhook,
+		invoices: req.Invoices,
+	}
+	if key, ok := requestAPIKey(r); ok {
+		j.owner = key.name
+	}
+	if !jobs.enqueue(j) {
+		sendError(w, tr(r, "File d'attente pleine, réessayez plus tard"), http.StatusServiceUnavailable)
+		return
+	}
+
+	logger(r).Info("Job queued", "job", j.status.ID, "invoices", len(req.Invoices))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+j.status.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(j.snapshot())
+}
+
+// handleJob returns a job status (GET /api/jobs/{id}) or its ZIP archive
+// (GET /api/jobs/{id}/result). Jobs created with an API key are only
+// visible with the same key.
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	j, ok := jobs.get(id)
+	if ok {
+		key, _ := requestAPIKey(r)
+		ok = j.owner == key.name
+	}
+	if !ok || (sub != "" && sub != "result") {
+		sendError(w, tr(r, "Tâche introuvable"), http.StatusNotFound)
+		return
+	}
+
+	if sub == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j.snapshot())
+		return
+	}
+
+	j.mu.Lock()
+	result := j.result
+	j.mu.Unlock()
+	if result == nil {
+		sendError(w, tr(r, "Résultat indisponible : la tâche n'est pas terminée ou a échoué"), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="factures-%s.zip"`, id))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(result)))
+	w.Write(result)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"0.0.0.0", false},
+		{"198.18.0.1", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:93.184.216.34", true},
+		{"::10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"2002:a00:1::1", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddr(netip.MustParseAddr(tt.ip)); got != tt.public {
+			t.Errorf("publicAddr(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
+
+func TestWebhookClientDialGuard(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	cfg = &Config{}
+	_, err := webhookClient().Post(srv.URL, "application/json", nil)
+	if err == nil || !strings.Contains(err.Error(), "is not public") {
+		t.Errorf("webhook to a loopback address: %v", err)
+	}
+
+	cfg = &Config{WebhookAllowPrivate: true}
+	resp, err := webhookClient().Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("webhook with private addresses allowed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestJobWebhookDoesNotBlockWorker(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = &Config{WebhookAllowPrivate: true, JobTTL: time.Hour}
+
+	release := make(chan struct{})
+	delivered := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		body, _ := io.ReadAll(r.Body)
+		delivered <- string(body)
+	}))
+	defer srv.Close()
+
+	q := &jobQueue{jobs: make(map[string]*job), client: webhookClient()}
+	j := &job{status: JobStatus{ID: "job-1", Status: jobPending}, lang: "fr", webhook: srv.URL}
+	done := make(chan struct{})
+	go func() {
+		q.run(j)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the worker waited for the webhook")
+	}
+
+	close(release)
+	select {
+	case body := <-delivered:
+		if !strings.Contains(body, `"status":"done"`) {
+			t.Errorf("webhook body = %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestInfo is shared by the handlers of a request so that the access
+// log can report what inner middlewares learned, such as the API key.
+type requestInfo struct {
+	id  string
+	key string
+}
+
+type requestInfoContextKey struct{}
+
+// setupLogging installs the default slog logger for the configured format
+// and level.
+func setupLogging(cfg *Config) {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if cfg.LogFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// withRequestLog assigns each request a correlation ID, returned in the
+// X-Request-ID header (a valid incoming one is kept), and logs the request
+// once it has been served. Requests outside /api are logged at debug level.
+func withRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		info := &requestInfo{id: id}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoContextKey{}, info)))
+
+		attrs := []any{
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"ip", getClientIP(r),
+		}
+		if info.key != "" {
+			attrs = append(attrs, "key", info.key)
+		}
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case !strings.HasPrefix(r.URL.Path, "/api/"):
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "Request", attrs...)
+	})
+}
+
+// logger returns the logger for a request, tagged with its correlation ID
+// and the API key name when the client authenticated.
+func logger(r *http.Request) *slog.Logger {
+	l := slog.Default()
+	if info, ok := r.Context().Value(requestInfoContextKey{}).(*requestInfo); ok {
+		l = l.With("request_id", info.id)
+		if info.key != "" {
+			l = l.With("key", info.key)
+		}
+	}
+	return l
+}
+
+// setRequestKey records the API key name for the access log.
+func setRequestKey(r *http.Request, name string) {
+	if info, ok := r.Context().Value(requestInfoContextKey{}).(*requestInfo); ok {
+		info.key = name
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts IDs set by a proxy if they are short and made of
+// safe characters, so they cannot forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -4,112 +4,108 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/fs"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+	"github.com/audrenbdb/facturx/archive"
+	"github.com/audrenbdb/facturx/csvimport"
+	"github.com/audrenbdb/facturx/sirene"
 )
 
 //go:embed dist/*
 var distFS embed.FS
 
-// Rate limiter: 10 requests per hour per IP
-const (
-	rateLimitWindow   = time.Hour
-	rateLimitRequests = 10
-)
-
-type rateLimiter struct {
-	mu       sync.Mutex
-	requests map[string][]time.Time
-}
+// cfg is the server configuration, loaded once at startup.
+var cfg *Config
 
-var limiter = &rateLimiter{
-	requests: make(map[string][]time.Time),
+type ErrorResponse struct {
+	Message string          `json:"message"`
+	Errors  []api.IssueJSON `json:"errors,omitempty"`
 }
 
-func (rl *rateLimiter) allow(ip string) (bool, int, time.Duration) {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-rateLimitWindow)
-
-	// Clean old requests
-	var recent []time.Time
-	for _, t := range rl.requests[ip] {
-		if t.After(windowStart) {
-			recent = append(recent, t)
+func main() {
+	var err error
+	cfg, err = loadConfig(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return
 		}
+		fmt.Fprintf(os.Stderr, "facturx-server: %v\n", err)
+		os.Exit(2)
 	}
-	rl.requests[ip] = recent
-
-	remaining := rateLimitRequests - len(recent)
-	if remaining <= 0 {
-		// Find when the oldest request will expire
-		resetIn := rl.requests[ip][0].Add(rateLimitWindow).Sub(now)
-		return false, 0, resetIn
+	setupLogging(cfg)
+	if err := facturx.WarmUp(); err != nil {
+		fmt.Fprintf(os.Stderr, "facturx-server: %v\n", err)
+		os.Exit(2)
+	}
+	store, err := newStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "facturx-server: %v\n", err)
+		os.Exit(2)
+	}
+	limiter = newRateLimiter(store)
+	jobs = newJobQueue(2)
+	if templates, err = openTemplateStore(cfg.TemplatesFile); err != nil {
+		fmt.Fprintf(os.Stderr, "facturx-server: %v\n", err)
+		os.Exit(2)
+	}
+	if cfg.Archive != "" {
+		if archiveStore, err = archive.Open(cfg.Archive); err != nil {
+			fmt.Fprintf(os.Stderr, "facturx-server: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	withOriginCheck, err := newOriginCheck(cfg.CORSOrigins)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "facturx-server: %v\n", err)
+		os.Exit(2)
+	}
+	if cfg.SireneAPIKey != "" {
+		companies = &sirene.Client{APIKey: cfg.SireneAPIKey}
 	}
 
-	// Allow and record the request
-	rl.requests[ip] = append(rl.requests[ip], now)
-	return true, remaining - 1, rateLimitWindow
-}
-
-type GenerateRequest struct {
-	Number       string      `json:"number"`
-	Date         string      `json:"date"`
-	Seller       ContactJSON `json:"seller"`
-	Buyer        ContactJSON `json:"buyer"`
-	Lines        []LineJSON  `json:"lines"`
-	PaymentTerms PaymentJSON `json:"paymentTerms"`
-	Note         string      `json:"note"`
-}
-
-type ContactJSON struct {
-	Name       string `json:"name"`
-	SIRET      string `json:"siret"`
-	VATNumber  string `json:"vatNumber"`
-	Street     string `json:"street"`
-	PostalCode string `json:"postalCode"`
-	City       string `json:"city"`
-	Email      string `json:"email"`
-}
-
-type LineJSON struct {
-	Description string  `json:"description"`
-	Quantity    float64 `json:"quantity"`
-	UnitPrice   float64 `json:"unitPrice"`
-	VATRegime   int     `json:"vatRegime"`
-}
-
-type PaymentJSON struct {
-	DueDate string `json:"dueDate"`
-	IBAN    string `json:"iban"`
-	BIC     string `json:"bic"`
-	Note    string `json:"note"`
-}
-
-type ErrorResponse struct {
-	Message string `json:"message"`
-}
-
-func main() {
 	// API routes
-	http.HandleFunc("/api/generate", handleGenerate)
+	http.HandleFunc("/api/generate", requireAPIKey(handleGenerate))
+	http.HandleFunc("/api/generate/xml", requireAPIKey(handleGenerateXML))
+	http.HandleFunc("/api/generate/batch", requireAPIKey(handleGenerateBatch))
+	http.HandleFunc("/api/generate/csv", requireAPIKey(handleGenerateCSV))
 	http.HandleFunc("/api/health", handleHealth)
+	http.HandleFunc("/api/validate", requireAPIKey(handleValidate))
+	http.HandleFunc("/api/extract", requireAPIKey(handleExtract))
+	http.HandleFunc("/api/preview", requireAPIKey(handlePreview))
+	http.HandleFunc("/api/jobs", requireAPIKey(handleJobs))
+	http.HandleFunc("/api/jobs/", requireAPIKey(handleJob))
+	http.HandleFunc("/api/templates", withTemplates(requireAPIKey(withRateLimit(handleTemplates))))
+	http.HandleFunc("/api/templates/", withTemplates(requireAPIKey(withRateLimit(handleTemplate))))
+	http.HandleFunc("/api/companies/", requireAPIKey(handleCompany))
+	http.HandleFunc("/api/sample", requireAPIKey(handleSamplePersona))
+	http.HandleFunc("/api/samples", requireAPIKey(handleSamples))
+	http.HandleFunc("/api/samples/", requireAPIKey(handleSample))
+	http.HandleFunc("/api/openapi.json", handleOpenAPI)
+	http.HandleFunc("/api/docs", handleDocs)
 
 	// Serve embedded frontend
 	distContent, err := fs.Sub(distFS, "dist")
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("Embedded frontend unavailable", "err", err)
+		os.Exit(1)
 	}
 	fileServer := http.FileServer(http.FS(distContent))
 
@@ -132,176 +128,583 @@ func main() {
 		fileServer.ServeHTTP(w, r)
 	})
 
-	addr := ":9473"
-	log.Printf("Factur-X server starting on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	if err := listenAndServe(cfg, withRequestLog(withCORS(withOriginCheck(withBodyLimit(http.DefaultServeMux))))); err != nil {
+		slog.Error("Server stopped", "err", err)
+		os.Exit(1)
+	}
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "backend": "go-native"})
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":       "ok",
+		"backend":      "go-native",
+		"capabilities": facturx.Capabilities(),
+	})
 }
 
+// getClientIP returns the address of the client, or the raw peer address
+// if it cannot be parsed.
 func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxied requests)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		return strings.TrimSpace(parts[0])
+	if addr, ok := clientAddr(r); ok {
+		return addr.String()
 	}
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	return r.RemoteAddr
+}
+
+// clientAddr returns the address of the client: the peer address, or for
+// requests relayed by a trusted proxy, the last X-Forwarded-For hop that is
+// not a trusted proxy (earlier hops are set by the client and can be
+// forged), else X-Real-IP.
+func clientAddr(r *http.Request) (netip.Addr, bool) {
+	peer, ok := parseIP(r.RemoteAddr)
+	if !ok || !trustedProxy(peer) {
+		return peer, ok
 	}
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			addr, ok := parseIP(hops[i])
+			if !ok {
+				break
+			}
+			peer = addr
+			if !trustedProxy(addr) {
+				break
+			}
+		}
+		return peer, true
 	}
-	return ip
+	if addr, ok := parseIP(r.Header.Get("X-Real-IP")); ok {
+		return addr, true
+	}
+	return peer, true
 }
 
-func handleGenerate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// parseIP parses an IP address with or without a port, such as
+// "192.0.2.1:1234", "2001:db8::1" or "[2001:db8::1]:1234". IPv4-mapped
+// IPv6 addresses are returned as IPv4 and zones are dropped.
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
 	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// trustedProxy reports whether forwarding headers sent by addr are
+// honoured, that is whether it is one of the trusted proxies.
+func trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range cfg.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
 
-	// Apply rate limiting
-	ip := getClientIP(r)
-	allowed, remaining, resetIn := limiter.allow(ip)
+// checkRateLimit applies the client's rate limit (see clientQuota) and sets
+// the X-RateLimit-* headers. It writes the error response and returns false
+// when the limit is exceeded.
+func checkRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	return checkRateLimitN(w, r, 1)
+}
+
+// checkRateLimitN is checkRateLimit for a request generating n invoices.
+func checkRateLimitN(w http.ResponseWriter, r *http.Request, n int) bool {
+	client, q := clientQuota(r)
+	allowed, remaining, resetIn := limiter.allowN(r.Context(), client, q, n)
 
-	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", rateLimitRequests))
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", q.limit))
 	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
 	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", int(resetIn.Seconds())))
 
 	if !allowed {
-		log.Printf("Rate limit exceeded for IP %s", ip)
-		sendError(w, fmt.Sprintf("Rate limit dépassé. Limite: %d factures par heure. Réessayez dans %d minutes.", rateLimitRequests, int(resetIn.Minutes())+1), http.StatusTooManyRequests)
-		return
+		logger(r).Warn("Rate limit exceeded", "client", client)
+		sendError(w, tr(r, "Rate limit dépassé. Limite : %d factures %s. Réessayez dans %d minutes.", q.limit, windowText(r, q.window), int(resetIn.Minutes())+1), http.StatusTooManyRequests)
+		return false
 	}
+	return true
+}
 
-	var req GenerateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, "Format de requête invalide: "+err.Error(), http.StatusBadRequest)
-		return
+// windowText describes a rate limit window for error messages.
+func windowText(r *http.Request, d time.Duration) string {
+	switch d {
+	case time.Hour:
+		return tr(r, "par heure")
+	case time.Minute:
+		return tr(r, "par minute")
+	case 24 * time.Hour:
+		return tr(r, "par jour")
+	}
+	return tr(r, "toutes les %s", d)
+}
+
+// decodeGenerateRequest reads a JSON GenerateRequest and converts it to the
+// library format. It writes the error response and returns false on failure.
+func decodeGenerateRequest(w http.ResponseWriter, r *http.Request) (api.GenerateRequest, facturx.InvoiceRequest, bool) {
+	var req api.GenerateRequest
+	if !decodeJSON(w, r, &req) {
+		return req, facturx.InvoiceRequest{}, false
+	}
+	if err := applyTemplate(r, &req); err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return req, facturx.InvoiceRequest{}, false
 	}
 
 	// Convert to facturx library format
-	invoiceReq, err := convertToFacturxFormat(req)
+	invoiceReq, err := toInvoiceRequest(req, language(r))
 	if err != nil {
-		sendError(w, err.Error(), http.StatusBadRequest)
+		sendError(w, trError(language(r), err), http.StatusBadRequest)
+		return req, facturx.InvoiceRequest{}, false
+	}
+	return req, invoiceReq, true
+}
+
+// toInvoiceRequest converts a JSON invoice for generation, targeting the
+// configured Factur-X version. Amounts on the PDF follow lang unless the
+// request sets a locale.
+func toInvoiceRequest(req api.GenerateRequest, lang string) (facturx.InvoiceRequest, error) {
+	invoiceReq, err := req.ToInvoiceRequest()
+	invoiceReq.FacturXVersion = cfg.FacturXVersion
+	invoiceReq.ObjectStreams = cfg.ObjectStreams
+	if invoiceReq.Locale == "" {
+		invoiceReq.Locale = facturx.Locale(lang)
+	}
+	return invoiceReq, err
+}
+
+func handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !checkRateLimit(w, r) {
+		return
+	}
+
+	req, invoiceReq, ok := decodeGenerateRequest(w, r)
+	if !ok {
 		return
 	}
 
 	// Generate PDF using Go library directly
-	pdfData, err := facturx.Generate(invoiceReq)
+	res, err := facturx.GenerateResult(invoiceReq)
 	if err != nil {
-		sendError(w, "Erreur de génération: "+err.Error(), http.StatusInternalServerError)
+		sendGenerationError(w, r, err, http.StatusInternalServerError, "Erreur de génération : %v")
 		return
 	}
+	pdfData := res.PDF
 
-	log.Printf("Generated invoice %s (%d bytes)", req.Number, len(pdfData))
+	logger(r).Info("Generated invoice", "number", req.Number, "bytes", len(pdfData),
+		"grandTotal", res.Totals.GrandTotal, "sha256", res.SHA256, "fingerprint", res.Fingerprint)
+	for _, lw := range res.LayoutWarnings {
+		logger(r).Warn("Text truncated on the PDF", "number", req.Number, "field", lw.Field)
+	}
+	archiveInvoice(logger(r), requestOwner(r), invoiceReq, pdfData)
 
 	// Send PDF response
 	w.Header().Set("Content-Type", "application/pdf")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="facture-%s.pdf"`, req.Number))
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(pdfData)))
+	w.Header().Set("X-Invoice-Fingerprint", res.Fingerprint)
 	w.Write(pdfData)
 }
 
-func convertToFacturxFormat(req GenerateRequest) (facturx.InvoiceRequest, error) {
-	// Convert date from YYYY-MM-DD to YYYYMMDD
-	date := strings.ReplaceAll(req.Date, "-", "")
-	if len(date) != 8 {
-		return facturx.InvoiceRequest{}, fmt.Errorf("format de date invalide")
-	}
-
-	// Determine VAT regime from lines
-	var regime facturx.VatRegime
-	if len(req.Lines) > 0 {
-		firstRegime := req.Lines[0].VATRegime
-		switch firstRegime {
-		case 4: // franchise_auto
-			regime = facturx.VatFranchiseAuto()
-		case 5: // exempt_health
-			regime = facturx.VatExemptHealth()
-		default:
-			// Standard VAT - get rate from regime code
-			rate := getVATRate(firstRegime)
-			regime = facturx.VatStandard(rate)
+// handleGenerateXML returns only the CII XML for a JSON invoice, for
+// integrators embedding it into their own PDFs.
+func handleGenerateXML(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkRateLimit(w, r) {
+		return
+	}
+
+	req, invoiceReq, ok := decodeGenerateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	xmlData, err := facturx.GenerateXMLOnly(&invoiceReq)
+	if err != nil {
+		sendGenerationError(w, r, err, http.StatusInternalServerError, "Erreur de génération : %v")
+		return
+	}
+
+	logger(r).Info("Generated XML", "number", req.Number, "bytes", len(xmlData))
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="facture-%s.xml"`, req.Number))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(xmlData)))
+	io.WriteString(w, xmlData)
+}
+
+// handlePreview renders the first page of a JSON invoice as SVG for the
+// live preview. It is not rate limited: nothing is generated for download.
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, invoiceReq, ok := decodeGenerateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	svg, err := facturx.PreviewSVG(invoiceReq)
+	if err != nil {
+		sendGenerationError(w, r, err, http.StatusUnprocessableEntity, "Erreur de prévisualisation : %v")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(svg)
+}
+
+// BatchIndexEntry describes one invoice of a batch in index.json.
+type BatchIndexEntry struct {
+	Index  int             `json:"index"`
+	Number string          `json:"number"`
+	Status string          `json:"status"` // "ok" or "error"
+	File   string          `json:"file,omitempty"`
+	Errors []api.IssueJSON `json:"errors,omitempty"`
+}
+
+// maxBatchSize caps the number of invoices in a batch request.
+const maxBatchSize = 100
+
+// handleGenerateBatch generates an array of JSON invoices and streams back
+// a ZIP with one PDF per valid invoice and an index.json reporting each
+// success or failure. Every invoice counts against the rate limit.
+func handleGenerateBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reqs []api.GenerateRequest
+	if !decodeJSON(w, r, &reqs) {
+		return
+	}
+	for i := range reqs {
+		if err := applyTemplate(r, &reqs[i]); err != nil {
+			sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchSize {
+		sendError(w, tr(r, "Le lot doit contenir entre 1 et %d factures", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+	if !checkRateLimitN(w, r, len(reqs)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="factures.zip"`)
+	generated, err := writeBatchArchive(r.Context(), w, batchInvoices(reqs, language(r)), requestOwner(r), language(r), nil)
+	if err != nil {
+		// Headers are already sent: the truncated archive reports the failure
+		logger(r).Error("Batch generation aborted", "err", err)
+		return
+	}
+	logger(r).Info("Generated batch", "invoices", generated)
+}
+
+// handleGenerateCSV generates the invoices of an uploaded CSV file (see
+// package csvimport), as a multipart "file" field or the raw body, and
+// streams back the same ZIP as handleGenerateBatch. Invalid rows are
+// reported in index.json with their line and column.
+func handleGenerateCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var sep rune
+	if s := r.URL.Query().Get("sep"); s != "" {
+		if len([]rune(s)) != 1 {
+			sendError(w, tr(r, "Séparateur invalide : %q", s), http.StatusBadRequest)
+			return
+		}
+		sep = []rune(s)[0]
+	}
+	data, err := readUpload(r)
+	if err != nil {
+		sendUploadError(w, r, err)
+		return
+	}
+	rows, err := csvimport.Read(bytes.NewReader(data), sep)
+	if err != nil {
+		sendError(w, tr(r, "CSV invalide : %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(rows) == 0 || len(rows) > maxBatchSize {
+		sendError(w, tr(r, "Le lot doit contenir entre 1 et %d factures", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+	if !checkRateLimitN(w, r, len(rows)) {
+		return
+	}
+
+	invoices := make([]batchInvoice, len(rows))
+	for i, row := range rows {
+		row.Request.FacturXVersion = cfg.FacturXVersion
+		row.Request.ObjectStreams = cfg.ObjectStreams
+		row.Request.Locale = facturx.Locale(language(r))
+		invoices[i] = batchInvoice{number: row.Number, req: row.Request, errs: row.Errors}
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="factures.zip"`)
+	generated, err := writeBatchArchive(r.Context(), w, invoices, requestOwner(r), language(r), nil)
+	if err != nil {
+		logger(r).Error("CSV batch generation aborted", "err", err)
+		return
+	}
+	logger(r).Info("Generated CSV batch", "invoices", generated)
+}
+
+// batchInvoice is an invoice of a batch, or the errors preventing its
+// generation.
+type batchInvoice struct {
+	number string
+	req    facturx.InvoiceRequest
+	errs   []error
+}
+
+// batchInvoices converts JSON invoices, keeping conversion errors to report
+// them per invoice.
+func batchInvoices(reqs []api.GenerateRequest, lang string) []batchInvoice {
+	invoices := make([]batchInvoice, len(reqs))
+	for i, req := range reqs {
+		invoices[i].number = req.Number
+		invoiceReq, err := toInvoiceRequest(req, lang)
+		if err != nil {
+			invoices[i].errs = []error{err}
+			continue
+		}
+		invoices[i].req = invoiceReq
+	}
+	return invoices
+}
+
+// writeBatchArchive writes a ZIP with one PDF per valid invoice and an
+// index.json reporting each success or failure in lang, and returns the
+// number of PDFs. The PDFs are archived for the API key owner. progress,
+// if not nil, is called after each invoice is processed.
+func writeBatchArchive(ctx context.Context, w io.Writer, batch []batchInvoice, owner, lang string, progress func()) (int, error) {
+	// Invalid invoices are reported in the index; valid ones are generated
+	index := make([]BatchIndexEntry, len(batch))
+	var invoices []facturx.InvoiceRequest
+	var positions []int
+	for i, inv := range batch {
+		index[i] = BatchIndexEntry{Index: i, Number: inv.number}
+		if len(inv.errs) > 0 {
+			index[i].Status = "error"
+			for _, err := range inv.errs {
+				index[i].Errors = append(index[i].Errors, issueFromError(lang, err))
+			}
+			if progress != nil {
+				progress()
+			}
+			continue
+		}
+		invoices = append(invoices, inv.req)
+		positions = append(positions, i)
+	}
+
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+	generated := 0
+	err := facturx.GenerateConcurrent(ctx, invoices, 4, func(res facturx.BatchResult) error {
+		if progress != nil {
+			defer progress()
+		}
+		entry := &index[positions[res.Index]]
+		if res.Err != nil {
+			entry.Status = "error"
+			entry.Errors = []api.IssueJSON{issueFromError(lang, res.Err)}
+			return nil
+		}
+
+		archiveInvoice(slog.Default(), owner, invoices[res.Index], res.PDF)
+
+		name := batchFileName(entry.Number, used)
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(res.PDF); err != nil {
+			return err
+		}
+		entry.Status, entry.File = "ok", name
+		generated++
+		return nil
+	})
+	if err != nil {
+		return generated, err
+	}
+
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "index.json", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return generated, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(index); err != nil {
+		return generated, err
+	}
+	return generated, zw.Close()
+}
+
+// batchFileName returns a unique archive entry name for an invoice number.
+func batchFileName(number string, used map[string]bool) string {
+	base := "facture-" + strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
 		}
+		return r
+	}, number)
+	name := base + ".pdf"
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d.pdf", base, i)
+	}
+	used[name] = true
+	return name
+}
+
+// handleValidate checks an invoice without generating it. It accepts either
+// a JSON GenerateRequest, or a Factur-X PDF / CII XML sent as the raw body
+// or as the "file" field of a multipart form.
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result facturx.ValidationResult
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req api.GenerateRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if err := applyTemplate(r, &req); err != nil {
+			sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		invoiceReq, err := toInvoiceRequest(req, language(r))
+		if err != nil {
+			sendError(w, trError(language(r), err), http.StatusBadRequest)
+			return
+		}
+		result = facturx.Validate(&invoiceReq)
 	} else {
-		regime = facturx.VatStandard(20.0)
-	}
-
-	// Build custom mentions from payment info
-	var mentions []string
-	if req.PaymentTerms.Note != "" {
-		mentions = append(mentions, req.PaymentTerms.Note)
-	}
-	if req.PaymentTerms.IBAN != "" {
-		mentions = append(mentions, fmt.Sprintf("IBAN: %s", req.PaymentTerms.IBAN))
-	}
-	if req.Note != "" {
-		mentions = append(mentions, req.Note)
-	}
-
-	invoiceReq := facturx.InvoiceRequest{
-		Number: req.Number,
-		Date:   date,
-		Seller: facturx.Contact{
-			Name:        req.Seller.Name,
-			Address:     req.Seller.Street,
-			ZipCode:     req.Seller.PostalCode,
-			City:        req.Seller.City,
-			CountryCode: "FR",
-			Siret:       strings.ReplaceAll(req.Seller.SIRET, " ", ""),
-			VatNumber:   req.Seller.VATNumber,
-		},
-		Buyer: facturx.Contact{
-			Name:        req.Buyer.Name,
-			Address:     req.Buyer.Street,
-			ZipCode:     req.Buyer.PostalCode,
-			City:        req.Buyer.City,
-			CountryCode: "FR",
-			Siret:       strings.ReplaceAll(req.Buyer.SIRET, " ", ""),
-		},
-		Regime:         regime,
-		AddEISuffix:    false,
-		CustomMentions: strings.Join(mentions, "\n"),
-	}
-
-	// Convert lines
-	for _, line := range req.Lines {
-		invoiceReq.Lines = append(invoiceReq.Lines, facturx.InvoiceLine{
-			Description: line.Description,
-			Quantity:    line.Quantity,
-			UnitPrice:   line.UnitPrice,
-		})
-	}
-
-	return invoiceReq, nil
+		data, err := readUpload(r)
+		if err != nil {
+			sendUploadError(w, r, err)
+			return
+		}
+		if bytes.HasPrefix(data, []byte("%PDF-")) {
+			result, err = facturx.ValidatePDF(data)
+		} else {
+			result, err = facturx.ValidateXML(data)
+		}
+		if errors.Is(err, facturx.ErrPDF) {
+			sendError(w, tr(r, "PDF invalide : %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			sendError(w, tr(r, "XML invalide : %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	report := validationReport(r, result)
+	if r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		report.WriteHTML(w, language(r))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
 }
 
-func getVATRate(regime int) float64 {
-	switch regime {
-	case 0: // standard
-		return 20.0
-	case 1: // reduced
-		return 10.0
-	case 2: // super_reduced
-		return 5.5
-	case 3: // minimal
-		return 2.1
-	case 4, 5, 6, 7: // exempt
-		return 0.0
-	default:
-		return 20.0
+// ExtractResponse is the JSON view of an extracted invoice.
+type ExtractResponse struct {
+	Invoice api.GenerateRequest `json:"invoice"`
+	Totals  api.TotalsJSON      `json:"totals"`
+	XML     string              `json:"xml"`
+}
+
+// handleExtract returns the XML embedded in an uploaded Factur-X PDF, or a
+// parsed JSON view of it with ?format=json.
+func handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := readUpload(r)
+	if err != nil {
+		sendUploadError(w, r, err)
+		return
+	}
+	xmlData, err := facturx.ExtractXML(data)
+	if err != nil {
+		sendError(w, tr(r, "PDF invalide : %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "json" {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("Content-Disposition", `attachment; filename="factur-x.xml"`)
+		w.Write(xmlData)
+		return
+	}
+
+	invoice, err := facturx.ParseXML(xmlData)
+	if err != nil {
+		sendError(w, tr(r, "XML invalide : %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ExtractResponse{
+		Invoice: api.FromInvoiceRequest(*invoice),
+		Totals:  api.NewTotalsJSON(facturx.ComputeTotals(invoice)),
+		XML:     string(xmlData),
+	})
+}
+
+// readUpload returns the uploaded file: the "file" field of a multipart
+// form, or the raw request body.
+func readUpload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return io.ReadAll(r.Body)
 	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
 }
 
 func sendError(w http.ResponseWriter, message string, status int) {
+	sendErrorResponse(w, ErrorResponse{Message: message}, status)
+}
+
+func sendErrorResponse(w http.ResponseWriter, resp ErrorResponse, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Message: message})
+	json.NewEncoder(w).Encode(resp)
 }
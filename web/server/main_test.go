@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+)
+
+// withTrustedProxies sets the trusted proxies of the configuration for the
+// duration of the test.
+func withTrustedProxies(t *testing.T, proxies ...string) {
+	t.Helper()
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = &Config{}
+	for _, p := range proxies {
+		prefix, err := parsePrefix(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, prefix)
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	withTrustedProxies(t, "10.0.0.0/8", "::1")
+
+	tests := []struct {
+		name     string
+		remote   string
+		xff      []string
+		realIP   string
+		want     string
+		wantFail bool
+	}{
+		{name: "direct client", remote: "203.0.113.7:52000", want: "203.0.113.7"},
+		{name: "spoofed XFF from an untrusted peer", remote: "203.0.113.7:52000", xff: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "spoofed X-Real-IP from an untrusted peer", remote: "203.0.113.7:52000", realIP: "198.51.100.1", want: "203.0.113.7"},
+		{name: "one trusted proxy", remote: "10.0.0.1:3000", xff: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "several trusted hops", remote: "10.0.0.1:3000", xff: []string{"203.0.113.7, 10.1.2.3", "10.0.0.2"}, want: "203.0.113.7"},
+		{name: "client-forged hops before the real client", remote: "10.0.0.1:3000", xff: []string{"1.2.3.4, 203.0.113.7, 10.1.2.3"}, want: "203.0.113.7"},
+		{name: "only trusted hops", remote: "10.0.0.1:3000", xff: []string{"10.1.2.3"}, want: "10.1.2.3"},
+		{name: "garbage XFF entry", remote: "10.0.0.1:3000", xff: []string{"203.0.113.7, not-an-ip, 10.1.2.3"}, want: "10.1.2.3"},
+		{name: "garbage last XFF entry", remote: "10.0.0.1:3000", xff: []string{"203.0.113.7, unknown"}, want: "10.0.0.1"},
+		{name: "X-Real-IP from a trusted proxy", remote: "10.0.0.1:3000", realIP: "203.0.113.7", want: "203.0.113.7"},
+		{name: "IPv6 loopback proxy", remote: "[::1]:8080", xff: []string{"2001:db8::7"}, want: "2001:db8::7"},
+		{name: "IPv6 client", remote: "[2001:db8::7]:443", want: "2001:db8::7"},
+		{name: "IPv4-mapped peer", remote: "[::ffff:1.2.3.4]:443", want: "1.2.3.4"},
+		{name: "IPv4-mapped trusted proxy", remote: "[::ffff:10.0.0.1]:443", xff: []string{"::ffff:203.0.113.7"}, want: "203.0.113.7"},
+		{name: "unparsable peer", remote: "pipe", wantFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/generate", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			addr, ok := clientAddr(r)
+			if tt.wantFail {
+				if ok {
+					t.Errorf("clientAddr = %v, want no address", addr)
+				}
+				if got := getClientIP(r); got != tt.remote {
+					t.Errorf("getClientIP = %q, want %q", got, tt.remote)
+				}
+				return
+			}
+			if !ok || addr.String() != tt.want {
+				t.Errorf("clientAddr = %v, %v, want %s", addr, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientAddrNoTrustedProxies(t *testing.T) {
+	withTrustedProxies(t)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if addr, _ := clientAddr(r); addr.String() != "127.0.0.1" {
+		t.Errorf("clientAddr = %v, want the peer", addr)
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.1:1234", "192.0.2.1"},
+		{" 192.0.2.1 ", "192.0.2.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"[2001:db8::1]:1234", "2001:db8::1"},
+		{"[::1]:8080", "::1"},
+		{"::ffff:1.2.3.4", "1.2.3.4"},
+		{"[::ffff:1.2.3.4]:80", "1.2.3.4"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"", ""},
+		{"unknown", ""},
+		{"1.2.3.4.5", ""},
+		{"[1.2.3.4]:x:y", ""},
+	}
+	for _, tt := range tests {
+		addr, ok := parseIP(tt.in)
+		if got := addr.String(); ok != (tt.want != "") || ok && got != tt.want {
+			t.Errorf("parseIP(%q) = %s, %v, want %q", tt.in, got, ok, tt.want)
+		}
+	}
+}
+
+func TestClientNetwork(t *testing.T) {
+	withTrustedProxies(t)
+	network := func(remote string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		return clientNetwork(r)
+	}
+
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"[2001:db8:1:2::1]:443", "[2001:db8:1:2:ffff:ffff:ffff:ffff]:443", true},
+		{"[2001:db8:1:2::1]:443", "[2001:db8:1:3::1]:443", false},
+		{"192.0.2.1:443", "192.0.2.1:80", true},
+		{"192.0.2.1:443", "192.0.2.2:443", false},
+		{"[::ffff:192.0.2.1]:443", "192.0.2.1:443", true},
+	}
+	for _, tt := range tests {
+		if same := network(tt.a) == network(tt.b); same != tt.same {
+			t.Errorf("%s and %s: same bucket = %v, want %v (%s, %s)", tt.a, tt.b, same, tt.same, network(tt.a), network(tt.b))
+		}
+	}
+	if got := network("[2001:db8:1:2:3:4:5:6]:443"); got != "2001:db8:1:2::/64" {
+		t.Errorf("clientNetwork = %s, want 2001:db8:1:2::/64", got)
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"192.0.2.1", "192.0.2.1/32"},
+		{"::1", "::1/128"},
+		{"::ffff:192.0.2.1", "192.0.2.1/32"},
+		{"2001:db8::1/64", "2001:db8::/64"},
+		{"10.0.0.0/33", ""},
+		{"proxy.example.com", ""},
+	}
+	for _, tt := range tests {
+		prefix, err := parsePrefix(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("parsePrefix(%q) = %v, want an error", tt.in, prefix)
+			}
+			continue
+		}
+		if err != nil || prefix != netip.MustParsePrefix(tt.want) {
+			t.Errorf("parsePrefix(%q) = %v, %v, want %s", tt.in, prefix, err, tt.want)
+		}
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []apiKey
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "alice:k1", want: []apiKey{{name: "alice", key: "k1"}}},
+		{in: " alice:k1 , bob:k2:pro ,", want: []apiKey{{name: "alice", key: "k1"}, {name: "bob", key: "k2", tier: "pro"}}},
+		{in: "alice:k1:", want: []apiKey{{name: "alice", key: "k1"}}},
+		{in: "alice", wantErr: true},
+		{in: "alice:", wantErr: true},
+		{in: ":k1", wantErr: true},
+		{in: "alice:k1:pro:extra", wantErr: true},
+		{in: "alice:k1,bob", wantErr: true},
+	}
+	for _, tt := range tests {
+		keys, err := parseAPIKeys(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseAPIKeys(%q) = %v, want an error", tt.in, keys)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("parseAPIKeys(%q) = %v, %v, want %v", tt.in, keys, err, tt.want)
+		}
+	}
+}
+
+// withAPIKeys sets the API keys of the configuration, and a "pro" rate
+// limit tier, for the duration of the test.
+func withAPIKeys(t *testing.T, keys string) {
+	t.Helper()
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	apiKeys, err := parseAPIKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{
+		APIKeys:           apiKeys,
+		RateLimitRequests: 10,
+		RateLimitWindow:   time.Minute,
+		RateLimitTiers:    map[string]quota{"pro": {limit: 1000, window: time.Hour}},
+	}
+}
+
+func TestLookupAPIKey(t *testing.T) {
+	withAPIKeys(t, "alice:secret-a,bob:secret-b:pro")
+	tests := []struct {
+		given string
+		want  string
+	}{
+		{"secret-a", "alice"},
+		{"secret-b", "bob"},
+		{"", ""},
+		{"secret", ""},
+		{"secret-a ", ""},
+		{"SECRET-A", ""},
+		{"alice", ""},
+	}
+	for _, tt := range tests {
+		key, ok := lookupAPIKey(tt.given)
+		if ok != (tt.want != "") || key.name != tt.want {
+			t.Errorf("lookupAPIKey(%q) = %v, %v, want %q", tt.given, key, ok, tt.want)
+		}
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		headers  map[string]string
+		want     int
+		wantKey  string
+		wantRate string
+	}{
+		{name: "no key configured", want: http.StatusOK, wantRate: "ip:192.0.2.1"},
+		{name: "missing key", keys: "alice:secret-a", want: http.StatusUnauthorized},
+		{name: "wrong key", keys: "alice:secret-a", headers: map[string]string{"X-API-Key": "secret-b"}, want: http.StatusUnauthorized},
+		{name: "X-API-Key", keys: "alice:secret-a", headers: map[string]string{"X-API-Key": "secret-a"}, want: http.StatusOK, wantKey: "alice", wantRate: "key:alice"},
+		{name: "Bearer token", keys: "alice:secret-a", headers: map[string]string{"Authorization": "Bearer secret-a"}, want: http.StatusOK, wantKey: "alice", wantRate: "key:alice"},
+		{name: "Bearer token with spaces", keys: "alice:secret-a", headers: map[string]string{"Authorization": "Bearer  secret-a "}, want: http.StatusOK, wantKey: "alice", wantRate: "key:alice"},
+		{name: "other scheme", keys: "alice:secret-a", headers: map[string]string{"Authorization": "Basic secret-a"}, want: http.StatusUnauthorized},
+		{name: "wrong X-API-Key before a valid Bearer token", keys: "alice:secret-a", headers: map[string]string{"X-API-Key": "wrong", "Authorization": "Bearer secret-a"}, want: http.StatusUnauthorized},
+		{name: "tiered key", keys: "alice:secret-a,bob:secret-b:pro", headers: map[string]string{"X-API-Key": "secret-b"}, want: http.StatusOK, wantKey: "bob", wantRate: "key:bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withAPIKeys(t, tt.keys)
+			var owner, logged, rateKey string
+			var q quota
+			next := func(w http.ResponseWriter, r *http.Request) {
+				owner = requestOwner(r)
+				logged = r.Context().Value(requestInfoContextKey{}).(*requestInfo).key
+				rateKey, q = clientQuota(r)
+			}
+			r := httptest.NewRequest("POST", "/api/generate", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			withRequestLog(requireAPIKey(next)).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusUnauthorized {
+				if w.Header().Get("WWW-Authenticate") != "Bearer" {
+					t.Error("no WWW-Authenticate challenge")
+				}
+				return
+			}
+			if owner != tt.wantKey || logged != tt.wantKey {
+				t.Errorf("request key = %q, logged as %q, want %q", owner, logged, tt.wantKey)
+			}
+			if rateKey != tt.wantRate {
+				t.Errorf("rate limit key = %q, want %q", rateKey, tt.wantRate)
+			}
+			wantQuota := quota{limit: 10, window: time.Minute}
+			if tt.wantKey == "bob" {
+				wantQuota = cfg.RateLimitTiers["pro"]
+			}
+			if q != wantQuota {
+				t.Errorf("quota = %+v, want %+v", q, wantQuota)
+			}
+		})
+	}
+}
+
+func TestValidateUsesServerSettings(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg = &Config{FacturXVersion: "9.9"}
+
+	body, err := json.Marshal(api.FromInvoiceRequest(facturx.InvoiceRequest{
+		Number: "F-001",
+		Date:   "20240115",
+		Seller: facturx.Contact{Name: "ACME Corp", Address: "123 Rue de Paris", ZipCode: "75001", City: "Paris", CountryCode: "FR", Siret: "52825000400033"},
+		Buyer:  facturx.Contact{Name: "Client SA", Address: "456 Avenue des Champs", ZipCode: "69001", City: "Lyon", CountryCode: "FR"},
+		Lines:  []facturx.InvoiceLine{{Description: "Conseil", Quantity: 1, UnitPrice: 100}},
+		Regime: facturx.VatStandard(20),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/api/validate", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handleValidate(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", w.Code, w.Body)
+	}
+	// The invoice is validated as it would be generated, for the Factur-X
+	// version of the server
+	if !strings.Contains(w.Body.String(), "version Factur-X inconnue") {
+		t.Errorf("report = %s", w.Body)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Store records rate-limited hits. Implementations shared between server
+// instances (such as redisStore) make the limit apply across all of them.
+type Store interface {
+	// Hit records n hits for key if, together with the hits of the last
+	// window, they do not exceed limit. It returns the number of hits left
+	// and the time until the oldest recorded hit expires.
+	Hit(ctx context.Context, key string, n, limit int, window time.Duration) (allowed bool, remaining int, resetIn time.Duration, err error)
+}
+
+// newStore returns the rate limit store selected by the configuration.
+func newStore(cfg *Config) (Store, error) {
+	if cfg.RedisURL != "" {
+		return newRedisStore(cfg.RedisURL)
+	}
+	return newMemoryStore(), nil
+}
+
+// quota is a number of requests allowed over a sliding window.
+type quota struct {
+	limit  int
+	window time.Duration
+}
+
+// Rate limiter: each client (an API key, or an IP address for anonymous
+// requests) gets its own quota
+type rateLimiter struct {
+	store Store
+}
+
+var limiter *rateLimiter
+
+func newRateLimiter(store Store) *rateLimiter {
+	return &rateLimiter{store: store}
+}
+
+// allowN records n requests of client at once, if they all fit in its
+// quota. Requests are let through when the store fails, so that an
+// unavailable Redis does not take the service down.
+func (rl *rateLimiter) allowN(ctx context.Context, client string, q quota, n int) (bool, int, time.Duration) {
+	allowed, remaining, resetIn, err := rl.store.Hit(ctx, "ratelimit:"+client, n, q.limit, q.window)
+	if err != nil {
+		slog.Error("Rate limit store failed", "err", err)
+		return true, q.limit, q.window
+	}
+	return allowed, remaining, resetIn
+}
+
+// clientQuota identifies the client of a request and returns its quota:
+// the key's tier for authenticated requests, the default quota otherwise.
+func clientQuota(r *http.Request) (string, quota) {
+	q := quota{limit: cfg.RateLimitRequests, window: cfg.RateLimitWindow}
+	key, ok := requestAPIKey(r)
+	if !ok {
+		return "ip:" + clientNetwork(r), q
+	}
+	if tier, ok := cfg.RateLimitTiers[key.tier]; ok {
+		q = tier
+	}
+	return "key:" + key.name, q
+}
+
+// withRateLimit applies the client's rate limit to every request of a
+// handler, for routes that do not generate invoices.
+func withRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkRateLimit(w, r) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// memoryStore keeps hits in memory, for a single server instance.
+type memoryStore struct {
+	mu        sync.Mutex
+	keys      map[string]memoryHits
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// memoryHits are the recent hits of a key, with the window of its quota:
+// tiers have different windows.
+type memoryHits struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+// memorySweepInterval is how often idle keys are dropped.
+const memorySweepInterval = time.Minute
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{keys: make(map[string]memoryHits), lastSweep: time.Now(), now: time.Now}
+}
+
+func (s *memoryStore) Hit(_ context.Context, key string, n, limit int, window time.Duration) (bool, int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	windowStart := now.Add(-window)
+
+	// Drop clients that have been idle for a whole window of their own
+	// quota, so the map does not grow forever
+	if now.Sub(s.lastSweep) > memorySweepInterval {
+		for k, e := range s.keys {
+			if len(e.hits) == 0 || !e.hits[len(e.hits)-1].After(now.Add(-e.window)) {
+				delete(s.keys, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	// Clean old hits
+	var recent []time.Time
+	for _, t := range s.keys[key].hits {
+		if t.After(windowStart) {
+			recent = append(recent, t)
+		}
+	}
+
+	remaining := limit - len(recent)
+	if remaining < n {
+		s.keys[key] = memoryHits{recent, window}
+		// Find when the oldest hit will expire
+		resetIn := window
+		if len(recent) > 0 {
+			resetIn = recent[0].Add(window).Sub(now)
+		}
+		return false, remaining, resetIn, nil
+	}
+
+	// Allow and record the hits
+	for i := 0; i < n; i++ {
+		recent = append(recent, now)
+	}
+	s.keys[key] = memoryHits{recent, window}
+	return true, remaining - n, window, nil
+}
+
+// clientNetwork returns the rate limited network of an anonymous client:
+// its IPv4 address, or the /64 of its IPv6 address, which subscribers are
+// usually given whole and could rotate through to evade the limit.
+func clientNetwork(r *http.Request) string {
+	addr, ok := clientAddr(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if addr.Is6() {
+		return netip.PrefixFrom(addr, 64).Masked().String()
+	}
+	return addr.String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for memoryStore.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestMemoryStore() (*memoryStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)}
+	s := newMemoryStore()
+	s.now = clock.now
+	s.lastSweep = clock.t
+	return s, clock
+}
+
+func TestMemoryStoreHit(t *testing.T) {
+	s, clock := newTestMemoryStore()
+	ctx := context.Background()
+	hit := func(n int) (bool, int, time.Duration) {
+		t.Helper()
+		allowed, remaining, resetIn, err := s.Hit(ctx, "ip:192.0.2.1", n, 3, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed, remaining, resetIn
+	}
+
+	if allowed, remaining, _ := hit(1); !allowed || remaining != 2 {
+		t.Fatalf("first hit: allowed %v, remaining %d", allowed, remaining)
+	}
+	clock.advance(10 * time.Minute)
+	if allowed, remaining, _ := hit(2); !allowed || remaining != 0 {
+		t.Fatalf("batch of 2: allowed %v, remaining %d", allowed, remaining)
+	}
+	allowed, remaining, resetIn := hit(1)
+	if allowed || remaining != 0 || resetIn != 50*time.Minute {
+		t.Fatalf("over the limit: allowed %v, remaining %d, reset in %v", allowed, remaining, resetIn)
+	}
+
+	// The first hit expires after an hour, freeing one request
+	clock.advance(50*time.Minute + time.Second)
+	if allowed, remaining, _ := hit(1); !allowed || remaining != 0 {
+		t.Errorf("after the first hit expired: allowed %v, remaining %d", allowed, remaining)
+	}
+	if allowed, _, _ := hit(2); allowed {
+		t.Error("a batch larger than the remaining quota was allowed")
+	}
+}
+
+func TestMemoryStoreSweepTiers(t *testing.T) {
+	s, clock := newTestMemoryStore()
+	ctx := context.Background()
+
+	// A client on a daily tier uses up its quota
+	for range 2 {
+		s.Hit(ctx, "key:daily", 1, 2, 24*time.Hour)
+	}
+	// Requests on a one-minute tier keep coming for two hours, sweeping
+	// idle keys along the way
+	for range 120 {
+		clock.advance(time.Minute + time.Second)
+		s.Hit(ctx, "key:minute", 1, 100, time.Minute)
+	}
+	if _, ok := s.keys["key:daily"]; !ok {
+		t.Fatal("the daily key was swept before its window ended")
+	}
+	if allowed, _, _, _ := s.Hit(ctx, "key:daily", 1, 2, 24*time.Hour); allowed {
+		t.Error("the daily quota was reset by the sweep of a shorter tier")
+	}
+
+	// Once idle for its whole window, the daily key is dropped
+	clock.advance(24 * time.Hour)
+	s.Hit(ctx, "key:minute", 1, 100, time.Minute)
+	if _, ok := s.keys["key:daily"]; ok {
+		t.Error("the idle daily key was not swept")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hitScript implements a sliding window on a sorted set of hit timestamps,
+// atomically. It returns {allowed, remaining, resetIn in milliseconds}.
+const hitScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count + n > limit then
+	local reset = window
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+	return {0, limit - count, reset}
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, ARGV[5] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, limit - count - n, window}
+`
+
+// redisStore is a Store shared by several server instances through Redis.
+// It speaks the RESP protocol directly over a small pool of connections.
+type redisStore struct {
+	addr     string
+	password string
+	db       int
+	idle     chan net.Conn
+}
+
+// newRedisStore parses a redis://[:password@]host[:port][/db] URL.
+func newRedisStore(rawURL string) (*redisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q", rawURL)
+	}
+	s := &redisStore{addr: u.Host, idle: make(chan net.Conn, 8)}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return s, nil
+}
+
+func (s *redisStore) Hit(ctx context.Context, key string, n, limit int, window time.Duration) (bool, int, time.Duration, error) {
+	member := make([]byte, 8)
+	rand.Read(member)
+
+	reply, err := s.do(ctx, "EVAL", hitScript, "1", "facturx:"+key,
+		strconv.FormatInt(time.Now().UnixMilli(), 10),
+		strconv.FormatInt(window.Milliseconds(), 10),
+		strconv.Itoa(limit), strconv.Itoa(n), hex.EncodeToString(member))
+	if err != nil {
+		return false, 0, 0, err
+	}
+	values, ok := reply.([]any)
+	if !ok || len(values) != 3 {
+		return false, 0, 0, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	var ints [3]int64
+	for i, v := range values {
+		if ints[i], ok = v.(int64); !ok {
+			return false, 0, 0, fmt.Errorf("redis: unexpected reply %v", reply)
+		}
+	}
+	return ints[0] == 1, int(ints[1]), time.Duration(ints[2]) * time.Millisecond, nil
+}
+
+// do sends a command and reads its reply. Connections are returned to the
+// pool only after a complete exchange.
+func (s *redisStore) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := exchange(ctx, conn, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection, or dials and initializes a new one.
+func (s *redisStore) conn(ctx context.Context) (net.Conn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if s.password != "" {
+		if _, err := exchange(ctx, conn, "AUTH", s.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := exchange(ctx, conn, "SELECT", strconv.Itoa(s.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// exchange writes a command as a RESP array of bulk strings and reads the
+// reply.
+func exchange(ctx context.Context, conn net.Conn, args ...string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readReply(bufio.NewReader(conn))
+}
+
+// readReply reads one RESP reply. Integers are returned as int64, bulk and
+// simple strings as string, arrays as []any and nil replies as nil.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer %q", line)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		// An error element fails the reply, but the remaining elements are
+		// still read so that the connection can be reused.
+		values := make([]any, count)
+		var replyErr error
+		for i := range values {
+			values[i], err = readReply(r)
+			var redisErr redisError
+			switch {
+			case errors.As(err, &redisErr):
+				if replyErr == nil {
+					replyErr = err
+				}
+			case err != nil:
+				return nil, err
+			}
+		}
+		if replyErr != nil {
+			return nil, replyErr
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
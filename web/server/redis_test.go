@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    any
+		wantErr string
+	}{
+		{"simple string", "+OK\r\n", "OK", ""},
+		{"error", "-ERR wrong\r\n", nil, "redis: ERR wrong"},
+		{"integer", ":-42\r\n", int64(-42), ""},
+		{"bulk string", "$5\r\nhe\r\nl\r\n", "he\r\nl", ""},
+		{"nil bulk string", "$-1\r\n", nil, ""},
+		{"array", "*3\r\n:1\r\n:2\r\n$1\r\nx\r\n", []any{int64(1), int64(2), "x"}, ""},
+		{"nested array", "*2\r\n*1\r\n:1\r\n+a\r\n", []any{[]any{int64(1)}, "a"}, ""},
+		{"nil array", "*-1\r\n", nil, ""},
+		{"error element", "*3\r\n:1\r\n-ERR first\r\n-ERR second\r\n", nil, "redis: ERR first"},
+		{"invalid integer", ":x\r\n", nil, `redis: invalid integer ":x"`},
+		{"truncated bulk string", "$20\r\nab", nil, "redis: unexpected EOF"},
+		{"unknown type", "?\r\n", nil, `redis: unexpected reply "?"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.in + "+next\r\n"))
+			got, err := readReply(r)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("readReply = %v, %v, want error %q", got, err, tt.wantErr)
+				}
+			} else if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("readReply = %#v, %v, want %#v", got, err, tt.want)
+			}
+			var redisErr redisError
+			if err != nil && !errors.As(err, &redisErr) {
+				return
+			}
+			// A complete reply leaves the reader on the next one
+			if next, err := readReply(r); next != "next" {
+				t.Errorf("next reply = %v, %v", next, err)
+			}
+		})
+	}
+}
+
+// fakeRedis serves the given replies in turn on a pipe, one per command,
+// and returns the client end of the pipe. Replies are written line by line,
+// as they may arrive over TCP.
+func fakeRedis(t *testing.T, replies ...string) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+	go func() {
+		r := bufio.NewReader(server)
+		for _, reply := range replies {
+			if _, err := readReply(r); err != nil {
+				return
+			}
+			for line := range strings.Lines(reply) {
+				if _, err := server.Write([]byte(line)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return client
+}
+
+func TestRedisStoreReusesConnAfterErrorReply(t *testing.T) {
+	s := &redisStore{idle: make(chan net.Conn, 1)}
+	s.idle <- fakeRedis(t, "*2\r\n-ERR script failed\r\n:1\r\n", "+PONG\r\n")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var redisErr redisError
+	if _, err := s.do(ctx, "EVAL", "return"); !errors.As(err, &redisErr) {
+		t.Fatalf("do = %v, want an error reply", err)
+	}
+	if len(s.idle) != 1 {
+		t.Fatal("connection not returned to the pool after an error reply")
+	}
+	if reply, err := s.do(ctx, "PING"); reply != "PONG" || err != nil {
+		t.Errorf("reply on the pooled connection = %v, %v, want PONG", reply, err)
+	}
+}
+
+func TestRedisStoreHit(t *testing.T) {
+	s := &redisStore{idle: make(chan net.Conn, 1)}
+	s.idle <- fakeRedis(t, "*3\r\n:1\r\n:4\r\n:60000\r\n", "*2\r\n:1\r\n:4\r\n")
+	ctx := context.Background()
+
+	allowed, remaining, resetIn, err := s.Hit(ctx, "ip:192.0.2.1", 1, 5, time.Minute)
+	if err != nil || !allowed || remaining != 4 || resetIn != time.Minute {
+		t.Errorf("Hit = %v, %d, %v, %v", allowed, remaining, resetIn, err)
+	}
+	if _, _, _, err := s.Hit(ctx, "ip:192.0.2.1", 1, 5, time.Minute); err == nil {
+		t.Error("Hit accepted a malformed reply")
+	}
+}
+
+func TestNewRedisStore(t *testing.T) {
+	tests := []struct {
+		url      string
+		addr     string
+		password string
+		db       int
+		wantErr  bool
+	}{
+		{url: "redis://localhost", addr: "localhost:6379"},
+		{url: "redis://:secret@redis.internal:6380/2", addr: "redis.internal:6380", password: "secret", db: 2},
+		{url: "redis://[::1]/", addr: "[::1]:6379"},
+		{url: "redis://localhost/db", wantErr: true},
+		{url: "http://localhost", wantErr: true},
+		{url: "redis:///0", wantErr: true},
+	}
+	for _, tt := range tests {
+		s, err := newRedisStore(tt.url)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("newRedisStore(%q) accepted an invalid URL", tt.url)
+			}
+			continue
+		}
+		if err != nil || s.addr != tt.addr || s.password != tt.password || s.db != tt.db {
+			t.Errorf("newRedisStore(%q) = %+v, %v", tt.url, s, err)
+		}
+	}
+}
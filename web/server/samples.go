@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+	"github.com/audrenbdb/facturx/corpus"
+)
+
+// handleSamplePersona returns a realistic invoice ready to be posted to
+// /api/generate, dated today, for the persona given by the "persona" query
+// parameter (freelance by default). The SPA and API explorers use it to
+// try the generator in one click.
+func handleSamplePersona(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("persona")
+	if name == "" {
+		name = "freelance"
+	}
+	persona, ok := personas[name]
+	if !ok {
+		names := make([]string, 0, len(personas))
+		for n := range personas {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		sendError(w, tr(r, "Profil d'exemple inconnu : %s (disponibles : %s)", name, strings.Join(names, ", ")), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(persona(time.Now()))
+}
+
+// personas build the sample invoice of /api/sample for a given day.
+var personas = map[string]func(today time.Time) api.GenerateRequest{
+	"freelance": func(today time.Time) api.GenerateRequest {
+		return api.GenerateRequest{
+			Number: today.Format("2006") + "-042",
+			Date:   today.Format("2006-01-02"),
+			Seller: api.ContactJSON{Contact: facturx.Contact{
+				Name: "Camille Durand EI", Siret: "52825000400033", NAF: "7410Z",
+				Address: "8 rue des Arts", ZipCode: "35000", City: "Rennes",
+			}, Email: "camille@durand-graphisme.fr"},
+			Buyer: api.ContactJSON{Contact: facturx.Contact{
+				Name: "Dupont Industries SA", Siret: "35600000000048",
+				Address: "15 rue de la République", ZipCode: "69002", City: "Lyon",
+			}, Email: "comptabilite@dupont-industries.fr"},
+			Lines: []api.LineJSON{
+				sampleLine("Création d'identité visuelle (logo et charte graphique)", 1, 1800, 4),
+				sampleLine("Déclinaison des supports (cartes de visite, papeterie)", 3, 150, 4),
+				sampleLine("Séance de travail avec l'équipe marketing (heure)", 4, 60, 4),
+			},
+			PaymentTerms: api.PaymentJSON{
+				DueDate:     today.AddDate(0, 0, 30).Format("2006-01-02"),
+				IBAN:        "FR76 3000 6000 0112 3456 7890 189",
+				Note:        "Paiement à 30 jours par virement bancaire.",
+				LatePayment: &facturx.LatePaymentTerms{},
+			},
+			Note: "Merci pour votre confiance !",
+		}
+	},
+	"medical": func(today time.Time) api.GenerateRequest {
+		return api.GenerateRequest{
+			Number: today.Format("2006") + "-0187",
+			Date:   today.Format("2006-01-02"),
+			Seller: api.ContactJSON{Contact: facturx.Contact{
+				Name: "Claire Martin, masseur-kinésithérapeute", Siret: "52825000400033",
+				Address: "3 place de la Mairie", ZipCode: "33000", City: "Bordeaux",
+				ProfessionalIds: []facturx.ProfessionalId{{Type: "RPPS", Value: "10101234567"}},
+			}},
+			Buyer: api.ContactJSON{Contact: facturx.Contact{
+				Name: "Éloïse Lefèvre", Address: "8 rue des Lilas", ZipCode: "33000", City: "Bordeaux",
+			}, Email: "eloise.lefevre@example.com"},
+			Lines: []api.LineJSON{
+				sampleLine("Séance de rééducation (AMK 7,5)", 10, 16.13, 5),
+				sampleLine("Bilan-diagnostic kinésithérapique", 1, 48.3, 5),
+			},
+			PaymentTerms: api.PaymentJSON{Note: "Réglée par carte bancaire."},
+		}
+	},
+	"ecommerce": func(today time.Time) api.GenerateRequest {
+		return api.GenerateRequest{
+			Number: "CMD-" + today.Format("20060102") + "-1234",
+			Date:   today.Format("2006-01-02"),
+			Seller: api.ContactJSON{Contact: facturx.Contact{
+				Name: "La Maison du Thé", Siret: "52825000400033", VatNumber: "FR32528250004",
+				Address: "42 quai Saint-Antoine", ZipCode: "69002", City: "Lyon",
+				LegalForm: "SAS", ShareCapital: 5000, RCSCity: "Lyon", NAF: "4791B",
+			}, Email: "boutique@maisonduthe.fr"},
+			Buyer: api.ContactJSON{Contact: facturx.Contact{
+				Name: "Julien Moreau", Address: "27 avenue Jean Jaurès", ZipCode: "31000", City: "Toulouse",
+			}, Email: "julien.moreau@example.com"},
+			Lines: []api.LineJSON{
+				sampleLine("Thé vert Sencha bio - 100 g", 2, 9.90, 0),
+				sampleLine("Théière en fonte 0,8 L", 1, 45, 0),
+				sampleLine("Coffret découverte 12 sachets", 1, 18.50, 0),
+			},
+			Shipping:     6.90,
+			PaymentTerms: api.PaymentJSON{Note: "Commande réglée en ligne par carte bancaire."},
+			Note:         "Droit de rétractation de 14 jours à compter de la livraison.",
+		}
+	},
+}
+
+// sampleLine returns a line of a sample invoice with a VAT regime code.
+func sampleLine(description string, quantity, unitPrice float64, regime int) api.LineJSON {
+	return api.LineJSON{
+		InvoiceLine: facturx.InvoiceLine{Description: description, Quantity: quantity, UnitPrice: unitPrice},
+		VATRegime:   &regime,
+	}
+}
+
+// handleSamples lists the sample invoices of the corpus, for the demo to
+// showcase edge cases (VAT regimes, accents, 500 lines...).
+func handleSamples(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(corpus.All())
+}
+
+// handleSample generates the sample invoice /api/samples/{name}. It counts
+// against the rate limit like any generation.
+func handleSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sample, ok := corpus.Get(strings.TrimPrefix(r.URL.Path, "/api/samples/"))
+	if !ok {
+		sendError(w, tr(r, "Exemple introuvable"), http.StatusNotFound)
+		return
+	}
+	if !checkRateLimit(w, r) {
+		return
+	}
+
+	res, err := facturx.GenerateResult(sample.Request)
+	if err != nil {
+		sendGenerationError(w, r, err, http.StatusInternalServerError, "Erreur de génération : %v")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="facture-%s.pdf"`, sample.Name))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(res.PDF)))
+	w.Header().Set("X-Invoice-Fingerprint", res.Fingerprint)
+	w.Write(res.PDF)
+}
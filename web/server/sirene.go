@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/audrenbdb/facturx/sirene"
+)
+
+// companies looks up establishments in the Sirene directory, or is nil
+// when no INSEE API key is configured.
+var companies sirene.Directory
+
+// handleCompany returns the establishment of a SIRET, so that the frontend
+// can prefill a party and warn about closed establishments.
+func handleCompany(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if companies == nil {
+		sendError(w, tr(r, "Recherche SIRET non configurée"), http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	e, err := companies.Lookup(ctx, strings.TrimPrefix(r.URL.Path, "/api/companies/"))
+	switch {
+	case errors.Is(err, sirene.ErrInvalidSiret):
+		sendError(w, tr(r, "SIRET invalide (14 chiffres avec une clé de contrôle valide)"), http.StatusBadRequest)
+		return
+	case errors.Is(err, sirene.ErrNotFound):
+		sendError(w, tr(r, "SIRET inconnu du répertoire Sirene"), http.StatusNotFound)
+		return
+	case err != nil:
+		logger(r).Error("Sirene lookup failed", "err", err)
+		sendError(w, tr(r, "Répertoire Sirene indisponible"), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
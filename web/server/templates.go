@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/audrenbdb/facturx"
+	"github.com/audrenbdb/facturx/api"
+)
+
+// Template holds invoice fields reused across invoices. A generate request
+// referencing a template by ID gets its empty seller and payment fields,
+// its note, header, footer, layout and the VAT regime of lines that omit one from the
+// template.
+type Template struct {
+	ID           string                `json:"id"`
+	Name         string                `json:"name,omitempty"`
+	Seller       api.ContactJSON       `json:"seller"`
+	VATRegime    *int                  `json:"vatRegime,omitempty"`
+	PaymentTerms api.PaymentJSON       `json:"paymentTerms"`
+	Note         string                `json:"note,omitempty"`
+	Header       *facturx.Header       `json:"header,omitempty"`
+	Footer       *facturx.Footer       `json:"footer,omitempty"`
+	Layout       *facturx.LayoutConfig `json:"layout,omitempty"`
+}
+
+// storedTemplate is a template as saved on disk, with the name of the API
+// key owning it (empty for anonymous access).
+type storedTemplate struct {
+	Owner string `json:"owner,omitempty"`
+	Template
+}
+
+// templateStore keeps templates in a JSON file, rewritten on each change.
+type templateStore struct {
+	mu        sync.Mutex
+	path      string
+	templates map[string]storedTemplate // by owner + "/" + ID
+}
+
+var templates *templateStore
+
+// maxTemplates caps the templates of an API key: the whole store is kept
+// in memory and rewritten to the file on each change.
+const maxTemplates = 100
+
+var (
+	errTemplateNotFound = errors.New("template not found")
+	errTooManyTemplates = errors.New("too many templates")
+)
+
+// openTemplateStore loads the templates file; a missing file is an empty
+// store.
+func openTemplateStore(path string) (*templateStore, error) {
+	s := &templateStore{path: path, templates: make(map[string]storedTemplate)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []storedTemplate
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, t := range list {
+		s.templates[t.Owner+"/"+t.ID] = t
+	}
+	return s, nil
+}
+
+func (s *templateStore) list(owner string) []Template {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Template{}
+	for _, t := range s.templates {
+		if t.Owner == owner {
+			list = append(list, t.Template)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *templateStore) get(owner, id string) (Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.templates[owner+"/"+id]
+	if !ok {
+		return Template{}, errTemplateNotFound
+	}
+	return t.Template, nil
+}
+
+func (s *templateStore) put(owner string, t Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := owner + "/" + t.ID
+	old, existed := s.templates[key]
+	if !existed {
+		count := 0
+		for _, t := range s.templates {
+			if t.Owner == owner {
+				count++
+			}
+		}
+		if count >= maxTemplates {
+			return errTooManyTemplates
+		}
+	}
+	s.templates[key] = storedTemplate{Owner: owner, Template: t}
+	if err := s.save(); err != nil {
+		if existed {
+			s.templates[key] = old
+		} else {
+			delete(s.templates, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *templateStore) delete(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := owner + "/" + id
+	old, ok := s.templates[key]
+	if !ok {
+		return errTemplateNotFound
+	}
+	delete(s.templates, key)
+	if err := s.save(); err != nil {
+		s.templates[key] = old
+		return err
+	}
+	return nil
+}
+
+// save writes the store atomically. s.mu must be held.
+func (s *templateStore) save() error {
+	list := make([]storedTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Owner != list[j].Owner {
+			return list[i].Owner < list[j].Owner
+		}
+		return list[i].ID < list[j].ID
+	})
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".templates-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// applyTemplate fills the request from the template it references, if any.
+func applyTemplate(r *http.Request, req *api.GenerateRequest) error {
+	if req.Template == "" {
+		return nil
+	}
+	owner := requestOwner(r)
+	if owner == "" {
+		return errors.New(tr(r, "Modèles indisponibles : le serveur n'a pas de clé d'API"))
+	}
+	t, err := templates.get(owner, req.Template)
+	if err != nil {
+		return errors.New(tr(r, "Modèle inconnu : %s", req.Template))
+	}
+
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&req.Seller.Name, t.Seller.Name)
+	if req.Seller.Siret == "" && req.Seller.Siren == "" && req.Seller.RCS == "" {
+		req.Seller.Siret = t.Seller.Siret
+		req.Seller.Siren = t.Seller.Siren
+		req.Seller.RCS = t.Seller.RCS
+	}
+	fill(&req.Seller.VatNumber, t.Seller.VatNumber)
+	fill(&req.Seller.Address, t.Seller.Address)
+	fill(&req.Seller.ZipCode, t.Seller.ZipCode)
+	fill(&req.Seller.City, t.Seller.City)
+	fill(&req.Seller.CountryCode, t.Seller.CountryCode)
+	fill(&req.Seller.Email, t.Seller.Email)
+	fill(&req.PaymentTerms.DueDate, t.PaymentTerms.DueDate)
+	fill(&req.PaymentTerms.IBAN, t.PaymentTerms.IBAN)
+	fill(&req.PaymentTerms.BIC, t.PaymentTerms.BIC)
+	fill(&req.PaymentTerms.Note, t.PaymentTerms.Note)
+	if req.PaymentTerms.LatePayment == nil {
+		req.PaymentTerms.LatePayment = t.PaymentTerms.LatePayment
+	}
+	if req.PaymentTerms.CashDiscount == nil {
+		req.PaymentTerms.CashDiscount = t.PaymentTerms.CashDiscount
+	}
+	fill(&req.Note, t.Note)
+	if req.Header == nil {
+		req.Header = t.Header
+	}
+	if req.Footer == nil {
+		req.Footer = t.Footer
+	}
+	if req.Layout == nil {
+		req.Layout = t.Layout
+	}
+	for i := range req.Lines {
+		if req.Lines[i].VATRegime == nil {
+			req.Lines[i].VATRegime = t.VATRegime
+		}
+	}
+	req.Template = ""
+	return nil
+}
+
+// withTemplates disables the template routes (404) when the server has no
+// API key: every anonymous visitor would share the same templates, with
+// their seller details and IBAN.
+func withTemplates(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(cfg.APIKeys) == 0 {
+			sendError(w, tr(r, "Modèles indisponibles : le serveur n'a pas de clé d'API"), http.StatusNotFound)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requestOwner returns the name of the request's API key, empty when the
+// request is anonymous.
+func requestOwner(r *http.Request) string {
+	key, _ := requestAPIKey(r)
+	return key.name
+}
+
+// handleTemplates lists (GET) or creates (POST) templates. Templates are
+// private to the API key that created them.
+func handleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(templates.list(requestOwner(r)))
+	case "POST":
+		var t Template
+		if !decodeJSON(w, r, &t) {
+			return
+		}
+		if !validTemplateID(t.ID) {
+			sendError(w, tr(r, "Identifiant de modèle invalide (lettres, chiffres, - et _ uniquement)"), http.StatusBadRequest)
+			return
+		}
+		if _, err := templates.get(requestOwner(r), t.ID); err == nil {
+			sendError(w, tr(r, "Un modèle porte déjà cet identifiant"), http.StatusConflict)
+			return
+		}
+		saveTemplate(w, r, t, http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTemplate reads (GET), replaces (PUT) or deletes (DELETE) the
+// template /api/templates/{id}.
+func handleTemplate(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/templates/")
+	owner := requestOwner(r)
+
+	switch r.Method {
+	case "GET":
+		t, err := templates.get(owner, id)
+		if err != nil {
+			sendError(w, tr(r, "Modèle introuvable"), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	case "PUT":
+		var t Template
+		if !decodeJSON(w, r, &t) {
+			return
+		}
+		if t.ID != "" && t.ID != id {
+			sendError(w, tr(r, "L'identifiant du corps ne correspond pas à l'URL"), http.StatusBadRequest)
+			return
+		}
+		if !validTemplateID(id) {
+			sendError(w, tr(r, "Identifiant de modèle invalide (lettres, chiffres, - et _ uniquement)"), http.StatusBadRequest)
+			return
+		}
+		t.ID = id
+		saveTemplate(w, r, t, http.StatusOK)
+	case "DELETE":
+		err := templates.delete(owner, id)
+		if errors.Is(err, errTemplateNotFound) {
+			sendError(w, tr(r, "Modèle introuvable"), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger(r).Error("Template store write failed", "err", err)
+			sendError(w, tr(r, "Impossible d'enregistrer les modèles"), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func saveTemplate(w http.ResponseWriter, r *http.Request, t Template, status int) {
+	if t.VATRegime != nil && (*t.VATRegime < 0 || *t.VATRegime > 5) {
+		sendError(w, tr(r, "Régime de TVA invalide"), http.StatusBadRequest)
+		return
+	}
+	err := templates.put(requestOwner(r), t)
+	if errors.Is(err, errTooManyTemplates) {
+		sendError(w, tr(r, "Nombre maximal de modèles atteint (%d)", maxTemplates), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logger(r).Error("Template store write failed", "err", err)
+		sendError(w, tr(r, "Impossible d'enregistrer les modèles"), http.StatusInternalServerError)
+		return
+	}
+	logger(r).Info("Template saved", "template", t.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(t)
+}
+
+func validTemplateID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupTemplates configures the server with the given API keys, an empty
+// template store and an in-memory rate limiter, for the duration of the
+// test. It returns the template routes as main sets them up.
+func setupTemplates(t *testing.T, keys string) http.Handler {
+	t.Helper()
+	savedCfg, savedTemplates, savedLimiter := cfg, templates, limiter
+	t.Cleanup(func() { cfg, templates, limiter = savedCfg, savedTemplates, savedLimiter })
+
+	apiKeys, err := parseAPIKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{APIKeys: apiKeys, RateLimitRequests: 1000, RateLimitWindow: time.Hour, MaxBodySize: 1 << 20}
+	if templates, err = openTemplateStore(filepath.Join(t.TempDir(), "templates.json")); err != nil {
+		t.Fatal(err)
+	}
+	limiter = newRateLimiter(newMemoryStore())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/templates", withTemplates(requireAPIKey(withRateLimit(handleTemplates))))
+	mux.HandleFunc("/api/templates/", withTemplates(requireAPIKey(withRateLimit(handleTemplate))))
+	return withBodyLimit(mux)
+}
+
+func templateRequest(h http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestTemplatesPerOwner(t *testing.T) {
+	h := setupTemplates(t, "alice:alice-key,bob:bob-key")
+	const tmpl = `{"id": "acme", "seller": {"name": "ACME"}, "paymentTerms": {"iban": "FR7630001007941234567890185"}}`
+
+	if w := templateRequest(h, "POST", "/api/templates", "alice-key", tmpl); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	if w := templateRequest(h, "GET", "/api/templates/acme", "alice-key", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "FR7630001007941234567890185") {
+		t.Errorf("owner read: %d %s", w.Code, w.Body)
+	}
+
+	// Bob sees nothing of Alice's templates and cannot change them
+	w := templateRequest(h, "GET", "/api/templates", "bob-key", "")
+	var list []Template
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 0 {
+		t.Errorf("other owner list = %s", w.Body)
+	}
+	if w := templateRequest(h, "GET", "/api/templates/acme", "bob-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("other owner read: %d %s", w.Code, w.Body)
+	}
+	if w := templateRequest(h, "DELETE", "/api/templates/acme", "bob-key", ""); w.Code != http.StatusNotFound {
+		t.Errorf("other owner delete: %d", w.Code)
+	}
+	if w := templateRequest(h, "PUT", "/api/templates/acme", "bob-key", `{"seller": {"name": "Bob"}}`); w.Code != http.StatusOK {
+		t.Errorf("other owner put: %d %s", w.Code, w.Body)
+	}
+	w = templateRequest(h, "GET", "/api/templates/acme", "alice-key", "")
+	if !strings.Contains(w.Body.String(), `"ACME"`) {
+		t.Errorf("template overwritten by another owner: %s", w.Body)
+	}
+
+	if w := templateRequest(h, "GET", "/api/templates", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous list: %d", w.Code)
+	}
+}
+
+func TestTemplatesWithoutAPIKeys(t *testing.T) {
+	h := setupTemplates(t, "")
+	for _, method := range []string{"GET", "POST"} {
+		if w := templateRequest(h, method, "/api/templates", "", `{"id": "acme"}`); w.Code != http.StatusNotFound {
+			t.Errorf("%s /api/templates: %d", method, w.Code)
+		}
+	}
+	if w := templateRequest(h, "PUT", "/api/templates/acme", "", `{}`); w.Code != http.StatusNotFound {
+		t.Errorf("PUT /api/templates/acme: %d", w.Code)
+	}
+}
+
+func TestTemplatesLimit(t *testing.T) {
+	h := setupTemplates(t, "alice:alice-key")
+	for i := range maxTemplates {
+		if w := templateRequest(h, "PUT", fmt.Sprintf("/api/templates/t%d", i), "alice-key", `{}`); w.Code != http.StatusOK {
+			t.Fatalf("template %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+	if w := templateRequest(h, "PUT", "/api/templates/one-more", "alice-key", `{}`); w.Code != http.StatusForbidden {
+		t.Errorf("template over the limit: %d %s", w.Code, w.Body)
+	}
+	// Replacing an existing template is still allowed
+	if w := templateRequest(h, "PUT", "/api/templates/t0", "alice-key", `{"note": "x"}`); w.Code != http.StatusOK {
+		t.Errorf("replace at the limit: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestTemplatesRateLimit(t *testing.T) {
+	h := setupTemplates(t, "alice:alice-key")
+	cfg.RateLimitRequests = 2
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if w := templateRequest(h, "GET", "/api/templates", "alice-key", ""); w.Code != want {
+			t.Errorf("request %d: %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// listenAndServe serves handler on cfg.Addr, over TLS when configured.
+// HTTP/2 is negotiated automatically on TLS connections.
+func listenAndServe(cfg *Config, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if !cfg.TLS() {
+		slog.Info("Factur-X server starting", "addr", cfg.Addr)
+		return srv.ListenAndServe()
+	}
+
+	// Fallback for plain HTTP: ACME challenges, then redirect to HTTPS
+	redirect := http.HandlerFunc(redirectHTTPS)
+	var fallback http.Handler = redirect
+	if len(cfg.TLSDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.TLSDomains...),
+			Cache:      autocert.DirCache(cfg.TLSCacheDir),
+		}
+		srv.TLSConfig = m.TLSConfig()
+		fallback = m.HTTPHandler(redirect)
+	} else {
+		srv.TLSConfig = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+	if cfg.HTTPAddr != "" {
+		go func() {
+			slog.Info("HTTP redirect listener starting", "addr", cfg.HTTPAddr)
+			httpSrv := &http.Server{Addr: cfg.HTTPAddr, Handler: fallback, ReadHeaderTimeout: 10 * time.Second}
+			if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("HTTP redirect listener failed", "err", err)
+			}
+		}()
+	}
+
+	slog.Info("Factur-X server starting", "addr", cfg.Addr, "tls", true)
+	return srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+}
+
+// redirectHTTPS redirects a plain HTTP request to the same URL over HTTPS.
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(cfg.Addr); err == nil && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
@@ -48,6 +48,17 @@ function formatSiret(value) {
   return digits.replace(/(\d{3})(?=\d)/g, '$1 ').trim()
 }
 
+function pickContact(contact) {
+  return {
+    name: contact.name || '',
+    siret: formatSiret(contact.siret || ''),
+    street: contact.street || '',
+    postalCode: contact.postalCode || '',
+    city: contact.city || '',
+    email: contact.email || '',
+  }
+}
+
 function formatCurrency(amount) {
   return new Intl.NumberFormat('fr-FR', {
     style: 'currency',
@@ -218,49 +229,12 @@ function TotalsDisplay({ lines }) {
   )
 }
 
-// Demo data for quick testing
-const demoData = {
-  invoiceNumber: `FAC-${new Date().getFullYear()}-${String(Math.floor(Math.random() * 999) + 1).padStart(3, '0')}`,
-  seller: {
-    name: 'TechConsult SARL',
-    siret: '528 250 004 00033', // Valid Luhn checksum
-    vatNumber: 'FR32528250004',
-    street: '42 Boulevard Haussmann',
-    postalCode: '75009',
-    city: 'Paris',
-    email: 'facturation@techconsult.fr',
-  },
-  buyer: {
-    name: 'Dupont Industries SA',
-    siret: '356 000 000 00048', // La Poste - valid Luhn checksum
-    street: '15 Rue de la République',
-    postalCode: '69002',
-    city: 'Lyon',
-    email: 'comptabilite@dupont-industries.fr',
-  },
-  lines: [
-    {
-      description: 'Développement application web - Phase 1',
-      quantity: 5,
-      unitPrice: 650,
-      vatRegime: 'standard',
-    },
-    {
-      description: 'Consultation technique et architecture',
-      quantity: 2,
-      unitPrice: 450,
-      vatRegime: 'standard',
-    },
-    {
-      description: 'Formation équipe développement (1 journée)',
-      quantity: 1,
-      unitPrice: 1200,
-      vatRegime: 'reduced',
-    },
-  ],
-  iban: 'FR76 3000 6000 0112 3456 7890 189',
-  note: 'Paiement à 30 jours par virement bancaire.',
-}
+// Demo personas served by /api/sample
+const DEMO_PERSONAS = [
+  { id: 'freelance', label: 'Freelance' },
+  { id: 'medical', label: 'Médical' },
+  { id: 'ecommerce', label: 'E-commerce' },
+]
 
 export default function InvoiceForm() {
   const [invoiceNumber, setInvoiceNumber] = useState('')
@@ -276,22 +250,34 @@ export default function InvoiceForm() {
   const [isGenerating, setIsGenerating] = useState(false)
   const [errors, setErrors] = useState({})
 
-  // Fill form with demo data
-  const fillDemoData = useCallback(() => {
-    setInvoiceNumber(demoData.invoiceNumber)
-    setInvoiceDate(new Date().toISOString().split('T')[0])
-    // Set due date to 30 days from now
-    const due = new Date()
-    due.setDate(due.getDate() + 30)
-    setDueDate(due.toISOString().split('T')[0])
-    setVatExemption('none')
-    setSeller(demoData.seller)
-    setBuyer(demoData.buyer)
-    setLines(demoData.lines.map(l => ({ ...l })))
-    setIban(demoData.iban)
-    setBic('')
-    setNote(demoData.note)
-    setErrors({})
+  // Fill form with the demo invoice of a persona
+  const fillDemoData = useCallback(async (persona) => {
+    try {
+      const response = await fetch(`/api/sample?persona=${persona}`)
+      if (!response.ok) throw new Error((await response.json()).message)
+      const sample = await response.json()
+      const regimeId = (code) => VAT_REGIMES.find(v => v.code === code)?.id || 'standard'
+      const exemption = regimeId(sample.lines[0]?.vatRegime)
+      setInvoiceNumber(sample.number)
+      setInvoiceDate(sample.date)
+      setDueDate(sample.paymentTerms.dueDate || '')
+      setVatExemption(VAT_EXEMPTIONS.some(e => e.id === exemption) ? exemption : 'none')
+      setSeller({ ...initialSeller, ...pickContact(sample.seller), vatNumber: sample.seller.vatNumber || '' })
+      setBuyer({ ...initialBuyer, ...pickContact(sample.buyer) })
+      setLines(sample.lines.map(l => ({
+        description: l.description,
+        quantity: l.quantity,
+        unitPrice: l.unitPrice,
+        vatRegime: regimeId(l.vatRegime),
+      })))
+      setIban(sample.paymentTerms.iban || '')
+      setBic(sample.paymentTerms.bic || '')
+      setNote(sample.paymentTerms.note || '')
+      setErrors({})
+    } catch (error) {
+      console.error('Sample error:', error)
+      alert(`Erreur: ${error.message}\n\nNote: Le serveur API doit être lancé sur le port 9473.`)
+    }
   }, [])
 
   // When VAT exemption changes, update all lines
@@ -406,7 +392,8 @@ export default function InvoiceForm() {
 
       if (!response.ok) {
         const error = await response.json()
-        throw new Error(error.message || 'Erreur lors de la génération')
+        const details = (error.errors || []).map((e) => `${e.field} : ${e.message}`)
+        throw new Error([error.message || 'Erreur lors de la génération', ...details].join('\n'))
       }
 
       const blob = await response.blob()
@@ -441,19 +428,24 @@ export default function InvoiceForm() {
               </div>
               <div>
                 <p className="font-medium text-amber-900">Mode démonstration</p>
-                <p className="text-sm text-amber-700">Remplissez avec des données d'exemple</p>
+                <p className="text-sm text-amber-700">Remplissez avec une facture d'exemple</p>
               </div>
             </div>
-            <button
-              type="button"
-              onClick={fillDemoData}
-              className="w-full sm:w-auto shrink-0 px-5 py-3 bg-amber-500 hover:bg-amber-600 text-white font-semibold rounded-xl shadow-sm hover:shadow transition-all flex items-center justify-center gap-2"
-            >
-              <svg className="w-5 h-5" fill="none" viewBox="0 0 24 24" stroke="currentColor">
-                <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M19 11H5m14 0a2 2 0 012 2v6a2 2 0 01-2 2H5a2 2 0 01-2-2v-6a2 2 0 012-2m14 0V9a2 2 0 00-2-2M5 11V9a2 2 0 012-2m0 0V5a2 2 0 012-2h6a2 2 0 012 2v2M7 7h10" />
-              </svg>
-              Données démo
-            </button>
+            <div className="flex flex-col sm:flex-row gap-2 w-full sm:w-auto">
+              {DEMO_PERSONAS.map((persona) => (
+                <button
+                  key={persona.id}
+                  type="button"
+                  onClick={() => fillDemoData(persona.id)}
+                  className="w-full sm:w-auto shrink-0 px-5 py-3 bg-amber-500 hover:bg-amber-600 text-white font-semibold rounded-xl shadow-sm hover:shadow transition-all flex items-center justify-center gap-2"
+                >
+                  <svg className="w-5 h-5" fill="none" viewBox="0 0 24 24" stroke="currentColor">
+                    <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M19 11H5m14 0a2 2 0 012 2v6a2 2 0 01-2 2H5a2 2 0 01-2-2v-6a2 2 0 012-2m14 0V9a2 2 0 00-2-2M5 11V9a2 2 0 012-2m0 0V5a2 2 0 012-2h6a2 2 0 012 2v2M7 7h10" />
+                  </svg>
+                  {persona.label}
+                </button>
+              ))}
+            </div>
           </div>
         </div>
 
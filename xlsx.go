@@ -0,0 +1,208 @@
+package facturx
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerSubsystem("xlsx")
+}
+
+// ExportXLSX writes an Excel workbook summarizing the given invoices.
+//
+// The workbook has two sheets: "Factures" with one row per invoice (number,
+// date, parties, totals) and "Lignes" with one row per invoice line. Amounts
+// are written as numbers with a 2-decimal format and dates as real Excel
+// dates, so accountants can sort and sum them directly.
+func ExportXLSX(w io.Writer, invoices []InvoiceRequest) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+		{"xl/worksheets/sheet1.xml", xlsxInvoicesSheet(invoices)},
+		{"xl/worksheets/sheet2.xml", xlsxLinesSheet(invoices)},
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// Cell style indexes defined in xlsxStyles.
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleAmount  = 2
+	xlsxStyleDate    = 3
+)
+
+// xlsxInvoicesSheet builds the "Factures" sheet.
+func xlsxInvoicesSheet(invoices []InvoiceRequest) string {
+	var sheet xlsxSheetWriter
+	sheet.row(
+		sheet.header("Numéro"), sheet.header("Date"), sheet.header("Vendeur"), sheet.header("SIRET vendeur"),
+		sheet.header("Acheteur"), sheet.header("Taux TVA"), sheet.header("Total HT"),
+		sheet.header("TVA"), sheet.header("Total TTC"),
+	)
+
+	for _, inv := range invoices {
+		inv = normalizeDates(inv)
+		calc := calculateInvoice(&inv)
+		sheet.row(
+			sheet.text(inv.Number), sheet.date(inv.Date), sheet.text(inv.Seller.Name), sheet.text(inv.Seller.Siret),
+			sheet.text(inv.Buyer.Name), sheet.number(calc.vatRate, xlsxStyleDefault), sheet.number(calc.taxBase.Float(), xlsxStyleAmount),
+			sheet.number(calc.taxTotal.Float(), xlsxStyleAmount), sheet.number(calc.grandTotal.Float(), xlsxStyleAmount),
+		)
+	}
+
+	return sheet.String()
+}
+
+// xlsxLinesSheet builds the "Lignes" sheet.
+func xlsxLinesSheet(invoices []InvoiceRequest) string {
+	var sheet xlsxSheetWriter
+	sheet.row(
+		sheet.header("Facture"), sheet.header("Ligne"), sheet.header("Description"),
+		sheet.header("Quantité"), sheet.header("Prix unitaire HT"), sheet.header("Total HT"),
+	)
+
+	for _, inv := range invoices {
+		calc := calculateInvoice(&inv)
+		for i, line := range inv.Lines {
+			sheet.row(
+				sheet.text(inv.Number), sheet.number(float64(i+1), xlsxStyleDefault), sheet.text(line.Description),
+				sheet.number(line.Quantity, xlsxStyleDefault), sheet.number(line.UnitPrice, xlsxStyleAmount),
+				sheet.number(calc.lineAmounts[i].Float(), xlsxStyleAmount),
+			)
+		}
+	}
+
+	return sheet.String()
+}
+
+// xlsxSheetWriter accumulates rows of a worksheet.
+type xlsxSheetWriter struct {
+	rows strings.Builder
+	n    int
+}
+
+// xlsxCell is a serialized cell without its reference attribute.
+type xlsxCell struct {
+	attrs string
+	inner string
+}
+
+func (s *xlsxSheetWriter) header(text string) xlsxCell {
+	c := s.text(text)
+	c.attrs += fmt.Sprintf(` s="%d"`, xlsxStyleHeader)
+	return c
+}
+
+func (s *xlsxSheetWriter) text(text string) xlsxCell {
+	return xlsxCell{attrs: ` t="inlineStr"`, inner: "<is><t>" + escapeXML(text) + "</t></is>"}
+}
+
+func (s *xlsxSheetWriter) number(v float64, style int) xlsxCell {
+	return xlsxCell{attrs: fmt.Sprintf(` s="%d"`, style), inner: fmt.Sprintf("<v>%g</v>", v)}
+}
+
+// date writes a YYYYMMDD date as an Excel serial date, or as text if invalid.
+func (s *xlsxSheetWriter) date(ciiDate string) xlsxCell {
+	t, err := parseCIIDate(ciiDate)
+	if err != nil {
+		return s.text(ciiDate)
+	}
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	serial := int(t.Sub(epoch).Hours() / 24)
+	return xlsxCell{attrs: fmt.Sprintf(` s="%d"`, xlsxStyleDate), inner: fmt.Sprintf("<v>%d</v>", serial)}
+}
+
+func (s *xlsxSheetWriter) row(cells ...xlsxCell) {
+	s.n++
+	fmt.Fprintf(&s.rows, `<row r="%d">`, s.n)
+	for i, c := range cells {
+		fmt.Fprintf(&s.rows, `<c r="%s%d"%s>%s</c>`, xlsxColumn(i), s.n, c.attrs, c.inner)
+	}
+	s.rows.WriteString("</row>")
+}
+
+func (s *xlsxSheetWriter) String() string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetData>` + s.rows.String() + `</sheetData></worksheet>`
+}
+
+// xlsxColumn converts a 0-based column index to its letter reference (0 → A, 26 → AA).
+func xlsxColumn(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+	return name
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>
+<sheet name="Factures" sheetId="1" r:id="rId1"/>
+<sheet name="Lignes" sheetId="2" r:id="rId2"/>
+</sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+// xlsxStyles defines the cell formats: 0 default, 1 bold header, 2 amount, 3 date.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="#,##0.00"/><numFmt numFmtId="165" formatCode="dd/mm/yyyy"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
@@ -5,9 +5,6 @@ import (
 	"strings"
 )
 
-// Factur-X BASIC profile URN (EN 16931 compliant)
-const profileURN = "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic"
-
 // CII namespace declarations
 const (
 	nsRSM = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
@@ -16,6 +13,10 @@ const (
 	nsQDT = "urn:un:unece:uncefact:data:standard:QualifiedDataType:100"
 )
 
+// ecoContributionReason is the reason of eco-contribution line charges
+// (BT-144), also used to recognise them when parsing.
+const ecoContributionReason = "Éco-participation DEEE"
+
 // escapeXML escapes special characters for XML content.
 func escapeXML(s string) string {
 	var b strings.Builder
@@ -56,27 +57,43 @@ func fmtQuantity(value float64) string {
 
 // invoiceCalculation holds calculated invoice values.
 type invoiceCalculation struct {
-	lineTotal         float64
-	taxBase           float64
-	taxTotal          float64
-	grandTotal        float64
-	dueAmount         float64
-	vatRate           float64
-	vatCategoryCode   string
-	vatExemptionCode  string
-	vatExemptionText  string
+	lineAmounts      []amount
+	lineDiscounts    []amount
+	lineTotal        amount
+	chargeTotal      amount
+	taxBase          amount
+	taxTotal         amount
+	grandTotal       amount
+	prepaidAmount    amount
+	dueAmount        amount
+	vatRate          float64
+	vatCategoryCode  string
+	vatExemptionCode string
+	vatExemptionText string
 }
 
 // calculateInvoice computes invoice totals according to EN 16931 business rules.
+// Amounts are computed in cents so that rounding is exact (see amount).
 func calculateInvoice(req *InvoiceRequest) invoiceCalculation {
 	// BR-CO-10: Sum of line net amounts
-	var lineTotal float64
-	for _, line := range req.Lines {
-		lineTotal += line.Quantity * line.UnitPrice
+	// Line discounts (BG-27) are deducted from the line amounts and
+	// eco-contributions (BG-28) added to them
+	lineAmounts := make([]amount, len(req.Lines))
+	lineDiscounts := make([]amount, len(req.Lines))
+	var lineTotal amount
+	for i, line := range req.Lines {
+		base := lineNetAmount(line.Quantity, line.UnitPrice)
+		lineDiscounts[i] = percentOf(base, line.DiscountPercent)
+		lineAmounts[i] = base - lineDiscounts[i] + toAmount(line.EcoContribution)
+		lineTotal += lineAmounts[i]
 	}
 
-	// Tax base is the sum of line amounts for simple invoices (no allowances/charges)
-	taxBase := lineTotal
+	// BR-CO-13: tax base = line total + document-level charges
+	var chargeTotal amount
+	for _, c := range req.Charges {
+		chargeTotal += toAmount(c.Amount)
+	}
+	taxBase := lineTotal + chargeTotal
 
 	// Determine VAT treatment
 	vatRate := req.Regime.rate
@@ -85,273 +102,367 @@ func calculateInvoice(req *InvoiceRequest) invoiceCalculation {
 	vatExemptionText := req.Regime.exemptionText
 
 	// BR-CO-14: VAT amount calculation
-	taxTotal := taxBase * vatRate / 100.0
+	taxTotal := percentOf(taxBase, vatRate)
 
 	// BR-CO-15: Grand total = tax base + tax
 	grandTotal := taxBase + taxTotal
 
-	// For simple invoices without prepayment, due = grand total
-	dueAmount := grandTotal
+	// BR-CO-16: Amount due = grand total - paid amount
+	prepaidAmount := toAmount(req.PrepaidAmount)
+	dueAmount := grandTotal - prepaidAmount
 
 	return invoiceCalculation{
-		lineTotal:         lineTotal,
-		taxBase:           taxBase,
-		taxTotal:          taxTotal,
-		grandTotal:        grandTotal,
-		dueAmount:         dueAmount,
-		vatRate:           vatRate,
-		vatCategoryCode:   vatCategoryCode,
-		vatExemptionCode:  vatExemptionCode,
-		vatExemptionText:  vatExemptionText,
+		lineAmounts:      lineAmounts,
+		lineDiscounts:    lineDiscounts,
+		lineTotal:        lineTotal,
+		chargeTotal:      chargeTotal,
+		taxBase:          taxBase,
+		taxTotal:         taxTotal,
+		grandTotal:       grandTotal,
+		prepaidAmount:    prepaidAmount,
+		dueAmount:        dueAmount,
+		vatRate:          vatRate,
+		vatCategoryCode:  vatCategoryCode,
+		vatExemptionCode: vatExemptionCode,
+		vatExemptionText: vatExemptionText,
 	}
 }
 
 // generateCIIXML generates the complete CII XML document.
-func generateCIIXML(req *InvoiceRequest) string {
-	calc := calculateInvoice(req)
-	var xml strings.Builder
-	xml.Grow(8192)
-
-	// XML declaration
-	xml.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
-	xml.WriteByte('\n')
-
-	// Root element with namespaces
-	fmt.Fprintf(&xml, `<rsm:CrossIndustryInvoice xmlns:rsm="%s" xmlns:ram="%s" xmlns:udt="%s" xmlns:qdt="%s">`,
-		nsRSM, nsRAM, nsUDT, nsQDT)
-	xml.WriteByte('\n')
-
-	// ExchangedDocumentContext - identifies profile
-	writeDocumentContext(&xml)
-
-	// ExchangedDocument - invoice header
-	writeExchangedDocument(&xml, req)
-
-	// SupplyChainTradeTransaction - the main content
-	writeSupplyChainTradeTransaction(&xml, req, &calc)
-
-	xml.WriteString("</rsm:CrossIndustryInvoice>\n")
-
-	return xml.String()
+func generateCIIXML(req *InvoiceRequest) (string, error) {
+	doc := buildCII(req)
+	if req.CustomizeCII != nil {
+		req.CustomizeCII(doc)
+	}
+	data, err := doc.Marshal(req.XMLFormat)
+	if err != nil {
+		return "", err
+	}
+	if err := auditXML(data); err != nil {
+		return "", err
+	}
+	return data, nil
 }
 
-// writeDocumentContext writes the ExchangedDocumentContext element.
-func writeDocumentContext(xml *strings.Builder) {
-	xml.WriteString("  <rsm:ExchangedDocumentContext>\n")
-
-	// Business process (optional but recommended)
-	xml.WriteString("    <ram:BusinessProcessSpecifiedDocumentContextParameter>\n")
-	xml.WriteString("      <ram:ID>A1</ram:ID>\n")
-	xml.WriteString("    </ram:BusinessProcessSpecifiedDocumentContextParameter>\n")
-
-	// Guideline - MUST be Factur-X BASIC
-	xml.WriteString("    <ram:GuidelineSpecifiedDocumentContextParameter>\n")
-	fmt.Fprintf(xml, "      <ram:ID>%s</ram:ID>\n", profileURN)
-	xml.WriteString("    </ram:GuidelineSpecifiedDocumentContextParameter>\n")
-
-	xml.WriteString("  </rsm:ExchangedDocumentContext>\n")
+// BuildCII returns the CII document model of an invoice request, as
+// generated before InvoiceRequest.CustomizeCII is applied. Call XML or
+// Marshal to serialize it.
+func BuildCII(req *InvoiceRequest) (*CrossIndustryInvoice, error) {
+	r := normalizeDates(*req)
+	if err := Validate(&r).Err(); err != nil {
+		return nil, err
+	}
+	return buildCII(&r), nil
 }
 
-// writeExchangedDocument writes the ExchangedDocument element (invoice header).
-func writeExchangedDocument(xml *strings.Builder, req *InvoiceRequest) {
-	xml.WriteString("  <rsm:ExchangedDocument>\n")
-
-	// Invoice number (BT-1)
-	fmt.Fprintf(xml, "    <ram:ID>%s</ram:ID>\n", escapeXML(req.Number))
-
-	// Type code: 380 = Commercial Invoice (BT-3)
-	xml.WriteString("    <ram:TypeCode>380</ram:TypeCode>\n")
-
-	// Issue date (BT-2) - format code 102 = YYYYMMDD
-	xml.WriteString("    <ram:IssueDateTime>\n")
-	fmt.Fprintf(xml, "      <udt:DateTimeString format=\"102\">%s</udt:DateTimeString>\n", escapeXML(req.Date))
-	xml.WriteString("    </ram:IssueDateTime>\n")
-
-	xml.WriteString("  </rsm:ExchangedDocument>\n")
+// paymentMeansCode returns the payment means code (BT-81) of a request, or
+// "" if it has none.
+func paymentMeansCode(req *InvoiceRequest) PaymentMeansCode {
+	switch {
+	case req.PaymentMeans != "":
+		return req.PaymentMeans
+	case req.DirectDebit != nil:
+		return PaymentMeansSEPADirectDebit
+	case req.Payment != nil:
+		return req.Payment.Method.MeansCode()
+	default:
+		return ""
+	}
 }
 
-// writeSupplyChainTradeTransaction writes the main transaction content.
-func writeSupplyChainTradeTransaction(xml *strings.Builder, req *InvoiceRequest, calc *invoiceCalculation) {
-	xml.WriteString("  <rsm:SupplyChainTradeTransaction>\n")
-
-	// Line items
-	for i, line := range req.Lines {
-		writeLineItem(xml, &line, i+1, calc)
+// buildCII maps a validated request onto the CII document model.
+func buildCII(req *InvoiceRequest) *CrossIndustryInvoice {
+	calc := calculateInvoice(req)
+	doc := &CrossIndustryInvoice{
+		Context: ExchangedDocumentContext{
+			BusinessProcess: &DocumentContextParameter{ID: "A1"},
+			// Guideline - Factur-X BASIC, or EXTENDED for installments
+			Guideline: DocumentContextParameter{ID: guidelineOf(req)},
+		},
+		Document: ExchangedDocument{
+			// Invoice number (BT-1)
+			ID: req.Number,
+			// Type code (BT-3): 380 = Commercial Invoice, 386 = Down payment...
+			TypeCode: req.Type.code(),
+			// Issue date (BT-2) - format code 102 = YYYYMMDD
+			IssueDate: Date(req.Date),
+		},
 	}
 
-	// Trade agreement (seller, buyer)
-	writeApplicableHeaderTradeAgreement(xml, req)
-
-	// Trade delivery
-	writeApplicableHeaderTradeDelivery(xml, req.Date)
-
-	// Trade settlement (payment, totals)
-	writeApplicableHeaderTradeSettlement(xml, calc)
+	// Invoice notes (BG-1)
+	for _, note := range legalNotes(req) {
+		doc.Document.Notes = append(doc.Document.Notes, IncludedNote{Content: note.text, SubjectCode: note.subjectCode})
+	}
 
-	xml.WriteString("  </rsm:SupplyChainTradeTransaction>\n")
+	transaction := &doc.Transaction
+	for i := range req.Lines {
+		transaction.Lines = append(transaction.Lines, buildLineItem(&req.Lines[i], i, &calc))
+	}
+	transaction.Agreement = buildHeaderTradeAgreement(req)
+	transaction.Delivery = buildHeaderTradeDelivery(req)
+	transaction.Settlement = buildHeaderTradeSettlement(req, &calc)
+	return doc
 }
 
-// writeLineItem writes a single line item.
-func writeLineItem(xml *strings.Builder, line *InvoiceLine, lineNum int, calc *invoiceCalculation) {
-	lineAmount := line.Quantity * line.UnitPrice
-
-	xml.WriteString("    <ram:IncludedSupplyChainTradeLineItem>\n")
-
-	// Line ID (BT-126)
-	xml.WriteString("      <ram:AssociatedDocumentLineDocument>\n")
-	fmt.Fprintf(xml, "        <ram:LineID>%d</ram:LineID>\n", lineNum)
-	xml.WriteString("      </ram:AssociatedDocumentLineDocument>\n")
-
-	// Product information
-	xml.WriteString("      <ram:SpecifiedTradeProduct>\n")
-	fmt.Fprintf(xml, "        <ram:Name>%s</ram:Name>\n", escapeXML(line.Description))
-	xml.WriteString("      </ram:SpecifiedTradeProduct>\n")
-
-	// Line trade agreement (price)
-	xml.WriteString("      <ram:SpecifiedLineTradeAgreement>\n")
-	xml.WriteString("        <ram:NetPriceProductTradePrice>\n")
-	fmt.Fprintf(xml, "          <ram:ChargeAmount>%s</ram:ChargeAmount>\n", fmtPrice(line.UnitPrice))
-	xml.WriteString("        </ram:NetPriceProductTradePrice>\n")
-	xml.WriteString("      </ram:SpecifiedLineTradeAgreement>\n")
-
-	// Line trade delivery (quantity)
-	xml.WriteString("      <ram:SpecifiedLineTradeDelivery>\n")
-	fmt.Fprintf(xml, "        <ram:BilledQuantity unitCode=\"C62\">%s</ram:BilledQuantity>\n", fmtQuantity(line.Quantity))
-	xml.WriteString("      </ram:SpecifiedLineTradeDelivery>\n")
+// lineTax returns the VAT category of lines and document-level charges.
+func lineTax(calc *invoiceCalculation) TradeTax {
+	return TradeTax{
+		TypeCode:              "VAT",
+		CategoryCode:          calc.vatCategoryCode,
+		RateApplicablePercent: fmtAmount(calc.vatRate),
+	}
+}
 
-	// Line trade settlement
-	xml.WriteString("      <ram:SpecifiedLineTradeSettlement>\n")
+// buildLineItem returns the line item at index i.
+func buildLineItem(line *InvoiceLine, i int, calc *invoiceCalculation) LineItem {
+	item := LineItem{
+		// Line ID (BT-126)
+		LineID: fmt.Sprint(i + 1),
+		Name:   line.Description,
+		// Net price (BT-146) and quantity (BT-129), in units (C62)
+		NetPrice:       TradePrice{ChargeAmount: fmtPrice(line.UnitPrice)},
+		BilledQuantity: Quantity{Value: fmtQuantity(line.Quantity), UnitCode: "C62"},
+		Tax:            lineTax(calc),
+		// Line net amount (BT-131)
+		LineTotal: calc.lineAmounts[i].String(),
+	}
 
-	// Line VAT
-	xml.WriteString("        <ram:ApplicableTradeTax>\n")
-	xml.WriteString("          <ram:TypeCode>VAT</ram:TypeCode>\n")
-	fmt.Fprintf(xml, "          <ram:CategoryCode>%s</ram:CategoryCode>\n", calc.vatCategoryCode)
-	fmt.Fprintf(xml, "          <ram:RateApplicablePercent>%s</ram:RateApplicablePercent>\n", fmtAmount(calc.vatRate))
-	xml.WriteString("        </ram:ApplicableTradeTax>\n")
+	// Gross price (BT-148) and item price discount (BT-147)
+	if line.GrossPrice > 0 {
+		item.GrossPrice = &TradePrice{ChargeAmount: fmtPrice(line.GrossPrice)}
+		if discount := line.GrossPrice - line.UnitPrice; discount > 0 {
+			item.GrossPrice.Allowance = &TradeAllowanceCharge{ActualAmount: fmtPrice(discount)}
+		}
+	}
 
-	// Line net amount (BT-131)
-	xml.WriteString("        <ram:SpecifiedTradeSettlementLineMonetarySummation>\n")
-	fmt.Fprintf(xml, "          <ram:LineTotalAmount>%s</ram:LineTotalAmount>\n", fmtAmount(lineAmount))
-	xml.WriteString("        </ram:SpecifiedTradeSettlementLineMonetarySummation>\n")
+	// Line billing period (BG-26). BASIC has no line delivery date, so a
+	// service date alone is written as a one-day period.
+	start, end := line.PeriodStart, line.PeriodEnd
+	if start.IsZero() && end.IsZero() && line.Date != "" {
+		if date, err := parseDisplayDate(line.Date); err == nil {
+			start, end = date, date
+		}
+	}
+	if !start.IsZero() || !end.IsZero() {
+		item.BillingPeriod = &Period{}
+		if !start.IsZero() {
+			item.BillingPeriod.Start = Date(formatCIIDate(start))
+		}
+		if !end.IsZero() {
+			item.BillingPeriod.End = Date(formatCIIDate(end))
+		}
+	}
 
-	xml.WriteString("      </ram:SpecifiedLineTradeSettlement>\n")
+	// Line discount (BG-27), reason code 95 "Discount"
+	if line.DiscountPercent > 0 {
+		item.AllowanceCharges = append(item.AllowanceCharges, TradeAllowanceCharge{
+			CalculationPercent: fmtAmount(line.DiscountPercent),
+			BasisAmount:        lineNetAmount(line.Quantity, line.UnitPrice).String(),
+			ActualAmount:       calc.lineDiscounts[i].String(),
+			ReasonCode:         "95",
+			Reason:             "Remise",
+		})
+	}
 
-	xml.WriteString("    </ram:IncludedSupplyChainTradeLineItem>\n")
+	// Eco-contribution (BG-28)
+	if line.EcoContribution != 0 {
+		item.AllowanceCharges = append(item.AllowanceCharges, TradeAllowanceCharge{
+			ChargeIndicator: true,
+			ActualAmount:    toAmount(line.EcoContribution).String(),
+			Reason:          ecoContributionReason,
+		})
+	}
+	return item
 }
 
-// writeApplicableHeaderTradeAgreement writes seller and buyer information.
-func writeApplicableHeaderTradeAgreement(xml *strings.Builder, req *InvoiceRequest) {
-	xml.WriteString("    <ram:ApplicableHeaderTradeAgreement>\n")
-
-	// Seller (BG-4)
-	writeTradeParty(xml, &req.Seller, "SellerTradeParty", req.AddEISuffix)
+// buildHeaderTradeAgreement returns the seller, buyer and referenced
+// documents.
+func buildHeaderTradeAgreement(req *InvoiceRequest) HeaderTradeAgreement {
+	agreement := HeaderTradeAgreement{
+		// Seller (BG-4) and buyer (BG-7)
+		Seller: buildTradeParty(&req.Seller, req.AddEISuffix),
+		Buyer:  buildTradeParty(&req.Buyer, false),
+	}
 
-	// Buyer (BG-7)
-	writeTradeParty(xml, &req.Buyer, "BuyerTradeParty", false)
+	// Purchase order reference (BT-13)
+	if req.OrderRef != "" {
+		agreement.BuyerOrder = &ReferencedDocument{IssuerAssignedID: req.OrderRef}
+	}
 
-	xml.WriteString("    </ram:ApplicableHeaderTradeAgreement>\n")
+	// Supporting documents embedded in the PDF (BG-24)
+	for _, s := range req.Supplements {
+		agreement.Additional = append(agreement.Additional, ReferencedDocument{
+			IssuerAssignedID: s.ID,
+			TypeCode:         supplementTypeCode,
+			Name:             s.Description,
+		})
+	}
+	return agreement
 }
 
-// writeTradeParty writes a trade party (seller or buyer).
-func writeTradeParty(xml *strings.Builder, contact *Contact, elementName string, addEISuffix bool) {
-	fmt.Fprintf(xml, "      <ram:%s>\n", elementName)
-
+// buildTradeParty returns a trade party (seller or buyer).
+func buildTradeParty(contact *Contact, addEISuffix bool) TradeParty {
 	// Name (BT-27 for seller, BT-44 for buyer)
 	name := contact.Name
 	if addEISuffix {
 		name = contact.Name + ", Entrepreneur Individuel"
 	}
-	fmt.Fprintf(xml, "        <ram:Name>%s</ram:Name>\n", escapeXML(name))
+	party := TradeParty{
+		Name: name,
+		// Postal address (BG-5 for seller, BG-8 for buyer)
+		Address: TradeAddress{
+			Postcode:  contact.ZipCode,
+			LineOne:   contact.Address,
+			City:      contact.City,
+			CountryID: contact.CountryCode,
+		},
+	}
 
-	// Legal organization with SIRET
-	xml.WriteString("        <ram:SpecifiedLegalOrganization>\n")
-	fmt.Fprintf(xml, "          <ram:ID schemeID=\"0002\">%s</ram:ID>\n", escapeXML(contact.Siret))
-	xml.WriteString("        </ram:SpecifiedLegalOrganization>\n")
+	// Professional identifiers (BT-29 for seller, BT-46 for buyer), without
+	// scheme: ADELI or RPPS are not ISO 6523 ICD codes
+	for _, id := range contact.ProfessionalIds {
+		party.IDs = append(party.IDs, Identifier{Value: strings.TrimSpace(id.Value)})
+	}
+
+	// Global identifiers (BT-29 for seller, BT-46 for buyer)
+	for _, id := range contact.GlobalIds {
+		party.GlobalIDs = append(party.GlobalIDs, Identifier{Value: id.Value, SchemeID: id.Scheme})
+	}
 
-	// Postal address (BG-5 for seller, BG-8 for buyer)
-	xml.WriteString("        <ram:PostalTradeAddress>\n")
-	fmt.Fprintf(xml, "          <ram:PostcodeCode>%s</ram:PostcodeCode>\n", escapeXML(contact.ZipCode))
-	fmt.Fprintf(xml, "          <ram:LineOne>%s</ram:LineOne>\n", escapeXML(contact.Address))
-	fmt.Fprintf(xml, "          <ram:CityName>%s</ram:CityName>\n", escapeXML(contact.City))
-	fmt.Fprintf(xml, "          <ram:CountryID>%s</ram:CountryID>\n", escapeXML(contact.CountryCode))
-	xml.WriteString("        </ram:PostalTradeAddress>\n")
+	// Legal organization with SIRET, SIREN or RCS (omitted for B2C buyers)
+	if id, scheme := contact.legalID(); id != "" {
+		party.LegalOrganization = &Identifier{Value: id, SchemeID: scheme}
+	}
+	// Trading name (BT-28, BT-45)
+	if name := strings.TrimSpace(contact.TradingName); name != "" {
+		party.TradingName = &name
+	}
 
 	// Tax registration (VAT number) if present
 	if contact.VatNumber != "" {
-		xml.WriteString("        <ram:SpecifiedTaxRegistration>\n")
-		fmt.Fprintf(xml, "          <ram:ID schemeID=\"VA\">%s</ram:ID>\n", escapeXML(contact.VatNumber))
-		xml.WriteString("        </ram:SpecifiedTaxRegistration>\n")
+		party.TaxRegistrations = []TaxRegistration{{ID: Identifier{Value: contact.VatNumber, SchemeID: "VA"}}}
 	}
-
-	fmt.Fprintf(xml, "      </ram:%s>\n", elementName)
+	return party
 }
 
-// writeApplicableHeaderTradeDelivery writes delivery information.
-func writeApplicableHeaderTradeDelivery(xml *strings.Builder, date string) {
-	xml.WriteString("    <ram:ApplicableHeaderTradeDelivery>\n")
+// buildHeaderTradeDelivery returns the delivery information.
+func buildHeaderTradeDelivery(req *InvoiceRequest) HeaderTradeDelivery {
+	var delivery HeaderTradeDelivery
 
-	// Actual delivery date (BT-72) - using invoice date as default
-	xml.WriteString("      <ram:ActualDeliverySupplyChainEvent>\n")
-	xml.WriteString("        <ram:OccurrenceDateTime>\n")
-	fmt.Fprintf(xml, "          <udt:DateTimeString format=\"102\">%s</udt:DateTimeString>\n", date)
-	xml.WriteString("        </ram:OccurrenceDateTime>\n")
-	xml.WriteString("      </ram:ActualDeliverySupplyChainEvent>\n")
+	// Actual delivery date (BT-72)
+	if !req.DeliveryDate.IsZero() {
+		delivery.ActualDelivery = &SupplyChainEvent{Date: Date(formatCIIDate(req.DeliveryDate))}
+	}
 
-	xml.WriteString("    </ram:ApplicableHeaderTradeDelivery>\n")
+	// Despatch advice reference (BT-16)
+	if req.DespatchAdviceRef != "" {
+		delivery.DespatchAdvice = &ReferencedDocument{IssuerAssignedID: req.DespatchAdviceRef}
+	}
+	return delivery
 }
 
-// writeApplicableHeaderTradeSettlement writes payment and totals.
-func writeApplicableHeaderTradeSettlement(xml *strings.Builder, calc *invoiceCalculation) {
-	xml.WriteString("    <ram:ApplicableHeaderTradeSettlement>\n")
-
-	// Invoice currency (BT-5)
-	xml.WriteString("      <ram:InvoiceCurrencyCode>EUR</ram:InvoiceCurrencyCode>\n")
-
-	// VAT breakdown (BG-23)
-	xml.WriteString("      <ram:ApplicableTradeTax>\n")
-	fmt.Fprintf(xml, "        <ram:CalculatedAmount>%s</ram:CalculatedAmount>\n", fmtAmount(calc.taxTotal))
-	xml.WriteString("        <ram:TypeCode>VAT</ram:TypeCode>\n")
-
-	// Exemption reason if applicable
-	if calc.vatExemptionText != "" {
-		fmt.Fprintf(xml, "        <ram:ExemptionReason>%s</ram:ExemptionReason>\n", escapeXML(calc.vatExemptionText))
+// buildHeaderTradeSettlement returns the payment information and totals.
+func buildHeaderTradeSettlement(req *InvoiceRequest, calc *invoiceCalculation) HeaderTradeSettlement {
+	// VAT breakdown (BG-23), with the exemption reason if applicable
+	tax := lineTax(calc)
+	tax.CalculatedAmount = calc.taxTotal.String()
+	tax.BasisAmount = calc.taxBase.String()
+	tax.ExemptionReason = calc.vatExemptionText
+	tax.ExemptionReasonCode = calc.vatExemptionCode
+
+	// Tax point date (BT-7) or VAT due date type (BT-8)
+	if !req.TaxPointDate.IsZero() {
+		tax.TaxPointDate = Date(formatCIIDate(req.TaxPointDate))
+	} else {
+		tax.DueDateTypeCode = string(req.VatDueDateType)
 	}
 
-	fmt.Fprintf(xml, "        <ram:BasisAmount>%s</ram:BasisAmount>\n", fmtAmount(calc.taxBase))
-	fmt.Fprintf(xml, "        <ram:CategoryCode>%s</ram:CategoryCode>\n", calc.vatCategoryCode)
-
-	// Exemption reason code if applicable
-	if calc.vatExemptionCode != "" {
-		fmt.Fprintf(xml, "        <ram:ExemptionReasonCode>%s</ram:ExemptionReasonCode>\n", calc.vatExemptionCode)
+	settlement := HeaderTradeSettlement{
+		// Invoice currency (BT-5)
+		Currency: "EUR",
+		Taxes:    []TradeTax{tax},
+		// Payment terms (BT-20) - required when DuePayableAmount > 0
+		PaymentTerms: []PaymentTerms{{Description: "Paiement à réception de facture"}},
+		// Monetary summation (BG-22): line total (BT-106), tax basis total
+		// (BT-109), tax total (BT-110), grand total (BT-112) and amount
+		// due (BT-115)
+		Summation: MonetarySummation{
+			LineTotal:     calc.lineTotal.String(),
+			TaxBasisTotal: calc.taxBase.String(),
+			TaxTotal:      CurrencyAmount{Value: calc.taxTotal.String(), CurrencyID: "EUR"},
+			GrandTotal:    calc.grandTotal.String(),
+			DuePayable:    calc.dueAmount.String(),
+		},
 	}
 
-	fmt.Fprintf(xml, "        <ram:RateApplicablePercent>%s</ram:RateApplicablePercent>\n", fmtAmount(calc.vatRate))
-	xml.WriteString("      </ram:ApplicableTradeTax>\n")
-
-	// Payment terms (BT-20) - required when DuePayableAmount > 0
-	xml.WriteString("      <ram:SpecifiedTradePaymentTerms>\n")
-	xml.WriteString("        <ram:Description>Paiement à réception de facture</ram:Description>\n")
-	xml.WriteString("      </ram:SpecifiedTradePaymentTerms>\n")
-
-	// Monetary summation (BG-22)
-	xml.WriteString("      <ram:SpecifiedTradeSettlementHeaderMonetarySummation>\n")
+	// Document-level charges (BG-21) and their total (BT-108)
+	for _, c := range req.Charges {
+		categoryTax := lineTax(calc)
+		settlement.AllowanceCharges = append(settlement.AllowanceCharges, TradeAllowanceCharge{
+			ChargeIndicator: true,
+			ActualAmount:    toAmount(c.Amount).String(),
+			ReasonCode:      c.ReasonCode,
+			Reason:          c.Reason,
+			CategoryTax:     &categoryTax,
+		})
+	}
+	if len(req.Charges) > 0 {
+		settlement.Summation.ChargeTotal = calc.chargeTotal.String()
+	}
 
-	// Sum of line net amounts (BT-106)
-	fmt.Fprintf(xml, "        <ram:LineTotalAmount>%s</ram:LineTotalAmount>\n", fmtAmount(calc.lineTotal))
+	// Installments (EXTENDED): one payment terms per due date, with its
+	// partial amount
+	if n := len(req.Installments); n > 0 {
+		settlement.PaymentTerms = nil
+		for i, inst := range req.Installments {
+			settlement.PaymentTerms = append(settlement.PaymentTerms, PaymentTerms{
+				Description:          fmt.Sprintf("Échéance %d/%d", i+1, n),
+				DueDate:              Date(formatCIIDate(inst.DueDate)),
+				PartialPaymentAmount: toAmount(inst.Amount).String(),
+			})
+		}
+	}
 
-	// Tax basis total (BT-109)
-	fmt.Fprintf(xml, "        <ram:TaxBasisTotalAmount>%s</ram:TaxBasisTotalAmount>\n", fmtAmount(calc.taxBase))
+	// Payment means (BG-16)
+	if code := paymentMeansCode(req); code != "" {
+		settlement.PaymentMeans = []PaymentMeans{{TypeCode: string(code)}}
+	}
 
-	// Tax total (BT-110)
-	fmt.Fprintf(xml, "        <ram:TaxTotalAmount currencyID=\"EUR\">%s</ram:TaxTotalAmount>\n", fmtAmount(calc.taxTotal))
+	// SEPA direct debit (BG-19): creditor identifier (BT-90), debited
+	// account (BT-91) and mandate reference (BT-89) in every payment terms
+	if dd := req.DirectDebit; dd != nil {
+		settlement.CreditorReferenceID = strings.TrimSpace(dd.CreditorID)
+		settlement.PaymentMeans[0].DebtorAccount = &FinancialAccount{IBAN: compactIBAN(dd.DebtorIBAN)}
+		if len(req.Installments) == 0 {
+			settlement.PaymentTerms[0].Description = "Prélèvement SEPA"
+		}
+		for i := range settlement.PaymentTerms {
+			settlement.PaymentTerms[i].DirectDebitMandateID = strings.TrimSpace(dd.MandateID)
+		}
+	}
 
-	// Grand total (BT-112)
-	fmt.Fprintf(xml, "        <ram:GrandTotalAmount>%s</ram:GrandTotalAmount>\n", fmtAmount(calc.grandTotal))
+	if req.CashDiscount != nil {
+		for i := range settlement.PaymentTerms {
+			settlement.PaymentTerms[i].Description += ". " + req.CashDiscount.text()
+		}
+	}
 
-	// Due payable amount (BT-115)
-	fmt.Fprintf(xml, "        <ram:DuePayableAmount>%s</ram:DuePayableAmount>\n", fmtAmount(calc.dueAmount))
+	// Payment due date (BT-9)
+	if !req.DueDate.IsZero() {
+		settlement.PaymentTerms[0].DueDate = Date(formatCIIDate(req.DueDate))
+	}
 
-	xml.WriteString("      </ram:SpecifiedTradeSettlementHeaderMonetarySummation>\n")
+	// Paid amount (BT-113)
+	if calc.prepaidAmount != 0 {
+		settlement.Summation.TotalPrepaid = calc.prepaidAmount.String()
+	}
 
-	xml.WriteString("    </ram:ApplicableHeaderTradeSettlement>\n")
+	// Preceding invoice reference (BG-3)
+	if p := req.PrecedingInvoice; p != nil {
+		settlement.InvoiceReference = &ReferencedDocument{IssuerAssignedID: p.Number}
+		if !p.Date.IsZero() {
+			settlement.InvoiceReference.IssueDate = Date(formatCIIDate(p.Date))
+		}
+	}
+	return settlement
 }
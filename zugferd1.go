@@ -0,0 +1,179 @@
+package facturx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ZUGFeRD 1.0 invoices (ZUGFeRD-invoice.xml) use the older CII 2013 syntax:
+// a CrossIndustryDocument root, "SupplyChain" instead of "Header" and
+// "Line" in the names of the trade aggregates, and ApplicablePercent for
+// VAT rates. ParseCII reads them through the types below and maps them
+// onto the CrossIndustryInvoice model, so the rest of the package handles
+// both syntaxes alike.
+
+// zugferd1Document is a ZUGFeRD 1.0 invoice.
+type zugferd1Document struct {
+	Guideline   string                   `xml:"SpecifiedExchangedDocumentContext>GuidelineSpecifiedDocumentContextParameter>ID"`
+	Document    ExchangedDocument        `xml:"HeaderExchangedDocument"`
+	Transaction zugferd1TradeTransaction `xml:"SpecifiedSupplyChainTradeTransaction"`
+}
+
+// zugferd1TradeTransaction holds the header and the lines of the invoice.
+type zugferd1TradeTransaction struct {
+	Agreement struct {
+		Seller     TradeParty         `xml:"SellerTradeParty"`
+		Buyer      TradeParty         `xml:"BuyerTradeParty"`
+		BuyerOrder *zugferd1Reference `xml:"BuyerOrderReferencedDocument"`
+	} `xml:"ApplicableSupplyChainTradeAgreement"`
+	Delivery struct {
+		ActualDelivery *SupplyChainEvent  `xml:"ActualDeliverySupplyChainEvent"`
+		DespatchAdvice *zugferd1Reference `xml:"DespatchAdviceReferencedDocument"`
+	} `xml:"ApplicableSupplyChainTradeDelivery"`
+	Settlement struct {
+		Currency         string                    `xml:"InvoiceCurrencyCode"`
+		Taxes            []zugferd1Tax             `xml:"ApplicableTradeTax"`
+		AllowanceCharges []zugferd1AllowanceCharge `xml:"SpecifiedTradeAllowanceCharge"`
+		PaymentTerms     []PaymentTerms            `xml:"SpecifiedTradePaymentTerms"`
+		Summation        MonetarySummation         `xml:"SpecifiedTradeSettlementMonetarySummation"`
+	} `xml:"ApplicableSupplyChainTradeSettlement"`
+	Lines []zugferd1LineItem `xml:"IncludedSupplyChainTradeLineItem"`
+}
+
+// zugferd1Reference is a referenced document, identified by its ID.
+type zugferd1Reference struct {
+	ID string `xml:"ID"`
+}
+
+// zugferd1Tax is a VAT breakdown or category.
+type zugferd1Tax struct {
+	CalculatedAmount  string `xml:"CalculatedAmount"`
+	TypeCode          string `xml:"TypeCode"`
+	ExemptionReason   string `xml:"ExemptionReason"`
+	BasisAmount       string `xml:"BasisAmount"`
+	CategoryCode      string `xml:"CategoryCode"`
+	ApplicablePercent string `xml:"ApplicablePercent"`
+}
+
+// zugferd1AllowanceCharge is a document-level allowance or charge.
+type zugferd1AllowanceCharge struct {
+	ChargeIndicator bool         `xml:"ChargeIndicator>Indicator"`
+	BasisAmount     string       `xml:"BasisAmount"`
+	ActualAmount    string       `xml:"ActualAmount"`
+	ReasonCode      string       `xml:"ReasonCode"`
+	Reason          string       `xml:"Reason"`
+	CategoryTax     *zugferd1Tax `xml:"CategoryTradeTax"`
+}
+
+// zugferd1LineItem is an invoice line. BASIC lines have no price nor VAT
+// category.
+type zugferd1LineItem struct {
+	LineID         string       `xml:"AssociatedDocumentLineDocument>LineID"`
+	GrossPrice     *TradePrice  `xml:"SpecifiedSupplyChainTradeAgreement>GrossPriceProductTradePrice"`
+	NetPrice       *TradePrice  `xml:"SpecifiedSupplyChainTradeAgreement>NetPriceProductTradePrice"`
+	BilledQuantity Quantity     `xml:"SpecifiedSupplyChainTradeDelivery>BilledQuantity"`
+	Tax            *zugferd1Tax `xml:"SpecifiedSupplyChainTradeSettlement>ApplicableTradeTax"`
+	BillingPeriod  *Period      `xml:"SpecifiedSupplyChainTradeSettlement>BillingSpecifiedPeriod"`
+	LineTotal      string       `xml:"SpecifiedSupplyChainTradeSettlement>SpecifiedTradeSettlementMonetarySummation>LineTotalAmount"`
+	Name           string       `xml:"SpecifiedTradeProduct>Name"`
+}
+
+// tradeTax maps a ZUGFeRD 1.0 VAT breakdown onto the CII model.
+func (t *zugferd1Tax) tradeTax() TradeTax {
+	return TradeTax{
+		CalculatedAmount:      t.CalculatedAmount,
+		TypeCode:              t.TypeCode,
+		ExemptionReason:       t.ExemptionReason,
+		BasisAmount:           t.BasisAmount,
+		CategoryCode:          t.CategoryCode,
+		RateApplicablePercent: t.ApplicablePercent,
+	}
+}
+
+// cii maps a ZUGFeRD 1.0 invoice onto the CII model.
+func (z *zugferd1Document) cii() *CrossIndustryInvoice {
+	doc := &CrossIndustryInvoice{
+		Context:  ExchangedDocumentContext{Guideline: DocumentContextParameter{ID: z.Guideline}},
+		Document: z.Document,
+	}
+	doc.XMLName.Local = "CrossIndustryInvoice"
+
+	agreement := &z.Transaction.Agreement
+	doc.Transaction.Agreement.Seller = agreement.Seller
+	doc.Transaction.Agreement.Buyer = agreement.Buyer
+	if agreement.BuyerOrder != nil {
+		doc.Transaction.Agreement.BuyerOrder = &ReferencedDocument{IssuerAssignedID: agreement.BuyerOrder.ID}
+	}
+	delivery := &z.Transaction.Delivery
+	doc.Transaction.Delivery.ActualDelivery = delivery.ActualDelivery
+	if delivery.DespatchAdvice != nil {
+		doc.Transaction.Delivery.DespatchAdvice = &ReferencedDocument{IssuerAssignedID: delivery.DespatchAdvice.ID}
+	}
+
+	settlement := &z.Transaction.Settlement
+	header := &doc.Transaction.Settlement
+	header.Currency = settlement.Currency
+	header.PaymentTerms = settlement.PaymentTerms
+	header.Summation = settlement.Summation
+	for _, t := range settlement.Taxes {
+		header.Taxes = append(header.Taxes, t.tradeTax())
+	}
+	for _, c := range settlement.AllowanceCharges {
+		charge := TradeAllowanceCharge{
+			ChargeIndicator: c.ChargeIndicator,
+			BasisAmount:     c.BasisAmount,
+			ActualAmount:    c.ActualAmount,
+			ReasonCode:      c.ReasonCode,
+			Reason:          c.Reason,
+		}
+		if c.CategoryTax != nil {
+			tax := c.CategoryTax.tradeTax()
+			charge.CategoryTax = &tax
+		}
+		header.AllowanceCharges = append(header.AllowanceCharges, charge)
+	}
+
+	for _, l := range z.Transaction.Lines {
+		line := LineItem{
+			LineID:         l.LineID,
+			Name:           l.Name,
+			GrossPrice:     l.GrossPrice,
+			BilledQuantity: l.BilledQuantity,
+			BillingPeriod:  l.BillingPeriod,
+			LineTotal:      l.LineTotal,
+		}
+		if l.NetPrice != nil {
+			line.NetPrice = *l.NetPrice
+		}
+		if strings.TrimSpace(line.NetPrice.ChargeAmount) == "" {
+			line.NetPrice.ChargeAmount = zugferd1UnitPrice(l.LineTotal, l.BilledQuantity.Value)
+		}
+		switch {
+		case l.Tax != nil:
+			line.Tax = l.Tax.tradeTax()
+		case len(header.Taxes) == 1:
+			// BASIC lines share the single VAT breakdown
+			line.Tax = TradeTax{
+				TypeCode:              header.Taxes[0].TypeCode,
+				CategoryCode:          header.Taxes[0].CategoryCode,
+				RateApplicablePercent: header.Taxes[0].RateApplicablePercent,
+			}
+		}
+		doc.Transaction.Lines = append(doc.Transaction.Lines, line)
+	}
+	return doc
+}
+
+// zugferd1UnitPrice derives the price of a BASIC line from its total and
+// quantity, or returns "" if they are not numbers.
+func zugferd1UnitPrice(lineTotal, quantity string) string {
+	total, err := strconv.ParseFloat(strings.TrimSpace(lineTotal), 64)
+	if err != nil {
+		return ""
+	}
+	q, err := strconv.ParseFloat(strings.TrimSpace(quantity), 64)
+	if err != nil || q == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(total/q, 'f', -1, 64)
+}